@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActorStats is how the runs one actor triggered went.
+type ActorStats struct {
+	Actor        string         `json:"actor"`
+	Bot          bool           `json:"bot"`
+	Stats        DashboardStats `json:"stats"`
+	SuccessRate  *float64       `json:"success_rate,omitempty"` // percentage of finished runs that succeeded
+	FailureShare float64        `json:"failure_share"`          // percentage of all failures in the period
+}
+
+type ActorsResponse struct {
+	Period       string       `json:"period"`
+	FetchedAt    time.Time    `json:"fetched_at"`
+	Truncated    bool         `json:"truncated,omitempty"` // job list capped at MAX_JOBS, older runs aren't counted
+	Failed       int          `json:"failed"`
+	Unattributed int          `json:"unattributed"` // runs without an actor, e.g. from providers that don't report one
+	Actors       []ActorStats `json:"actors"`       // most failures first
+}
+
+// isBot reports whether a login belongs to an app or bot account, e.g.
+// "dependabot[bot]" or "renovate-bot".
+func isBot(login string) bool {
+	login = strings.ToLower(login)
+	return strings.HasSuffix(login, "[bot]") || strings.HasSuffix(login, "-bot") || strings.HasSuffix(login, "_bot")
+}
+
+// actorsHandler serves /api/stats/actors?period=week, the success and
+// failure counts per triggering actor: a "build breaker" leaderboard that
+// also shows which bots cause the most failures. ?bots=false leaves bots
+// out, ?limit= caps the list.
+func actorsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := ActorsResponse{Period: period, FetchedAt: snap.FetchedAt, Truncated: snap.Response.Truncated, Actors: []ActorStats{}}
+	byActor := make(map[string]*ActorStats)
+	for _, job := range snap.Response.Jobs {
+		if job.Actor == "" {
+			response.Unattributed++
+			continue
+		}
+		if query.Get("bots") == "false" && isBot(job.Actor) {
+			continue
+		}
+		actor, ok := byActor[job.Actor]
+		if !ok {
+			actor = &ActorStats{Actor: job.Actor, Bot: isBot(job.Actor)}
+			byActor[job.Actor] = actor
+		}
+		addToStats(&actor.Stats, job)
+		if job.Status == "failed" && !hasTag(job, "maintenance") {
+			response.Failed++
+		}
+	}
+
+	for _, actor := range byActor {
+		actor.SuccessRate = successRate(actor.Stats)
+		if response.Failed > 0 {
+			actor.FailureShare = math.Round(float64(actor.Stats.Failed)/float64(response.Failed)*1000) / 10
+		}
+		response.Actors = append(response.Actors, *actor)
+	}
+	sort.Slice(response.Actors, func(i, j int) bool {
+		a, b := response.Actors[i].Stats, response.Actors[j].Stats
+		if a.Failed != b.Failed {
+			return a.Failed > b.Failed
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return response.Actors[i].Actor < response.Actors[j].Actor
+	})
+	if limit > 0 && len(response.Actors) > limit {
+		response.Actors = response.Actors[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runtime configuration: some settings can be changed through
+// /api/admin/config without editing the environment and restarting. The
+// changes are kept in the Store on top of the environment, so they survive
+// restarts (with a persistent store) and reach every replica within
+// runtimeConfigPoll. Admins are the holders of ADMIN_TOKEN and, with OAuth,
+// the users in OAUTH_ADMINS.
+
+// runtimeMu guards the settings that can change at runtime: sources,
+// cacheTTL, pollInterval, the repository filters and the alert rules.
+var runtimeMu sync.RWMutex
+
+const runtimeConfigKey = "runtime-config"
+
+// runtimeConfigPoll is how often replicas pick up changes made elsewhere.
+const runtimeConfigPoll = 30 * time.Second
+
+var adminToken string
+
+// RuntimeConfig holds the settings changed at runtime. Unset (null) fields
+// keep their environment value.
+type RuntimeConfig struct {
+	CacheTTL      *string   `json:"cache_ttl,omitempty"`      // CACHE_TTL, how often the dashboard refreshes
+	PollInterval  *string   `json:"poll_interval,omitempty"`  // POLL_INTERVAL
+	GitHubOrgs    *[]string `json:"github_orgs,omitempty"`    // GITHUB_ORG
+	RepoInclude   *[]string `json:"repo_include,omitempty"`   // REPO_INCLUDE
+	RepoExclude   *[]string `json:"repo_exclude,omitempty"`   // REPO_EXCLUDE
+	AlertOn       *string   `json:"alert_on,omitempty"`       // ALERT_ON
+	AlertBranches *[]string `json:"alert_branches,omitempty"` // ALERT_BRANCHES
+	UpdatedBy     string    `json:"updated_by,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// runtimeSettings are the values in effect.
+type runtimeSettings struct {
+	CacheTTL      string   `json:"cache_ttl"`
+	PollInterval  string   `json:"poll_interval"`
+	GitHubOrgs    []string `json:"github_orgs"`
+	RepoInclude   []string `json:"repo_include"`
+	RepoExclude   []string `json:"repo_exclude"`
+	AlertOn       string   `json:"alert_on"`
+	AlertBranches []string `json:"alert_branches"`
+}
+
+var (
+	// envSettings are the settings from the environment, what a reset
+	// goes back to.
+	envSettings runtimeSettings
+	// appliedAt is the UpdatedAt of the runtime config in effect.
+	appliedAt time.Time
+)
+
+// loadAdminConfig reads ADMIN_TOKEN and applies the runtime config in the
+// store on top of the environment. It runs once the store is set up.
+func loadAdminConfig() {
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	envSettings = currentSettings()
+
+	cfg, err := loadRuntimeConfig(context.Background())
+	if err != nil {
+		log.Printf("⚠️  Error reading runtime config from store: %v", err)
+		return
+	}
+	if cfg != nil {
+		if err := applyRuntimeConfig(cfg); err != nil {
+			log.Printf("⚠️  Ignoring invalid runtime config from %s: %v", cfg.UpdatedBy, err)
+			return
+		}
+		log.Printf("🛠️  Applied runtime config changed by %s at %s", cfg.UpdatedBy, cfg.UpdatedAt.Format(time.RFC3339))
+	}
+}
+
+func currentSettings() runtimeSettings {
+	settings := runtimeSettings{
+		CacheTTL:     currentCacheTTL().String(),
+		PollInterval: currentPollInterval().String(),
+		GitHubOrgs:   []string{},
+		RepoInclude:  []string{},
+		RepoExclude:  []string{},
+	}
+	for _, src := range currentSources() {
+		if src.Provider.Name() == "github" {
+			settings.GitHubOrgs = append(settings.GitHubOrgs, accountEntry(src.Org))
+		}
+	}
+	include, exclude := repoFilters()
+	for _, pattern := range include {
+		settings.RepoInclude = append(settings.RepoInclude, pattern.String())
+	}
+	for _, pattern := range exclude {
+		settings.RepoExclude = append(settings.RepoExclude, pattern.String())
+	}
+	settings.AlertOn, settings.AlertBranches = alertRules()
+	if settings.AlertBranches == nil {
+		settings.AlertBranches = []string{}
+	}
+	return settings
+}
+
+func loadRuntimeConfig(ctx context.Context) (*RuntimeConfig, error) {
+	data, ok, err := store.Get(ctx, runtimeConfigKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var cfg *RuntimeConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyRuntimeConfig validates cfg and puts it into effect over the
+// environment settings; nothing changes when it's invalid.
+func applyRuntimeConfig(cfg *RuntimeConfig) error {
+	apply, err := checkRuntimeConfig(cfg)
+	if err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+// checkRuntimeConfig validates cfg, and returns what puts it into effect.
+func checkRuntimeConfig(cfg *RuntimeConfig) (apply func(), err error) {
+	settings := envSettings
+	if cfg.CacheTTL != nil {
+		settings.CacheTTL = *cfg.CacheTTL
+	}
+	if cfg.PollInterval != nil {
+		settings.PollInterval = *cfg.PollInterval
+	}
+	if cfg.GitHubOrgs != nil {
+		settings.GitHubOrgs = *cfg.GitHubOrgs
+	}
+	if cfg.RepoInclude != nil {
+		settings.RepoInclude = *cfg.RepoInclude
+	}
+	if cfg.RepoExclude != nil {
+		settings.RepoExclude = *cfg.RepoExclude
+	}
+	if cfg.AlertOn != nil {
+		settings.AlertOn = *cfg.AlertOn
+	}
+	if cfg.AlertBranches != nil {
+		settings.AlertBranches = *cfg.AlertBranches
+	}
+
+	ttl, err := time.ParseDuration(settings.CacheTTL)
+	if err != nil || ttl < 0 {
+		return nil, fmt.Errorf("invalid cache_ttl %q: expected a duration such as 60s, or 0", settings.CacheTTL)
+	}
+	interval, err := time.ParseDuration(settings.PollInterval)
+	if err != nil || interval < 0 {
+		return nil, fmt.Errorf("invalid poll_interval %q: expected a duration such as 5m, or 0", settings.PollInterval)
+	}
+	orgs, users := splitAccounts(settings.GitHubOrgs)
+	for _, org := range orgs {
+		if org == "" || strings.ContainsAny(org, "/ ,") {
+			return nil, fmt.Errorf("invalid organization %q in github_orgs", org)
+		}
+	}
+	include, err := parseRepoPatterns(settings.RepoInclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo_include: %v", err)
+	}
+	exclude, err := parseRepoPatterns(settings.RepoExclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo_exclude: %v", err)
+	}
+	if settings.AlertOn != "failed" && settings.AlertOn != "finished" {
+		return nil, fmt.Errorf("invalid alert_on %q: expected failed or finished", settings.AlertOn)
+	}
+
+	// Other providers keep their sources; GitHub's come last, as when set
+	// up from GITHUB_ORG
+	updated := currentSources()
+	if demoMode {
+		if strings.Join(settings.GitHubOrgs, ",") != strings.Join(envSettings.GitHubOrgs, ",") {
+			return nil, fmt.Errorf("github_orgs can't be changed in DEMO_MODE")
+		}
+	} else {
+		updated = []source{}
+		for _, src := range currentSources() {
+			if src.Provider.Name() != "github" {
+				updated = append(updated, src)
+			}
+		}
+		for _, org := range orgs {
+			updated = append(updated, source{Provider: newGitHubProvider(), Org: org})
+		}
+		if len(updated) == 0 {
+			return nil, fmt.Errorf("github_orgs can't be empty without other CI providers")
+		}
+	}
+
+	return func() {
+		setAlertRules(settings.AlertOn, settings.AlertBranches)
+		runtimeMu.Lock()
+		defer runtimeMu.Unlock()
+		cacheTTL = ttl
+		pollInterval = interval
+		sources = updated
+		repoInclude, repoExclude = include, exclude
+		if !demoMode {
+			githubUsers = users
+		}
+		appliedAt = cfg.UpdatedAt
+	}, nil
+}
+
+// watchRuntimeConfig applies the changes other replicas make.
+func watchRuntimeConfig() {
+	for range time.Tick(runtimeConfigPoll) {
+		cfg, err := loadRuntimeConfig(context.Background())
+		if err != nil || cfg == nil {
+			continue
+		}
+		runtimeMu.RLock()
+		current := appliedAt.Equal(cfg.UpdatedAt)
+		runtimeMu.RUnlock()
+		if current {
+			continue
+		}
+		if err := applyRuntimeConfig(cfg); err != nil {
+			log.Printf("⚠️  Ignoring invalid runtime config from %s: %v", cfg.UpdatedBy, err)
+			continue
+		}
+		log.Printf("🛠️  Applied runtime config changed by %s", cfg.UpdatedBy)
+	}
+}
+
+// invalidConfigError is a change of the runtime config that doesn't
+// validate.
+type invalidConfigError struct{ error }
+
+// updateRuntimeConfig changes the stored runtime config under a lock and
+// puts it into effect, unless update or the validation fails. It's only
+// applied once it's saved, so a replica never runs a config the others
+// won't pick up.
+func updateRuntimeConfig(ctx context.Context, admin string, update func(cfg *RuntimeConfig) error) error {
+	release, ok, err := store.Lock(ctx, "lock:"+runtimeConfigKey, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errConfigLocked
+	}
+	defer release()
+
+	cfg, err := loadRuntimeConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("reading runtime config: %w", err)
+	}
+	if cfg == nil {
+		cfg = &RuntimeConfig{}
+	}
+	if err := update(cfg); err != nil {
+		return err
+	}
+	cfg.UpdatedBy, cfg.UpdatedAt = admin, clock()
+	apply, err := checkRuntimeConfig(cfg)
+	if err != nil {
+		return invalidConfigError{err}
+	}
+	data, _ := json.Marshal(cfg)
+	if err := store.Set(ctx, runtimeConfigKey, data, 0); err != nil {
+		return fmt.Errorf("saving runtime config: %w", err)
+	}
+	apply()
+	log.Printf("🛠️  %s changed the runtime config: %s", admin, data)
+	return nil
+}
+
+var errConfigLocked = errors.New("runtime config is being changed elsewhere, try again")
+
+func runtimeConfigErrorStatus(err error) int {
+	var invalid invalidConfigError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.Is(err, errConfigLocked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// adminFrom returns who makes an admin request: "admin token" for
+// ADMIN_TOKEN, or the login of a signed-in admin.
+func adminFrom(r *http.Request) (string, bool) {
+	if auth := r.Header.Get("Authorization"); adminToken != "" && strings.HasPrefix(auth, "Bearer ") {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(adminToken)) == 1 {
+			return "admin token", true
+		}
+	}
+	if oauthConfig != nil {
+		if sess := loadSession(r); sess != nil && oauthAdmins[strings.ToLower(sess.Login)] {
+			return sess.Login, true
+		}
+	}
+	return "", false
+}
+
+// requireAdmin answers requests that aren't an admin's, and returns who
+// makes those that are.
+func requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if adminToken == "" && len(oauthAdmins) == 0 {
+		http.Error(w, "Admin API is not enabled (set ADMIN_TOKEN or OAUTH_ADMINS)", http.StatusNotFound)
+		return "", false
+	}
+	admin, ok := adminFrom(r)
+	if !ok {
+		http.Error(w, "Admin API needs ADMIN_TOKEN as bearer token or a login in OAUTH_ADMINS", http.StatusUnauthorized)
+	}
+	return admin, ok
+}
+
+// adminConfigHandler serves /api/admin/config:
+//
+//	GET                                          settings in effect, changes and environment values
+//	PATCH  {"cache_ttl": "2m", "alert_on": ...}  change settings; null goes back to the environment value
+//	DELETE                                       back to the environment
+func adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := loadRuntimeConfig(ctx)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading runtime config: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Settings    runtimeSettings `json:"settings"`
+			Changes     *RuntimeConfig  `json:"changes"` // null without changes
+			Environment runtimeSettings `json:"environment"`
+		}{currentSettings(), cfg, envSettings})
+
+	case http.MethodPatch, http.MethodDelete:
+		// Fields left out stay as they are, null ones are reset
+		var patch map[string]json.RawMessage
+		if r.Method == http.MethodPatch {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&patch); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid JSON body: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		err := updateRuntimeConfig(ctx, admin, func(cfg *RuntimeConfig) error {
+			if r.Method == http.MethodDelete {
+				*cfg = RuntimeConfig{}
+				return nil
+			}
+			for field, value := range patch {
+				var target interface{}
+				switch field {
+				case "cache_ttl":
+					cfg.CacheTTL, target = nil, &cfg.CacheTTL
+				case "poll_interval":
+					cfg.PollInterval, target = nil, &cfg.PollInterval
+				case "github_orgs":
+					cfg.GitHubOrgs, target = nil, &cfg.GitHubOrgs
+				case "repo_include":
+					cfg.RepoInclude, target = nil, &cfg.RepoInclude
+				case "repo_exclude":
+					cfg.RepoExclude, target = nil, &cfg.RepoExclude
+				case "alert_on":
+					cfg.AlertOn, target = nil, &cfg.AlertOn
+				case "alert_branches":
+					cfg.AlertBranches, target = nil, &cfg.AlertBranches
+				default:
+					return invalidConfigError{fmt.Errorf("unknown setting %q", field)}
+				}
+				if err := json.Unmarshal(value, target); err != nil {
+					return invalidConfigError{fmt.Errorf("invalid %s: %v", field, err)}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), runtimeConfigErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(currentSettings())
+
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
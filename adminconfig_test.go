@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingStore can't save the runtime config.
+type failingStore struct {
+	Store
+}
+
+func (s failingStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == runtimeConfigKey {
+		return errors.New("store is read-only")
+	}
+	return s.Store.Set(ctx, key, value, ttl)
+}
+
+// useTestAdminConfig sets up the environment settings of a test,
+// restored after it.
+func useTestAdminConfig(t *testing.T) {
+	t.Helper()
+	previousStore, token, env, applied := store, adminToken, envSettings, appliedAt
+	ttl, interval, srcs, include, exclude, users := cacheTTL, pollInterval, sources, repoInclude, repoExclude, githubUsers
+	on, branches := alertRules()
+	t.Cleanup(func() {
+		store, adminToken, envSettings, appliedAt = previousStore, token, env, applied
+		cacheTTL, pollInterval, sources, repoInclude, repoExclude, githubUsers = ttl, interval, srcs, include, exclude, users
+		setAlertRules(on, branches)
+	})
+
+	store, adminToken = newMemoryStore(), "secret"
+	cacheTTL, pollInterval = time.Minute, 0
+	sources = []source{{Provider: githubProvider{}, Org: "acme"}}
+	repoInclude, repoExclude = nil, []repoPattern{{glob: "*-archive"}}
+	setAlertRules("failed", nil)
+	envSettings = currentSettings()
+}
+
+func adminRequest(method, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/admin/config", strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	adminConfigHandler(w, r)
+	return w
+}
+
+func TestAdminConfigPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		store      func(Store) Store
+		token      string
+		body       string
+		wantStatus int
+		want       func(s *runtimeSettings) // changes to the environment settings
+		wantSaved  bool
+	}{
+		{
+			name:       "without the admin token",
+			body:       `{"poll_interval": "2m"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "with a wrong token",
+			token:      "guess",
+			body:       `{"poll_interval": "2m"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "poll interval and repository filters",
+			token:      "secret",
+			body:       `{"poll_interval": "2m", "repo_include": ["platform-*", "!*-deprecated"], "repo_exclude": []}`,
+			wantStatus: http.StatusOK,
+			want: func(s *runtimeSettings) {
+				s.PollInterval = "2m0s"
+				s.RepoInclude = []string{"platform-*", "!*-deprecated"}
+				s.RepoExclude = []string{}
+			},
+			wantSaved: true,
+		},
+		{
+			name:       "cache TTL and alert rules",
+			token:      "secret",
+			body:       `{"cache_ttl": "5m", "alert_on": "finished", "alert_branches": ["main"]}`,
+			wantStatus: http.StatusOK,
+			want: func(s *runtimeSettings) {
+				s.CacheTTL = "5m0s"
+				s.AlertOn, s.AlertBranches = "finished", []string{"main"}
+			},
+			wantSaved: true,
+		},
+		{
+			name:       "null keeps the environment value",
+			token:      "secret",
+			body:       `{"poll_interval": null}`,
+			wantStatus: http.StatusOK,
+			want:       func(s *runtimeSettings) {},
+			wantSaved:  true,
+		},
+		{
+			name:       "invalid poll interval",
+			token:      "secret",
+			body:       `{"poll_interval": "-1m", "cache_ttl": "5m"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid repository pattern",
+			token:      "secret",
+			body:       `{"repo_exclude": ["[abc"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown setting",
+			token:      "secret",
+			body:       `{"max_jobs": 10}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not saved",
+			store:      func(s Store) Store { return failingStore{s} },
+			token:      "secret",
+			body:       `{"poll_interval": "2m"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestAdminConfig(t)
+			if tt.store != nil {
+				store = tt.store(store)
+			}
+
+			w := adminRequest(http.MethodPatch, tt.body, tt.token)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			want := envSettings
+			if tt.want != nil {
+				tt.want(&want)
+			}
+			if got := currentSettings(); !reflect.DeepEqual(got, want) {
+				t.Errorf("settings = %+v, want %+v", got, want)
+			}
+			cfg, err := loadRuntimeConfig(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (cfg != nil) != tt.wantSaved {
+				t.Errorf("saved config = %+v, want saved %v", cfg, tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestAdminConfigApplies(t *testing.T) {
+	useTestAdminConfig(t)
+	fetchedAt := time.Now()
+	if nextPoll("week", fetchedAt) != nil {
+		t.Fatal("week is polled before POLL_INTERVAL is set")
+	}
+
+	w := adminRequest(http.MethodPatch, `{"poll_interval": "2m", "repo_include": ["acme/platform-*"]}`, "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if next := nextPoll("week", fetchedAt); next == nil || !next.Equal(fetchedAt.Add(2*time.Minute)) {
+		t.Errorf("next poll = %v, want in 2m", next)
+	}
+	if !repoSelected("acme", "platform-api") || repoSelected("acme", "web") {
+		t.Error("repo_include isn't applied")
+	}
+
+	w = adminRequest(http.MethodDelete, "", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var settings runtimeSettings
+	if err := json.Unmarshal(w.Body.Bytes(), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(settings, envSettings) {
+		t.Errorf("settings after reset = %+v, want %+v", settings, envSettings)
+	}
+	if nextPoll("week", fetchedAt) != nil || !repoSelected("acme", "web") || repoSelected("acme", "web-archive") {
+		t.Error("reset didn't go back to the environment")
+	}
+}
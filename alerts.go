@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Alerts: org-wide notifications about finished runs, by default the
+// failures, sent to every configured alert target (ntfy, Gotify, Matrix)
+// independently of the personal watches. Each target is enabled by its own
+// environment variables. OWNER_ALERT_TARGETS also sends a run to the ntfy
+// topic or Matrix room of each of its CODEOWNERS owners (codeowners.go).
+
+// alertTarget is a place alerts are sent to.
+type alertTarget interface {
+	Name() string
+	Send(ctx context.Context, n notification, failed bool) error
+}
+
+var alerts struct {
+	targets  []alertTarget
+	finished bool                     // ALERT_ON=finished: successes too
+	branches map[string]bool          // ALERT_BRANCHES; empty alerts on every branch
+	owners   map[string][]alertTarget // OWNER_ALERT_TARGETS, by lowercased owner
+
+	// finished and branches can be changed at runtime, under runtimeMu
+}
+
+func loadAlertConfig() {
+	if err := setAlertRules(getEnvString("ALERT_ON", "failed"), splitList(os.Getenv("ALERT_BRANCHES"))); err != nil {
+		log.Fatalf("Invalid ALERT_ON: %v", err)
+	}
+
+	if target := loadNtfyTarget(); target != nil {
+		alerts.targets = append(alerts.targets, target)
+	}
+	if target := loadGotifyTarget(); target != nil {
+		alerts.targets = append(alerts.targets, target)
+	}
+	if target := loadMatrixTarget(); target != nil {
+		alerts.targets = append(alerts.targets, target)
+	}
+	loadOwnerAlertTargets()
+	if len(alerts.targets) > 0 {
+		names := make([]string, len(alerts.targets))
+		for i, target := range alerts.targets {
+			names[i] = target.Name()
+		}
+		log.Printf("🚨 Alerting on %s runs through %s", getEnvString("ALERT_ON", "failed"), strings.Join(names, ", "))
+	}
+}
+
+// loadOwnerAlertTargets reads OWNER_ALERT_TARGETS, a comma-separated list
+// of owner=target, where the target is an ntfy topic URL (with NTFY_TOKEN)
+// or a Matrix room on MATRIX_HOMESERVER, e.g.
+// @acme/payments=https://ntfy.sh/payments-ci,@acme/web=#web-ci:example.org.
+func loadOwnerAlertTargets() {
+	entries := splitList(os.Getenv("OWNER_ALERT_TARGETS"))
+	if len(entries) == 0 {
+		return
+	}
+	alerts.owners = make(map[string][]alertTarget)
+	for _, entry := range entries {
+		owner, dest, ok := strings.Cut(entry, "=")
+		owner, dest = "@"+strings.TrimPrefix(strings.TrimSpace(owner), "@"), strings.TrimSpace(dest)
+		if !ok || owner == "@" || dest == "" {
+			log.Fatalf("Invalid OWNER_ALERT_TARGETS entry %q: expected @owner=<ntfy topic URL or Matrix room>", entry)
+		}
+		var target alertTarget
+		switch {
+		case strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://"):
+			target = &ntfyTarget{url: dest, token: os.Getenv("NTFY_TOKEN"), client: newHTTPClient()}
+		case strings.HasPrefix(dest, "!") || strings.HasPrefix(dest, "#"):
+			homeserver, token := strings.TrimRight(strings.TrimSpace(os.Getenv("MATRIX_HOMESERVER")), "/"), os.Getenv("MATRIX_ACCESS_TOKEN")
+			if homeserver == "" || token == "" {
+				log.Fatalf("Invalid OWNER_ALERT_TARGETS entry %q: Matrix rooms need MATRIX_HOMESERVER and MATRIX_ACCESS_TOKEN", entry)
+			}
+			target = &matrixTarget{homeserver: homeserver, token: token, rooms: []string{dest}, client: newHTTPClient(), roomIDs: make(map[string]string)}
+		default:
+			log.Fatalf("Invalid OWNER_ALERT_TARGETS entry %q: expected an http(s) ntfy topic URL, a !room:server or a #alias:server", entry)
+		}
+		alerts.owners[strings.ToLower(owner)] = append(alerts.owners[strings.ToLower(owner)], target)
+	}
+	if !codeownersEnabled {
+		log.Printf("⚠️  OWNER_ALERT_TARGETS is set, but runs only get owners with CODEOWNERS_ENABLED=true")
+	}
+	log.Printf("🚨 Alerting %d CODEOWNERS owners on their own targets", len(alerts.owners))
+}
+
+// setAlertRules sets which runs are alerted on, from the environment or at
+// runtime (see adminconfig.go).
+func setAlertRules(on string, branches []string) error {
+	if on != "failed" && on != "finished" {
+		return fmt.Errorf("%q, expected failed or finished", on)
+	}
+	set := make(map[string]bool)
+	for _, branch := range branches {
+		set[branch] = true
+	}
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	alerts.finished = on == "finished"
+	alerts.branches = set
+	return nil
+}
+
+// alertRules returns ALERT_ON and ALERT_BRANCHES as they're in effect.
+func alertRules() (on string, branches []string) {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	on = "failed"
+	if alerts.finished {
+		on = "finished"
+	}
+	for branch := range alerts.branches {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	return on, branches
+}
+
+// alertOn reports whether a finished run is alerted on. Failures during a
+// maintenance window are expected, so they never are.
+func alertOn(job Job) bool {
+	if hasTag(job, "maintenance") {
+		return false
+	}
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	if job.Status != "failed" && !alerts.finished {
+		return false
+	}
+	return len(alerts.branches) == 0 || alerts.branches[job.Branch]
+}
+
+// sendAlerts sends the finished runs that alerts are on to every target,
+// and to the targets of their owners.
+func sendAlerts(ctx context.Context, finished []Job) {
+	for _, job := range finished {
+		if !alertOn(job) {
+			continue
+		}
+		n := runNotification(job)
+		for _, target := range alerts.targets {
+			sendAlert(ctx, job, n, target, target.Name())
+		}
+		for _, owner := range job.Owners {
+			for _, target := range alerts.owners[strings.ToLower(owner)] {
+				sendAlert(ctx, job, n, target, target.Name()+" of "+owner)
+			}
+		}
+	}
+}
+
+// sendAlert sends a run to one target, once; name tells the target apart
+// from others of the same kind.
+func sendAlert(ctx context.Context, job Job, n notification, target alertTarget, name string) {
+	if !claimNotification(ctx, "alert-sent:"+strings.ToLower(name), job) {
+		return
+	}
+	if err := target.Send(ctx, n, job.Status == "failed"); err != nil {
+		log.Printf("⚠️  Error sending alert about %s/%s %s to %s: %v", job.Organization, job.Pipeline, job.Name, name, err)
+		return
+	}
+	log.Printf("🚨 Alerted %s: %s/%s %s %s", name, job.Organization, job.Pipeline, job.Name, job.Status)
+}
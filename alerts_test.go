@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAlertOn(t *testing.T) {
+	defer func(on string, branches []string) { setAlertRules(on, branches) }(alertRules())
+
+	failed := Job{Status: "failed", Branch: "main"}
+	maintenance := Job{Status: "failed", Branch: "main", Tags: []string{"maintenance"}}
+	tests := []struct {
+		name     string
+		on       string
+		branches []string
+		job      Job
+		want     bool
+	}{
+		{"failure", "failed", nil, failed, true},
+		{"success", "failed", nil, Job{Status: "success", Branch: "main"}, false},
+		{"success when alerting on finished runs", "finished", nil, Job{Status: "success", Branch: "main"}, true},
+		{"failure on an alerted branch", "failed", []string{"main"}, failed, true},
+		{"failure on another branch", "failed", []string{"release"}, failed, false},
+		{"failure during maintenance", "failed", nil, maintenance, false},
+		{"failure during maintenance when alerting on finished runs", "finished", nil, maintenance, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := setAlertRules(tt.on, tt.branches); err != nil {
+				t.Fatal(err)
+			}
+			if got := alertOn(tt.job); got != tt.want {
+				t.Errorf("alertOn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Runs are also sent to the targets of their CODEOWNERS owners, once per
+// target.
+func TestSendAlertsToOwners(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		got[r.URL.Path]++
+	}))
+	defer server.Close()
+
+	defer func(s Store, targets []alertTarget, owners map[string][]alertTarget) {
+		store, alerts.targets, alerts.owners = s, targets, owners
+	}(store, alerts.targets, alerts.owners)
+	defer func(on string, branches []string) { setAlertRules(on, branches) }(alertRules())
+	store = newMemoryStore()
+	topic := func(name string) alertTarget {
+		return &ntfyTarget{url: server.URL + "/" + name, client: server.Client()}
+	}
+	alerts.targets = []alertTarget{topic("ci")}
+	alerts.owners = map[string][]alertTarget{
+		"@acme/payments": {topic("payments")},
+		"@acme/web":      {topic("web")},
+	}
+	if err := setAlertRules("failed", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	job := func(id, status string, owners ...string) Job {
+		return Job{Provider: "github", ID: id, Organization: "acme", Pipeline: "api", Name: "CI", Status: status, Owners: owners}
+	}
+	sendAlerts(context.Background(), []Job{
+		job("1", "failed", "@acme/payments", "@octocat"),
+		job("2", "failed", "@ACME/Web"),
+		job("3", "success", "@acme/payments"),
+		job("4", "failed", "@acme/payments"),
+	})
+
+	want := map[string]int{"/ci": 3, "/payments": 2, "/web": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("alerts by topic = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// In-cluster service account files, see
+// https://kubernetes.io/docs/tasks/run-application/access-api-from-pod/
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	arcScaleSetLabel  = "actions.github.com/scale-set-name"
+)
+
+// RunnerPod is a runner pod that is stuck or failed.
+type RunnerPod struct {
+	Name    string `json:"name"`
+	Phase   string `json:"phase"`
+	Reason  string `json:"reason,omitempty"` // e.g. ImagePullBackOff, Unschedulable
+	Message string `json:"message,omitempty"`
+}
+
+// RunnerScaleSet is an actions-runner-controller AutoscalingRunnerSet with
+// its runner pods.
+type RunnerScaleSet struct {
+	Name            string      `json:"name"`
+	Namespace       string      `json:"namespace"`
+	Organization    string      `json:"organization,omitempty"` // from githubConfigUrl, empty for enterprise-wide sets
+	MinRunners      int         `json:"min_runners"`
+	MaxRunners      *int        `json:"max_runners,omitempty"`
+	CurrentRunners  int         `json:"current_runners"`
+	RunningRunners  int         `json:"running_runners"`
+	PendingRunners  int         `json:"pending_runners"` // scale-ups that have no running pod yet
+	FailedRunners   int         `json:"failed_runners"`
+	PodsRunning     int         `json:"pods_running"`
+	PodsPending     int         `json:"pods_pending"`
+	PodsFailed      int         `json:"pods_failed"`
+	FailedPods      []RunnerPod `json:"failed_pods,omitempty"`
+	PendingPods     []RunnerPod `json:"pending_pods,omitempty"`
+	QueuedJobs      int         `json:"queued_jobs"` // pending runs of the organization, not waiting on concurrency
+	GitHubConfigURL string      `json:"github_config_url"`
+}
+
+type RunnersResponse struct {
+	ScaleSets  []RunnerScaleSet `json:"scale_sets"`
+	QueuedJobs int              `json:"queued_jobs"`
+	Period     string           `json:"period"` // snapshot the queued jobs are counted from
+}
+
+var arc struct {
+	enabled    bool
+	namespaces []string // empty for all namespaces
+	apiURL     string
+	client     *http.Client
+}
+
+// loadARCConfig enables actions-runner-controller visibility when
+// ARC_ENABLED is true. It uses the pod's service account, so the
+// dashboard must run inside the cluster.
+func loadARCConfig() {
+	if os.Getenv("ARC_ENABLED") != "true" {
+		return
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		log.Fatal("ARC_ENABLED requires running inside Kubernetes (KUBERNETES_SERVICE_HOST is not set)")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		log.Fatalf("Error reading service account CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	arc.enabled = true
+	arc.namespaces = splitList(os.Getenv("ARC_NAMESPACES"))
+	arc.apiURL = "https://" + net.JoinHostPort(host, port)
+	arc.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	namespaces := "all"
+	if len(arc.namespaces) > 0 {
+		namespaces = strings.Join(arc.namespaces, ", ")
+	}
+	log.Printf("☸️  ARC visibility enabled (namespaces: %s)", namespaces)
+}
+
+// kubeAuth reads the service account token on every request, since the
+// kubelet rotates it.
+func kubeAuth(req *http.Request) {
+	if token, err := os.ReadFile(serviceAccountDir + "/token"); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+}
+
+// kubePaths returns the path of a resource in every configured namespace,
+// or the cluster-wide path when no namespaces are configured.
+func kubePaths(prefix, resource string) []string {
+	if len(arc.namespaces) == 0 {
+		return []string{prefix + "/" + resource}
+	}
+	paths := make([]string, len(arc.namespaces))
+	for i, ns := range arc.namespaces {
+		paths[i] = prefix + "/namespaces/" + url.PathEscape(ns) + "/" + resource
+	}
+	return paths
+}
+
+type kubeRunnerSet struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		GitHubConfigURL string `json:"githubConfigUrl"`
+		MinRunners      int    `json:"minRunners"`
+		MaxRunners      *int   `json:"maxRunners"`
+	} `json:"spec"`
+	Status struct {
+		CurrentRunners          int `json:"currentRunners"`
+		PendingEphemeralRunners int `json:"pendingEphemeralRunners"`
+		RunningEphemeralRunners int `json:"runningEphemeralRunners"`
+		FailedEphemeralRunners  int `json:"failedEphemeralRunners"`
+	} `json:"status"`
+}
+
+type kubePod struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Status struct {
+		Phase      string `json:"phase"`
+		Reason     string `json:"reason"`
+		Message    string `json:"message"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+		ContainerStatuses []struct {
+			State struct {
+				Waiting *struct {
+					Reason  string `json:"reason"`
+					Message string `json:"message"`
+				} `json:"waiting"`
+			} `json:"state"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// badWaitingReasons are container states a runner pod won't recover from
+// on its own.
+var badWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// classifyPod sorts a runner pod into running, pending or failed. Pods that
+// are Pending only because a container can't start count as failed.
+func classifyPod(pod kubePod) (string, RunnerPod) {
+	info := RunnerPod{Name: pod.Metadata.Name, Phase: pod.Status.Phase, Reason: pod.Status.Reason, Message: pod.Status.Message}
+	for _, c := range pod.Status.ContainerStatuses {
+		if w := c.State.Waiting; w != nil && badWaitingReasons[w.Reason] {
+			info.Reason, info.Message = w.Reason, w.Message
+			return "failed", info
+		}
+	}
+	switch pod.Status.Phase {
+	case "Running":
+		return "running", info
+	case "Failed":
+		return "failed", info
+	case "Pending":
+		for _, c := range pod.Status.Conditions {
+			if c.Type == "PodScheduled" && c.Status == "False" {
+				info.Reason, info.Message = c.Reason, c.Message
+			}
+		}
+		return "pending", info
+	default: // Succeeded, Unknown
+		return "", info
+	}
+}
+
+// orgFromConfigURL returns the organization of a githubConfigUrl such as
+// https://github.com/acme or https://github.com/acme/repo. Enterprise
+// scale sets serve every organization and return "".
+func orgFromConfigURL(configURL string) string {
+	u, err := url.Parse(configURL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if parts[0] == "" || parts[0] == "enterprises" {
+		return ""
+	}
+	return parts[0]
+}
+
+func fetchRunnerScaleSets(ctx context.Context) ([]RunnerScaleSet, error) {
+	var sets []kubeRunnerSet
+	for _, path := range kubePaths("/apis/actions.github.com/v1alpha1", "autoscalingrunnersets") {
+		var list struct {
+			Items []kubeRunnerSet `json:"items"`
+		}
+		if _, err := apiGetJSON(ctx, arc.client, arc.apiURL+path, kubeAuth, &list); err != nil {
+			return nil, fmt.Errorf("listing AutoscalingRunnerSets: %w", err)
+		}
+		sets = append(sets, list.Items...)
+	}
+
+	var pods []kubePod
+	for _, path := range kubePaths("/api/v1", "pods") {
+		var list struct {
+			Items []kubePod `json:"items"`
+		}
+		query := url.Values{"labelSelector": {arcScaleSetLabel}}
+		if _, err := apiGetJSON(ctx, arc.client, arc.apiURL+path+"?"+query.Encode(), kubeAuth, &list); err != nil {
+			return nil, fmt.Errorf("listing runner pods: %w", err)
+		}
+		pods = append(pods, list.Items...)
+	}
+
+	result := make([]RunnerScaleSet, len(sets))
+	index := make(map[string]int) // namespace/name -> result index
+	for i, set := range sets {
+		result[i] = RunnerScaleSet{
+			Name:            set.Metadata.Name,
+			Namespace:       set.Metadata.Namespace,
+			Organization:    orgFromConfigURL(set.Spec.GitHubConfigURL),
+			MinRunners:      set.Spec.MinRunners,
+			MaxRunners:      set.Spec.MaxRunners,
+			CurrentRunners:  set.Status.CurrentRunners,
+			RunningRunners:  set.Status.RunningEphemeralRunners,
+			PendingRunners:  set.Status.PendingEphemeralRunners,
+			FailedRunners:   set.Status.FailedEphemeralRunners,
+			GitHubConfigURL: set.Spec.GitHubConfigURL,
+		}
+		index[set.Metadata.Namespace+"/"+set.Metadata.Name] = i
+	}
+	for _, pod := range pods {
+		i, ok := index[pod.Metadata.Namespace+"/"+pod.Metadata.Labels[arcScaleSetLabel]]
+		if !ok {
+			continue
+		}
+		state, info := classifyPod(pod)
+		switch state {
+		case "running":
+			result[i].PodsRunning++
+		case "pending":
+			result[i].PodsPending++
+			result[i].PendingPods = append(result[i].PendingPods, info)
+		case "failed":
+			result[i].PodsFailed++
+			result[i].FailedPods = append(result[i].FailedPods, info)
+		}
+	}
+	return result, nil
+}
+
+// runnersHandler serves the runner scale sets next to the number of queued
+// runs, so runner autoscaling problems can be told apart from slow CI.
+func runnersHandler(w http.ResponseWriter, r *http.Request) {
+	if !arc.enabled {
+		http.Error(w, "ARC visibility is not enabled (set ARC_ENABLED=true)", http.StatusNotFound)
+		return
+	}
+	ctx := r.Context()
+	sets, err := fetchRunnerScaleSets(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching runners: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	// Queued runs come from the freshest cached snapshot; runs waiting on a
+	// concurrency group don't need a runner
+	response := RunnersResponse{ScaleSets: sets}
+	queued := make(map[string]int)
+	for _, period := range []string{"today", "week", "month"} {
+		snap, err := loadSnapshot(ctx, period)
+		if err != nil || snap == nil {
+			continue
+		}
+		for _, job := range snap.Response.Jobs {
+			if job.Status == "pending" && !job.WaitingOnConcurrency && job.Provider == "github" {
+				queued[job.Organization]++
+				response.QueuedJobs++
+			}
+		}
+		response.Period = period
+		break
+	}
+	for i := range response.ScaleSets {
+		if org := response.ScaleSets[i].Organization; org != "" {
+			response.ScaleSets[i].QueuedJobs = queued[org]
+		} else {
+			response.ScaleSets[i].QueuedJobs = response.QueuedJobs
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
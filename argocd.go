@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArgoCDStatus is the sync state of an ArgoCD application that deploys
+// what a run built.
+type ArgoCDStatus struct {
+	App      string `json:"app"`
+	Sync     string `json:"sync"`     // Synced, OutOfSync, Unknown
+	Health   string `json:"health"`   // Healthy, Progressing, Degraded, ...
+	Deployed bool   `json:"deployed"` // the application runs this run's commit
+}
+
+// argoApp links an ArgoCD application to the repository, and optionally
+// the workflow, whose runs produce its image.
+type argoApp struct {
+	name     string
+	repo     string // "org/repo"
+	workflow string // workflow name, empty for any workflow of the repository
+}
+
+type argoApplication struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Source struct {
+			RepoURL string `json:"repoURL"`
+		} `json:"source"`
+	} `json:"spec"`
+	Status struct {
+		Sync struct {
+			Status   string `json:"status"`
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status string `json:"status"`
+		} `json:"health"`
+		Summary struct {
+			Images []string `json:"images"`
+		} `json:"summary"`
+	} `json:"status"`
+}
+
+// argoCacheTTL is how long the application list is reused between
+// snapshots.
+const argoCacheTTL = 30 * time.Second
+
+var argocd struct {
+	url    string
+	token  string
+	apps   []argoApp // from ARGOCD_APPS; empty to match applications by their source repository
+	client *http.Client
+
+	mu        sync.Mutex
+	items     []argoApplication
+	fetchedAt time.Time
+}
+
+// loadArgoCDConfig enables the ArgoCD integration when ARGOCD_URL is set.
+// ARGOCD_APPS maps applications to the repository (and workflow) building
+// their image, e.g. "payments-prod=acme/payments:Deploy".
+func loadArgoCDConfig() {
+	argocd.url = strings.TrimRight(os.Getenv("ARGOCD_URL"), "/")
+	if argocd.url == "" {
+		return
+	}
+	argocd.token = os.Getenv("ARGOCD_TOKEN")
+	argocd.client = newHTTPClient()
+
+	for _, entry := range splitList(os.Getenv("ARGOCD_APPS")) {
+		name, target, ok := strings.Cut(entry, "=")
+		repo, workflow, _ := strings.Cut(target, ":")
+		if !ok || strings.Count(repo, "/") != 1 {
+			log.Fatalf("Invalid ARGOCD_APPS entry %q: expected app=org/repo[:workflow]", entry)
+		}
+		argocd.apps = append(argocd.apps, argoApp{name: name, repo: repo, workflow: workflow})
+	}
+	log.Printf("🐙 ArgoCD enabled: %s (%d mapped application(s))", argocd.url, len(argocd.apps))
+}
+
+func argoAuth(req *http.Request) {
+	if argocd.token != "" {
+		req.Header.Set("Authorization", "Bearer "+argocd.token)
+	}
+}
+
+// argoApplications returns the ArgoCD applications, refetching them when
+// the cached list is older than argoCacheTTL. On errors the previous list
+// is kept.
+func argoApplications(ctx context.Context) []argoApplication {
+	argocd.mu.Lock()
+	defer argocd.mu.Unlock()
+	if time.Since(argocd.fetchedAt) < argoCacheTTL {
+		return argocd.items
+	}
+
+	var resp struct {
+		Items []argoApplication `json:"items"`
+	}
+	if _, err := apiGetJSON(ctx, argocd.client, argocd.url+"/api/v1/applications", argoAuth, &resp); err != nil {
+		log.Printf("⚠️  Error fetching ArgoCD applications: %v", err)
+		return argocd.items
+	}
+	argocd.items = resp.Items
+	argocd.fetchedAt = time.Now()
+	return argocd.items
+}
+
+// repoFromURL turns a Git URL such as https://github.com/acme/payments.git
+// or git@github.com:acme/payments.git into "acme/payments".
+func repoFromURL(repoURL string) string {
+	repoURL = strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	repoURL = strings.ReplaceAll(repoURL, ":", "/")
+	parts := strings.Split(repoURL, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2] + "/" + parts[len(parts)-1]
+}
+
+// runsCommit reports whether the application runs the given commit: either
+// an image tag contains its short SHA, or the application syncs from the
+// commit itself.
+func runsCommit(app argoApplication, sha string) bool {
+	if app.Status.Sync.Revision == sha {
+		return true
+	}
+	if len(sha) < 7 {
+		return false
+	}
+	for _, image := range app.Status.Summary.Images {
+		if i := strings.LastIndex(image, ":"); i >= 0 && strings.Contains(image[i+1:], sha[:7]) {
+			return true
+		}
+	}
+	return false
+}
+
+// addArgoCDStatus correlates successful runs with the ArgoCD applications
+// deploying their output. The run whose commit an application runs is
+// marked deployed; newer successful runs are marked as not yet synced, so
+// "built green, but not in prod yet" is visible. Older runs are left alone.
+func addArgoCDStatus(jobs []Job) {
+	if argocd.url == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	items := argoApplications(ctx)
+
+	for _, item := range items {
+		links := argoLinks(item)
+		for _, link := range links {
+			var candidates []int
+			for i, job := range jobs {
+				if job.Status != "success" || job.HeadSHA == "" || !strings.EqualFold(job.Organization+"/"+job.Pipeline, link.repo) {
+					continue
+				}
+				if link.workflow != "" && !strings.HasPrefix(job.Name, link.workflow+" #") {
+					continue
+				}
+				candidates = append(candidates, i)
+			}
+			sort.Slice(candidates, func(a, b int) bool { return jobs[candidates[a]].CreatedAt.After(jobs[candidates[b]].CreatedAt) })
+
+			for _, i := range candidates {
+				deployed := runsCommit(item, jobs[i].HeadSHA)
+				jobs[i].ArgoCD = append(jobs[i].ArgoCD, ArgoCDStatus{
+					App:      item.Metadata.Name,
+					Sync:     item.Status.Sync.Status,
+					Health:   item.Status.Health.Status,
+					Deployed: deployed,
+				})
+				if deployed {
+					break
+				}
+			}
+		}
+	}
+}
+
+// argoLinks returns the configured mappings of an application, or one
+// derived from its source repository when ARGOCD_APPS is empty.
+func argoLinks(item argoApplication) []argoApp {
+	if len(argocd.apps) == 0 {
+		if repo := repoFromURL(item.Spec.Source.RepoURL); repo != "" {
+			return []argoApp{{name: item.Metadata.Name, repo: repo}}
+		}
+		return nil
+	}
+	var links []argoApp
+	for _, app := range argocd.apps {
+		if app.name == item.Metadata.Name {
+			links = append(links, app)
+		}
+	}
+	return links
+}
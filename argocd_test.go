@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useFakeArgoCD serves one application deploying acme/api at the commit
+// of run 2, restored after the test. It returns how often the application
+// list was fetched.
+func useFakeArgoCD(t *testing.T) func() int {
+	t.Helper()
+	var mu sync.Mutex
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		w.Write([]byte(`{"items": [{"metadata": {"name": "api-prod"}, "spec": {"source": {"repoURL": "https://github.com/acme/api.git"}},
+			"status": {"sync": {"status": "Synced"}, "health": {"status": "Healthy"}, "summary": {"images": ["ghcr.io/acme/api:a2b2c3d"]}}}]}`))
+	}))
+	url, client, items, fetchedAt := argocd.url, argocd.client, argocd.items, argocd.fetchedAt
+	t.Cleanup(func() {
+		server.Close()
+		argocd.url, argocd.client, argocd.items, argocd.fetchedAt = url, client, items, fetchedAt
+	})
+	argocd.url, argocd.client, argocd.items, argocd.fetchedAt = server.URL, server.Client(), nil, time.Time{}
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+}
+
+func TestAddArgoCDStatus(t *testing.T) {
+	useFakeArgoCD(t)
+	now := time.Now()
+	run := func(id, status string, minutes int) Job {
+		return Job{ID: id, Organization: "acme", Pipeline: "api", Name: "CI #" + id, Status: status,
+			HeadSHA: "a" + id + "b2c3d4e5f", CreatedAt: now.Add(-time.Duration(minutes) * time.Minute)}
+	}
+	jobs := []Job{run("4", "failed", 5), run("3", "success", 10), run("2", "success", 20), run("1", "success", 30)}
+	addArgoCDStatus(jobs)
+
+	synced := ArgoCDStatus{App: "api-prod", Sync: "Synced", Health: "Healthy"}
+	deployed := synced
+	deployed.Deployed = true
+	want := [][]ArgoCDStatus{nil, {synced}, {deployed}, nil}
+	for i, job := range jobs {
+		if !reflect.DeepEqual(job.ArgoCD, want[i]) {
+			t.Errorf("run %s: ArgoCD = %+v, want %+v", job.ID, job.ArgoCD, want[i])
+		}
+	}
+}
+
+// Streamed runs get their ArgoCD status once, in their chunk and in the
+// cached snapshot alike.
+func TestStreamAddsArgoCDStatusOnce(t *testing.T) {
+	useTestStore(t)
+	useFakeSources(t)
+	fetches := useFakeArgoCD(t)
+
+	statuses := func(jobs []Job) map[string]int {
+		counts := make(map[string]int)
+		for _, job := range jobs {
+			counts[job.ID] = len(job.ArgoCD)
+		}
+		return counts
+	}
+	want := map[string]int{"1": 1, "2": 1, "3": 0}
+
+	var streamed []Job
+	for _, chunk := range streamChunks(t) {
+		streamed = append(streamed, chunk.Jobs...)
+	}
+	if got := statuses(streamed); !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed ArgoCD statuses = %v, want %v", got, want)
+	}
+	snap, err := loadSnapshot(context.Background(), "week")
+	if err != nil || snap == nil {
+		t.Fatalf("snapshot = %v, %v", snap, err)
+	}
+	if got := statuses(snap.Response.Jobs); !reflect.DeepEqual(got, want) {
+		data, _ := json.Marshal(snap.Response.Jobs)
+		t.Errorf("cached ArgoCD statuses = %v, want %v: %s", got, want, data)
+	}
+	if n := fetches(); n != 1 {
+		t.Errorf("applications fetched %d times, want once", n)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Re-run attempts: a run is listed once, with the status of its latest
+// attempt, so a failure that was re-run and fixed counts as a success.
+// The earlier attempts are kept on the job and only counted in the stats
+// with ?attempts=all. Successes that needed a re-run of a failed attempt
+// are counted separately as passed_on_rerun, the cost of flaky runs.
+
+type attemptResult struct {
+	status  string
+	seconds int64
+}
+
+// attemptStatuses caches finished earlier attempts, which never change, by
+// "org/repo/run_id/attempt".
+var attemptStatuses = struct {
+	sync.Mutex
+	m map[string]attemptResult
+}{m: make(map[string]attemptResult)}
+
+const maxCachedAttempts = 5000
+
+// addSupersededAttempts fills in the statuses of a GitHub run's earlier
+// attempts. Re-runs are rare, so fetching them one by one is affordable.
+func addSupersededAttempts(ctx context.Context, job *Job) error {
+	job.SupersededAttempts = nil
+	job.FailedAttemptSeconds = 0
+	for attempt := 1; attempt < job.Attempt; attempt++ {
+		result, err := attemptStatus(ctx, job.Organization, job.Pipeline, job.RunID, attempt)
+		if err != nil {
+			return err
+		}
+		job.SupersededAttempts = append(job.SupersededAttempts, result.status)
+		if result.status == "failed" {
+			job.FailedAttemptSeconds += result.seconds
+		}
+	}
+	return nil
+}
+
+func attemptStatus(ctx context.Context, owner, repo string, runID int64, attempt int) (attemptResult, error) {
+	key := fmt.Sprintf("%s/%s/%d/%d", owner, repo, runID, attempt)
+	attemptStatuses.Lock()
+	result, ok := attemptStatuses.m[key]
+	attemptStatuses.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	if err := budget.acquire(ctx); err != nil {
+		return result, err
+	}
+	run, resp, err := githubClient.Actions.GetWorkflowRunAttempt(ctx, owner, repo, runID, attempt, &github.WorkflowRunAttemptOptions{ExcludePullRequests: github.Bool(true)})
+	budget.update(resp)
+	if err != nil {
+		return result, err
+	}
+	result.status = dashboardStatus(run.GetStatus(), run.GetConclusion())
+	if run.RunStartedAt != nil && run.UpdatedAt != nil {
+		result.seconds = max(int64(run.UpdatedAt.Sub(run.RunStartedAt.Time).Seconds()), 0)
+	}
+
+	attemptStatuses.Lock()
+	if len(attemptStatuses.m) >= maxCachedAttempts {
+		attemptStatuses.m = make(map[string]attemptResult)
+	}
+	attemptStatuses.m[key] = result
+	attemptStatuses.Unlock()
+	return result, nil
+}
+
+// passedOnRerun reports whether a job succeeded only after a failed
+// attempt was re-run.
+func passedOnRerun(job Job) bool {
+	if job.Status != "success" {
+		return false
+	}
+	for _, status := range job.SupersededAttempts {
+		if status == "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// addSupersededToStats counts the earlier attempts of a job as runs of
+// their own.
+func addSupersededToStats(stats *DashboardStats, job Job) {
+	for _, status := range job.SupersededAttempts {
+		addToStats(stats, Job{Status: status, Tags: job.Tags})
+	}
+}
+
+func supersededStats(jobs []Job) DashboardStats {
+	var stats DashboardStats
+	for _, job := range jobs {
+		addSupersededToStats(&stats, job)
+	}
+	return stats
+}
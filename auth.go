@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// GitHub OAuth login (OAUTH_CLIENT_ID / OAUTH_CLIENT_SECRET): every page and
+// API call needs a signed-in GitHub user, who only sees the runs of
+// repositories they can access on GitHub. Users who can access every
+// repository of the configured organizations (or are in OAUTH_ADMINS) see
+// everything; the others only get the endpoints that can be narrowed down
+// per repository.
+
+var (
+	oauthConfig *oauth2.Config
+	oauthAdmins = make(map[string]bool)
+
+	// sessionTTL is how long a login lasts.
+	sessionTTL = 12 * time.Hour
+	// accessCacheTTL is how long the repositories a user can access are
+	// reused before they're listed again with the user's token.
+	accessCacheTTL = 10 * time.Minute
+	// viewTokenTTL is how long view tokens last by default, up to
+	// viewTokenMaxTTL.
+	viewTokenTTL    = 90 * 24 * time.Hour
+	viewTokenMaxTTL = 365 * 24 * time.Hour
+)
+
+// maxAccessPages caps the listing of a user's repositories (100 per page).
+const maxAccessPages = 30
+
+const (
+	sessionCookie    = "cicd_session"
+	oauthStateCookie = "cicd_oauth_state"
+)
+
+// openPaths don't need a login: the login flow itself, what probes and
+// Prometheus scrape, the admin API, which checks its own credentials, and
+// the confirmation links of email watches, opened from the mail.
+var openPaths = []string{"/auth/", "/api/status", "/metrics", "/api/admin/", "/api/watches/confirm"}
+
+// scopedPaths narrow their data down to the viewer's repositories, so they
+// are served to users without access to everything, as are run details
+// under /api/runs/. Pages and static files aren't under /api/ and are
+// always served.
+var scopedPaths = map[string]bool{
+	"/api/dashboard":          true,
+	"/api/dashboard/delta":    true,
+	"/api/search":             true,
+	"/api/logs":               true,
+	"/api/refresh":            true,
+	"/api/watches":            true,
+	"/api/push/key":           true,
+	"/api/push/subscriptions": true,
+	"/api/view-tokens":        true,
+	"/api/stats/workflows":    true,
+}
+
+func scopedPath(path string) bool {
+	return !strings.HasPrefix(path, "/api/") || scopedPaths[path] ||
+		(strings.HasPrefix(path, "/api/runs/") && path != "/api/runs/compare")
+}
+
+type session struct {
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// viewerAccess is what a signed-in user may see. Repos holds lowercased
+// "org/repo" names: the repositories the user can access plus the public
+// repositories of the configured organizations. Requests with a view token
+// have no login and see the token's slice instead (see viewtokens.go).
+type viewerAccess struct {
+	Login     string          `json:"login"`
+	Full      bool            `json:"full"`
+	Repos     map[string]bool `json:"repos,omitempty"`
+	View      *ViewToken      `json:"-"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+type viewerKey struct{}
+
+func loadAuthConfig() {
+	clientID, clientSecret := os.Getenv("OAUTH_CLIENT_ID"), os.Getenv("OAUTH_CLIENT_SECRET")
+	if clientID == "" && clientSecret == "" {
+		return
+	}
+	if clientID == "" || clientSecret == "" {
+		log.Fatal("OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET must be set together")
+	}
+	oauthConfig = &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     githubOAuthEndpoint(),
+		RedirectURL:  os.Getenv("OAUTH_REDIRECT_URL"), // empty uses the callback URL registered on the OAuth app
+		// Private repositories only show up in the user's listing with repo
+		Scopes: []string{"repo", "read:org"},
+	}
+	for _, login := range splitList(os.Getenv("OAUTH_ADMINS")) {
+		oauthAdmins[strings.ToLower(login)] = true
+	}
+	sessionTTL = getEnvDuration("SESSION_TTL", sessionTTL)
+	accessCacheTTL = getEnvDuration("ACCESS_CACHE_TTL", accessCacheTTL)
+	viewTokenMaxTTL = getEnvDuration("VIEW_TOKEN_MAX_TTL", viewTokenMaxTTL)
+	viewTokenTTL = min(getEnvDuration("VIEW_TOKEN_TTL", viewTokenTTL), viewTokenMaxTTL)
+	log.Printf("🔐 GitHub OAuth login enabled (%d admin(s))", len(oauthAdmins))
+}
+
+// requireLogin wraps the server's handler with the login check and puts the
+// viewer's access into the request context. Without OAuth it's a no-op.
+func requireLogin(next http.Handler) http.Handler {
+	if oauthConfig == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range openPaths {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if token, from := requestViewToken(r); token != "" {
+			access, err := viewTokenAccess(r.Context(), token)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error checking view token: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if access != nil {
+				if !viewTokenAllowed(r) {
+					http.Error(w, "View tokens can only read the dashboard of their repositories", http.StatusForbidden)
+					return
+				}
+				if from == "query" && !strings.HasPrefix(r.URL.Path, "/api/") {
+					http.SetCookie(w, &http.Cookie{Name: viewTokenCookie, Value: token, Path: "/", HttpOnly: true,
+						Secure: secureRequest(r), SameSite: http.SameSiteLaxMode, MaxAge: int((400 * 24 * time.Hour).Seconds())})
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), viewerKey{}, access)))
+				return
+			}
+			if from != "cookie" {
+				http.Error(w, "Invalid or revoked view token", http.StatusUnauthorized)
+				return
+			}
+			// A revoked token left in the cookie: sign in instead
+			http.SetCookie(w, &http.Cookie{Name: viewTokenCookie, Path: "/", MaxAge: -1})
+		}
+
+		sess := loadSession(r)
+		if sess == nil {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Error(w, "Login required: sign in at /auth/login", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		access, err := viewerAccessFor(r.Context(), sess)
+		if err != nil {
+			log.Printf("❌ Error checking repository access of %s: %v", sess.Login, err)
+			http.Error(w, fmt.Sprintf("Error checking your repository access: %v", err), http.StatusBadGateway)
+			return
+		}
+		if !access.Full && !scopedPath(r.URL.Path) {
+			http.Error(w, "This endpoint covers whole organizations and needs access to all of their repositories", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), viewerKey{}, access)))
+	})
+}
+
+// viewerFrom returns the access of the request's user, or nil when logins
+// are disabled.
+func viewerFrom(r *http.Request) *viewerAccess {
+	access, _ := r.Context().Value(viewerKey{}).(*viewerAccess)
+	return access
+}
+
+// restricted reports whether the viewer only sees some repositories. A nil
+// viewer (no OAuth) sees everything.
+func (a *viewerAccess) restricted() bool {
+	return a != nil && !a.Full
+}
+
+// canSee reports whether a run's repository is visible to the viewer. Runs
+// of other CI providers can't be checked against GitHub and are only shown
+// to viewers who see everything.
+func (a *viewerAccess) canSee(job Job) bool {
+	if !a.restricted() {
+		return true
+	}
+	if a.View != nil {
+		return a.View.covers(job)
+	}
+	if job.Provider != "github" {
+		return false
+	}
+	return a.Repos[strings.ToLower(job.Organization+"/"+job.Pipeline)]
+}
+
+// jobs keeps the visible runs.
+func (a *viewerAccess) jobs(jobs []Job) []Job {
+	if !a.restricted() {
+		return jobs
+	}
+	visible := []Job{}
+	for _, job := range jobs {
+		if a.canSee(job) {
+			visible = append(visible, job)
+		}
+	}
+	return visible
+}
+
+// snapshot narrows a snapshot down to the viewer's repositories. Stats are
+// recomputed from the visible runs, and the per-organization rollups and
+// debug info, which cover every repository, are left out.
+func (a *viewerAccess) snapshot(snap *Snapshot) *Snapshot {
+	if !a.restricted() {
+		return snap
+	}
+	scoped := *snap
+	scoped.Response.Jobs = a.jobs(snap.Response.Jobs)
+	scoped.Response.Stats = calculateStats(scoped.Response.Jobs)
+	scoped.Superseded = supersededStats(scoped.Response.Jobs)
+	scoped.Deduped, scoped.Runners = nil, nil
+	scoped.Response.Errors = a.errors(snap.Response.Errors)
+	scoped.Debug, scoped.Orgs = nil, nil
+	return &scoped
+}
+
+// errors keeps the fetch errors of visible repositories; errors about a
+// whole organization would name repositories the viewer can't see.
+func (a *viewerAccess) errors(errs []FetchError) []FetchError {
+	if !a.restricted() {
+		return errs
+	}
+	var visible []FetchError
+	for _, fetchErr := range errs {
+		if fetchErr.Repository != "" && a.canSee(Job{Provider: fetchErr.Provider, Organization: fetchErr.Organization, Pipeline: fetchErr.Repository}) {
+			visible = append(visible, fetchErr)
+		}
+	}
+	return visible
+}
+
+func loadSession(r *http.Request) *session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	data, ok, err := store.Get(r.Context(), "session:"+cookie.Value)
+	if err != nil {
+		log.Printf("⚠️  Error reading session from store: %v", err)
+		return nil
+	}
+	var sess *session
+	if !ok || json.Unmarshal(data, &sess) != nil || sess == nil || clock().Sub(sess.CreatedAt) > sessionTTL {
+		return nil
+	}
+	return sess
+}
+
+// viewerAccessFor returns what a user may see, from the store while it's
+// younger than accessCacheTTL.
+func viewerAccessFor(ctx context.Context, sess *session) (*viewerAccess, error) {
+	key := "access:" + strings.ToLower(sess.Login)
+	if data, ok, err := store.Get(ctx, key); err == nil && ok {
+		var access viewerAccess
+		if json.Unmarshal(data, &access) == nil && clock().Sub(access.CheckedAt) < accessCacheTTL {
+			return &access, nil
+		}
+	}
+
+	access, err := checkViewerAccess(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(access); err == nil {
+		if err := store.Set(ctx, key, data, accessCacheTTL); err != nil {
+			log.Printf("⚠️  Error saving repository access of %s to store: %v", sess.Login, err)
+		}
+	}
+	return access, nil
+}
+
+// saveUserToken keeps the token of a user who set up something that works
+// without them, like a watch or a view token, so their access can be
+// checked again later.
+func saveUserToken(ctx context.Context, sess *session) {
+	if err := store.Set(ctx, "user-token:"+strings.ToLower(sess.Login), []byte(sess.Token), 0); err != nil {
+		log.Printf("⚠️  Error saving the token of %s: %v", sess.Login, err)
+	}
+}
+
+// storedUserAccess returns what a user may see, checked again with their
+// saved token once accessCacheTTL passed. It's nil without a saved token or
+// when GitHub no longer accepts it.
+func storedUserAccess(ctx context.Context, login string) (*viewerAccess, error) {
+	token, ok, err := store.Get(ctx, "user-token:"+strings.ToLower(login))
+	if err != nil || !ok {
+		return nil, err
+	}
+	access, err := viewerAccessFor(ctx, &session{Login: login, Token: string(token)})
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusUnauthorized {
+		return nil, nil
+	}
+	return access, err
+}
+
+// checkViewerAccess lists the repositories the user can access with their
+// own token. Private repositories of organizations that restrict OAuth app
+// access don't show up until an owner approves the app, so those stay
+// hidden.
+func checkViewerAccess(ctx context.Context, sess *session) (*viewerAccess, error) {
+	access := &viewerAccess{Login: sess.Login, Repos: make(map[string]bool), CheckedAt: clock()}
+	if oauthAdmins[strings.ToLower(sess.Login)] || demoMode {
+		access.Full, access.Repos = true, nil
+		return access, nil
+	}
+
+	client := userClient(ctx, &oauth2.Token{AccessToken: sess.Token})
+	opts := &github.RepositoryListByAuthenticatedUserOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for page := 0; page < maxAccessPages; page++ {
+		repos, resp, err := client.Repositories.ListByAuthenticatedUser(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			access.Repos[strings.ToLower(repo.GetFullName())] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	// Public repositories are no secret; the user sees everything when
+	// no private repository is left out
+	access.Full = true
+	for _, src := range currentSources() {
+		if src.Provider.Name() != "github" {
+			access.Full = false
+			continue
+		}
+		repos, err := listOrgRepos(ctx, src.Org)
+		if err != nil {
+			log.Printf("⚠️  Error listing repositories of %s to check access of %s: %v", src.Org, sess.Login, err)
+			access.Full = false
+			continue
+		}
+		for _, repo := range repos {
+			key := strings.ToLower(src.Org + "/" + repo.Name)
+			if !repo.Private {
+				access.Repos[key] = true
+			} else if !access.Repos[key] {
+				access.Full = false
+			}
+		}
+	}
+	if access.Full {
+		access.Repos = nil
+	}
+	log.Printf("🔐 %s can access %d repositories (full access: %v)", sess.Login, len(access.Repos), access.Full)
+	return access, nil
+}
+
+// userClient calls the GitHub API as the signed-in user.
+func userClient(ctx context.Context, token *oauth2.Token) *github.Client {
+	client := github.NewClient(oauthConfig.Client(ctx, token))
+	client.BaseURL = githubClient.BaseURL // the same API the dashboard reads
+	return client
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// secureRequest reports whether the client talks HTTPS to us, directly or
+// through a TLS-terminating proxy, so cookies can be marked Secure.
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// safeNext keeps redirects after login on this site.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// loginHandler serves /auth/login?next=/..., sending the user to GitHub.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if oauthConfig == nil {
+		http.Error(w, "Login is not enabled (set OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET)", http.StatusNotFound)
+		return
+	}
+	state := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state + "|" + url.QueryEscape(safeNext(r.URL.Query().Get("next"))),
+		Path:     "/auth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, oauthConfig.AuthCodeURL(state), http.StatusFound)
+}
+
+// callbackHandler serves /auth/callback, where GitHub sends the user back
+// with a code to exchange for their token.
+func callbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oauthConfig == nil {
+		http.NotFound(w, r)
+		return
+	}
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	state, next, _ := strings.Cut(cookie.Value, "|")
+	if r.URL.Query().Get("state") != state {
+		http.Error(w, "Invalid login state, please try again", http.StatusBadRequest)
+		return
+	}
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		http.Error(w, fmt.Sprintf("GitHub login failed: %s", r.URL.Query().Get("error_description")), http.StatusForbidden)
+		return
+	}
+
+	token, err := oauthConfig.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("❌ Error exchanging OAuth code: %v", err)
+		http.Error(w, "GitHub login failed", http.StatusBadGateway)
+		return
+	}
+	user, _, err := userClient(r.Context(), token).Users.Get(r.Context(), "")
+	if err != nil {
+		log.Printf("❌ Error reading the signed-in GitHub user: %v", err)
+		http.Error(w, "GitHub login failed", http.StatusBadGateway)
+		return
+	}
+
+	id := randomToken()
+	data, _ := json.Marshal(session{Login: user.GetLogin(), Token: token.AccessToken, CreatedAt: clock()})
+	if err := store.Set(r.Context(), "session:"+id, data, sessionTTL); err != nil {
+		http.Error(w, fmt.Sprintf("Error saving session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/auth/", MaxAge: -1})
+	log.Printf("🔐 %s signed in", user.GetLogin())
+
+	nextURL, _ := url.QueryUnescape(next)
+	http.Redirect(w, r, safeNext(nextURL), http.StatusFound)
+}
+
+// logoutHandler serves /auth/logout.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil && cookie.Value != "" {
+		// The store can't delete; a null session is as good as none
+		if err := store.Set(r.Context(), "session:"+cookie.Value, []byte("null"), time.Second); err != nil {
+			log.Printf("⚠️  Error ending session: %v", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: viewTokenCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// meHandler serves /auth/me, the signed-in user and what they can see.
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	if oauthConfig == nil {
+		http.Error(w, "Login is not enabled", http.StatusNotFound)
+		return
+	}
+	sess := loadSession(r)
+	if sess == nil {
+		http.Error(w, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+	access, err := viewerAccessFor(r.Context(), sess)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error checking your repository access: %v", err), http.StatusBadGateway)
+		return
+	}
+	response := struct {
+		Login string `json:"login"`
+		Full  bool   `json:"full_access"`
+		Repos int    `json:"repos,omitempty"` // visible repositories, without full access
+	}{Login: sess.Login, Full: access.Full, Repos: len(access.Repos)}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureProvider fetches Azure DevOps build and release pipelines. Every
+// "organization/project" in AZURE_DEVOPS_PROJECTS is an organization on
+// the dashboard; build and release definitions are its pipelines.
+type azureProvider struct {
+	baseURL    string // e.g. https://dev.azure.com
+	releaseURL string // release management lives on its own host, e.g. https://vsrm.dev.azure.com
+	token      string
+	client     *http.Client
+}
+
+const azureAPIVersion = "7.0"
+
+// releaseSuffix marks release pipelines, whose runs are deployments
+// rather than builds.
+const releaseSuffix = " (release)"
+
+// loadAzureConfig adds a source for every project in AZURE_DEVOPS_PROJECTS.
+func loadAzureConfig() {
+	projects := splitList(os.Getenv("AZURE_DEVOPS_PROJECTS"))
+	if len(projects) == 0 {
+		return
+	}
+	for _, project := range projects {
+		if strings.Count(project, "/") != 1 {
+			log.Fatalf("Invalid AZURE_DEVOPS_PROJECTS entry %q: expected organization/project", project)
+		}
+	}
+
+	baseURL := strings.TrimRight(os.Getenv("AZURE_DEVOPS_URL"), "/")
+	releaseURL := strings.TrimRight(os.Getenv("AZURE_DEVOPS_RELEASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "https://dev.azure.com"
+		if releaseURL == "" {
+			releaseURL = "https://vsrm.dev.azure.com"
+		}
+	}
+	if releaseURL == "" {
+		releaseURL = baseURL // Azure DevOps Server serves both from one host
+	}
+
+	provider := &azureProvider{
+		baseURL:    baseURL,
+		releaseURL: releaseURL,
+		token:      os.Getenv("AZURE_DEVOPS_TOKEN"),
+		client:     newHTTPClient(),
+	}
+	for _, project := range projects {
+		sources = append(sources, source{Provider: provider, Org: project})
+	}
+	log.Printf("🔷 Azure DevOps enabled: %d project(s) on %s", len(projects), baseURL)
+}
+
+func (p *azureProvider) Name() string { return "azure" }
+
+// auth uses a personal access token as the password of basic auth.
+func (p *azureProvider) auth(req *http.Request) {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(":"+p.token)))
+	}
+}
+
+func (p *azureProvider) apiURL(host, project, path string, query url.Values) string {
+	query.Set("api-version", azureAPIVersion)
+	org, name, _ := strings.Cut(project, "/")
+	return fmt.Sprintf("%s/%s/%s/_apis/%s?%s", host, url.PathEscape(org), url.PathEscape(name), path, query.Encode())
+}
+
+type azureDefinition struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type azureBuild struct {
+	ID           int64           `json:"id"`
+	BuildNumber  string          `json:"buildNumber"`
+	Status       string          `json:"status"`
+	Result       string          `json:"result"`
+	QueueTime    time.Time       `json:"queueTime"`
+	StartTime    *time.Time      `json:"startTime"`
+	FinishTime   *time.Time      `json:"finishTime"`
+	SourceBranch string          `json:"sourceBranch"`
+	Definition   azureDefinition `json:"definition"`
+	Links        struct {
+		Web struct {
+			Href string `json:"href"`
+		} `json:"web"`
+	} `json:"_links"`
+}
+
+type azureDeployment struct {
+	ID                 int64           `json:"id"`
+	DeploymentStatus   string          `json:"deploymentStatus"`
+	OperationStatus    string          `json:"operationStatus"`
+	QueuedOn           time.Time       `json:"queuedOn"`
+	StartedOn          *time.Time      `json:"startedOn"`
+	CompletedOn        *time.Time      `json:"completedOn"`
+	ReleaseDefinition  azureDefinition `json:"releaseDefinition"`
+	ReleaseEnvironment struct {
+		Name string `json:"name"`
+	} `json:"releaseEnvironment"`
+	Release struct {
+		Name  string `json:"name"`
+		Links struct {
+			Web struct {
+				Href string `json:"href"`
+			} `json:"web"`
+		} `json:"_links"`
+	} `json:"release"`
+}
+
+// ListPipelines returns the build definitions built during the window and
+// the release definitions deployed during it, most recently run first.
+func (p *azureProvider) ListPipelines(ctx context.Context, window fetchWindow, project string) ([]Pipeline, error) {
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	defer cancel()
+
+	lastRun := make(map[string]time.Time)
+	pipelines := make(map[string]Pipeline)
+
+	builds, err := p.listBuilds(listCtx, window, project, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	for _, build := range builds {
+		name := build.Definition.Name
+		pipelines[name] = Pipeline{Org: project, Name: name, ID: strconv.FormatInt(build.Definition.ID, 10)}
+		if build.QueueTime.After(lastRun[name]) {
+			lastRun[name] = build.QueueTime
+		}
+	}
+
+	deployments, err := p.listDeployments(listCtx, window, project, url.Values{})
+	if err != nil {
+		// Release management may not be enabled for the project
+		log.Printf("   ⚠️  Error listing release deployments in %s: %v", project, err)
+	}
+	for _, deployment := range deployments {
+		name := deployment.ReleaseDefinition.Name + releaseSuffix
+		pipelines[name] = Pipeline{Org: project, Name: name, ID: strconv.FormatInt(deployment.ReleaseDefinition.ID, 10)}
+		if deployment.QueuedOn.After(lastRun[name]) {
+			lastRun[name] = deployment.QueuedOn
+		}
+	}
+
+	result := make([]Pipeline, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		result = append(result, pipeline)
+	}
+	sort.Slice(result, func(i, j int) bool { return lastRun[result[i].Name].After(lastRun[result[j].Name]) })
+
+	log.Printf("✅ Found %d Azure DevOps pipelines run %s in %s", len(result), window.name(), project)
+	return result, nil
+}
+
+func (p *azureProvider) listBuilds(ctx context.Context, window fetchWindow, project string, query url.Values) ([]azureBuild, error) {
+	query.Set("minTime", window.Start.UTC().Format(time.RFC3339))
+	query.Set("queryOrder", "queueTimeDescending")
+	query.Set("$top", "200")
+	var resp struct {
+		Value []azureBuild `json:"value"`
+	}
+	_, err := apiGetJSON(ctx, p.client, p.apiURL(p.baseURL, project, "build/builds", query), p.auth, &resp)
+	return resp.Value, err
+}
+
+func (p *azureProvider) listDeployments(ctx context.Context, window fetchWindow, project string, query url.Values) ([]azureDeployment, error) {
+	query.Set("minStartedTime", window.Start.UTC().Format(time.RFC3339))
+	query.Set("queryOrder", "descending")
+	query.Set("$top", "100")
+	var resp struct {
+		Value []azureDeployment `json:"value"`
+	}
+	_, err := apiGetJSON(ctx, p.client, p.apiURL(p.releaseURL, project, "release/deployments", query), p.auth, &resp)
+	return resp.Value, err
+}
+
+// ListRuns returns the builds or deployments of a definition in the window.
+func (p *azureProvider) ListRuns(ctx context.Context, window fetchWindow, pipeline Pipeline) ([]Job, error) {
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+
+	var jobs []Job
+	if strings.HasSuffix(pipeline.Name, releaseSuffix) {
+		deployments, err := p.listDeployments(runCtx, window, pipeline.Org, url.Values{"definitionId": {pipeline.ID}})
+		if err != nil {
+			return nil, err
+		}
+		for _, deployment := range deployments {
+			if window.contains(deployment.QueuedOn) {
+				jobs = append(jobs, azureDeploymentToJob(pipeline, deployment))
+			}
+		}
+	} else {
+		builds, err := p.listBuilds(runCtx, window, pipeline.Org, url.Values{"definitions": {pipeline.ID}})
+		if err != nil {
+			return nil, err
+		}
+		for _, build := range builds {
+			if window.contains(build.QueueTime) {
+				jobs = append(jobs, azureBuildToJob(pipeline, build))
+			}
+		}
+	}
+	log.Printf("   ✅ Found %d runs in %s/%s", len(jobs), pipeline.Org, pipeline.Name)
+	return jobs, nil
+}
+
+// azureBuildStatus maps a build's status and result to the dashboard's
+// statuses; partially succeeded builds count as failed, like any GitHub
+// conclusion other than success.
+func azureBuildStatus(status, result string) string {
+	switch status {
+	case "completed":
+		if result == "succeeded" {
+			return "success"
+		}
+		return "failed"
+	case "inProgress", "cancelling":
+		return "running"
+	default: // notStarted, postponed
+		return "pending"
+	}
+}
+
+func azureDeploymentStatus(status string) string {
+	switch status {
+	case "succeeded":
+		return "success"
+	case "failed", "partiallySucceeded":
+		return "failed"
+	case "inProgress":
+		return "running"
+	default: // notDeployed, undefined
+		return "pending"
+	}
+}
+
+// azureConclusion maps the result of a completed build, or the status of a
+// finished deployment, to GitHub's conclusions, see Job.Conclusion.
+func azureConclusion(result string) string {
+	switch result {
+	case "succeeded":
+		return "success"
+	case "failed", "partiallySucceeded":
+		return "failure"
+	case "canceled", "Canceled", "Cancelled":
+		return "cancelled"
+	}
+	return ""
+}
+
+// azureJob fills in the fields builds and deployments share.
+func azureJob(pipeline Pipeline, id, status, conclusion, name, branch, htmlURL string, runID int64, queued time.Time, started, finished *time.Time) Job {
+	startedAt := queued
+	if started != nil {
+		startedAt = *started
+	}
+	end := clock()
+	if finished != nil {
+		end = *finished
+	}
+	h := fnv.New32a()
+	h.Write([]byte(pipeline.Org + "/" + pipeline.Name))
+
+	job := Job{
+		ID:           id,
+		Provider:     "azure",
+		Name:         name,
+		Status:       status,
+		Conclusion:   conclusion,
+		Pipeline:     pipeline.Name,
+		Branch:       branch,
+		Duration:     formatDuration(startedAt, end),
+		Started:      formatTimeAgo(startedAt, defaultLocale),
+		Organization: pipeline.Org,
+		RunID:        runID,
+		HTMLURL:      htmlURL,
+		CreatedAt:    queued,
+
+		StartedAt:       startedAt,
+		DurationSeconds: int64(end.Sub(startedAt).Seconds()),
+		WorkflowID:      int64(h.Sum32()),
+	}
+	return job
+}
+
+func azureBuildToJob(pipeline Pipeline, build azureBuild) Job {
+	conclusion := ""
+	if build.Status == "completed" {
+		conclusion = azureConclusion(build.Result)
+	}
+	return azureJob(pipeline,
+		fmt.Sprintf("ADO-%06d", build.ID),
+		azureBuildStatus(build.Status, build.Result),
+		conclusion,
+		fmt.Sprintf("%s #%s", build.Definition.Name, build.BuildNumber),
+		strings.TrimPrefix(build.SourceBranch, "refs/heads/"),
+		build.Links.Web.Href,
+		build.ID, build.QueueTime, build.StartTime, build.FinishTime)
+}
+
+// azureDeploymentToJob maps a deployment of a release to a stage. The
+// stage is shown where builds show their branch.
+func azureDeploymentToJob(pipeline Pipeline, deployment azureDeployment) Job {
+	status := azureDeploymentStatus(deployment.DeploymentStatus)
+	conclusion := azureConclusion(deployment.DeploymentStatus)
+	if deployment.OperationStatus == "Canceled" || deployment.OperationStatus == "Cancelled" {
+		status, conclusion = "failed", "cancelled"
+	}
+	return azureJob(pipeline,
+		fmt.Sprintf("ADO-R%06d", deployment.ID),
+		status,
+		conclusion,
+		fmt.Sprintf("%s %s", deployment.ReleaseDefinition.Name, deployment.Release.Name),
+		deployment.ReleaseEnvironment.Name,
+		deployment.Release.Links.Web.Href,
+		deployment.ID, deployment.QueuedOn, deployment.StartedOn, deployment.CompletedOn)
+}
+
+// GetLogs concatenates the logs of a build. Release deployments have no
+// single log and aren't supported.
+func (p *azureProvider) GetLogs(ctx context.Context, pipeline Pipeline, buildID int64) (string, error) {
+	if strings.HasSuffix(pipeline.Name, releaseSuffix) {
+		return "", errors.New("logs of release deployments are not supported, open the release in Azure DevOps")
+	}
+
+	var logs struct {
+		Value []struct {
+			ID int64 `json:"id"`
+		} `json:"value"`
+	}
+	_, err := apiGetJSON(ctx, p.client, p.apiURL(p.baseURL, pipeline.Org, fmt.Sprintf("build/builds/%d/logs", buildID), url.Values{}), p.auth, &logs)
+	if isNotFound(err) {
+		return "", errLogsNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, entry := range logs.Value {
+		var lines struct {
+			Value []string `json:"value"`
+		}
+		if _, err := apiGetJSON(ctx, p.client, p.apiURL(p.baseURL, pipeline.Org, fmt.Sprintf("build/builds/%d/logs/%d", buildID, entry.ID), url.Values{}), p.auth, &lines); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "==> log %d <==\n", entry.ID)
+		for _, line := range lines.Value {
+			out.WriteString(line)
+			out.WriteString("\n")
+		}
+		if out.Len() >= maxLogBytes {
+			out.WriteString("... (truncated)\n")
+			break
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAzureBuildToJob(t *testing.T) {
+	queued := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	started, finished := queued.Add(time.Minute), queued.Add(11*time.Minute)
+	pipeline := Pipeline{Org: "contoso/shop", Name: "api-ci"}
+
+	tests := []struct {
+		status, result string
+		wantStatus     string
+		wantConclusion string
+	}{
+		{"completed", "succeeded", "success", "success"},
+		{"completed", "partiallySucceeded", "failed", "failure"},
+		{"completed", "canceled", "failed", "cancelled"},
+		{"inProgress", "", "running", ""},
+		{"cancelling", "", "running", ""},
+		{"notStarted", "", "pending", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status+" "+tt.result, func(t *testing.T) {
+			build := azureBuild{ID: 512, BuildNumber: "20251110.3", Status: tt.status, Result: tt.result, QueueTime: queued,
+				StartTime: &started, FinishTime: &finished, SourceBranch: "refs/heads/release/1.2", Definition: azureDefinition{Name: "api-ci"}}
+			job := azureBuildToJob(pipeline, build)
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion {
+				t.Errorf("status, conclusion = %q, %q, want %q, %q", job.Status, job.Conclusion, tt.wantStatus, tt.wantConclusion)
+			}
+			if job.ID != "ADO-000512" || job.Name != "api-ci #20251110.3" || job.Branch != "release/1.2" ||
+				!job.CreatedAt.Equal(queued) || !job.StartedAt.Equal(started) || job.DurationSeconds != 600 {
+				t.Errorf("job = %+v", job)
+			}
+		})
+	}
+}
+
+// Deployments of a release show their stage where builds show a branch.
+func TestAzureDeploymentToJob(t *testing.T) {
+	queued := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	pipeline := Pipeline{Org: "contoso/shop", Name: "Release: web"}
+
+	tests := []struct {
+		deploymentStatus, operationStatus string
+		wantStatus                        string
+		wantConclusion                    string
+	}{
+		{"succeeded", "Approved", "success", "success"},
+		{"partiallySucceeded", "PhaseSucceeded", "failed", "failure"},
+		{"failed", "Canceled", "failed", "cancelled"},
+		{"inProgress", "Pending", "running", ""},
+		{"notDeployed", "Queued", "pending", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.deploymentStatus+" "+tt.operationStatus, func(t *testing.T) {
+			deployment := azureDeployment{ID: 77, DeploymentStatus: tt.deploymentStatus, OperationStatus: tt.operationStatus, QueuedOn: queued,
+				ReleaseDefinition: azureDefinition{Name: "web"}}
+			deployment.ReleaseEnvironment.Name = "Production"
+			deployment.Release.Name = "Release-42"
+			job := azureDeploymentToJob(pipeline, deployment)
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion {
+				t.Errorf("status, conclusion = %q, %q, want %q, %q", job.Status, job.Conclusion, tt.wantStatus, tt.wantConclusion)
+			}
+			if job.ID != "ADO-R000077" || job.Name != "web Release-42" || job.Branch != "Production" || !job.StartedAt.Equal(queued) {
+				t.Errorf("job = %+v", job)
+			}
+		})
+	}
+}
+
+func TestAzureAPIURL(t *testing.T) {
+	p := &azureProvider{}
+	got := p.apiURL("https://dev.azure.com", "contoso/My Shop", "build/builds", map[string][]string{"$top": {"100"}})
+	if want := "https://dev.azure.com/contoso/My%20Shop/_apis/build/builds?%24top=100&api-version=" + azureAPIVersion; got != want {
+		t.Errorf("apiURL() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// BisectResult narrows down where a workflow started failing on a branch:
+// the last successful run, the first failing run after it, and the commits
+// in between.
+type BisectResult struct {
+	Repository   string            `json:"repository"`
+	Workflow     string            `json:"workflow"`
+	Branch       string            `json:"branch"`
+	Status       string            `json:"status"` // failing, passing, or unknown without history
+	LatestRun    *HistoryRun       `json:"latest_run,omitempty"`
+	LastSuccess  *HistoryRun       `json:"last_success,omitempty"` // none in the history when failing ever since
+	FirstFailure *HistoryRun       `json:"first_failure,omitempty"`
+	FailingRuns  int               `json:"failing_runs"` // since the last success
+	CompareURL   string            `json:"compare_url,omitempty"`
+	Commits      *CommitComparison `json:"commits,omitempty"`
+	// Set when the workflow file itself changed since the last success
+	WorkflowChange *WorkflowChange `json:"workflow_change,omitempty"`
+}
+
+// bisectHandler serves /api/bisect?repo=org/repo&workflow=CI&branch=main.
+func bisectHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	repo := strings.Trim(query.Get("repo"), "/")
+	org, name, ok := strings.Cut(repo, "/")
+	workflow, branch := query.Get("workflow"), query.Get("branch")
+	if !ok || workflow == "" || branch == "" {
+		http.Error(w, "Expected ?repo=org/repo&workflow=name&branch=name", http.StatusBadRequest)
+		return
+	}
+
+	history, err := loadHistory(r.Context(), org, name, branch)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading run history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	result := bisect(history, query.Get("provider"), workflow)
+	result.Repository, result.Branch = repo, branch
+
+	if result.LastSuccess != nil && result.FirstFailure != nil && result.LastSuccess.HeadSHA != "" && result.FirstFailure.HeadSHA != "" {
+		base, head := result.LastSuccess.HeadSHA, result.FirstFailure.HeadSHA
+		if result.FirstFailure.Provider == "github" {
+			result.CompareURL = fmt.Sprintf("%s/%s/compare/%s...%s", githubWebURL, repo, base, head)
+			if githubClient != nil && !demoMode {
+				commits, err := compareCommits(r.Context(), org, name, base, head)
+				if err != nil {
+					log.Printf("⚠️  Error comparing %s...%s in %s: %v", base[:7], head[:7], repo, err)
+				}
+				result.Commits = commits
+				if commits != nil {
+					result.WorkflowChange, err = bisectWorkflowChange(r.Context(), org, name, result.FirstFailure.RunID, base, head, commits)
+					if err != nil {
+						log.Printf("⚠️  Error checking workflow changes in %s: %v", repo, err)
+					}
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(result)
+}
+
+// bisect walks a branch's history (newest first) back from the latest run
+// of the workflow to the last success. Failures during maintenance windows
+// don't count, they say nothing about the code.
+func bisect(history []HistoryRun, provider, workflow string) BisectResult {
+	result := BisectResult{Workflow: workflow, Status: "unknown"}
+	for i := range history {
+		run := &history[i]
+		if !strings.EqualFold(run.Workflow, workflow) || (provider != "" && run.Provider != provider) {
+			continue
+		}
+		if slices.Contains(run.Tags, "maintenance") {
+			continue
+		}
+		if result.LatestRun == nil {
+			result.LatestRun = run
+			result.Workflow = run.Workflow
+			result.Status = "passing"
+		}
+		if run.Status == "success" {
+			result.LastSuccess = run
+			break
+		}
+		result.Status = "failing"
+		result.FirstFailure = run
+		result.FailingRuns++
+	}
+	return result
+}
+
+func bisectWorkflowChange(ctx context.Context, owner, repo string, runID int64, base, head string, commits *CommitComparison) (*WorkflowChange, error) {
+	path, err := runPath(ctx, owner, repo, runID)
+	if err != nil {
+		return nil, err
+	}
+	return workflowChange(ctx, owner, repo, path, base, head, commits)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// bitbucketProvider fetches Bitbucket Cloud pipelines. Workspaces play the
+// role of organizations and repositories keep their role; every pipeline
+// run becomes a Job.
+type bitbucketProvider struct {
+	baseURL  string
+	user     string
+	password string // app password, or an access token when user is empty
+	client   *http.Client
+}
+
+// bitbucketMaxPages caps how many pages are read per listing.
+const bitbucketMaxPages = 5
+
+// loadBitbucketConfig adds a source for every workspace in
+// BITBUCKET_WORKSPACES.
+func loadBitbucketConfig() {
+	workspaces := splitList(os.Getenv("BITBUCKET_WORKSPACES"))
+	if len(workspaces) == 0 {
+		return
+	}
+
+	provider := &bitbucketProvider{
+		baseURL:  "https://api.bitbucket.org/2.0",
+		user:     os.Getenv("BITBUCKET_USERNAME"),
+		password: os.Getenv("BITBUCKET_APP_PASSWORD"),
+		client:   newHTTPClient(),
+	}
+	if provider.user == "" {
+		provider.password = os.Getenv("BITBUCKET_TOKEN")
+	}
+	for _, workspace := range workspaces {
+		sources = append(sources, source{Provider: provider, Org: workspace})
+	}
+	log.Printf("🪣 Bitbucket enabled: %d workspace(s)", len(workspaces))
+}
+
+func (p *bitbucketProvider) Name() string { return "bitbucket" }
+
+func (p *bitbucketProvider) auth(req *http.Request) {
+	switch {
+	case p.user != "":
+		req.SetBasicAuth(p.user, p.password)
+	case p.password != "":
+		req.Header.Set("Authorization", "Bearer "+p.password)
+	}
+}
+
+// bitbucketList reads a paginated endpoint, following "next" links until
+// stop returns true for a page or the page cap is reached.
+func bitbucketList[T any](ctx context.Context, p *bitbucketProvider, pageURL string, stop func([]T) bool) ([]T, error) {
+	var all []T
+	for page := 0; page < bitbucketMaxPages && pageURL != ""; page++ {
+		var resp struct {
+			Values []T    `json:"values"`
+			Next   string `json:"next"`
+		}
+		if _, err := apiGetJSON(ctx, p.client, pageURL, p.auth, &resp); err != nil {
+			return nil, err
+		}
+		all = append(all, resp.Values...)
+		if stop != nil && stop(resp.Values) {
+			break
+		}
+		pageURL = resp.Next
+	}
+	return all, nil
+}
+
+type bitbucketRepository struct {
+	Slug       string    `json:"slug"`
+	UpdatedOn  time.Time `json:"updated_on"`
+	Mainbranch *struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+}
+
+type bitbucketState struct {
+	Name   string `json:"name"` // PENDING, IN_PROGRESS, COMPLETED
+	Result *struct {
+		Name string `json:"name"` // SUCCESSFUL, FAILED, ERROR, STOPPED, EXPIRED
+	} `json:"result"`
+	Stage *struct {
+		Name string `json:"name"` // RUNNING, PAUSED, HALTED
+	} `json:"stage"`
+}
+
+type bitbucketPipeline struct {
+	UUID        string         `json:"uuid"`
+	BuildNumber int64          `json:"build_number"`
+	State       bitbucketState `json:"state"`
+	CreatedOn   time.Time      `json:"created_on"`
+	CompletedOn *time.Time     `json:"completed_on"`
+	Target      struct {
+		RefName  string `json:"ref_name"`
+		Selector struct {
+			Type    string `json:"type"`
+			Pattern string `json:"pattern"`
+		} `json:"selector"`
+	} `json:"target"`
+}
+
+type bitbucketStep struct {
+	UUID        string         `json:"uuid"`
+	Name        string         `json:"name"`
+	State       bitbucketState `json:"state"`
+	StartedOn   *time.Time     `json:"started_on"`
+	CompletedOn *time.Time     `json:"completed_on"`
+}
+
+// ListPipelines returns the workspace's repositories updated during the
+// window, most recently updated first.
+func (p *bitbucketProvider) ListPipelines(ctx context.Context, window fetchWindow, workspace string) ([]Pipeline, error) {
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	defer cancel()
+
+	query := url.Values{
+		"q":       {fmt.Sprintf("updated_on >= %s", window.Start.UTC().Format(time.RFC3339))},
+		"sort":    {"-updated_on"},
+		"pagelen": {"100"},
+	}
+	repos, err := bitbucketList[bitbucketRepository](listCtx, p, p.baseURL+"/repositories/"+url.PathEscape(workspace)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var pipelines []Pipeline
+	for _, repo := range repos {
+		if !window.contains(repo.UpdatedOn) {
+			continue
+		}
+		pipeline := Pipeline{Org: workspace, Name: repo.Slug}
+		if repo.Mainbranch != nil {
+			pipeline.DefaultBranch = repo.Mainbranch.Name
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	log.Printf("✅ Found %d Bitbucket repositories updated %s in %s", len(pipelines), window.name(), workspace)
+	return pipelines, nil
+}
+
+func (p *bitbucketProvider) pipelinesURL(repo Pipeline) string {
+	return fmt.Sprintf("%s/repositories/%s/%s/pipelines/", p.baseURL, url.PathEscape(repo.Org), url.PathEscape(repo.Name))
+}
+
+// ListRuns returns the repository's pipeline runs inside the window.
+func (p *bitbucketProvider) ListRuns(ctx context.Context, window fetchWindow, repo Pipeline) ([]Job, error) {
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+
+	query := url.Values{"sort": {"-created_on"}, "pagelen": {"100"}}
+	pipelines, err := bitbucketList(runCtx, p, p.pipelinesURL(repo)+"?"+query.Encode(), func(page []bitbucketPipeline) bool {
+		return len(page) > 0 && page[len(page)-1].CreatedOn.Before(window.Start)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	for _, pipeline := range pipelines {
+		if !window.contains(pipeline.CreatedOn) {
+			continue
+		}
+		job := bitbucketPipelineToJob(repo, pipeline)
+		if job.Status == "running" {
+			if err := p.addProgress(runCtx, repo, pipeline.UUID, &job); err != nil {
+				log.Printf("   ⚠️  Error fetching steps of pipeline %d in %s/%s: %v", pipeline.BuildNumber, repo.Org, repo.Name, err)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	log.Printf("   ✅ Found %d pipelines in %s/%s", len(jobs), repo.Org, repo.Name)
+	return jobs, nil
+}
+
+// bitbucketStatus maps a pipeline or step state to the dashboard's
+// statuses. Pipelines paused on a manual step count as pending.
+func bitbucketStatus(state bitbucketState) string {
+	switch state.Name {
+	case "COMPLETED":
+		if state.Result != nil && state.Result.Name == "SUCCESSFUL" {
+			return "success"
+		}
+		return "failed"
+	case "IN_PROGRESS":
+		if state.Stage != nil && state.Stage.Name == "PAUSED" {
+			return "pending"
+		}
+		return "running"
+	default: // PENDING
+		return "pending"
+	}
+}
+
+// bitbucketConclusion maps the result of a completed pipeline to GitHub's
+// conclusions, see Job.Conclusion.
+func bitbucketConclusion(state bitbucketState) string {
+	if state.Name != "COMPLETED" || state.Result == nil {
+		return ""
+	}
+	switch state.Result.Name {
+	case "SUCCESSFUL":
+		return "success"
+	case "STOPPED":
+		return "cancelled"
+	case "EXPIRED":
+		return "skipped"
+	default: // FAILED, ERROR
+		return "failure"
+	}
+}
+
+func bitbucketPipelineToJob(repo Pipeline, pipeline bitbucketPipeline) Job {
+	status := bitbucketStatus(pipeline.State)
+	end := clock()
+	if pipeline.CompletedOn != nil {
+		end = *pipeline.CompletedOn
+	}
+
+	// Custom pipelines are named by their selector; branch and default
+	// pipelines have no name of their own
+	name := "Pipeline"
+	if pipeline.Target.Selector.Type == "custom" && pipeline.Target.Selector.Pattern != "" {
+		name = pipeline.Target.Selector.Pattern
+	}
+	branch := pipeline.Target.RefName
+	if branch == "" {
+		branch = "N/A"
+	}
+
+	// Build numbers are only unique per repository
+	h := fnv.New32a()
+	h.Write([]byte(repo.Org + "/" + repo.Name))
+	repoHash := h.Sum32()
+	h.Write([]byte("/" + name))
+
+	job := Job{
+		ID:           fmt.Sprintf("BB-%08x-%d", repoHash, pipeline.BuildNumber),
+		Provider:     "bitbucket",
+		Name:         fmt.Sprintf("%s #%d", name, pipeline.BuildNumber),
+		Status:       status,
+		Conclusion:   bitbucketConclusion(pipeline.State),
+		Pipeline:     repo.Name,
+		Branch:       branch,
+		Duration:     formatDuration(pipeline.CreatedOn, end),
+		Started:      formatTimeAgo(pipeline.CreatedOn, defaultLocale),
+		Organization: repo.Org,
+		RunID:        pipeline.BuildNumber,
+		HTMLURL:      fmt.Sprintf("https://bitbucket.org/%s/%s/pipelines/results/%d", repo.Org, repo.Name, pipeline.BuildNumber),
+		CreatedAt:    pipeline.CreatedOn,
+
+		StartedAt:       pipeline.CreatedOn,
+		DurationSeconds: int64(end.Sub(pipeline.CreatedOn).Seconds()),
+		WorkflowID:      int64(h.Sum32()),
+	}
+	return job
+}
+
+// listSteps returns the steps of a pipeline. The API accepts the build
+// number wherever it expects the pipeline UUID.
+func (p *bitbucketProvider) listSteps(ctx context.Context, repo Pipeline, pipeline string) ([]bitbucketStep, error) {
+	return bitbucketList[bitbucketStep](ctx, p, p.pipelinesURL(repo)+url.PathEscape(pipeline)+"/steps/?pagelen=100", nil)
+}
+
+// addProgress counts the finished steps of a running pipeline.
+func (p *bitbucketProvider) addProgress(ctx context.Context, repo Pipeline, pipelineUUID string, job *Job) error {
+	steps, err := p.listSteps(ctx, repo, pipelineUUID)
+	if err != nil {
+		return err
+	}
+	completed, total := 0, len(steps)
+	for _, step := range steps {
+		if step.CompletedOn != nil {
+			completed++
+		}
+	}
+	job.StepsCompleted = &completed
+	job.StepsTotal = &total
+	return nil
+}
+
+// GetLogs concatenates the logs of the pipeline's steps.
+func (p *bitbucketProvider) GetLogs(ctx context.Context, repo Pipeline, buildNumber int64) (string, error) {
+	pipeline := fmt.Sprint(buildNumber)
+	steps, err := p.listSteps(ctx, repo, pipeline)
+	if isNotFound(err) {
+		return "", errLogsNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, step := range steps {
+		logURL := p.pipelinesURL(repo) + pipeline + "/steps/" + url.PathEscape(step.UUID) + "/log"
+		text, err := apiGetText(ctx, p.client, logURL, p.auth, int64(maxLogBytes-out.Len()))
+		if err != nil && !isNotFound(err) {
+			return "", err
+		}
+		fmt.Fprintf(&out, "==> %s <==\n%s\n", step.Name, text)
+		if out.Len() >= maxLogBytes {
+			out.WriteString("... (truncated)\n")
+			break
+		}
+	}
+	return out.String(), nil
+}
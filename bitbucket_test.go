@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBitbucketPipelineToJob(t *testing.T) {
+	repo := Pipeline{Org: "acme", Name: "api"}
+	tests := []struct {
+		name           string
+		state          string
+		target         string
+		wantStatus     string
+		wantConclusion string
+		wantName       string
+		wantBranch     string
+	}{
+		{
+			name:       "successful",
+			state:      `{"name": "COMPLETED", "result": {"name": "SUCCESSFUL"}}`,
+			target:     `{"ref_name": "main", "selector": {"type": "branches", "pattern": "main"}}`,
+			wantStatus: "success", wantConclusion: "success", wantName: "Pipeline #42", wantBranch: "main",
+		},
+		{
+			name:       "error",
+			state:      `{"name": "COMPLETED", "result": {"name": "ERROR"}}`,
+			target:     `{"ref_name": "main"}`,
+			wantStatus: "failed", wantConclusion: "failure", wantName: "Pipeline #42", wantBranch: "main",
+		},
+		{
+			name:       "stopped",
+			state:      `{"name": "COMPLETED", "result": {"name": "STOPPED"}}`,
+			target:     `{"ref_name": "main"}`,
+			wantStatus: "failed", wantConclusion: "cancelled", wantName: "Pipeline #42", wantBranch: "main",
+		},
+		{
+			name:       "paused for a manual step",
+			state:      `{"name": "IN_PROGRESS", "stage": {"name": "PAUSED"}}`,
+			target:     `{"ref_name": "main"}`,
+			wantStatus: "pending", wantName: "Pipeline #42", wantBranch: "main",
+		},
+		{
+			name:       "custom pipeline",
+			state:      `{"name": "IN_PROGRESS", "stage": {"name": "RUNNING"}}`,
+			target:     `{"ref_name": "release", "selector": {"type": "custom", "pattern": "deploy-prod"}}`,
+			wantStatus: "running", wantName: "deploy-prod #42", wantBranch: "release",
+		},
+		{
+			name:       "no branch",
+			state:      `{"name": "PENDING"}`,
+			target:     `{}`,
+			wantStatus: "pending", wantName: "Pipeline #42", wantBranch: "N/A",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `{"uuid": "{7a1c}", "build_number": 42, "created_on": "2025-11-10T09:00:00Z", "state": ` + tt.state + `, "target": ` + tt.target + `}`
+			if tt.wantConclusion != "" {
+				data = strings.Replace(data, `"build_number"`, `"completed_on": "2025-11-10T09:05:00Z", "build_number"`, 1)
+			}
+			var pipeline bitbucketPipeline
+			if err := json.Unmarshal([]byte(data), &pipeline); err != nil {
+				t.Fatal(err)
+			}
+
+			job := bitbucketPipelineToJob(repo, pipeline)
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion {
+				t.Errorf("status, conclusion = %q, %q, want %q, %q", job.Status, job.Conclusion, tt.wantStatus, tt.wantConclusion)
+			}
+			if job.Name != tt.wantName || job.Branch != tt.wantBranch || job.RunID != 42 ||
+				job.HTMLURL != "https://bitbucket.org/acme/api/pipelines/results/42" {
+				t.Errorf("job = %+v", job)
+			}
+			if tt.wantConclusion != "" && job.DurationSeconds != 300 {
+				t.Errorf("duration = %ds, want until the pipeline completed", job.DurationSeconds)
+			}
+		})
+	}
+
+	// Build numbers repeat across repositories
+	other := bitbucketPipelineToJob(Pipeline{Org: "acme", Name: "web"}, bitbucketPipeline{BuildNumber: 42})
+	if job := bitbucketPipelineToJob(repo, bitbucketPipeline{BuildNumber: 42}); job.ID == other.ID {
+		t.Errorf("builds #42 of two repositories share ID %s", job.ID)
+	}
+}
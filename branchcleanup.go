@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Branch cleanup: runs of pull request branches keep counting after the
+// pull request is merged and the branch deleted, although their failures
+// no longer need anyone. With BRANCH_CLEANUP such runs get a branch_state:
+//
+//	merged   the branch was the head of a merged pull request and has no
+//	         commits since, or is gone after the merge
+//	deleted  the branch is gone without a merged pull request; only for
+//	         pull request runs, as tag pushes have no branch either
+//
+// /api/branches/cleanup lists them, and EXCLUDE_STALE_BRANCHES or
+// ?stale_branches=exclude leaves them out of the stats.
+
+var (
+	// branchCleanup turns on checking branches (BRANCH_CLEANUP), which
+	// costs two calls per repository with branch runs per branchStateTTL.
+	branchCleanup bool
+
+	// excludeStaleBranches leaves runs of merged and deleted branches out
+	// of the dashboard by default (EXCLUDE_STALE_BRANCHES).
+	excludeStaleBranches bool
+)
+
+const branchStateTTL = 15 * time.Minute
+
+// repoBranches is what a repository's branches and recently merged pull
+// requests say about the branches runs were on.
+type repoBranches struct {
+	heads     map[string]string // existing branch -> head SHA
+	complete  bool              // every branch was listed, so missing ones are gone
+	merged    map[string]string // head branch of a merged pull request -> its head SHA
+	fetchedAt time.Time
+}
+
+var branchStates = struct {
+	sync.Mutex
+	repos map[string]repoBranches
+}{repos: make(map[string]repoBranches)}
+
+func loadBranchCleanupConfig() {
+	branchCleanup = os.Getenv("BRANCH_CLEANUP") == "true"
+	excludeStaleBranches = os.Getenv("EXCLUDE_STALE_BRANCHES") == "true"
+	if excludeStaleBranches && !branchCleanup {
+		log.Fatalf("Invalid EXCLUDE_STALE_BRANCHES: needs BRANCH_CLEANUP=true")
+	}
+	if branchCleanup {
+		log.Printf("🧹 Branch cleanup insight enabled (exclude stale branches: %v)", excludeStaleBranches)
+	}
+}
+
+// fetchRepoBranches returns the branches and recently merged pull requests
+// of a repository, cached for branchStateTTL.
+func fetchRepoBranches(ctx context.Context, org, repo string) (repoBranches, error) {
+	key := org + "/" + repo
+	branchStates.Lock()
+	branches, ok := branchStates.repos[key]
+	branchStates.Unlock()
+	if ok && clock().Sub(branches.fetchedAt) < branchStateTTL {
+		return branches, nil
+	}
+
+	branches = repoBranches{heads: make(map[string]string), merged: make(map[string]string), fetchedAt: clock()}
+	if err := budget.acquire(ctx); err != nil {
+		return branches, err
+	}
+	listCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	listed, err := listBranches(listCtx, org, repo)
+	cancel()
+	if err != nil {
+		return branches, err
+	}
+	for _, branch := range listed {
+		branches.heads[branch.GetName()] = branch.GetCommit().GetSHA()
+	}
+	branches.complete = len(listed) < maxBranchPages*100
+
+	// The most recently closed pull requests are enough: older branches
+	// have no runs in the period anymore
+	if err := budget.acquire(ctx); err != nil {
+		return branches, err
+	}
+	listCtx, cancel = withPhaseTimeout(ctx, runListTimeout)
+	pulls, resp, err := githubClient.PullRequests.List(listCtx, org, repo, &github.PullRequestListOptions{
+		State:       "closed",
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	cancel()
+	budget.update(resp)
+	if err != nil {
+		return branches, err
+	}
+	for _, pull := range pulls {
+		// Pull requests from forks have their branch in the fork
+		if pull.MergedAt == nil || pull.GetHead().GetRepo().GetFullName() != key {
+			continue
+		}
+		if _, ok := branches.merged[pull.GetHead().GetRef()]; !ok {
+			branches.merged[pull.GetHead().GetRef()] = pull.GetHead().GetSHA()
+		}
+	}
+
+	branchStates.Lock()
+	branchStates.repos[key] = branches
+	branchStates.Unlock()
+	return branches, nil
+}
+
+// state returns the branch_state of a run of the repository: "merged",
+// "deleted" or "" for a branch still in use.
+func (b repoBranches) state(repo Pipeline, run *github.WorkflowRun) string {
+	branch := run.GetHeadBranch()
+	if branch == "" || branch == repo.DefaultBranch {
+		return ""
+	}
+	// Runs of pull requests from forks are on the fork's branches
+	if fullName := run.GetHeadRepository().GetFullName(); fullName != "" && fullName != repo.Org+"/"+repo.Name {
+		return ""
+	}
+	head, exists := b.heads[branch]
+	mergedHead, merged := b.merged[branch]
+	switch {
+	case exists && merged && head == mergedHead:
+		return "merged" // nothing pushed since the merge
+	case exists || !b.complete:
+		return ""
+	case merged:
+		return "merged"
+	case strings.HasPrefix(run.GetEvent(), "pull_request"):
+		return "deleted"
+	}
+	return ""
+}
+
+// addBranchStates sets BranchState on the jobs of one repository's runs.
+func addBranchStates(ctx context.Context, repo Pipeline, runs []*github.WorkflowRun, jobs []Job) error {
+	if !branchCleanup || len(jobs) == 0 || budget.low() {
+		return nil
+	}
+	byRunID := make(map[int64]*github.WorkflowRun, len(runs))
+	onBranch := false
+	for _, run := range runs {
+		byRunID[run.GetID()] = run
+		onBranch = onBranch || (run.GetHeadBranch() != "" && run.GetHeadBranch() != repo.DefaultBranch)
+	}
+	// Repositories that only build their default branch don't need a look
+	if !onBranch {
+		return nil
+	}
+	branches, err := fetchRepoBranches(ctx, repo.Org, repo.Name)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if run, ok := byRunID[jobs[i].RunID]; ok {
+			jobs[i].BranchState = branches.state(repo, run)
+		}
+	}
+	return nil
+}
+
+// withoutStaleBranches leaves out the runs of merged and deleted branches.
+func withoutStaleBranches(jobs []Job) []Job {
+	active := []Job{}
+	for _, job := range jobs {
+		if job.BranchState == "" {
+			active = append(active, job)
+		}
+	}
+	return active
+}
+
+// excludesStaleBranches reports whether a dashboard request leaves out the
+// runs of merged and deleted branches: ?stale_branches=exclude or include,
+// EXCLUDE_STALE_BRANCHES without either.
+func excludesStaleBranches(r *http.Request) bool {
+	switch r.URL.Query().Get("stale_branches") {
+	case "exclude":
+		return true
+	case "include":
+		return false
+	}
+	return excludeStaleBranches
+}
+
+// StaleBranch is a merged or deleted branch with runs in the period.
+type StaleBranch struct {
+	Repository string    `json:"repository"`
+	Branch     string    `json:"branch"`
+	State      string    `json:"state"`
+	Runs       int       `json:"runs"`
+	Failed     int       `json:"failed"`
+	LastRunAt  time.Time `json:"last_run_at"`
+}
+
+type BranchCleanupResponse struct {
+	Period    string        `json:"period"`
+	FetchedAt time.Time     `json:"fetched_at"`
+	Enabled   bool          `json:"enabled"`
+	Runs      int           `json:"runs"`   // of all stale branches
+	Failed    int           `json:"failed"` // of all stale branches
+	Branches  []StaleBranch `json:"branches"`
+}
+
+// branchCleanupHandler serves /api/branches/cleanup?period=week, the
+// merged and deleted branches that still have runs in the period, most
+// runs first.
+func branchCleanupHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	snap = viewerFrom(r).snapshot(snap)
+
+	response := BranchCleanupResponse{Period: period, FetchedAt: snap.FetchedAt, Enabled: branchCleanup, Branches: []StaleBranch{}}
+	byBranch := make(map[string]*StaleBranch)
+	for _, job := range snap.Response.Jobs {
+		if job.BranchState == "" {
+			continue
+		}
+		repo := job.Organization + "/" + job.Pipeline
+		b, ok := byBranch[repo+"|"+job.Branch]
+		if !ok {
+			b = &StaleBranch{Repository: repo, Branch: job.Branch, State: job.BranchState}
+			byBranch[repo+"|"+job.Branch] = b
+		}
+		b.Runs++
+		response.Runs++
+		if job.Status == "failed" {
+			b.Failed++
+			response.Failed++
+		}
+		if job.CreatedAt.After(b.LastRunAt) {
+			b.LastRunAt = job.CreatedAt
+		}
+	}
+	for _, b := range byBranch {
+		response.Branches = append(response.Branches, *b)
+	}
+	sort.Slice(response.Branches, func(i, j int) bool {
+		a, b := response.Branches[i], response.Branches[j]
+		if a.Runs != b.Runs {
+			return a.Runs > b.Runs
+		}
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Branch < b.Branch
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
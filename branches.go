@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// BranchHealth is the latest run on one branch of a repository.
+type BranchHealth struct {
+	Branch     string     `json:"branch"`
+	Protected  bool       `json:"protected,omitempty"`
+	State      string     `json:"state,omitempty"` // "merged" or "deleted", see BRANCH_CLEANUP
+	Status     string     `json:"status"`          // of the latest run, "none" without runs in the period
+	LatestRun  *Job       `json:"latest_run,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	Age        string     `json:"age,omitempty"` // how long ago the latest run started, localized
+	AgeSeconds int64      `json:"age_seconds,omitempty"`
+	Runs       int        `json:"runs"`
+	Failed     int        `json:"failed"`
+}
+
+type BranchesResponse struct {
+	Repository string         `json:"repository"`
+	Period     string         `json:"period"`
+	FetchedAt  time.Time      `json:"fetched_at"`
+	Branches   []BranchHealth `json:"branches"`
+}
+
+// maxBranchPages caps how many pages of branches are listed for a repo.
+const maxBranchPages = 3
+
+// branchesHandler serves /api/branches?repo=org/repo, the health of every
+// branch of a repository, for repos with long-lived release branches.
+func branchesHandler(w http.ResponseWriter, r *http.Request) {
+	repo := strings.Trim(r.URL.Query().Get("repo"), "/")
+	if !strings.Contains(repo, "/") {
+		http.Error(w, "Expected ?repo=org/repo", http.StatusBadRequest)
+		return
+	}
+	provider := r.URL.Query().Get("provider") // optional, for the same org/repo on several CI systems
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		// Release branches see few runs, a week is often too short
+		period = "month"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	branches := make(map[string]*BranchHealth)
+	for _, job := range snap.Response.Jobs {
+		if (provider != "" && job.Provider != provider) || job.Organization+"/"+job.Pipeline != repo {
+			continue
+		}
+		b, ok := branches[job.Branch]
+		if !ok {
+			b = &BranchHealth{Branch: job.Branch}
+			branches[job.Branch] = b
+		}
+		b.Runs++
+		if job.Status == "failed" {
+			b.Failed++
+		}
+		if b.LatestRun == nil || job.CreatedAt.After(b.LatestRun.CreatedAt) {
+			latest := job
+			b.LatestRun = &latest
+		}
+	}
+
+	// Branches without runs in the period are listed too, so stale release
+	// branches stand out
+	if (provider == "" || provider == "github") && githubClient != nil && !demoMode {
+		owner, name, _ := strings.Cut(repo, "/")
+		listed, err := listBranches(r.Context(), owner, name)
+		if err != nil {
+			log.Printf("⚠️  Error listing branches of %s: %v", repo, err)
+		}
+		for _, branch := range listed {
+			b, ok := branches[branch.GetName()]
+			if !ok {
+				b = &BranchHealth{Branch: branch.GetName()}
+				branches[branch.GetName()] = b
+			}
+			b.Protected = branch.GetProtected()
+		}
+	}
+
+	locale := requestLocale(r.URL.Query().Get("locale"))
+	response := BranchesResponse{Repository: repo, Period: period, FetchedAt: snap.FetchedAt, Branches: []BranchHealth{}}
+	for _, b := range branches {
+		b.Status = "none"
+		if b.LatestRun != nil {
+			jobs := []Job{*b.LatestRun}
+			localizeJobs(jobs, locale)
+			updateElapsed(jobs)
+			b.LatestRun = &jobs[0]
+			b.Status = b.LatestRun.Status
+			b.State = b.LatestRun.BranchState
+
+			lastRun := b.LatestRun.StartedAt
+			if lastRun.IsZero() {
+				lastRun = b.LatestRun.CreatedAt
+			}
+			b.LastRunAt = &lastRun
+			b.Age = formatTimeAgo(lastRun, locale)
+			b.AgeSeconds = int64(clock().Sub(lastRun).Seconds())
+		}
+		response.Branches = append(response.Branches, *b)
+	}
+	// Most recently active first, branches without runs last
+	sort.Slice(response.Branches, func(i, j int) bool {
+		a, b := response.Branches[i], response.Branches[j]
+		if (a.LastRunAt == nil) != (b.LastRunAt == nil) {
+			return a.LastRunAt != nil
+		}
+		if a.LastRunAt != nil && !a.LastRunAt.Equal(*b.LastRunAt) {
+			return a.LastRunAt.After(*b.LastRunAt)
+		}
+		return a.Branch < b.Branch
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
+
+func listBranches(ctx context.Context, owner, repo string) ([]*github.Branch, error) {
+	var all []*github.Branch
+	opts := &github.BranchListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for page := 0; page < maxBranchPages; page++ {
+		branches, resp, err := githubClient.Repositories.ListBranches(ctx, owner, repo, opts)
+		budget.update(resp)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, branches...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return all, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+var errBudgetExhausted = errors.New("rate limit budget exhausted")
+
+// errThrottled is returned for requests that can't wait for the throttle
+// to end before their deadline.
+var errThrottled = errors.New("GitHub requests are throttled")
+
+var (
+	// rateLimitReserve is the number of calls always left untouched, per
+	// token, so other tools sharing the token keep working.
+	rateLimitReserve = 100
+
+	// rateLimitLowWatermark is the fraction of the limit below which the
+	// scheduler starts pacing calls and only fetches default branch runs.
+	rateLimitLowWatermark = 0.2
+
+	// maxPaceDelay caps the delay inserted between calls while pacing.
+	maxPaceDelay = 2 * time.Second
+
+	// secondaryRateLimitWait is the pause after a secondary rate limit
+	// that didn't say how long to wait, as GitHub recommends.
+	secondaryRateLimitWait = time.Minute
+)
+
+// rateBudget tracks the remaining GitHub rate limit across all concurrent
+// fetches and decides whether the next call may go out. Instead of blindly
+// spending the budget and failing halfway through a crawl, it paces calls
+// when the budget runs low and stops before the reserve is touched. When
+// GitHub answers with a secondary rate limit or an exhausted primary one,
+// every call waits until the time GitHub asked for, instead of the next
+// repositories running into the same limit.
+type rateBudget struct {
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	limit     int
+	resetAt   time.Time
+
+	throttledUntil time.Time
+	throttleReason string
+
+	// unlimited is set while GitHub Enterprise Server answers without a
+	// rate limit, as it does with rate limiting off
+	unlimited bool
+}
+
+var budget = &rateBudget{}
+
+// update records the rate limit reported by a GitHub response.
+func (b *rateBudget) update(resp *github.Response) {
+	if resp == nil || resp.Response == nil {
+		return
+	}
+	if resp.Rate.Limit == 0 {
+		// Errors may come from a proxy in front of the server
+		if githubEnterprise && resp.StatusCode < http.StatusBadRequest {
+			b.mu.Lock()
+			b.unlimited = true
+			b.mu.Unlock()
+		}
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unlimited = false
+
+	if githubTokens != nil {
+		// The pool saw the response and knows the sum of all tokens
+		if remaining, limit, resetAt, ok := githubTokens.rateLimit(); ok {
+			b.known, b.remaining, b.limit, b.resetAt = true, remaining, limit, resetAt
+		}
+		return
+	}
+	reset := resp.Rate.Reset.Time
+	// Responses of concurrent requests may arrive out of order; within the
+	// same reset window the lowest remaining count is the most recent
+	if b.known && reset.Equal(b.resetAt) && resp.Rate.Remaining > b.remaining {
+		return
+	}
+	b.known = true
+	b.remaining = resp.Rate.Remaining
+	b.limit = resp.Rate.Limit
+	b.resetAt = reset
+}
+
+// rateLimit returns the last known rate limit, or nil before the first
+// response.
+func (b *rateBudget) rateLimit() *RateLimitInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.known {
+		return nil
+	}
+	info := &RateLimitInfo{Remaining: b.remaining, Limit: b.limit, ResetAt: b.resetAt}
+	if n := githubTokens.size(); n > 1 {
+		info.Tokens = n
+	}
+	if until := b.throttledUntil; time.Now().Before(until) {
+		info.ThrottledUntil, info.ThrottleReason = &until, b.throttleReason
+	}
+	return info
+}
+
+// rateLimitDisabled reports whether GitHub Enterprise Server has rate
+// limiting off.
+func (b *rateBudget) rateLimitDisabled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.unlimited && !b.known
+}
+
+// throttle holds back all calls until the given time. A throttle that
+// ends later already stays in place.
+func (b *rateBudget) throttle(until time.Time, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !until.After(b.throttledUntil) {
+		return
+	}
+	if !time.Now().Before(b.throttledUntil) {
+		log.Printf("⏸️  GitHub %s, pausing GitHub requests until %s", strings.ReplaceAll(reason, "_", " "), until.Format(time.RFC3339))
+	}
+	b.throttledUntil, b.throttleReason = until, reason
+}
+
+// waitThrottle waits for the throttle to end. It returns errThrottled
+// right away when ctx ends before that, and errBudgetExhausted while the
+// primary rate limit is used up, whose reset can be up to an hour away.
+func (b *rateBudget) waitThrottle(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		wait, reason := time.Until(b.throttledUntil), b.throttleReason
+		b.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		if reason == "rate_limit" {
+			return errBudgetExhausted
+		}
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(time.Now().Add(wait)) {
+			return errThrottled
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			// The throttle may have been extended meanwhile
+		}
+	}
+}
+
+// low reports whether the budget is below the low watermark.
+func (b *rateBudget) low() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lowLocked()
+}
+
+func (b *rateBudget) lowLocked() bool {
+	if !b.known || time.Now().After(b.resetAt) {
+		return false
+	}
+	return float64(b.remaining) < float64(b.limit)*rateLimitLowWatermark
+}
+
+// acquire reserves one API call, after waiting out a throttle. It returns
+// errBudgetExhausted when only the reserve is left before the next reset,
+// and sleeps between calls while the budget is low so the remaining calls
+// are spread until the reset.
+func (b *rateBudget) acquire(ctx context.Context) error {
+	if err := b.waitThrottle(ctx); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if !b.known || time.Now().After(b.resetAt) {
+		// Unknown or already reset: let the call through and learn from it
+		b.mu.Unlock()
+		return nil
+	}
+	reserve := reservedCalls()
+	if b.remaining <= reserve {
+		b.mu.Unlock()
+		return errBudgetExhausted
+	}
+
+	var delay time.Duration
+	if b.lowLocked() {
+		usable := b.remaining - reserve
+		delay = time.Until(b.resetAt) / time.Duration(usable)
+		if delay > maxPaceDelay {
+			delay = maxPaceDelay
+		}
+	}
+	// Count the call optimistically so concurrent fetches see it
+	b.remaining--
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// reservedCalls is the reserve of all tokens together.
+func reservedCalls() int {
+	return rateLimitReserve * githubTokens.size()
+}
+
+func loadBudgetConfig() {
+	rateLimitReserve = getEnvInt("RATE_LIMIT_RESERVE", rateLimitReserve)
+	maxPaceDelay = getEnvDuration("RATE_LIMIT_MAX_PACE_DELAY", maxPaceDelay)
+	secondaryRateLimitWait = getEnvDuration("SECONDARY_RATE_LIMIT_WAIT", secondaryRateLimitWait)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buildkiteProvider fetches builds through the Buildkite REST API.
+// Buildkite organizations map to organizations and pipelines to
+// pipelines; every build becomes a Job.
+type buildkiteProvider struct {
+	baseURL string
+	token   string
+	client  *http.Client
+
+	mu        sync.Mutex
+	rateLimit *RateLimitInfo
+}
+
+// loadBuildkiteConfig adds a source for every org slug in BUILDKITE_ORGS.
+func loadBuildkiteConfig() {
+	orgs := splitList(os.Getenv("BUILDKITE_ORGS"))
+	if len(orgs) == 0 {
+		return
+	}
+	token := os.Getenv("BUILDKITE_TOKEN")
+	if token == "" {
+		log.Fatal("BUILDKITE_TOKEN environment variable is required when BUILDKITE_ORGS is set")
+	}
+
+	provider := &buildkiteProvider{
+		baseURL: "https://api.buildkite.com/v2",
+		token:   token,
+		client:  newHTTPClient(),
+	}
+	for _, org := range orgs {
+		sources = append(sources, source{Provider: provider, Org: org})
+	}
+	log.Printf("🪁 Buildkite enabled: %d organization(s)", len(orgs))
+}
+
+func (p *buildkiteProvider) Name() string { return "buildkite" }
+
+func (p *buildkiteProvider) RateLimit() *RateLimitInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rateLimit
+}
+
+func (p *buildkiteProvider) auth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+p.token)
+}
+
+// get fetches an API path and records the rate limit headers. Buildkite
+// reports the reset as seconds from now.
+func (p *buildkiteProvider) get(ctx context.Context, path string, out interface{}) error {
+	header, err := apiGetJSON(ctx, p.client, p.baseURL+path, p.auth, out)
+	if err != nil {
+		return err
+	}
+	remaining, err1 := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	limit, err2 := strconv.Atoi(header.Get("RateLimit-Limit"))
+	reset, err3 := strconv.Atoi(header.Get("RateLimit-Reset"))
+	if err1 == nil && err2 == nil && err3 == nil {
+		p.mu.Lock()
+		p.rateLimit = &RateLimitInfo{Remaining: remaining, Limit: limit, ResetAt: time.Now().Add(time.Duration(reset) * time.Second)}
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+type buildkiteBuild struct {
+	ID         string     `json:"id"`
+	Number     int64      `json:"number"`
+	State      string     `json:"state"`
+	Branch     string     `json:"branch"`
+	WebURL     string     `json:"web_url"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Pipeline   struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	} `json:"pipeline"`
+	Jobs []buildkiteJob `json:"jobs"`
+}
+
+type buildkiteJob struct {
+	ID                 string     `json:"id"`
+	Type               string     `json:"type"`
+	Name               string     `json:"name"`
+	State              string     `json:"state"`
+	WebURL             string     `json:"web_url"`
+	StartedAt          *time.Time `json:"started_at"`
+	FinishedAt         *time.Time `json:"finished_at"`
+	ParallelGroupIndex *int       `json:"parallel_group_index"`
+	ParallelGroupTotal *int       `json:"parallel_group_total"`
+}
+
+func buildsQuery(window fetchWindow) string {
+	return url.Values{
+		"created_from": {window.Start.UTC().Format(time.RFC3339)},
+		"per_page":     {"100"},
+	}.Encode()
+}
+
+// ListPipelines returns the org's pipelines that had builds during the
+// window, most recently built first.
+func (p *buildkiteProvider) ListPipelines(ctx context.Context, window fetchWindow, org string) ([]Pipeline, error) {
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	defer cancel()
+
+	var builds []buildkiteBuild
+	if err := p.get(listCtx, "/organizations/"+url.PathEscape(org)+"/builds?"+buildsQuery(window), &builds); err != nil {
+		return nil, err
+	}
+
+	lastBuild := make(map[string]time.Time)
+	for _, build := range builds {
+		if build.CreatedAt.After(lastBuild[build.Pipeline.Slug]) {
+			lastBuild[build.Pipeline.Slug] = build.CreatedAt
+		}
+	}
+	pipelines := make([]Pipeline, 0, len(lastBuild))
+	for slug := range lastBuild {
+		pipelines = append(pipelines, Pipeline{Org: org, Name: slug})
+	}
+	sort.Slice(pipelines, func(i, j int) bool { return lastBuild[pipelines[i].Name].After(lastBuild[pipelines[j].Name]) })
+
+	log.Printf("✅ Found %d Buildkite pipelines built %s in %s", len(pipelines), window.name(), org)
+	return pipelines, nil
+}
+
+// ListRuns returns the pipeline's builds inside the window.
+func (p *buildkiteProvider) ListRuns(ctx context.Context, window fetchWindow, pipeline Pipeline) ([]Job, error) {
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+
+	var builds []buildkiteBuild
+	path := fmt.Sprintf("/organizations/%s/pipelines/%s/builds?%s", url.PathEscape(pipeline.Org), url.PathEscape(pipeline.Name), buildsQuery(window))
+	if err := p.get(runCtx, path, &builds); err != nil {
+		return nil, err
+	}
+	log.Printf("   ✅ Found %d builds in %s/%s", len(builds), pipeline.Org, pipeline.Name)
+
+	var jobs []Job
+	for _, build := range builds {
+		if window.contains(build.CreatedAt) {
+			jobs = append(jobs, buildkiteBuildToJob(pipeline, build))
+		}
+	}
+	return jobs, nil
+}
+
+// buildkiteStatus maps a build or job state to the dashboard's statuses.
+func buildkiteStatus(state string) string {
+	switch state {
+	case "passed":
+		return "success"
+	case "failed", "canceled", "timed_out", "broken", "expired", "skipped":
+		return "failed"
+	case "running", "failing", "canceling", "assigned", "accepted":
+		return "running"
+	default: // scheduled, blocked, waiting, not_run, limited, limiting
+		return "pending"
+	}
+}
+
+// buildkiteConclusion maps a finished build's state to GitHub's
+// conclusions, see Job.Conclusion.
+func buildkiteConclusion(state string) string {
+	switch state {
+	case "passed":
+		return "success"
+	case "failed", "broken":
+		return "failure"
+	case "canceled":
+		return "cancelled"
+	case "timed_out", "expired":
+		return "timed_out"
+	case "skipped", "not_run":
+		return "skipped"
+	}
+	return ""
+}
+
+func buildkiteBuildToJob(pipeline Pipeline, build buildkiteBuild) Job {
+	status := buildkiteStatus(build.State)
+	startedAt := build.CreatedAt
+	if build.StartedAt != nil {
+		startedAt = *build.StartedAt
+	}
+	end := clock()
+	if build.FinishedAt != nil {
+		end = *build.FinishedAt
+	}
+	name := build.Pipeline.Name
+	if name == "" {
+		name = pipeline.Name
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(pipeline.Org + "/" + pipeline.Name))
+
+	job := Job{
+		ID:           "BK-" + strings.SplitN(build.ID, "-", 2)[0],
+		Provider:     "buildkite",
+		Name:         fmt.Sprintf("%s #%d", name, build.Number),
+		Status:       status,
+		Conclusion:   buildkiteConclusion(build.State),
+		Pipeline:     pipeline.Name,
+		Branch:       build.Branch,
+		Duration:     formatDuration(startedAt, end),
+		Started:      formatTimeAgo(startedAt, defaultLocale),
+		Organization: pipeline.Org,
+		RunID:        build.Number,
+		HTMLURL:      build.WebURL,
+		CreatedAt:    build.CreatedAt,
+
+		StartedAt:       startedAt,
+		DurationSeconds: int64(end.Sub(startedAt).Seconds()),
+		WorkflowID:      int64(h.Sum32()),
+
+		// Builds held back by concurrency limits are "limited"
+		WaitingOnConcurrency: build.State == "limited",
+	}
+
+	// Builds come with their jobs, so progress and parallel legs are free
+	var completed, total int
+	for _, j := range build.Jobs {
+		if j.Type != "script" {
+			continue // wait steps, block steps and triggers
+		}
+		total++
+		if j.FinishedAt != nil {
+			completed++
+		}
+		if j.ParallelGroupTotal != nil && *j.ParallelGroupTotal > 1 && j.ParallelGroupIndex != nil && expandMatrix(status) {
+			leg := MatrixLeg{
+				Job:      j.Name,
+				Matrix:   fmt.Sprintf("%d/%d", *j.ParallelGroupIndex+1, *j.ParallelGroupTotal),
+				Status:   buildkiteStatus(j.State),
+				Duration: "N/A",
+				HTMLURL:  j.WebURL,
+			}
+			if j.StartedAt != nil {
+				legEnd := clock()
+				if j.FinishedAt != nil {
+					legEnd = *j.FinishedAt
+				}
+				leg.Duration = formatDuration(*j.StartedAt, legEnd)
+				leg.DurationSeconds = int64(legEnd.Sub(*j.StartedAt).Seconds())
+			}
+			job.MatrixLegs = append(job.MatrixLegs, leg)
+		}
+	}
+	if status == "running" && total > 0 {
+		job.StepsCompleted = &completed
+		job.StepsTotal = &total
+	}
+	return job
+}
+
+// GetLogs concatenates the logs of the build's script jobs.
+func (p *buildkiteProvider) GetLogs(ctx context.Context, pipeline Pipeline, number int64) (string, error) {
+	buildPath := fmt.Sprintf("/organizations/%s/pipelines/%s/builds/%d", url.PathEscape(pipeline.Org), url.PathEscape(pipeline.Name), number)
+	var build buildkiteBuild
+	err := p.get(ctx, buildPath, &build)
+	if isNotFound(err) {
+		return "", errLogsNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, job := range build.Jobs {
+		if job.Type != "script" {
+			continue
+		}
+		var jobLog struct {
+			Content string `json:"content"`
+		}
+		if err := p.get(ctx, buildPath+"/jobs/"+job.ID+"/log", &jobLog); err != nil && !isNotFound(err) {
+			return "", err
+		}
+		fmt.Fprintf(&out, "==> %s <==\n%s\n", job.Name, jobLog.Content)
+		if out.Len() >= maxLogBytes {
+			out.WriteString("... (truncated)\n")
+			break
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildkiteBuildToJob(t *testing.T) {
+	created := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	started, finished := created.Add(time.Minute), created.Add(6*time.Minute)
+	pipeline := Pipeline{Org: "acme", Name: "api"}
+
+	tests := []struct {
+		state          string
+		wantStatus     string
+		wantConclusion string
+		wantWaiting    bool
+	}{
+		{"passed", "success", "success", false},
+		{"broken", "failed", "failure", false},
+		{"canceled", "failed", "cancelled", false},
+		{"expired", "failed", "timed_out", false},
+		{"skipped", "failed", "skipped", false},
+		{"failing", "running", "", false},
+		{"limited", "pending", "", true},
+		{"blocked", "pending", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			build := buildkiteBuild{ID: "0190a1b2-c3d4-7e5f", Number: 8, State: tt.state, Branch: "main", CreatedAt: created, StartedAt: &started, FinishedAt: &finished}
+			job := buildkiteBuildToJob(pipeline, build)
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion || job.WaitingOnConcurrency != tt.wantWaiting {
+				t.Errorf("status, conclusion, waiting = %q, %q, %v, want %q, %q, %v",
+					job.Status, job.Conclusion, job.WaitingOnConcurrency, tt.wantStatus, tt.wantConclusion, tt.wantWaiting)
+			}
+			if job.ID != "BK-0190a1b2" || job.Name != "api #8" || !job.StartedAt.Equal(started) || job.DurationSeconds != 300 {
+				t.Errorf("job = %+v", job)
+			}
+		})
+	}
+}
+
+// Running builds come with their jobs: progress counts the script steps,
+// and parallel jobs become matrix legs.
+func TestBuildkiteBuildProgress(t *testing.T) {
+	defer func(expansion string) { matrixExpansion = expansion }(matrixExpansion)
+	matrixExpansion = "all"
+
+	created := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	finished := created.Add(2 * time.Minute)
+	index := func(i int) *int { return &i }
+	build := buildkiteBuild{ID: "0190a1b2-c3d4-7e5f", Number: 8, State: "running", CreatedAt: created, Jobs: []buildkiteJob{
+		{Type: "script", Name: "lint", State: "passed", StartedAt: &created, FinishedAt: &finished},
+		{Type: "waiter"},
+		{Type: "script", Name: "test", State: "passed", StartedAt: &created, FinishedAt: &finished, ParallelGroupIndex: index(0), ParallelGroupTotal: index(2)},
+		{Type: "script", Name: "test", State: "scheduled", ParallelGroupIndex: index(1), ParallelGroupTotal: index(2)},
+	}}
+	job := buildkiteBuildToJob(Pipeline{Org: "acme", Name: "api"}, build)
+
+	if job.StepsCompleted == nil || job.StepsTotal == nil || *job.StepsCompleted != 2 || *job.StepsTotal != 3 {
+		t.Errorf("steps = %v of %v, want 2 of 3", job.StepsCompleted, job.StepsTotal)
+	}
+	want := []MatrixLeg{
+		{Job: "test", Matrix: "1/2", Status: "success", Duration: formatDuration(created, finished), DurationSeconds: 120},
+		{Job: "test", Matrix: "2/2", Status: "pending", Duration: "N/A"},
+	}
+	if !reflect.DeepEqual(job.MatrixLegs, want) {
+		t.Errorf("matrix legs = %+v, want %+v", job.MatrixLegs, want)
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Snapshot is a fetched dashboard response together with the time it was
+// fetched. Snapshots are kept in the shared Store so every replica can serve
+// data fetched by any other replica.
+type Snapshot struct {
+	Response  DashboardResponse `json:"response"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	Debug     *DebugInfo        `json:"debug,omitempty"`
+	Orgs      []OrgSummary      `json:"orgs,omitempty"`    // per-organization rollups, see /api/orgs
+	Removed   []RemovedJob      `json:"removed,omitempty"` // runs dropped since earlier snapshots, see /api/dashboard/delta
+
+	Superseded DashboardStats `json:"superseded"` // earlier attempts of re-run jobs, added to the stats with ?attempts=all
+	Deduped    *DedupedStats  `json:"deduped,omitempty"`
+	Runners    *RunnerTally   `json:"runners,omitempty"` // with RUNNER_STATS, see /api/stats/runners
+}
+
+var (
+	store Store
+
+	refreshGroup singleflight.Group
+
+	// dashboardGroup coalesces concurrent requests for a period, so they
+	// share one look at the store and, when it's expired, one fetch.
+	// Filters apply to the shared snapshot per request, so the period is
+	// the whole key.
+	dashboardGroup singleflight.Group
+
+	// cacheTTL is how long a snapshot is served before it is re-fetched.
+	// Zero disables caching and fetches on every request. It can be changed
+	// at runtime, so it's read with currentCacheTTL.
+	cacheTTL = 60 * time.Second
+
+	// cacheStaleTTL is how long after cacheTTL an expired snapshot is still
+	// served while it is refreshed in the background (CACHE_STALE_TTL). Zero
+	// makes requests wait for the refresh.
+	cacheStaleTTL = 5 * time.Minute
+
+	// fetchLockTTL bounds how long a replica may hold the fetch lock for a
+	// period, so a crashed replica cannot block the others forever.
+	fetchLockTTL = 10 * time.Minute
+)
+
+func currentCacheTTL() time.Duration {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return cacheTTL
+}
+
+const (
+	snapshotRetention = 24 * time.Hour
+	lockPollInterval  = 1 * time.Second
+)
+
+func snapshotKey(period string) string {
+	return "dashboard:" + period
+}
+
+func loadSnapshot(ctx context.Context, period string) (*Snapshot, error) {
+	data, ok, err := store.Get(ctx, snapshotKey(period))
+	if err != nil || !ok {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	noteSnapshot(period, &snap)
+	return &snap, nil
+}
+
+func saveSnapshot(ctx context.Context, period string, snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	noteSnapshot(period, snap)
+	return store.Set(ctx, snapshotKey(period), data, snapshotRetention)
+}
+
+func isFresh(snap *Snapshot) bool {
+	return snap != nil && time.Since(snap.FetchedAt) < currentCacheTTL()
+}
+
+// servableStale reports whether an expired snapshot may still be served
+// while it's refreshed in the background.
+func servableStale(snap *Snapshot) bool {
+	return snap != nil && cacheStaleTTL > 0 && time.Since(snap.FetchedAt) < currentCacheTTL()+cacheStaleTTL
+}
+
+// snapshotSignals wake the long polls of /api/dashboard/delta when a new
+// snapshot of their period is fetched, so they don't have to poll the
+// cache, let alone fetch.
+var snapshotSignals = struct {
+	sync.Mutex
+	next map[string]*snapshotSignal
+}{next: make(map[string]*snapshotSignal)}
+
+// snapshotSignal is closed with the next snapshot of a period.
+type snapshotSignal struct {
+	done chan struct{}
+	snap *Snapshot // set before done is closed
+}
+
+// nextSnapshot returns the signal of the period's next snapshot.
+func nextSnapshot(period string) *snapshotSignal {
+	snapshotSignals.Lock()
+	defer snapshotSignals.Unlock()
+	sig, ok := snapshotSignals.next[period]
+	if !ok {
+		sig = &snapshotSignal{done: make(chan struct{})}
+		snapshotSignals.next[period] = sig
+	}
+	return sig
+}
+
+// announceSnapshot hands a new snapshot of the period to whoever waits
+// for it.
+func announceSnapshot(period string, snap *Snapshot) {
+	snapshotSignals.Lock()
+	sig, ok := snapshotSignals.next[period]
+	delete(snapshotSignals.next, period)
+	snapshotSignals.Unlock()
+	if ok {
+		sig.snap = snap
+		close(sig.done)
+	}
+}
+
+// backgroundRefreshes holds the periods being refreshed in the background,
+// so a burst of requests for an expired snapshot starts one refresh.
+var backgroundRefreshes sync.Map
+
+// refreshInBackground refreshes the period without anyone waiting for it.
+func refreshInBackground(period string) {
+	if _, running := backgroundRefreshes.LoadOrStore(period, true); running {
+		return
+	}
+	go func() {
+		defer backgroundRefreshes.Delete(period)
+		if _, _, err := refreshDashboard(withRefreshTrigger(context.Background(), "background"), period); err != nil {
+			log.Printf("⚠️  Background refresh of %s failed: %v", period, err)
+		}
+	}()
+}
+
+// getDashboard returns a dashboard snapshot for the period, fetching from
+// GitHub only when no fresh snapshot exists. A snapshot that expired less
+// than cacheStaleTTL ago is returned as is and refreshed in the background.
+func getDashboard(ctx context.Context, period string) (*Snapshot, error) {
+	leader := false
+	v, err, _ := dashboardGroup.Do(period, func() (interface{}, error) {
+		leader = true
+		return loadDashboard(ctx, period, time.Time{})
+	})
+	if !leader {
+		countCacheLookup(period, "coalesced")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Snapshot), nil
+}
+
+// refreshDashboard forces a re-fetch of the period. Concurrent refreshes of
+// the same period share a single fetch; shared reports whether this caller
+// joined a fetch started by someone else.
+func refreshDashboard(ctx context.Context, period string) (snap *Snapshot, shared bool, err error) {
+	requestedAt := time.Now()
+	v, err, shared := refreshGroup.Do(period, func() (interface{}, error) {
+		return loadDashboard(ctx, period, requestedAt)
+	})
+	if err != nil {
+		return nil, shared, err
+	}
+	return v.(*Snapshot), shared, nil
+}
+
+// loadDashboard returns a fresh snapshot fetched no earlier than notBefore.
+// Only one replica fetches a given period at a time; the others wait for its
+// result instead of crawling GitHub in parallel.
+func loadDashboard(ctx context.Context, period string, notBefore time.Time) (*Snapshot, error) {
+	// Requests are counted by how they were served, refreshes aren't
+	lookup := "miss"
+	if notBefore.IsZero() {
+		defer func() { countCacheLookup(period, lookup) }()
+	}
+
+	if currentCacheTTL() <= 0 {
+		return fetchSnapshot(ctx, period)
+	}
+
+	usable := func(snap *Snapshot) bool {
+		return isFresh(snap) && !snap.FetchedAt.Before(notBefore)
+	}
+
+	snap, err := loadSnapshot(ctx, period)
+	if err != nil {
+		log.Printf("⚠️  Error reading snapshot for %s from store: %v", period, err)
+	}
+	if usable(snap) {
+		lookup = "hit"
+		return snap, nil
+	}
+	if notBefore.IsZero() && servableStale(snap) {
+		lookup = "stale"
+		refreshInBackground(period)
+		return snap, nil
+	}
+
+	for {
+		release, ok, err := store.Lock(ctx, "lock:"+snapshotKey(period), fetchLockTTL)
+		if err != nil {
+			log.Printf("⚠️  Error acquiring fetch lock for %s: %v, fetching without lock", period, err)
+			return fetchSnapshot(ctx, period)
+		}
+		if ok {
+			defer release()
+
+			// Another replica may have finished a fetch while we were waiting
+			if snap, err := loadSnapshot(ctx, period); err == nil && usable(snap) {
+				return snap, nil
+			}
+
+			fresh, err := fetchSnapshot(ctx, period)
+			// Old data marked stale beats no data, unless a refresh was
+			// explicitly asked for
+			if err != nil && snap != nil && notBefore.IsZero() {
+				log.Printf("⚠️  Serving stale snapshot for %s from %v: %v", period, snap.FetchedAt.Format(time.RFC3339), err)
+				lookup = "stale"
+				return snap, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := saveSnapshot(ctx, period, fresh); err != nil {
+				log.Printf("⚠️  Error saving snapshot for %s to store: %v", period, err)
+			}
+			persistSnapshot(period, fresh)
+			return fresh, nil
+		}
+
+		// Someone else is fetching this period. Serve the previous snapshot
+		// if there is one, otherwise wait for their result.
+		if snap != nil && notBefore.IsZero() {
+			lookup = "stale"
+			return snap, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+		if snap, err := loadSnapshot(ctx, period); err == nil && usable(snap) {
+			return snap, nil
+		}
+	}
+}
+
+// fetchSnapshot fetches workflow runs from GitHub and builds the dashboard
+// response for the period.
+func fetchSnapshot(ctx context.Context, period string) (*Snapshot, error) {
+	startTime := time.Now()
+	collector := newJobCollector(maxJobs)
+	calls := newCallCounter()
+	ctx = withCallCounter(ctx, calls)
+	startProgress(period)
+	rateLimit, orgs, err := fetchWorkflowRuns(ctx, period, collector)
+	finishProgress(period, err)
+	duration := time.Since(startTime)
+	countRefresh(ctx, period, duration, err)
+
+	if err != nil {
+		log.Printf("❌ Error fetching workflow runs: %v (took %v)", err, duration)
+		return nil, err
+	}
+
+	snap := buildSnapshot(collector, rateLimit)
+	snap.Debug = debugInfo(calls)
+	snap.Orgs = orgs
+	previous := trackChanges(ctx, period, snap)
+	notifyFinishedRuns(previous, snap)
+	recordHistory(snap)
+	recordWeeklySummary(snap, collector.dropped)
+	publishHealth(period, snap)
+	stats := snap.Response.Stats
+	log.Printf("📈 Dashboard stats: Success=%d, Failed=%d, Running=%d, Pending=%d, Maintenance=%d, Total=%d (took %v, %d API calls)",
+		stats.Success, stats.Failed, stats.Running, stats.Pending, stats.Maintenance, stats.Total, duration, snap.Debug.TotalAPICalls)
+	if forecast := forecastRefresh(period, snap); forecast != nil && !forecast.Sufficient {
+		log.Printf("⚠️  Rate limit forecast for %s: %s", period, forecast.Warning)
+	}
+	announceSnapshot(period, snap)
+	return snap, nil
+}
+
+// buildSnapshot turns the collected jobs into a dashboard snapshot.
+func buildSnapshot(collector *jobCollector, rateLimit *RateLimitInfo) *Snapshot {
+	stats := collector.stats
+	truncated := collector.truncated
+	jobs := collector.result()
+	if !collector.prepared {
+		prepareJobs(jobs)
+	}
+	if truncated {
+		log.Printf("✂️  Job list truncated to the newest %d of %d runs (MAX_JOBS)", len(jobs), stats.Total)
+	}
+
+	// Set default rate limit if nil
+	if rateLimit == nil {
+		rateLimit = &RateLimitInfo{
+			Remaining: 5000,
+			Limit:     5000,
+			ResetAt:   time.Now().Add(1 * time.Hour),
+		}
+	}
+
+	snap := &Snapshot{
+		Response: DashboardResponse{
+			Stats:     stats,
+			Jobs:      jobs,
+			RateLimit: *rateLimit,
+			Truncated: truncated,
+			Partial:   collector.partial,
+			Errors:    collector.errors,
+		},
+		FetchedAt:  time.Now(),
+		Superseded: collector.superseded,
+		Deduped:    collector.deduped.result(),
+	}
+	if runnerStats {
+		snap.Runners = &collector.runners
+	}
+	return snap
+}
+
+// prepareJobs adds what's derived from the runs of each repository. It
+// must run once per job: ArgoCD statuses and plugin tags are appended.
+func prepareJobs(jobs []Job) {
+	addMedianDurations(jobs)
+	linkConcurrencyWaits(jobs)
+	addArgoCDStatus(jobs)
+	enrichJobs(jobs)
+}
+
+type RefreshResponse struct {
+	Period         string    `json:"period"`
+	FetchedAt      time.Time `json:"fetched_at"`
+	DataAgeSeconds int       `json:"data_age_seconds"`
+	Coalesced      bool      `json:"coalesced"` // joined a refresh already in progress
+}
+
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("🔄 Refresh requested for period %s from %s", period, r.RemoteAddr)
+	snap, shared, err := refreshDashboard(withRefreshTrigger(context.Background(), "refresh"), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error refreshing workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(RefreshResponse{
+		Period:         period,
+		FetchedAt:      snap.FetchedAt,
+		DataAgeSeconds: int(time.Since(snap.FetchedAt).Seconds()),
+		Coalesced:      shared,
+	})
+}
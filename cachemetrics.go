@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache effectiveness, for tuning CACHE_TTL, CACHE_STALE_TTL and
+// POLL_INTERVAL: how requests for dashboard data were served, how long the
+// fetches behind them took, and how many conditional GitHub API requests
+// came back 304 Not Modified.
+
+type cacheLookupKey struct {
+	period string
+	result string // hit, stale (served while refreshed in the background), miss (waited for a fetch) or coalesced (joined another request)
+}
+
+type refreshKey struct {
+	period  string
+	trigger string // request, refresh, background, poll or prewarm
+	result  string // ok or error
+}
+
+type refreshTimes struct {
+	count   int
+	seconds float64
+}
+
+var cacheStats = struct {
+	sync.Mutex
+	lookups     map[cacheLookupKey]int
+	refreshes   map[refreshKey]*refreshTimes
+	conditional map[bool]int // by whether it came back 304
+}{lookups: make(map[cacheLookupKey]int), refreshes: make(map[refreshKey]*refreshTimes), conditional: make(map[bool]int)}
+
+func countCacheLookup(period, result string) {
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+	cacheStats.lookups[cacheLookupKey{period, result}]++
+}
+
+type refreshTriggerKey struct{}
+
+// withRefreshTrigger labels the fetches made with ctx by what started them.
+func withRefreshTrigger(ctx context.Context, trigger string) context.Context {
+	return context.WithValue(ctx, refreshTriggerKey{}, trigger)
+}
+
+// countRefresh records a fetch of the period that took duration.
+func countRefresh(ctx context.Context, period string, duration time.Duration, err error) {
+	trigger, ok := ctx.Value(refreshTriggerKey{}).(string)
+	if !ok {
+		trigger = "request"
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+	key := refreshKey{period, trigger, result}
+	times := cacheStats.refreshes[key]
+	if times == nil {
+		times = &refreshTimes{}
+		cacheStats.refreshes[key] = times
+	}
+	times.count++
+	times.seconds += duration.Seconds()
+}
+
+// countConditionalRequest records a GitHub API request sent with an ETag
+// or a date to compare against.
+func countConditionalRequest(req *http.Request, resp *http.Response) {
+	if req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		return
+	}
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+	cacheStats.conditional[resp != nil && resp.StatusCode == http.StatusNotModified]++
+}
+
+// writeCacheMetrics writes the cache counters in the Prometheus text format.
+func writeCacheMetrics(w io.Writer) {
+	cacheStats.Lock()
+	defer cacheStats.Unlock()
+
+	lookups := make([]cacheLookupKey, 0, len(cacheStats.lookups))
+	for key := range cacheStats.lookups {
+		lookups = append(lookups, key)
+	}
+	sort.Slice(lookups, func(i, j int) bool {
+		if lookups[i].period != lookups[j].period {
+			return lookups[i].period < lookups[j].period
+		}
+		return lookups[i].result < lookups[j].result
+	})
+	fmt.Fprintln(w, "# HELP dashboard_cache_requests_total Requests for dashboard data by period and how they were served (hit, stale, miss).")
+	fmt.Fprintln(w, "# TYPE dashboard_cache_requests_total counter")
+	for _, key := range lookups {
+		fmt.Fprintf(w, "dashboard_cache_requests_total{period=%q,result=%q} %d\n", key.period, key.result, cacheStats.lookups[key])
+	}
+
+	refreshes := make([]refreshKey, 0, len(cacheStats.refreshes))
+	for key := range cacheStats.refreshes {
+		refreshes = append(refreshes, key)
+	}
+	sort.Slice(refreshes, func(i, j int) bool {
+		a, b := refreshes[i], refreshes[j]
+		if a.period != b.period {
+			return a.period < b.period
+		}
+		if a.trigger != b.trigger {
+			return a.trigger < b.trigger
+		}
+		return a.result < b.result
+	})
+	fmt.Fprintln(w, "# HELP dashboard_refresh_duration_seconds Fetches of dashboard data by period, what started them and result.")
+	fmt.Fprintln(w, "# TYPE dashboard_refresh_duration_seconds summary")
+	for _, key := range refreshes {
+		labels := fmt.Sprintf("period=%q,trigger=%q,result=%q", key.period, key.trigger, key.result)
+		fmt.Fprintf(w, "dashboard_refresh_duration_seconds_sum{%s} %g\n", labels, cacheStats.refreshes[key].seconds)
+		fmt.Fprintf(w, "dashboard_refresh_duration_seconds_count{%s} %d\n", labels, cacheStats.refreshes[key].count)
+	}
+
+	fmt.Fprintln(w, "# HELP github_conditional_requests_total Conditional GitHub API requests by whether they came back 304 Not Modified.")
+	fmt.Fprintln(w, "# TYPE github_conditional_requests_total counter")
+	fmt.Fprintf(w, "github_conditional_requests_total{result=\"not_modified\"} %d\n", cacheStats.conditional[true])
+	fmt.Fprintf(w, "github_conditional_requests_total{result=\"modified\"} %d\n", cacheStats.conditional[false])
+}
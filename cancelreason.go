@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Cancelled runs count as failed, but why they were cancelled matters:
+// a run superseded by a newer one in its concurrency group is routine, a
+// run cancelled by someone or by hitting timeout-minutes isn't. GitHub
+// doesn't say, so the reason is inferred:
+//
+//	superseded  a newer run of the same workflow and branch was created
+//	            while it ran, as cancel-in-progress does
+//	timeout     one of its jobs was cancelled after running as long as its
+//	            timeout-minutes (default 360)
+//	user        neither, so someone (or the API) cancelled it
+//	unknown     its jobs couldn't be checked, e.g. with little budget left
+
+// supersedeGrace is how long after a run ended a newer run may have been
+// created and still count as the reason it was cancelled.
+const supersedeGrace = time.Minute
+
+// defaultJobTimeout is GitHub's timeout-minutes when a job sets none.
+const defaultJobTimeout = 360 * time.Minute
+
+// jobCancelReasons caches the reasons read from the jobs of cancelled runs,
+// which never change, by "org/repo/run_id/attempt".
+var jobCancelReasons = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+const maxCachedCancelReasons = 5000
+
+func cancelled(job Job) bool {
+	return job.Conclusion == "cancelled" || job.Conclusion == "timed_out"
+}
+
+// addCancelReasons sets CancelReason on the cancelled jobs of one
+// repository.
+func addCancelReasons(ctx context.Context, jobs []Job) {
+	for i := range jobs {
+		job := &jobs[i]
+		if !cancelled(*job) {
+			continue
+		}
+		switch {
+		case job.Conclusion == "timed_out":
+			job.CancelReason = "timeout"
+		case supersededBy(*job, jobs) != nil:
+			job.CancelReason = "superseded"
+		case budget.low():
+			job.CancelReason = "unknown"
+		default:
+			reason, err := jobCancelReason(ctx, *job)
+			if err != nil {
+				log.Printf("   ⚠️  Error checking why run %d in %s/%s was cancelled: %v", job.RunID, job.Organization, job.Pipeline, err)
+				reason = "unknown"
+			}
+			job.CancelReason = reason
+		}
+	}
+}
+
+// jobCancelReason tells a run cancelled by a timeout from one cancelled by
+// a user, from the run's jobs.
+func jobCancelReason(ctx context.Context, job Job) (string, error) {
+	key := fmt.Sprintf("%s/%s/%d/%d", job.Organization, job.Pipeline, job.RunID, job.Attempt)
+	jobCancelReasons.Lock()
+	reason, ok := jobCancelReasons.m[key]
+	jobCancelReasons.Unlock()
+	if ok {
+		return reason, nil
+	}
+
+	timedOut, err := ranIntoTimeout(ctx, job)
+	if err != nil {
+		return "", err
+	}
+	reason = "user"
+	if timedOut {
+		reason = "timeout"
+	}
+
+	jobCancelReasons.Lock()
+	if len(jobCancelReasons.m) >= maxCachedCancelReasons {
+		jobCancelReasons.m = make(map[string]string)
+	}
+	jobCancelReasons.m[key] = reason
+	jobCancelReasons.Unlock()
+	return reason, nil
+}
+
+// supersededBy returns the run of the same workflow and branch that was
+// created while the cancelled job ran, if any.
+func supersededBy(job Job, jobs []Job) *Job {
+	end := job.StartedAt.Add(time.Duration(job.DurationSeconds)*time.Second + supersedeGrace)
+	for i := range jobs {
+		other := &jobs[i]
+		if other.RunID == job.RunID || other.WorkflowID != job.WorkflowID || other.Branch != job.Branch {
+			continue
+		}
+		if other.CreatedAt.After(job.CreatedAt) && !other.CreatedAt.After(end) {
+			return other
+		}
+	}
+	return nil
+}
+
+// ranIntoTimeout reports whether a job of the run was cancelled after
+// running for its timeout-minutes.
+func ranIntoTimeout(ctx context.Context, job Job) (bool, error) {
+	runJobs, err := fetchRunJobs(ctx, job.Organization, job.Pipeline, job.RunID)
+	if err != nil {
+		return false, err
+	}
+	var timeouts map[string]time.Duration
+	for _, runJob := range runJobs {
+		if runJob.GetConclusion() != "cancelled" || runJob.StartedAt == nil || runJob.CompletedAt == nil {
+			continue
+		}
+		if timeouts == nil {
+			timeouts = jobTimeouts(ctx, job)
+		}
+		limit, ok := timeouts[baseJobName(runJob)]
+		if !ok {
+			limit = defaultJobTimeout
+		}
+		if runJob.CompletedAt.Sub(runJob.StartedAt.Time) >= limit-supersedeGrace {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// jobTimeouts returns the timeout-minutes of the jobs of the run's workflow
+// file by job ID and name. Jobs without one, or whose workflow file can't
+// be read, get GitHub's default.
+func jobTimeouts(ctx context.Context, job Job) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	if job.WorkflowID == 0 || budget.low() {
+		return timeouts
+	}
+	path, err := fetchWorkflowPath(ctx, job.Organization, job.Pipeline, job.WorkflowID)
+	if err != nil {
+		return timeouts
+	}
+	file, err := fetchWorkflowFile(ctx, job.Organization, job.Pipeline, path, job.HeadSHA)
+	if err != nil {
+		return timeouts
+	}
+	for id, definition := range file.Jobs {
+		minutes, err := strconv.ParseFloat(strings.TrimSpace(definition.TimeoutMinutes), 64)
+		if err != nil || minutes <= 0 {
+			continue
+		}
+		timeouts[id] = time.Duration(minutes * float64(time.Minute))
+		if definition.Name != "" {
+			timeouts[definition.Name] = timeouts[id]
+		}
+	}
+	return timeouts
+}
+
+// baseJobName strips the matrix values GitHub appends to a job's name,
+// e.g. "test (ubuntu-latest, 20)".
+func baseJobName(job *github.WorkflowJob) string {
+	name, _, _ := strings.Cut(job.GetName(), " (")
+	return name
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// circleciProvider fetches CircleCI workflows through the v2 API. An org
+// slug such as "gh/acme" plays the role of an organization, projects that
+// of repositories, and every workflow of a pipeline becomes a Job.
+type circleciProvider struct {
+	baseURL string
+	webURL  string // links to workflows
+	token   string
+	client  *http.Client
+}
+
+// circleciMaxPages caps how many pages of pipelines are read per listing.
+const circleciMaxPages = 5
+
+// loadCircleCIConfig adds a source for every org slug in CIRCLECI_ORGS.
+func loadCircleCIConfig() {
+	orgs := splitList(os.Getenv("CIRCLECI_ORGS"))
+	if len(orgs) == 0 {
+		return
+	}
+	// CircleCI server serves the web app on the same host as the API,
+	// circleci.com on app.circleci.com
+	baseURL := strings.TrimRight(os.Getenv("CIRCLECI_URL"), "/")
+	webURL := baseURL
+	if baseURL == "" {
+		baseURL, webURL = "https://circleci.com", "https://app.circleci.com"
+	}
+
+	provider := &circleciProvider{
+		baseURL: baseURL + "/api/v2",
+		webURL:  webURL,
+		token:   os.Getenv("CIRCLECI_TOKEN"),
+		client:  newHTTPClient(),
+	}
+	for _, org := range orgs {
+		sources = append(sources, source{Provider: provider, Org: org})
+	}
+	log.Printf("⭕ CircleCI enabled: %d organization(s)", len(orgs))
+}
+
+func (p *circleciProvider) Name() string { return "circleci" }
+
+func (p *circleciProvider) auth(req *http.Request) {
+	if p.token != "" {
+		req.Header.Set("Circle-Token", p.token)
+	}
+}
+
+type circleciPipeline struct {
+	ID          string    `json:"id"`
+	Number      int64     `json:"number"`
+	ProjectSlug string    `json:"project_slug"`
+	CreatedAt   time.Time `json:"created_at"`
+	VCS         struct {
+		Branch string `json:"branch"`
+		Tag    string `json:"tag"`
+	} `json:"vcs"`
+}
+
+type circleciWorkflow struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+}
+
+type circleciJob struct {
+	Name      string     `json:"name"`
+	JobNumber int64      `json:"job_number"`
+	Status    string     `json:"status"`
+	StartedAt *time.Time `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+}
+
+// listPipelines reads pipelines from a paginated endpoint until they are
+// older than the window.
+func (p *circleciProvider) listPipelines(ctx context.Context, window fetchWindow, path string, query url.Values) ([]circleciPipeline, error) {
+	var pipelines []circleciPipeline
+	for page := 0; page < circleciMaxPages; page++ {
+		var resp struct {
+			Items         []circleciPipeline `json:"items"`
+			NextPageToken string             `json:"next_page_token"`
+		}
+		pageURL := p.baseURL + path
+		if len(query) > 0 {
+			pageURL += "?" + query.Encode()
+		}
+		if _, err := apiGetJSON(ctx, p.client, pageURL, p.auth, &resp); err != nil {
+			return nil, err
+		}
+
+		older := false
+		for _, pipeline := range resp.Items {
+			if pipeline.CreatedAt.Before(window.Start) {
+				older = true
+				continue
+			}
+			pipelines = append(pipelines, pipeline)
+		}
+		if older || resp.NextPageToken == "" {
+			break
+		}
+		query.Set("page-token", resp.NextPageToken)
+	}
+	return pipelines, nil
+}
+
+// ListPipelines returns the org's projects that ran pipelines during the
+// window, most recently active first.
+func (p *circleciProvider) ListPipelines(ctx context.Context, window fetchWindow, org string) ([]Pipeline, error) {
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	defer cancel()
+
+	pipelines, err := p.listPipelines(listCtx, window, "/pipeline", url.Values{"org-slug": {org}})
+	if err != nil {
+		return nil, err
+	}
+
+	lastRun := make(map[string]time.Time)
+	for _, pipeline := range pipelines {
+		name := strings.TrimPrefix(pipeline.ProjectSlug, org+"/")
+		if pipeline.CreatedAt.After(lastRun[name]) {
+			lastRun[name] = pipeline.CreatedAt
+		}
+	}
+	projects := make([]Pipeline, 0, len(lastRun))
+	for name := range lastRun {
+		projects = append(projects, Pipeline{Org: org, Name: name})
+	}
+	sort.Slice(projects, func(i, j int) bool { return lastRun[projects[i].Name].After(lastRun[projects[j].Name]) })
+
+	log.Printf("✅ Found %d CircleCI projects active %s in %s", len(projects), window.name(), org)
+	return projects, nil
+}
+
+// ListRuns returns the workflows of the project's pipelines in the window.
+func (p *circleciProvider) ListRuns(ctx context.Context, window fetchWindow, project Pipeline) ([]Job, error) {
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+
+	slug := project.Org + "/" + project.Name
+	pipelines, err := p.listPipelines(runCtx, window, "/project/"+slug+"/pipeline", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("   ✅ Found %d pipelines in %s", len(pipelines), slug)
+
+	var jobs []Job
+	for _, pipeline := range pipelines {
+		var workflows struct {
+			Items []circleciWorkflow `json:"items"`
+		}
+		if _, err := apiGetJSON(runCtx, p.client, p.baseURL+"/pipeline/"+pipeline.ID+"/workflow", p.auth, &workflows); err != nil {
+			log.Printf("   ⚠️  Error fetching workflows of pipeline %d in %s: %v", pipeline.Number, slug, err)
+			continue
+		}
+		for _, workflow := range workflows.Items {
+			job := p.workflowToJob(project, pipeline, workflow)
+			if job.Status == "running" {
+				if err := p.addProgress(runCtx, workflow.ID, &job); err != nil {
+					log.Printf("   ⚠️  Error fetching jobs of workflow %s in %s: %v", workflow.ID, slug, err)
+				}
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// circleciStatus maps a workflow or job status to the dashboard's statuses.
+func circleciStatus(status string) string {
+	switch status {
+	case "success":
+		return "success"
+	case "failed", "error", "canceled", "unauthorized", "infrastructure_fail", "timedout":
+		return "failed"
+	case "running", "failing":
+		return "running"
+	default: // on_hold, not_run, queued, blocked
+		return "pending"
+	}
+}
+
+// circleciConclusion maps a finished workflow's status to GitHub's
+// conclusions, see Job.Conclusion.
+func circleciConclusion(status string) string {
+	switch status {
+	case "success":
+		return "success"
+	case "failed", "error", "unauthorized", "infrastructure_fail":
+		return "failure"
+	case "canceled":
+		return "cancelled"
+	case "timedout":
+		return "timed_out"
+	case "not_run":
+		return "skipped"
+	}
+	return ""
+}
+
+func (p *circleciProvider) workflowToJob(project Pipeline, pipeline circleciPipeline, workflow circleciWorkflow) Job {
+	status := circleciStatus(workflow.Status)
+	end := clock()
+	if workflow.StoppedAt != nil {
+		end = *workflow.StoppedAt
+	}
+	branch := pipeline.VCS.Branch
+	if branch == "" {
+		branch = pipeline.VCS.Tag
+	}
+	if branch == "" {
+		branch = "N/A"
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(project.Org + "/" + project.Name + "/" + workflow.Name))
+
+	job := Job{
+		ID:           "CC-" + strings.SplitN(workflow.ID, "-", 2)[0],
+		Provider:     "circleci",
+		Name:         fmt.Sprintf("%s #%d", workflow.Name, pipeline.Number),
+		Status:       status,
+		Conclusion:   circleciConclusion(workflow.Status),
+		Pipeline:     project.Name,
+		Branch:       branch,
+		Duration:     formatDuration(workflow.CreatedAt, end),
+		Started:      formatTimeAgo(workflow.CreatedAt, defaultLocale),
+		Organization: project.Org,
+		RunID:        pipeline.Number,
+		HTMLURL:      fmt.Sprintf("%s/pipelines/%s/%d/workflows/%s", p.webURL, pipeline.ProjectSlug, pipeline.Number, workflow.ID),
+		CreatedAt:    pipeline.CreatedAt,
+
+		StartedAt:       workflow.CreatedAt,
+		DurationSeconds: int64(end.Sub(workflow.CreatedAt).Seconds()),
+		WorkflowID:      int64(h.Sum32()),
+	}
+	return job
+}
+
+func (p *circleciProvider) listJobs(ctx context.Context, workflowID string) ([]circleciJob, error) {
+	var resp struct {
+		Items []circleciJob `json:"items"`
+	}
+	_, err := apiGetJSON(ctx, p.client, p.baseURL+"/workflow/"+workflowID+"/job", p.auth, &resp)
+	return resp.Items, err
+}
+
+// addProgress counts the finished jobs of a running workflow, since the v2
+// API has no step details.
+func (p *circleciProvider) addProgress(ctx context.Context, workflowID string, job *Job) error {
+	jobs, err := p.listJobs(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	completed, total := 0, len(jobs)
+	for _, j := range jobs {
+		if j.StoppedAt != nil {
+			completed++
+		}
+	}
+	job.StepsCompleted = &completed
+	job.StepsTotal = &total
+	return nil
+}
+
+// GetLogs collects the step output of every job of the pipeline. The v2
+// API has no logs endpoint, so the output comes from the v1.1 job details.
+func (p *circleciProvider) GetLogs(ctx context.Context, project Pipeline, number int64) (string, error) {
+	slug := project.Org + "/" + project.Name
+	var pipeline circleciPipeline
+	_, err := apiGetJSON(ctx, p.client, fmt.Sprintf("%s/project/%s/pipeline/%d", p.baseURL, slug, number), p.auth, &pipeline)
+	if isNotFound(err) {
+		return "", errLogsNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	var workflows struct {
+		Items []circleciWorkflow `json:"items"`
+	}
+	if _, err := apiGetJSON(ctx, p.client, p.baseURL+"/pipeline/"+pipeline.ID+"/workflow", p.auth, &workflows); err != nil {
+		return "", err
+	}
+
+	v1 := strings.TrimSuffix(p.baseURL, "/v2") + "/v1.1/project/" + slug
+	var out strings.Builder
+	for _, workflow := range workflows.Items {
+		jobs, err := p.listJobs(ctx, workflow.ID)
+		if err != nil {
+			return "", err
+		}
+		for _, job := range jobs {
+			if job.JobNumber == 0 {
+				continue // approval jobs have no output
+			}
+			var details struct {
+				Steps []struct {
+					Name    string `json:"name"`
+					Actions []struct {
+						OutputURL string `json:"output_url"`
+					} `json:"actions"`
+				} `json:"steps"`
+			}
+			if _, err := apiGetJSON(ctx, p.client, fmt.Sprintf("%s/%d", v1, job.JobNumber), p.auth, &details); err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&out, "==> %s / %s <==\n", workflow.Name, job.Name)
+			for _, step := range details.Steps {
+				fmt.Fprintf(&out, "--- %s\n", step.Name)
+				for _, action := range step.Actions {
+					if action.OutputURL == "" {
+						continue
+					}
+					// output_url is pre-signed, so it's fetched without the token
+					var messages []struct {
+						Message string `json:"message"`
+					}
+					if _, err := apiGetJSON(ctx, p.client, action.OutputURL, nil, &messages); err != nil {
+						return "", err
+					}
+					for _, m := range messages {
+						out.WriteString(m.Message)
+					}
+				}
+				if out.Len() >= maxLogBytes {
+					out.WriteString("\n... (truncated)\n")
+					return out.String(), nil
+				}
+			}
+		}
+	}
+	return out.String(), nil
+}
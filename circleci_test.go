@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircleCIWorkflowToJob(t *testing.T) {
+	created := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	stopped := created.Add(4 * time.Minute)
+	project := Pipeline{Org: "gh/acme", Name: "api"}
+
+	tests := []struct {
+		name           string
+		status         string
+		branch, tag    string
+		wantStatus     string
+		wantConclusion string
+		wantBranch     string
+	}{
+		{name: "success", status: "success", branch: "main", wantStatus: "success", wantConclusion: "success", wantBranch: "main"},
+		{name: "infrastructure failure", status: "infrastructure_fail", branch: "main", wantStatus: "failed", wantConclusion: "failure", wantBranch: "main"},
+		{name: "timed out", status: "timedout", branch: "main", wantStatus: "failed", wantConclusion: "timed_out", wantBranch: "main"},
+		{name: "canceled", status: "canceled", branch: "main", wantStatus: "failed", wantConclusion: "cancelled", wantBranch: "main"},
+		{name: "failing is still running", status: "failing", branch: "main", wantStatus: "running", wantBranch: "main"},
+		{name: "on hold", status: "on_hold", branch: "main", wantStatus: "pending", wantBranch: "main"},
+		{name: "not run", status: "not_run", branch: "main", wantStatus: "pending", wantConclusion: "skipped", wantBranch: "main"},
+		{name: "tag", status: "success", tag: "v1.2.0", wantStatus: "success", wantConclusion: "success", wantBranch: "v1.2.0"},
+		{name: "no branch", status: "success", wantStatus: "success", wantConclusion: "success", wantBranch: "N/A"},
+	}
+	p := &circleciProvider{webURL: "https://app.circleci.com"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := circleciPipeline{ID: "p-1", Number: 31, ProjectSlug: "gh/acme/api", CreatedAt: created}
+			pipeline.VCS.Branch, pipeline.VCS.Tag = tt.branch, tt.tag
+			workflow := circleciWorkflow{ID: "5034460f-c7c4-4c43-9457-de07e2029e7b", Name: "build", Status: tt.status, CreatedAt: created}
+			if tt.wantConclusion != "" {
+				workflow.StoppedAt = &stopped
+			}
+
+			job := p.workflowToJob(project, pipeline, workflow)
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion || job.Branch != tt.wantBranch {
+				t.Errorf("status, conclusion, branch = %q, %q, %q, want %q, %q, %q",
+					job.Status, job.Conclusion, job.Branch, tt.wantStatus, tt.wantConclusion, tt.wantBranch)
+			}
+			if job.ID != "CC-5034460f" || job.Name != "build #31" || job.RunID != 31 {
+				t.Errorf("job = %+v", job)
+			}
+			if want := "https://app.circleci.com/pipelines/gh/acme/api/31/workflows/5034460f-c7c4-4c43-9457-de07e2029e7b"; job.HTMLURL != want {
+				t.Errorf("URL = %q, want %q", job.HTMLURL, want)
+			}
+			if workflow.StoppedAt != nil && job.DurationSeconds != 240 {
+				t.Errorf("duration = %ds, want until the workflow stopped", job.DurationSeconds)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// CODEOWNERS ownership: every run gets the owners of its workflow file, as
+// the repository's CODEOWNERS assigns them, so failures can be filtered
+// and routed per team (OWNER_ALERT_TARGETS, see alerts.go).
+
+// codeownersEnabled turns on reading CODEOWNERS (CODEOWNERS_ENABLED), which
+// costs up to four calls per repository per codeownersTTL.
+var codeownersEnabled bool
+
+const codeownersTTL = time.Hour
+
+// codeownersPaths are where GitHub looks for the file, in order.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+type codeownersFile struct {
+	rules     []codeownersRule
+	paths     map[int64]string // workflow ID -> file; runs don't carry their path
+	fetchedAt time.Time
+}
+
+var codeowners = struct {
+	sync.Mutex
+	repos map[string]codeownersFile
+}{repos: make(map[string]codeownersFile)}
+
+func loadCodeownersConfig() {
+	codeownersEnabled = os.Getenv("CODEOWNERS_ENABLED") == "true"
+	if codeownersEnabled {
+		log.Printf("👥 CODEOWNERS ownership enabled")
+	}
+}
+
+// parseCodeowners reads the rules of a CODEOWNERS file. Lines without
+// owners are kept: they make a path unowned again.
+func parseCodeowners(content string) []codeownersRule {
+	var rules []codeownersRule
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern, err := regexp.Compile(codeownersPattern(strings.ReplaceAll(fields[0], `\#`, "#")))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return rules
+}
+
+// codeownersPattern translates a CODEOWNERS (gitignore-style) pattern into
+// a regular expression over repository paths. A pattern with a slash
+// other than a trailing one is anchored at the root; a directory owns
+// everything below it, except that "dir/*" stops at direct children.
+func codeownersPattern(pattern string) string {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	shallow := strings.HasSuffix(pattern, "/*") && !strings.HasSuffix(pattern, "**/*")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	switch {
+	case dir:
+		re.WriteString("/.*")
+	case !shallow:
+		re.WriteString("(?:/.*)?")
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// ownersOf returns the owners of a path: those of the last matching rule.
+func ownersOf(rules []codeownersRule, path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.MatchString(path) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// repoCodeowners returns the CODEOWNERS rules of a repository's default
+// branch and the paths of its workflows, cached for codeownersTTL. A
+// repository without the file has no rules.
+func repoCodeowners(ctx context.Context, org, repo string) (codeownersFile, error) {
+	key := org + "/" + repo
+	codeowners.Lock()
+	file, ok := codeowners.repos[key]
+	codeowners.Unlock()
+	if ok && clock().Sub(file.fetchedAt) < codeownersTTL {
+		return file, nil
+	}
+
+	file = codeownersFile{paths: make(map[int64]string), fetchedAt: clock()}
+	if err := budget.acquire(ctx); err != nil {
+		return file, err
+	}
+	listCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	workflows, resp, err := githubClient.Actions.ListWorkflows(listCtx, org, repo, &github.ListOptions{PerPage: 100})
+	cancel()
+	budget.update(resp)
+	if err != nil {
+		return file, err
+	}
+	for _, workflow := range workflows.Workflows {
+		file.paths[workflow.GetID()] = workflow.GetPath()
+	}
+
+	for _, path := range codeownersPaths {
+		if err := budget.acquire(ctx); err != nil {
+			return file, err
+		}
+		getCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+		content, _, resp, err := githubClient.Repositories.GetContents(getCtx, org, repo, path, nil)
+		cancel()
+		budget.update(resp)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return file, err
+		}
+		text, err := content.GetContent()
+		if err != nil {
+			return file, err
+		}
+		file.rules = parseCodeowners(text)
+		break
+	}
+
+	codeowners.Lock()
+	codeowners.repos[key] = file
+	codeowners.Unlock()
+	return file, nil
+}
+
+// addOwners sets each job's workflow file and the owners of that file.
+func addOwners(ctx context.Context, org, repo string, jobs []Job) error {
+	if !codeownersEnabled || len(jobs) == 0 || budget.low() {
+		return nil
+	}
+	file, err := repoCodeowners(ctx, org, repo)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if path, ok := file.paths[jobs[i].WorkflowID]; ok {
+			jobs[i].WorkflowPath = path
+			jobs[i].Owners = ownersOf(file.rules, path)
+		}
+	}
+	return nil
+}
+
+// filterByOwner keeps the jobs owned by a user or team, e.g.
+// "@acme/payments"; the leading @ may be left out.
+func filterByOwner(jobs []Job, owner string) []Job {
+	owner = "@" + strings.TrimPrefix(owner, "@")
+	filtered := []Job{}
+	for _, job := range jobs {
+		for _, o := range job.Owners {
+			if strings.EqualFold(o, owner) {
+				filtered = append(filtered, job)
+				break
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// maxJobs caps how many jobs are kept in memory per snapshot. Stats are
+// still counted over every run, only the job list is truncated to the
+// newest maxJobs entries. Zero means unlimited.
+var maxJobs = 5000
+
+// jobCollector receives jobs one at a time while fetching and keeps only the
+// newest maxJobs of them, so crawling an org with thousands of repositories
+// doesn't hold every run in memory at once.
+type jobCollector struct {
+	limit     int
+	jobs      jobHeap
+	stats     DashboardStats
+	truncated bool
+	partial   bool // FETCH_TIMEOUT passed before every pipeline was fetched
+
+	superseded DashboardStats // earlier attempts of re-run jobs
+	deduped    dedupeCollector
+	runners    RunnerTally // with RUNNER_STATS
+	errors     []FetchError
+	prepared   bool // jobs went through prepareJobs as they were added (streaming)
+
+	// Finished runs left out of the job list, still added to the weekly
+	// summaries, by provider|id
+	dropped map[string]weeklyRun
+}
+
+func newJobCollector(limit int) *jobCollector {
+	return &jobCollector{limit: limit}
+}
+
+// add counts the job and keeps it. Every fetched run passes through here
+// before anything is counted, so maintenance tagging happens here too.
+func (c *jobCollector) add(job Job) {
+	tagMaintenance(&job)
+	addToStats(&c.stats, job)
+	addSupersededToStats(&c.superseded, job)
+	c.deduped.add(job)
+	if runnerStats {
+		c.runners.add(job)
+	}
+	c.keep(job)
+}
+
+// keep buffers the job, evicting the oldest one when the buffer is full.
+func (c *jobCollector) keep(job Job) {
+	if c.limit <= 0 || len(c.jobs) < c.limit {
+		heap.Push(&c.jobs, job)
+		return
+	}
+
+	// Buffer is full: replace the oldest job if this one is newer
+	c.truncated = true
+	dropped := job
+	if job.CreatedAt.After(c.jobs[0].CreatedAt) {
+		dropped = c.jobs[0]
+		c.jobs[0] = job
+		heap.Fix(&c.jobs, 0)
+	}
+	if finished(dropped) {
+		c.drop(dropped.Provider+"|"+dropped.ID, weeklyRunOf(dropped))
+	}
+}
+
+func (c *jobCollector) drop(id string, run weeklyRun) {
+	if c.dropped == nil {
+		c.dropped = make(map[string]weeklyRun)
+	}
+	c.dropped[id] = run
+}
+
+func (c *jobCollector) len() int {
+	return c.stats.Total
+}
+
+// result returns the collected jobs sorted newest first.
+func (c *jobCollector) result() []Job {
+	jobs := []Job(c.jobs)
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	c.jobs = nil
+	return jobs
+}
+
+// jobHeap is a min-heap ordered by CreatedAt, so the oldest job is at the
+// root and can be evicted cheaply.
+type jobHeap []Job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].CreatedAt.Before(h[j].CreatedAt) }
+func (h jobHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *jobHeap) Push(x any)        { *h = append(*h, x.(Job)) }
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	*h = old[:n-1]
+	return job
+}
+
+// writeDashboardJSON encodes the response job by job instead of marshalling
+// the whole payload into one buffer first.
+func writeDashboardJSON(w io.Writer, response DashboardResponse) error {
+	// Encode everything except the jobs (the outer Jobs field shadows the
+	// embedded one and is omitted), then splice the jobs array in
+	header, err := json.Marshal(struct {
+		DashboardResponse
+		Jobs *struct{} `json:"jobs,omitempty"`
+	}{DashboardResponse: response})
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `,"jobs":[`); err != nil {
+		return err
+	}
+
+	for i, job := range response.Jobs {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// merge adds the jobs and stats collected by other.
+func (c *jobCollector) merge(other *jobCollector) {
+	addStats(&c.stats, other.stats)
+	addStats(&c.superseded, other.superseded)
+	c.deduped.merge(&other.deduped)
+	c.runners.merge(&other.runners)
+	c.errors = append(c.errors, other.errors...)
+	c.truncated = c.truncated || other.truncated
+	c.partial = c.partial || other.partial
+	for id, run := range other.dropped {
+		c.drop(id, run)
+	}
+
+	for _, job := range other.jobs {
+		c.keep(job)
+	}
+}
+
+// addStats adds the counters of other to stats.
+func addStats(stats *DashboardStats, other DashboardStats) {
+	stats.Success += other.Success
+	stats.Failed += other.Failed
+	stats.Running += other.Running
+	stats.Pending += other.Pending
+	stats.Maintenance += other.Maintenance
+	stats.Total += other.Total
+	stats.PassedOnRerun += other.PassedOnRerun
+	stats.PassedOnRerunSeconds += other.PassedOnRerunSeconds
+	if len(other.Buckets) > 0 {
+		// A new map, stats may be a copy sharing it with a cached snapshot
+		buckets := make(map[string]int, len(other.Buckets))
+		for name, n := range stats.Buckets {
+			buckets[name] = n
+		}
+		for name, n := range other.Buckets {
+			buckets[name] += n
+		}
+		stats.Buckets = buckets
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// RunComparison diffs two runs of the same workflow, for questions like
+// "why is this run 3x slower than yesterday's?".
+type RunComparison struct {
+	Repository           string            `json:"repository"`
+	Workflow             string            `json:"workflow"`
+	Base                 RunSummary        `json:"base"`
+	Head                 RunSummary        `json:"head"`
+	DurationDeltaSeconds int64             `json:"duration_delta_seconds"` // head minus base
+	DurationRatio        *float64          `json:"duration_ratio,omitempty"`
+	QueuedDeltaSeconds   int64             `json:"queued_delta_seconds"`
+	Jobs                 []JobComparison   `json:"jobs"`
+	SlowerSteps          []StepComparison  `json:"slower_steps"` // biggest slowdowns across all jobs
+	Commits              *CommitComparison `json:"commits,omitempty"`
+}
+
+type RunSummary struct {
+	RunID           int64  `json:"run_id"`
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	Branch          string `json:"branch"`
+	HeadSHA         string `json:"head_sha"`
+	Event           string `json:"event"`
+	Attempt         int    `json:"attempt"`
+	QueuedSeconds   int64  `json:"queued_seconds"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	HTMLURL         string `json:"html_url"`
+}
+
+type JobComparison struct {
+	Name                 string           `json:"name"`
+	BaseStatus           string           `json:"base_status,omitempty"` // empty when the job only ran in one of the runs
+	HeadStatus           string           `json:"head_status,omitempty"`
+	OutcomeChanged       bool             `json:"outcome_changed"`
+	BaseSeconds          int64            `json:"base_seconds"`
+	HeadSeconds          int64            `json:"head_seconds"`
+	DurationDeltaSeconds int64            `json:"duration_delta_seconds"`
+	BaseRunner           string           `json:"base_runner,omitempty"`
+	HeadRunner           string           `json:"head_runner,omitempty"`
+	RunnerChanged        bool             `json:"runner_changed"`
+	Steps                []StepComparison `json:"steps"`
+}
+
+type StepComparison struct {
+	Job                  string `json:"job,omitempty"` // only in slower_steps
+	Name                 string `json:"name"`
+	BaseStatus           string `json:"base_status,omitempty"`
+	HeadStatus           string `json:"head_status,omitempty"`
+	OutcomeChanged       bool   `json:"outcome_changed"`
+	BaseSeconds          int64  `json:"base_seconds"`
+	HeadSeconds          int64  `json:"head_seconds"`
+	DurationDeltaSeconds int64  `json:"duration_delta_seconds"`
+}
+
+// CommitComparison is what changed in the code between the two runs.
+type CommitComparison struct {
+	Status       string          `json:"status"` // ahead, behind, diverged or identical
+	AheadBy      int             `json:"ahead_by"`
+	BehindBy     int             `json:"behind_by"`
+	FilesChanged int             `json:"files_changed"`
+	Commits      []CommitSummary `json:"commits"`
+	HTMLURL      string          `json:"html_url"`
+
+	files []string // paths changed, for workflowChange
+}
+
+type CommitSummary struct {
+	SHA     string `json:"sha"`
+	Message string `json:"message"` // subject line
+	Author  string `json:"author"`
+	Login   string `json:"login,omitempty"` // the author's GitHub account, when known
+}
+
+// maxSlowerSteps caps slower_steps in a comparison.
+const maxSlowerSteps = 5
+
+// compareHandler serves /api/runs/compare?repo=owner/repo&base=&head=.
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	owner, repo, ok := strings.Cut(r.URL.Query().Get("repo"), "/")
+	if !ok || owner == "" || repo == "" {
+		http.Error(w, "Expected ?repo=owner/repo&base={run_id}&head={run_id}", http.StatusBadRequest)
+		return
+	}
+	baseID, err := strconv.ParseInt(r.URL.Query().Get("base"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid base run_id %q", r.URL.Query().Get("base")), http.StatusBadRequest)
+		return
+	}
+	headID, err := strconv.ParseInt(r.URL.Query().Get("head"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid head run_id %q", r.URL.Query().Get("head")), http.StatusBadRequest)
+		return
+	}
+	if githubClient == nil || demoMode {
+		http.Error(w, "Run comparison is only available for GitHub Actions", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	var details [2]*RunDetail
+	for i, runID := range []int64{baseID, headID} {
+		detail, err := fetchRunDetail(ctx, owner, repo, runID)
+		var ghErr *github.ErrorResponse
+		if errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusNotFound {
+			http.Error(w, fmt.Sprintf("Run %d not found in %s/%s", runID, owner, repo), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("❌ Error fetching run %d in %s/%s: %v", runID, owner, repo, err)
+			http.Error(w, fmt.Sprintf("Error fetching run: %v", err), http.StatusBadGateway)
+			return
+		}
+		details[i] = detail
+	}
+	base, head := details[0], details[1]
+	if base.WorkflowID != head.WorkflowID {
+		http.Error(w, fmt.Sprintf("Runs %d and %d belong to different workflows", baseID, headID), http.StatusBadRequest)
+		return
+	}
+
+	comparison := compareRuns(base, head)
+	comparison.Repository = owner + "/" + repo
+	if base.Commit.SHA != "" && head.Commit.SHA != "" {
+		commits, err := compareCommits(ctx, owner, repo, base.Commit.SHA, head.Commit.SHA)
+		if err != nil {
+			// The diff of the runs is still useful without the commits
+			log.Printf("⚠️  Error comparing %s...%s in %s/%s: %v", base.Commit.SHA[:7], head.Commit.SHA[:7], owner, repo, err)
+		}
+		comparison.Commits = commits
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(comparison)
+}
+
+func compareRuns(base, head *RunDetail) RunComparison {
+	comparison := RunComparison{
+		Workflow:             workflowName(head.Name),
+		Base:                 runSummary(base),
+		Head:                 runSummary(head),
+		DurationDeltaSeconds: head.Timing.DurationSeconds - base.Timing.DurationSeconds,
+		QueuedDeltaSeconds:   head.Timing.QueuedSeconds - base.Timing.QueuedSeconds,
+		Jobs:                 []JobComparison{},
+		SlowerSteps:          []StepComparison{},
+	}
+	if base.Timing.DurationSeconds > 0 {
+		ratio := math.Round(float64(head.Timing.DurationSeconds)/float64(base.Timing.DurationSeconds)*100) / 100
+		comparison.DurationRatio = &ratio
+	}
+
+	// Jobs are matched by name, in the head run's order; jobs that only ran
+	// in the base run come last
+	baseJobs := make(map[string]RunJob)
+	for _, job := range base.Jobs {
+		baseJobs[job.Name] = job
+	}
+	for _, job := range head.Jobs {
+		baseJob, ok := baseJobs[job.Name]
+		delete(baseJobs, job.Name)
+		var basePtr *RunJob
+		if ok {
+			basePtr = &baseJob
+		}
+		comparison.Jobs = append(comparison.Jobs, compareJobs(basePtr, &job))
+	}
+	for _, job := range base.Jobs {
+		if _, ok := baseJobs[job.Name]; ok {
+			comparison.Jobs = append(comparison.Jobs, compareJobs(&job, nil))
+		}
+	}
+
+	for _, job := range comparison.Jobs {
+		for _, step := range job.Steps {
+			if step.DurationDeltaSeconds > 0 {
+				step.Job = job.Name
+				comparison.SlowerSteps = append(comparison.SlowerSteps, step)
+			}
+		}
+	}
+	sort.SliceStable(comparison.SlowerSteps, func(i, j int) bool {
+		return comparison.SlowerSteps[i].DurationDeltaSeconds > comparison.SlowerSteps[j].DurationDeltaSeconds
+	})
+	if len(comparison.SlowerSteps) > maxSlowerSteps {
+		comparison.SlowerSteps = comparison.SlowerSteps[:maxSlowerSteps]
+	}
+	return comparison
+}
+
+func runSummary(detail *RunDetail) RunSummary {
+	return RunSummary{
+		RunID:           detail.RunID,
+		Name:            detail.Name,
+		Status:          detail.Status,
+		Branch:          detail.Branch,
+		HeadSHA:         detail.Commit.SHA,
+		Event:           detail.Event,
+		Attempt:         detail.Attempt,
+		QueuedSeconds:   detail.Timing.QueuedSeconds,
+		DurationSeconds: detail.Timing.DurationSeconds,
+		HTMLURL:         detail.HTMLURL,
+	}
+}
+
+// compareJobs diffs a job across the two runs; base or head is nil when the
+// job only ran in one of them.
+func compareJobs(base, head *RunJob) JobComparison {
+	var comparison JobComparison
+	var baseSteps, headSteps []RunStep
+	if base != nil {
+		comparison.Name = base.Name
+		comparison.BaseStatus = base.Status
+		comparison.BaseSeconds = base.DurationSeconds
+		comparison.BaseRunner = jobRunner(*base)
+		baseSteps = base.Steps
+	}
+	if head != nil {
+		comparison.Name = head.Name
+		comparison.HeadStatus = head.Status
+		comparison.HeadSeconds = head.DurationSeconds
+		comparison.HeadRunner = jobRunner(*head)
+		headSteps = head.Steps
+	}
+	comparison.OutcomeChanged = comparison.BaseStatus != comparison.HeadStatus
+	comparison.RunnerChanged = base != nil && head != nil && comparison.BaseRunner != comparison.HeadRunner
+	comparison.DurationDeltaSeconds = comparison.HeadSeconds - comparison.BaseSeconds
+
+	comparison.Steps = []StepComparison{}
+	byName := make(map[string]RunStep)
+	for _, step := range baseSteps {
+		byName[step.Name] = step
+	}
+	for _, step := range headSteps {
+		s := StepComparison{Name: step.Name, HeadStatus: step.Status, HeadSeconds: step.DurationSeconds}
+		if baseStep, ok := byName[step.Name]; ok {
+			delete(byName, step.Name)
+			s.BaseStatus, s.BaseSeconds = baseStep.Status, baseStep.DurationSeconds
+		}
+		s.OutcomeChanged = s.BaseStatus != s.HeadStatus
+		s.DurationDeltaSeconds = s.HeadSeconds - s.BaseSeconds
+		comparison.Steps = append(comparison.Steps, s)
+	}
+	for _, step := range baseSteps {
+		if _, ok := byName[step.Name]; ok {
+			comparison.Steps = append(comparison.Steps, StepComparison{
+				Name:                 step.Name,
+				BaseStatus:           step.Status,
+				OutcomeChanged:       true,
+				BaseSeconds:          step.DurationSeconds,
+				DurationDeltaSeconds: -step.DurationSeconds,
+			})
+		}
+	}
+	return comparison
+}
+
+// jobRunner identifies where a job ran: the runner name of self-hosted
+// runners, the labels otherwise (hosted runner names are random).
+func jobRunner(job RunJob) string {
+	labels := strings.Join(job.Labels, ",")
+	for _, label := range job.Labels {
+		if strings.EqualFold(label, "self-hosted") && job.RunnerName != "" {
+			return job.RunnerName + " (" + labels + ")"
+		}
+	}
+	return labels
+}
+
+func compareCommits(ctx context.Context, owner, repo, base, head string) (*CommitComparison, error) {
+	comparison, resp, err := githubClient.Repositories.CompareCommits(ctx, owner, repo, base, head, &github.ListOptions{PerPage: 100})
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+	result := &CommitComparison{
+		Status:       comparison.GetStatus(),
+		AheadBy:      comparison.GetAheadBy(),
+		BehindBy:     comparison.GetBehindBy(),
+		FilesChanged: len(comparison.Files),
+		Commits:      []CommitSummary{},
+		HTMLURL:      comparison.GetHTMLURL(),
+	}
+	for _, commit := range comparison.Commits {
+		result.Commits = append(result.Commits, CommitSummary{
+			SHA:     commit.GetSHA(),
+			Message: commitSubject(commit.GetCommit().GetMessage()),
+			Author:  commit.GetCommit().GetAuthor().GetName(),
+			Login:   commit.GetAuthor().GetLogin(),
+		})
+	}
+	for _, file := range comparison.Files {
+		result.files = append(result.files, file.GetFilename())
+	}
+	return result, nil
+}
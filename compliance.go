@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Compliance: which repositories run the workflows an organization
+// requires. Requirements come from the "workflows" rule of GitHub org
+// rulesets, GitHub's (older) org required workflows, and REQUIRED_WORKFLOWS
+// for providers without either.
+
+// requiredWorkflows are declared in REQUIRED_WORKFLOWS: "Workflow" applies
+// to every organization, "org:Workflow" to one.
+var requiredWorkflows []declaredRequirement
+
+type declaredRequirement struct {
+	org, workflow string
+}
+
+// complianceCacheTTL is how long an organization's requirements and
+// repositories are reused; they change far less often than runs.
+const complianceCacheTTL = time.Hour
+
+var complianceCache = struct {
+	sync.Mutex
+	orgs map[string]complianceOrg
+}{orgs: make(map[string]complianceOrg)}
+
+// complianceOrg is the cached part of an organization's compliance.
+type complianceOrg struct {
+	requirements []Requirement
+	repos        []complianceRepo
+	err          error // what couldn't be read, cached like the rest
+	fetchedAt    time.Time
+}
+
+type complianceRepo struct {
+	ID            int64
+	Name          string
+	DefaultBranch string
+	Private       bool
+}
+
+// Requirement is one workflow an organization requires.
+type Requirement struct {
+	Workflow         string `json:"workflow"`
+	Path             string `json:"path,omitempty"`
+	SourceRepository string `json:"source_repository,omitempty"` // where the workflow file lives
+	Source           string `json:"source"`                      // ruleset, required_workflow, or config
+	Ruleset          string `json:"ruleset,omitempty"`
+	Enforcement      string `json:"enforcement,omitempty"` // active, or evaluate for rulesets in evaluate mode
+
+	include, exclude []string // repository name patterns, none means all
+	repoIDs          []int64  // set when the requirement names its repositories
+}
+
+// applies reports whether the requirement covers a repository.
+func (req Requirement) applies(repo complianceRepo) bool {
+	if req.repoIDs != nil {
+		return slices.Contains(req.repoIDs, repo.ID)
+	}
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if pattern == "~ALL" {
+				return true
+			}
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(repo.Name)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(req.include) > 0 && !matches(req.include) {
+		return false
+	}
+	return !matches(req.exclude)
+}
+
+// ComplianceViolation is a repository that doesn't run a required workflow
+// successfully.
+type ComplianceViolation struct {
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	Source     string `json:"source"`
+	Status     string `json:"status"`             // missing (no run in the period) or failing
+	LastRun    *Job   `json:"last_run,omitempty"` // on the default branch when it has one
+}
+
+type OrgCompliance struct {
+	Organization string                `json:"organization"`
+	Provider     string                `json:"provider"`
+	Requirements []Requirement         `json:"requirements"`
+	Repositories int                   `json:"repositories"`
+	Compliant    int                   `json:"compliant"`
+	Violations   []ComplianceViolation `json:"violations"`
+	Error        string                `json:"error,omitempty"`
+}
+
+type ComplianceReport struct {
+	Period    string          `json:"period"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Orgs      []OrgCompliance `json:"orgs"`
+}
+
+func loadComplianceConfig() {
+	for _, entry := range splitList(os.Getenv("REQUIRED_WORKFLOWS")) {
+		org, workflow, ok := strings.Cut(entry, ":")
+		if !ok {
+			org, workflow = "", entry
+		}
+		if workflow == "" {
+			log.Fatalf("Invalid REQUIRED_WORKFLOWS entry %q: expected Workflow or org:Workflow", entry)
+		}
+		requiredWorkflows = append(requiredWorkflows, declaredRequirement{org: org, workflow: workflow})
+	}
+}
+
+// complianceHandler serves /api/compliance, the repositories missing or
+// failing their organization's required workflows. ?org= limits the
+// report to one organization.
+func complianceHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	org := r.URL.Query().Get("org")
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	report := ComplianceReport{Period: period, FetchedAt: snap.FetchedAt, Orgs: []OrgCompliance{}}
+	for _, src := range currentSources() {
+		if org != "" && src.Org != org {
+			continue
+		}
+		result := OrgCompliance{Organization: src.Org, Provider: src.Provider.Name(), Requirements: []Requirement{}, Violations: []ComplianceViolation{}}
+		cached, err := loadComplianceOrg(r.Context(), src, period)
+		if err != nil {
+			log.Printf("⚠️  Error reading required workflows of %s: %v", src.Org, err)
+			result.Error = err.Error()
+		}
+		result.Requirements = append(result.Requirements, cached.requirements...)
+		checkCompliance(&result, cached.repos, snap.Response.Jobs, requestLocale(r.URL.Query().Get("locale")))
+		report.Orgs = append(report.Orgs, result)
+	}
+	sort.Slice(report.Orgs, func(i, j int) bool { return report.Orgs[i].Organization < report.Orgs[j].Organization })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(report)
+}
+
+// checkCompliance compares each repository's runs against the
+// requirements that apply to it.
+func checkCompliance(result *OrgCompliance, repos []complianceRepo, jobs []Job, locale string) {
+	// Newest run per repository and workflow, on the default branch when
+	// it has runs there
+	latest := make(map[string]Job)
+	defaults := make(map[string]string)
+	for _, repo := range repos {
+		defaults[repo.Name] = repo.DefaultBranch
+	}
+	for _, job := range jobs {
+		if job.Provider != result.Provider || job.Organization != result.Organization {
+			continue
+		}
+		key := job.Pipeline + "|" + strings.ToLower(workflowName(job.Name))
+		previous, ok := latest[key]
+		onDefault := job.Branch == defaults[job.Pipeline]
+		previousOnDefault := ok && previous.Branch == defaults[job.Pipeline]
+		if !ok || (onDefault && !previousOnDefault) || (onDefault == previousOnDefault && job.CreatedAt.After(previous.CreatedAt)) {
+			latest[key] = job
+		}
+	}
+
+	result.Repositories = len(repos)
+	for _, repo := range repos {
+		compliant := true
+		for _, req := range result.Requirements {
+			// A workflow's own repository doesn't need to run it
+			if !req.applies(repo) || req.SourceRepository == result.Organization+"/"+repo.Name {
+				continue
+			}
+			violation := ComplianceViolation{Repository: result.Organization + "/" + repo.Name, Workflow: req.Workflow, Source: req.Source}
+			job, ok := latest[repo.Name+"|"+strings.ToLower(req.Workflow)]
+			switch {
+			case !ok:
+				violation.Status = "missing"
+			case job.Status == "failed":
+				violation.Status = "failing"
+				jobs := []Job{job}
+				localizeJobs(jobs, locale)
+				violation.LastRun = &jobs[0]
+			default:
+				continue
+			}
+			compliant = false
+			result.Violations = append(result.Violations, violation)
+		}
+		if compliant {
+			result.Compliant++
+		}
+	}
+	sort.Slice(result.Violations, func(i, j int) bool {
+		a, b := result.Violations[i], result.Violations[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Workflow < b.Workflow
+	})
+}
+
+// loadComplianceOrg returns an organization's requirements and
+// repositories, cached for complianceCacheTTL. Errors still return what
+// could be read, and are cached too, so an organization without access to
+// its rulesets isn't asked again on every request.
+func loadComplianceOrg(ctx context.Context, src source, period string) (complianceOrg, error) {
+	key := src.Provider.Name() + "|" + src.Org
+	complianceCache.Lock()
+	cached, ok := complianceCache.orgs[key]
+	complianceCache.Unlock()
+	if ok && clock().Sub(cached.fetchedAt) < complianceCacheTTL {
+		return cached, cached.err
+	}
+
+	org := complianceOrg{fetchedAt: clock()}
+	for _, declared := range requiredWorkflows {
+		if declared.org == "" || declared.org == src.Org {
+			org.requirements = append(org.requirements, Requirement{Workflow: declared.workflow, Source: "config"})
+		}
+	}
+
+	if src.Provider.Name() == "github" {
+		// Personal accounts have no rulesets or required workflows of their own
+		// The configured requirements are still checked without them
+		var errs []error
+		if !isGitHubUser(src.Org) {
+			requirements, err := fetchGitHubRequirements(ctx, src.Org)
+			org.requirements = append(org.requirements, requirements...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("reading rulesets: %w", err))
+			}
+		}
+		repos, err := listComplianceRepos(ctx, src.Org)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing repositories: %w", err))
+		}
+		org.repos, org.err = repos, errors.Join(errs...)
+	} else {
+		// Other providers only list the pipelines active in the period
+		pipelines, err := src.Provider.ListPipelines(ctx, newFetchWindow(period), src.Org)
+		for _, pipeline := range pipelines {
+			org.repos = append(org.repos, complianceRepo{Name: pipeline.Name, DefaultBranch: pipeline.DefaultBranch})
+		}
+		org.err = err
+	}
+
+	complianceCache.Lock()
+	complianceCache.orgs[key] = org
+	complianceCache.Unlock()
+	return org, org.err
+}
+
+// listComplianceRepos lists every repository of a GitHub organization,
+// active or not, except archived ones.
+func listComplianceRepos(ctx context.Context, orgName string) ([]complianceRepo, error) {
+	list, err := listOrgRepos(ctx, orgName)
+	var repos []complianceRepo
+	for _, repo := range list {
+		if !repo.Archived {
+			repos = append(repos, complianceRepo{ID: repo.ID, Name: repo.Name, DefaultBranch: repo.DefaultBranch, Private: repo.Private})
+		}
+	}
+	return repos, err
+}
+
+// fetchGitHubRequirements reads the workflows required by the org's
+// rulesets and by its required workflows.
+func fetchGitHubRequirements(ctx context.Context, orgName string) ([]Requirement, error) {
+	requirements, err := fetchRulesetRequirements(ctx, orgName)
+	if err != nil {
+		return requirements, err
+	}
+
+	// Required workflows predate rulesets and are gone on newer GitHub
+	// versions, so a missing endpoint isn't an error
+	list, resp, err := githubClient.Actions.ListOrgRequiredWorkflows(ctx, orgName, &github.ListOptions{PerPage: 100})
+	budget.update(resp)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return requirements, nil
+		}
+		return requirements, err
+	}
+	for _, workflow := range list.RequiredWorkflows {
+		req := Requirement{
+			Workflow:         workflow.GetName(),
+			Path:             workflow.GetPath(),
+			SourceRepository: workflow.GetRepository().GetFullName(),
+			Source:           "required_workflow",
+		}
+		if workflow.GetScope() == "selected" {
+			selected, resp, err := githubClient.Actions.ListRequiredWorkflowSelectedRepos(ctx, orgName, workflow.GetID(), &github.ListOptions{PerPage: 100})
+			budget.update(resp)
+			if err != nil {
+				return requirements, err
+			}
+			req.repoIDs = []int64{}
+			for _, repo := range selected.Repositories {
+				req.repoIDs = append(req.repoIDs, repo.GetID())
+			}
+		}
+		requirements = append(requirements, req)
+	}
+	return requirements, nil
+}
+
+func fetchRulesetRequirements(ctx context.Context, orgName string) ([]Requirement, error) {
+	rulesets, resp, err := githubClient.Organizations.GetAllOrganizationRulesets(ctx, orgName)
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var requirements []Requirement
+	for _, summary := range rulesets {
+		if summary.Enforcement == "disabled" {
+			continue
+		}
+		// The list leaves out rules and conditions
+		ruleset, resp, err := githubClient.Organizations.GetOrganizationRuleset(ctx, orgName, summary.GetID())
+		budget.update(resp)
+		if err != nil {
+			return requirements, err
+		}
+		for _, rule := range ruleset.Rules {
+			if rule.Type != "workflows" || rule.Parameters == nil {
+				continue
+			}
+			var params github.RequiredWorkflowsRuleParameters
+			if err := json.Unmarshal(*rule.Parameters, &params); err != nil {
+				return requirements, fmt.Errorf("invalid workflows rule in ruleset %q: %v", ruleset.Name, err)
+			}
+			for _, workflow := range params.RequiredWorkflows {
+				req := Requirement{
+					Path:        workflow.Path,
+					Source:      "ruleset",
+					Ruleset:     ruleset.Name,
+					Enforcement: ruleset.Enforcement,
+				}
+				if conditions := ruleset.Conditions; conditions != nil {
+					if names := conditions.RepositoryName; names != nil {
+						req.include, req.exclude = names.Include, names.Exclude
+					}
+					if ids := conditions.RepositoryID; ids != nil {
+						req.repoIDs = append([]int64{}, ids.RepositoryIDs...)
+					}
+				}
+				req.SourceRepository, req.Workflow = resolveRequiredWorkflow(ctx, workflow)
+				requirements = append(requirements, req)
+			}
+		}
+	}
+	return requirements, nil
+}
+
+// resolveRequiredWorkflow finds the repository and name of a ruleset's
+// workflow, which is referenced by repository ID and path only. The name
+// falls back to the file name when the file can't be read.
+func resolveRequiredWorkflow(ctx context.Context, workflow *github.RuleRequiredWorkflow) (string, string) {
+	name := strings.TrimSuffix(strings.TrimSuffix(path.Base(workflow.Path), ".yml"), ".yaml")
+	repo, resp, err := githubClient.Repositories.GetByID(ctx, workflow.GetRepositoryID())
+	budget.update(resp)
+	if err != nil {
+		log.Printf("   ⚠️  Error resolving repository %d of required workflow %s: %v", workflow.GetRepositoryID(), workflow.Path, err)
+		return "", name
+	}
+	ref := workflow.GetRef()
+	if ref == "" {
+		ref = repo.GetDefaultBranch()
+	}
+	file, err := fetchWorkflowFile(ctx, repo.GetOwner().GetLogin(), repo.GetName(), workflow.Path, ref)
+	if err != nil {
+		log.Printf("   ⚠️  Error reading required workflow %s in %s: %v", workflow.Path, repo.GetFullName(), err)
+		return repo.GetFullName(), name
+	}
+	if file.Name != "" {
+		name = file.Name
+	}
+	return repo.GetFullName(), name
+}
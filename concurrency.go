@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// addConcurrencyGroup reads the run's concurrency group from its workflow
+// file. Only the workflow-level group is considered, not per-job groups.
+func addConcurrencyGroup(ctx context.Context, orgName, repoName string, run *github.WorkflowRun, job *Job) error {
+	if run.GetWorkflowID() == 0 {
+		return nil
+	}
+	path, err := fetchWorkflowPath(ctx, orgName, repoName, run.GetWorkflowID())
+	if err != nil {
+		return err
+	}
+	file, err := fetchWorkflowFile(ctx, orgName, repoName, path, run.GetHeadSHA())
+	if err != nil {
+		return err
+	}
+	if file.Concurrency.Group != "" {
+		job.ConcurrencyGroup = evalConcurrencyGroup(file.Concurrency.Group, orgName, repoName, run)
+	}
+	return nil
+}
+
+// linkConcurrencyWaits points runs that wait on their concurrency group at
+// the run currently holding the group, if that run is in the job list.
+func linkConcurrencyWaits(jobs []Job) {
+	// Concurrency groups are scoped to the repository
+	type groupKey struct{ org, repo, group string }
+	holders := make(map[groupKey]int64)
+	for _, job := range jobs {
+		if job.ConcurrencyGroup != "" && job.Status == "running" {
+			holders[groupKey{job.Organization, job.Pipeline, job.ConcurrencyGroup}] = job.RunID
+		}
+	}
+
+	for i := range jobs {
+		if !jobs[i].WaitingOnConcurrency {
+			continue
+		}
+		if holder, ok := holders[groupKey{jobs[i].Organization, jobs[i].Pipeline, jobs[i].ConcurrencyGroup}]; ok {
+			jobs[i].WaitingOnRunID = holder
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// costEstimation enables recording runner minutes per run (COST_ESTIMATION),
+// which costs one extra API call per finished run.
+var costEstimation bool
+
+// runnerPrices maps runner labels to USD per minute. The OS families are
+// GitHub's prices for standard hosted runners; larger runners have custom
+// labels and are priced through RUNNER_PRICES.
+var runnerPrices = map[string]float64{
+	"linux":   0.008,
+	"windows": 0.016,
+	"macos":   0.08,
+}
+
+// loadCostConfig reads COST_ESTIMATION and RUNNER_PRICES, e.g.
+// "ubuntu-latest-8-cores=0.032,macos-latest-xlarge=0.16,linux=0.008".
+func loadCostConfig() {
+	costEstimation = os.Getenv("COST_ESTIMATION") == "true"
+	for _, entry := range splitList(os.Getenv("RUNNER_PRICES")) {
+		label, price, ok := strings.Cut(entry, "=")
+		value, err := strconv.ParseFloat(price, 64)
+		if !ok || err != nil || value < 0 {
+			log.Fatalf("Invalid RUNNER_PRICES entry %q: expected label=usd-per-minute", entry)
+		}
+		runnerPrices[strings.ToLower(label)] = value
+	}
+	if costEstimation {
+		log.Printf("💰 Cost estimation enabled (%d runner prices)", len(runnerPrices))
+	}
+}
+
+// runnerLabel picks the label a job is priced by: a label with its own
+// price, otherwise the OS family of a GitHub-hosted label. Self-hosted
+// runners aren't billed and return "".
+func runnerLabel(labels []string) string {
+	for _, label := range labels {
+		if strings.EqualFold(label, "self-hosted") {
+			return ""
+		}
+	}
+	for _, label := range labels {
+		if _, ok := runnerPrices[strings.ToLower(label)]; ok {
+			return strings.ToLower(label)
+		}
+	}
+	for _, label := range labels {
+		label = strings.ToLower(label)
+		switch {
+		case strings.HasPrefix(label, "ubuntu"):
+			return "linux"
+		case strings.HasPrefix(label, "windows"):
+			return "windows"
+		case strings.HasPrefix(label, "macos"):
+			return "macos"
+		}
+	}
+	return ""
+}
+
+// runnerMinutes sums the billable minutes of a run's finished jobs per
+// runner label. Like GitHub's billing, every job is rounded up to a whole
+// minute.
+func runnerMinutes(jobs []*github.WorkflowJob) map[string]int64 {
+	minutes := make(map[string]int64)
+	for _, job := range jobs {
+		if job.StartedAt == nil || job.CompletedAt == nil {
+			continue
+		}
+		label := runnerLabel(job.Labels)
+		if label == "" {
+			continue
+		}
+		seconds := job.CompletedAt.Sub(job.StartedAt.Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		minutes[label] += int64(math.Ceil(seconds / 60))
+	}
+	return minutes
+}
+
+// CostEntry is the estimated spend of one organization, repository,
+// workflow or runner label.
+type CostEntry struct {
+	Name    string  `json:"name"`
+	Runs    int     `json:"runs"`
+	Minutes int64   `json:"minutes"`
+	Cost    float64 `json:"cost"`
+}
+
+type CostsResponse struct {
+	Period        string             `json:"period"`
+	Currency      string             `json:"currency"`
+	Total         float64            `json:"total"`
+	Minutes       int64              `json:"minutes"`
+	RunsEstimated int                `json:"runs_estimated"`
+	RunsMissing   int                `json:"runs_missing"` // finished GitHub runs without billed minutes: skipped on a low budget, or self-hosted only
+	Organizations []CostEntry        `json:"organizations"`
+	Repositories  []CostEntry        `json:"repositories"`
+	Workflows     []CostEntry        `json:"workflows"`
+	Labels        []CostEntry        `json:"labels"`
+	Prices        map[string]float64 `json:"prices"`
+}
+
+// workflowName strips the run number from a job name, "CI #42" -> "CI".
+func workflowName(name string) string {
+	if i := strings.LastIndex(name, " #"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// estimateCosts adds up the runner minutes recorded on the jobs.
+func estimateCosts(jobs []Job) CostsResponse {
+	response := CostsResponse{Currency: "USD", Prices: runnerPrices}
+	orgs := make(map[string]*CostEntry)
+	repos := make(map[string]*CostEntry)
+	workflows := make(map[string]*CostEntry)
+	labels := make(map[string]*CostEntry)
+	add := func(entries map[string]*CostEntry, name string, minutes int64, cost float64) {
+		entry, ok := entries[name]
+		if !ok {
+			entry = &CostEntry{Name: name}
+			entries[name] = entry
+		}
+		entry.Runs++
+		entry.Minutes += minutes
+		entry.Cost += cost
+	}
+
+	for _, job := range jobs {
+		if job.RunnerMinutes == nil {
+			if (job.Provider == "github" || job.Provider == "demo") && finished(job) {
+				response.RunsMissing++
+			}
+			continue
+		}
+		response.RunsEstimated++
+		var runMinutes int64
+		var runCost float64
+		for label, minutes := range job.RunnerMinutes {
+			cost := float64(minutes) * runnerPrices[label]
+			add(labels, label, minutes, cost)
+			runMinutes += minutes
+			runCost += cost
+		}
+		repo := job.Organization + "/" + job.Pipeline
+		add(orgs, job.Organization, runMinutes, runCost)
+		add(repos, repo, runMinutes, runCost)
+		add(workflows, repo+"/"+workflowName(job.Name), runMinutes, runCost)
+		response.Minutes += runMinutes
+		response.Total += runCost
+	}
+
+	response.Organizations = sortedCosts(orgs)
+	response.Repositories = sortedCosts(repos)
+	response.Workflows = sortedCosts(workflows)
+	response.Labels = sortedCosts(labels)
+	return response
+}
+
+// sortedCosts returns the entries most expensive first, with costs rounded
+// to cents.
+func sortedCosts(entries map[string]*CostEntry) []CostEntry {
+	result := make([]CostEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.Cost = math.Round(entry.Cost*100) / 100
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cost != result[j].Cost {
+			return result[i].Cost > result[j].Cost
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func costsHandler(w http.ResponseWriter, r *http.Request) {
+	if !costEstimation {
+		http.Error(w, "Cost estimation is not enabled (set COST_ESTIMATION=true)", http.StatusNotFound)
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := estimateCosts(snap.Response.Jobs)
+	response.Period = period
+	response.Total = math.Round(response.Total*100) / 100
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
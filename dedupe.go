@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// commitKey identifies the runs of a workflow for one commit, empty for
+// runs without a commit SHA (most non-GitHub providers).
+func commitKey(job Job) string {
+	if job.HeadSHA == "" {
+		return ""
+	}
+	workflow := workflowName(job.Name)
+	if job.WorkflowID != 0 {
+		workflow = strconv.FormatInt(job.WorkflowID, 10)
+	}
+	return job.Provider + "|" + job.Organization + "/" + job.Pipeline + "|" + workflow + "|" + job.HeadSHA
+}
+
+// latestPerCommit keeps only the newest run per workflow and commit, so
+// re-triggered runs and force-pushes of the same commit show up once, with
+// the current state. jobs must be sorted newest first, as in snapshots.
+// Runs without a commit SHA are all kept.
+func latestPerCommit(jobs []Job) []Job {
+	seen := make(map[string]bool)
+	latest := []Job{}
+	for _, job := range jobs {
+		if key := commitKey(job); key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		latest = append(latest, job)
+	}
+	return latest
+}
+
+// DedupedStats are the stats of ?dedupe=commit, counted by the collector
+// over every run, before MAX_JOBS truncates the job list.
+type DedupedStats struct {
+	Stats        DashboardStats `json:"stats"`
+	Superseded   DashboardStats `json:"superseded"`
+	Deduplicated int            `json:"deduplicated"` // older runs of the same workflow and commit
+}
+
+// latestRun is the newest run of a workflow and commit the collector has
+// seen, counted on its own so a newer one can replace it.
+type latestRun struct {
+	createdAt  time.Time
+	stats      DashboardStats
+	superseded DashboardStats
+}
+
+// dedupeCollector counts the runs a collector sees the way latestPerCommit
+// would leave them.
+type dedupeCollector struct {
+	latest     map[string]latestRun
+	unkeyed    DashboardStats // runs without a commit SHA, all kept
+	superseded DashboardStats
+	total      int
+}
+
+func (d *dedupeCollector) add(job Job) {
+	d.total++
+	key := commitKey(job)
+	if key == "" {
+		addToStats(&d.unkeyed, job)
+		addSupersededToStats(&d.superseded, job)
+		return
+	}
+	run := latestRun{createdAt: job.CreatedAt}
+	addToStats(&run.stats, job)
+	addSupersededToStats(&run.superseded, job)
+	d.keep(key, run)
+}
+
+func (d *dedupeCollector) keep(key string, run latestRun) {
+	if d.latest == nil {
+		d.latest = make(map[string]latestRun)
+	}
+	if current, ok := d.latest[key]; !ok || run.createdAt.After(current.createdAt) {
+		d.latest[key] = run
+	}
+}
+
+func (d *dedupeCollector) merge(other *dedupeCollector) {
+	addStats(&d.unkeyed, other.unkeyed)
+	addStats(&d.superseded, other.superseded)
+	d.total += other.total
+	for key, run := range other.latest {
+		d.keep(key, run)
+	}
+}
+
+// result sums up the runs that are left.
+func (d *dedupeCollector) result() *DedupedStats {
+	result := &DedupedStats{Stats: d.unkeyed, Superseded: d.superseded}
+	for _, run := range d.latest {
+		addStats(&result.Stats, run.stats)
+		addStats(&result.Superseded, run.superseded)
+	}
+	result.Deduplicated = d.total - result.Stats.Total
+	return result
+}
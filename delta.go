@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RemovedJob is a run that dropped out of a period's snapshot, e.g. because
+// it is older than the period or past MAX_JOBS.
+type RemovedJob struct {
+	Provider  string    `json:"provider"`
+	ID        string    `json:"id"`
+	RemovedAt time.Time `json:"removed_at"`
+}
+
+type DeltaResponse struct {
+	Period    string         `json:"period"`
+	Cursor    string         `json:"cursor"` // pass as ?since= on the next poll
+	FetchedAt time.Time      `json:"fetched_at"`
+	Reset     bool           `json:"reset,omitempty"` // since is too old: jobs is the full list, replace everything
+	Stats     DashboardStats `json:"stats"`
+	RateLimit RateLimitInfo  `json:"rate_limit"`
+	Jobs      []Job          `json:"jobs"` // added or changed since the cursor
+	Removed   []RemovedJob   `json:"removed"`
+
+	*DataFreshness
+}
+
+func jobKey(job *Job) string {
+	return job.Provider + "|" + job.ID
+}
+
+// jobFingerprint is a job's content without the fields that change with
+// the clock rather than with the run.
+func jobFingerprint(job Job) string {
+	job.Started = ""
+	job.ElapsedSeconds = nil
+	job.ChangedAt = time.Time{}
+	data, _ := json.Marshal(job)
+	return string(data)
+}
+
+// trackChanges stamps every job of a freshly fetched snapshot with when it
+// last changed, by comparing it against the previous snapshot of the
+// period, and records the runs that dropped out of it. It returns the
+// previous snapshot, nil when there is none.
+func trackChanges(ctx context.Context, period string, snap *Snapshot) *Snapshot {
+	previous, err := loadSnapshot(ctx, period)
+	if err != nil {
+		log.Printf("⚠️  Error reading previous snapshot for %s: %v", period, err)
+	}
+
+	before := make(map[string]Job)
+	if previous != nil {
+		for _, job := range previous.Response.Jobs {
+			before[jobKey(&job)] = job
+		}
+	}
+
+	changed := 0
+	for i := range snap.Response.Jobs {
+		job := &snap.Response.Jobs[i]
+		key := jobKey(job)
+		old, ok := before[key]
+		delete(before, key)
+		if ok && !old.ChangedAt.IsZero() && jobFingerprint(old) == jobFingerprint(*job) {
+			job.ChangedAt = old.ChangedAt
+			continue
+		}
+		job.ChangedAt = snap.FetchedAt
+		changed++
+	}
+
+	// Whatever is left of the previous snapshot is gone now. Removals are
+	// kept as long as snapshots are, older cursors get a reset instead.
+	if previous != nil {
+		for _, removed := range previous.Removed {
+			if snap.FetchedAt.Sub(removed.RemovedAt) < snapshotRetention {
+				snap.Removed = append(snap.Removed, removed)
+			}
+		}
+	}
+	for _, job := range before {
+		snap.Removed = append(snap.Removed, RemovedJob{Provider: job.Provider, ID: job.ID, RemovedAt: snap.FetchedAt})
+	}
+	if previous != nil {
+		log.Printf("🔀 %s: %d run(s) added or changed, %d removed", period, changed, len(before))
+	}
+	return previous
+}
+
+// parseCursor accepts a cursor from a previous delta response or an
+// RFC 3339 timestamp.
+func parseCursor(since string) (time.Time, error) {
+	if nanos, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return time.Unix(0, nanos), nil
+	}
+	return time.Parse(time.RFC3339Nano, since)
+}
+
+func formatCursor(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// maxDeltaWait caps ?wait= on the delta endpoint.
+const maxDeltaWait = 2 * time.Minute
+
+// deltaStoreCheckInterval is how often a long poll looks for snapshots of
+// other replicas in the store.
+const deltaStoreCheckInterval = 5 * time.Second
+
+// deltaHandler serves /api/dashboard/delta?since=, only the runs added or
+// changed since the cursor, so polling clients don't transfer the full
+// dashboard every few seconds. With ?wait=30s the request is held until
+// there is something new or the wait is over (long polling).
+func deltaHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		http.Error(w, "Missing since parameter (cursor or RFC 3339 timestamp)", http.StatusBadRequest)
+		return
+	}
+	sinceTime, err := parseCursor(since)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid since %q: expected a cursor or RFC 3339 timestamp", since), http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if value := r.URL.Query().Get("wait"); value != "" {
+		wait, err = parseWait(value)
+		if err != nil || wait < 0 {
+			http.Error(w, fmt.Sprintf("Invalid wait %q: expected a duration such as 30s", value), http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxDeltaWait)
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	viewer := viewerFrom(r)
+	response := buildDelta(period, viewer.snapshot(snap), sinceTime)
+
+	// Long polling: wait for the next snapshot fetched by this replica, and
+	// look in the store now and then for one fetched by another. Neither
+	// fetches; refreshes are up to the poller and other requests.
+	if wait > 0 && response.empty() {
+		deadline := time.NewTimer(wait)
+		defer deadline.Stop()
+		ticker := time.NewTicker(deltaStoreCheckInterval)
+		defer ticker.Stop()
+	poll:
+		for {
+			next := nextSnapshot(period)
+			var latest *Snapshot
+			select {
+			case <-r.Context().Done():
+				return // client went away
+			case <-deadline.C:
+				break poll
+			case <-next.done:
+				latest = next.snap
+			case <-ticker.C:
+				if latest, err = loadSnapshot(r.Context(), period); err != nil {
+					log.Printf("⚠️  Error reading snapshot for %s while long polling: %v", period, err)
+				}
+			}
+			if latest == nil || !latest.FetchedAt.After(snap.FetchedAt) {
+				continue
+			}
+			snap = latest
+			if response = buildDelta(period, viewer.snapshot(snap), sinceTime); !response.empty() {
+				break poll
+			}
+		}
+	}
+	f := freshness(period, snap.FetchedAt)
+	response.DataFreshness = &f
+	setFreshnessHeaders(w, f)
+	response.Jobs = copyJobs(response.Jobs)
+	applyCustomTags(r.Context(), response.Jobs)
+	localizeJobs(response.Jobs, requestLocale(r.URL.Query().Get("locale")))
+	updateElapsed(response.Jobs)
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Vary", "Accept")
+	if wantsMsgpack(r) {
+		w.Header().Set("Content-Type", msgpackContentType)
+		if err := writeMsgpack(w, response); err != nil {
+			log.Printf("❌ Error writing delta response: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseWait accepts a duration such as "30s", or plain seconds.
+func parseWait(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func buildDelta(period string, snap *Snapshot, sinceTime time.Time) DeltaResponse {
+	response := DeltaResponse{
+		Period:    period,
+		Cursor:    formatCursor(snap.FetchedAt),
+		FetchedAt: snap.FetchedAt,
+		Stats:     snap.Response.Stats,
+		RateLimit: snap.Response.RateLimit,
+		Jobs:      []Job{},
+		Removed:   []RemovedJob{},
+		Reset:     snap.FetchedAt.Sub(sinceTime) >= snapshotRetention,
+	}
+	for _, job := range snap.Response.Jobs {
+		if response.Reset || job.ChangedAt.IsZero() || job.ChangedAt.After(sinceTime) {
+			response.Jobs = append(response.Jobs, job)
+		}
+	}
+	if !response.Reset {
+		for _, removed := range snap.Removed {
+			if removed.RemovedAt.After(sinceTime) {
+				response.Removed = append(response.Removed, removed)
+			}
+		}
+	}
+	return response
+}
+
+func (d DeltaResponse) empty() bool {
+	return !d.Reset && len(d.Jobs) == 0 && len(d.Removed) == 0
+}
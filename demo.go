@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+var (
+	// demoMode serves generated workflow runs instead of calling GitHub, so
+	// the dashboard can be evaluated or developed without a token.
+	demoMode bool
+
+	demoOrgs        = []string{"acme-corp", "acme-labs"}
+	demoRepos       = []string{"api-gateway", "web-frontend", "billing-service", "auth-service", "mobile-app", "infra-terraform", "docs"}
+	demoFailureRate = 0.15
+
+	demoMatrix    = []string{"ubuntu-latest, 18", "ubuntu-latest, 20", "macos-latest, 20", "windows-latest, 20"}
+	demoWorkflows = []string{"CI", "Build & Test", "Lint", "Deploy Staging", "Deploy Production", "CodeQL"}
+	// Files the demo workflows live in, see demoWorkflowSources
+	demoWorkflowFiles = map[string]string{"CI": "ci.yml", "Build & Test": "build.yml", "Lint": "lint.yml", "Deploy Staging": "deploy-staging.yml", "Deploy Production": "deploy.yml", "CodeQL": "codeql.yml"}
+	demoBranches      = []string{"main", "main", "main", "develop", "release/v1.4", "feature/login-flow", "fix/flaky-tests", "dependabot/npm_and_yarn/axios-1.6.2"}
+	demoActors        = []string{"alice", "bob", "carol", "dave", "dependabot[bot]"}
+	demoCommits       = []string{"Fix flaky integration test", "Bump axios from 1.6.1 to 1.6.2", "Add login rate limiting", "Refactor billing webhooks", "Update deploy manifests", "Merge pull request #128 from feature/login-flow"}
+	demoTeams         = []string{"backend", "frontend", "payments", "mobile"}
+)
+
+func loadDemoConfig() {
+	if env := os.Getenv("DEMO_ORGS"); env != "" {
+		demoOrgs = splitList(env)
+	}
+	if env := os.Getenv("DEMO_REPOS"); env != "" {
+		demoRepos = splitList(env)
+	}
+	if env := strings.TrimSpace(os.Getenv("DEMO_FAILURE_RATE")); env != "" {
+		rate, err := strconv.ParseFloat(env, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			log.Fatalf("Invalid DEMO_FAILURE_RATE %q: must be a number between 0 and 1", env)
+		}
+		demoFailureRate = rate
+	}
+	if len(demoOrgs) == 0 || len(demoRepos) == 0 {
+		log.Fatal("DEMO_ORGS and DEMO_REPOS must not be empty")
+	}
+}
+
+func demoHash(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// demoProvider generates workflow runs instead of calling GitHub. Every
+// repository gets runs at a fixed cadence, and each run is derived from a
+// hash of its slot, so the same run keeps the same ID and outcome across
+// refreshes.
+type demoProvider struct{}
+
+func (demoProvider) Name() string { return "demo" }
+
+func (demoProvider) RateLimit() *RateLimitInfo {
+	return &RateLimitInfo{Remaining: 5000, Limit: 5000, ResetAt: clock().Add(time.Hour)}
+}
+
+func (demoProvider) ListPipelines(ctx context.Context, window fetchWindow, orgName string) ([]Pipeline, error) {
+	pipelines := make([]Pipeline, len(demoRepos))
+	for i, repoName := range demoRepos {
+		pipelines[i] = Pipeline{Org: orgName, Name: repoName, DefaultBranch: "main"}
+	}
+	return pipelines, nil
+}
+
+func (demoProvider) ListRuns(ctx context.Context, window fetchWindow, repo Pipeline) ([]Job, error) {
+	orgName, repoName := repo.Org, repo.Name
+	repoSeed := demoHash(orgName, repoName)
+	interval := time.Duration(20+repoSeed%220) * time.Minute
+
+	var jobs []Job
+	for slot := window.Now.Truncate(interval); !slot.Before(window.Start); slot = slot.Add(-interval) {
+		runSeed := demoHash(orgName, repoName, strconv.FormatInt(slot.Unix(), 10))
+		rng := rand.New(rand.NewSource(int64(runSeed)))
+		run, duration := demoRun(rng, runSeed, orgName, repoName, slot.Add(time.Duration(rng.Int63n(int64(interval)))), window.Now)
+		if run.CreatedAt.After(window.Now) {
+			continue
+		}
+		// Deploys share a concurrency group per branch, and queued ones
+		// wait on it (see WaitingOnConcurrency in runToJob)
+		deploy := strings.HasPrefix(run.GetName(), "Deploy")
+		if deploy && run.GetStatus() == "queued" {
+			run.Status = github.String("pending")
+		}
+
+		job, ok := runToJob(window, orgName, repoName, run)
+		if !ok {
+			continue
+		}
+		job.Provider = "demo"
+		if job.Status == "running" {
+			demoRunProgress(&job, run, duration, window.Now)
+		}
+		if run.GetName() == "Build & Test" && expandMatrix(job.Status) {
+			job.MatrixLegs = demoMatrixLegs(job, duration)
+		}
+		if deploy && job.Status != "success" && job.Status != "failed" {
+			job.ConcurrencyGroup = "deploy-" + run.GetHeadBranch()
+		}
+		if costEstimation && finished(job) {
+			job.RunnerMinutes = demoRunnerMinutes(repoSeed, duration)
+		}
+		if runnerStats && finished(job) {
+			job.Runners = demoRunnerUsage(repoSeed, runSeed, job.Status)
+			job.RunnerJobs = demoRunnerJobs(orgName, job.Runners, runSeed, job.Status)
+		}
+		if codeownersEnabled {
+			job.WorkflowPath = ".github/workflows/" + demoWorkflowFiles[run.GetName()]
+			job.Owners = ownersOf(demoCodeowners(orgName, repoSeed), job.WorkflowPath)
+		}
+		for attempt := 1; attempt < job.Attempt; attempt++ {
+			job.SupersededAttempts = append(job.SupersededAttempts, "failed")
+			job.FailedAttemptSeconds += int64(duration.Seconds())
+		}
+		// Pull requests are merged within two days
+		if branchCleanup && job.Event == "pull_request" && window.Now.Sub(job.CreatedAt) > 48*time.Hour {
+			job.BranchState = "merged"
+		}
+		if cancelled(job) {
+			// Mostly superseded by a newer push, like in real repositories
+			job.CancelReason = []string{"superseded", "superseded", "superseded", "user", "timeout"}[runSeed%5]
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// demoRunnerMinutes bills a run on the repository's runner: mostly Linux,
+// with the odd Windows or macOS repository.
+func demoRunnerMinutes(repoSeed uint64, duration time.Duration) map[string]int64 {
+	label := "linux"
+	switch repoSeed % 10 {
+	case 0:
+		label = "windows"
+	case 1:
+		label = "macos"
+	}
+	return map[string]int64{label: int64(math.Ceil(duration.Minutes()))}
+}
+
+// demoRunnerUsage puts a run's jobs on the repository's runner label. Some
+// repositories use self-hosted runners, which queue a lot longer.
+func demoRunnerUsage(repoSeed, runSeed uint64, status string) []RunnerUsage {
+	label, queue := "ubuntu-latest", int64(5+runSeed%40)
+	switch repoSeed % 10 {
+	case 0:
+		label = "windows-latest"
+	case 1:
+		label = "macos-latest"
+		queue *= 3
+	case 2, 3:
+		label, queue = "self-hosted", int64(30+runSeed%600)
+	}
+	usage := RunnerUsage{Label: label, Jobs: 1 + int(runSeed%4), QueueSeconds: queue}
+	usage.MaxQueueSeconds = queue
+	usage.QueueSeconds *= int64(usage.Jobs)
+	if status == "failed" {
+		usage.Failed = 1
+	}
+	return []RunnerUsage{usage}
+}
+
+// demoRunnerJobs spreads the jobs on self-hosted runners over four
+// machines, of which runner-3 fails most of the failed runs.
+func demoRunnerJobs(orgName string, usages []RunnerUsage, runSeed uint64, status string) []RunnerJob {
+	var jobs []RunnerJob
+	for _, usage := range usages {
+		if usage.Label != "self-hosted" {
+			continue
+		}
+		for i := 0; i < usage.Jobs; i++ {
+			job := RunnerJob{
+				Job:    []string{"build", "test", "lint", "package"}[i],
+				Runner: fmt.Sprintf("%s-runner-%d", orgName, 1+(runSeed+uint64(i))%4),
+				Group:  "Default",
+			}
+			if status == "failed" && i == 0 {
+				job.Failed = true
+				if runSeed%3 != 0 {
+					job.Runner = orgName + "-runner-3"
+				}
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// demoCodeowners gives every repository a team, with deploy workflows
+// owned by the platform team as well.
+func demoCodeowners(orgName string, repoSeed uint64) []codeownersRule {
+	team := demoTeams[repoSeed%uint64(len(demoTeams))]
+	return parseCodeowners(fmt.Sprintf("* @%[1]s/%[2]s\n/.github/workflows/deploy*.yml @%[1]s/%[2]s @%[1]s/platform\n", orgName, team))
+}
+
+// GetLogs returns a made-up log for the run.
+func (demoProvider) GetLogs(ctx context.Context, repo Pipeline, runID int64) (string, error) {
+	var out strings.Builder
+	fmt.Fprintf(&out, "==> %s/%s run %d (demo) <==\n", repo.Org, repo.Name, runID)
+	for i, step := range []string{"Set up job", "Checkout", "Install dependencies", "Build", "Test", "Post Checkout", "Complete job"} {
+		fmt.Fprintf(&out, "%02d ##[group]%s\n", i+1, step)
+		fmt.Fprintf(&out, "%02d ##[endgroup]\n", i+1)
+	}
+	return out.String(), nil
+}
+
+func demoRun(rng *rand.Rand, seed uint64, orgName, repoName string, createdAt, now time.Time) (*github.WorkflowRun, time.Duration) {
+	duration := time.Duration(30+rng.Intn(1500)) * time.Second
+	startedAt := createdAt.Add(time.Duration(rng.Intn(60)) * time.Second)
+	updatedAt := startedAt.Add(duration)
+
+	status, conclusion := "completed", "success"
+	switch {
+	case now.Before(startedAt):
+		status, conclusion = "queued", ""
+		updatedAt = createdAt
+	case now.Before(updatedAt):
+		status, conclusion = "in_progress", ""
+		updatedAt = now
+	case rng.Float64() < demoFailureRate:
+		conclusion = "failure"
+		if rng.Intn(4) == 0 {
+			conclusion = "cancelled"
+		}
+	}
+
+	id := int64(seed % 1_000_000_000)
+	workflow := demoWorkflows[rng.Intn(len(demoWorkflows))]
+	branch := demoBranches[rng.Intn(len(demoBranches))]
+	htmlURL := fmt.Sprintf("https://github.com/%s/%s/actions/runs/%d", orgName, repoName, id)
+
+	run := &github.WorkflowRun{
+		ID:           github.Int64(id),
+		WorkflowID:   github.Int64(int64(demoHash(orgName, repoName, workflow) % 1_000_000)),
+		Name:         github.String(workflow),
+		RunNumber:    github.Int(1 + int(seed%5000)),
+		HeadBranch:   github.String(branch),
+		HeadSHA:      github.String(demoCommitSHA(orgName, repoName, branch, createdAt)),
+		Status:       github.String(status),
+		HTMLURL:      github.String(htmlURL),
+		CreatedAt:    &github.Timestamp{Time: createdAt},
+		RunStartedAt: &github.Timestamp{Time: startedAt},
+		UpdatedAt:    &github.Timestamp{Time: updatedAt},
+		Actor:        &github.User{Login: github.String(demoActors[seed%uint64(len(demoActors))])},
+		HeadCommit:   &github.HeadCommit{Message: github.String(demoCommits[seed/7%uint64(len(demoCommits))])},
+		Event:        github.String(demoEvent(workflow, branch)),
+	}
+	if conclusion != "" {
+		run.Conclusion = github.String(conclusion)
+	}
+	// Every so often a run is a re-run of a failed attempt
+	if seed%11 == 0 {
+		run.RunAttempt = github.Int(2 + int(seed/13%2))
+	}
+	return run, duration
+}
+
+// demoCommitSHA is the head of a demo branch, which moves every few hours,
+// so runs triggered in between share a commit.
+func demoCommitSHA(orgName, repoName, branch string, at time.Time) string {
+	slot := strconv.FormatInt(at.Truncate(4*time.Hour).Unix(), 10)
+	return fmt.Sprintf("%016x%016x%08x", demoHash(orgName, repoName, branch, slot), demoHash(slot, branch, repoName, orgName), uint32(demoHash(branch, slot)))
+}
+
+// demoEvent is what triggered a demo run: CodeQL runs nightly, work
+// branches build pull requests.
+func demoEvent(workflow, branch string) string {
+	switch {
+	case workflow == "CodeQL":
+		return "schedule"
+	case branch == "main" || branch == "develop" || strings.HasPrefix(branch, "release/"):
+		return "push"
+	}
+	return "pull_request"
+}
+
+// demoRunProgress fills in step counts for a running demo run, advancing
+// with the time it has been running.
+func demoRunProgress(job *Job, run *github.WorkflowRun, duration time.Duration, now time.Time) {
+	total := 4 + int(demoHash(job.ID)%12)
+	completed := 0
+	if started := run.GetRunStartedAt().Time; now.After(started) {
+		completed = int(float64(total) * float64(now.Sub(started)) / float64(duration))
+	}
+	if completed >= total {
+		completed = total - 1
+	}
+	job.StepsCompleted = &completed
+	job.StepsTotal = &total
+}
+
+// demoMatrixLegs splits a demo run into matrix legs. A failed run has one
+// failing leg, the way a single red OS usually turns a whole run red.
+func demoMatrixLegs(job Job, duration time.Duration) []MatrixLeg {
+	seed := demoHash(job.ID, "matrix")
+	failing := int(seed % uint64(len(demoMatrix)))
+
+	legs := make([]MatrixLeg, 0, len(demoMatrix))
+	for i, matrix := range demoMatrix {
+		legDuration := duration * time.Duration(60+demoHash(job.ID, matrix)%40) / 100
+		leg := MatrixLeg{
+			Job:             "test",
+			Matrix:          matrix,
+			Status:          "success",
+			Duration:        formatDuration(job.StartedAt, job.StartedAt.Add(legDuration)),
+			DurationSeconds: int64(legDuration.Seconds()),
+		}
+		switch {
+		case job.Status == "failed" && i == failing:
+			leg.Status = "failed"
+		case job.Status == "running" && i >= failing:
+			leg.Status = "running"
+		}
+		legs = append(legs, leg)
+	}
+	return legs
+}
+
+// demoActionsSettings returns the Actions settings of a demo organization
+// (repo "") or repository. Most follow the default baseline, a few
+// repositories were loosened.
+func demoActionsSettings(orgName, repoName string) map[string]string {
+	settings := map[string]string{
+		"allowed_actions":                  "selected",
+		"default_workflow_permissions":     "read",
+		"can_approve_pull_request_reviews": "false",
+		"fork_pr_approval":                 "first_time_contributors",
+	}
+	if repoName == "" {
+		settings["enabled_repositories"] = "all"
+		return settings
+	}
+	settings["enabled"] = "true"
+	if demoHash(orgName, repoName, "default_workflow_permissions")%4 == 0 {
+		settings["default_workflow_permissions"] = "write"
+	}
+	if demoHash(orgName, repoName, "allowed_actions")%5 == 0 {
+		settings["allowed_actions"] = "all"
+	}
+	if demoHash(orgName, repoName, "can_approve_pull_request_reviews")%7 == 0 {
+		settings["can_approve_pull_request_reviews"] = "true"
+	}
+	return settings
+}
+
+// demoWorkflowSources returns the workflow files of a demo organization's
+// repositories: current ones mostly, with some repositories lagging behind
+// on action versions, workflow commands and runner images.
+func demoWorkflowSources(orgName string) []workflowSource {
+	var files []workflowSource
+	for _, repoName := range demoRepos {
+		seed := demoHash(orgName, repoName, "workflows")
+		checkout, setupNode, runner := "v4", "v4", "ubuntu-latest"
+		switch seed % 4 {
+		case 0:
+			checkout, setupNode = "v2", "v2"
+		case 1:
+			checkout = "v3"
+		}
+		if seed%3 == 0 {
+			runner = "ubuntu-20.04"
+		}
+		output := `echo "version=$(cat VERSION)" >> "$GITHUB_OUTPUT"`
+		if seed%5 == 0 {
+			output = `echo "::set-output name=version::$(cat VERSION)"`
+		}
+		login := "docker/login-action@v3"
+		if seed%2 == 0 {
+			login = "docker/login-action@74a5d142397b4f367a81961eba4e8cd7edddf772 # v3.4.0"
+		}
+		// Some repositories deploy once CI has passed and publish through
+		// the organization's shared release workflow
+		deployOn := `
+  push:
+    branches: [main]`
+		if seed%3 != 1 {
+			deployOn = `
+  workflow_run:
+    workflows: [CI]
+    types: [completed]
+    branches: [main]`
+		}
+		release := ""
+		if seed%4 < 2 {
+			release = `  release:
+    needs: test
+    uses: ` + orgName + `/shared-workflows/.github/workflows/release.yml@main
+    secrets: inherit
+`
+		}
+
+		files = append(files, workflowSource{
+			Repository: orgName + "/" + repoName,
+			Path:       ".github/workflows/ci.yml",
+			Content: `name: CI
+on: [push, pull_request]
+jobs:
+  test:
+    runs-on: ` + runner + `
+    steps:
+      - uses: actions/checkout@` + checkout + `
+      - uses: actions/setup-node@` + setupNode + `
+        with:
+          node-version: 20
+      - uses: actions/cache@v4
+        with:
+          path: ~/.npm
+          key: npm-${{ hashFiles('package-lock.json') }}
+      - id: version
+        run: ` + output + `
+      - run: npm ci && npm test
+` + release,
+		})
+		files = append(files, workflowSource{
+			Repository: orgName + "/" + repoName,
+			Path:       ".github/workflows/deploy.yml",
+			Content: `name: Deploy Production
+on:` + deployOn + `
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: ` + login + `
+      - uses: docker/build-push-action@v` + strconv.Itoa(4+int(seed%3)) + `
+      - uses: azure/k8s-deploy@v4
+      - uses: ./.github/actions/notify
+`,
+		})
+	}
+	return files
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// deployEnvironments maps words in deploy workflow names to environments,
+// e.g. "Deploy Prod" deploys to production. Names with no known word use
+// what follows "deploy", e.g. "Deploy Canary" deploys to canary.
+var deployEnvironments = map[string]string{
+	"production":  "production",
+	"prod":        "production",
+	"staging":     "staging",
+	"stage":       "staging",
+	"stg":         "staging",
+	"development": "development",
+	"dev":         "development",
+}
+
+// maxDeployments caps the deployments read from the Deployments API per
+// request, each costs one extra call for its latest status.
+const maxDeployments = 30
+
+var deployWords = regexp.MustCompile(`[a-z0-9]+`)
+
+// EnvironmentTimeline is the deployments to one environment, newest first.
+type EnvironmentTimeline struct {
+	Environment string         `json:"environment"`
+	Current     *DeployRecord  `json:"current,omitempty"` // latest successful deployment
+	Deployments []DeployRecord `json:"deployments"`
+}
+
+// DeployRecord is one deployment, from a deploy workflow run, the
+// Deployments API, or both.
+type DeployRecord struct {
+	Repository    string    `json:"repository"`
+	Environment   string    `json:"environment"`
+	Status        string    `json:"status"`
+	State         string    `json:"state,omitempty"` // Deployments API state, e.g. "inactive" once superseded
+	Actor         string    `json:"actor,omitempty"`
+	SHA           string    `json:"sha,omitempty"`
+	Ref           string    `json:"ref,omitempty"`
+	CommitMessage string    `json:"commit_message,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	Workflow      string    `json:"workflow,omitempty"`
+	RunID         int64     `json:"run_id,omitempty"`
+	DeploymentID  int64     `json:"deployment_id,omitempty"`
+	HTMLURL       string    `json:"html_url,omitempty"`
+	Sources       []string  `json:"sources"` // "workflow", "deployments_api"
+}
+
+type DeploymentsResponse struct {
+	Period       string                `json:"period"`
+	Repository   string                `json:"repository,omitempty"`
+	FetchedAt    time.Time             `json:"fetched_at"`
+	Environments []EnvironmentTimeline `json:"environments"`
+}
+
+// loadDeployConfig reads DEPLOY_ENVIRONMENTS, extra words mapped to
+// environments, e.g. "uat=staging,live=production".
+func loadDeployConfig() {
+	for _, entry := range splitList(os.Getenv("DEPLOY_ENVIRONMENTS")) {
+		word, environment, ok := strings.Cut(entry, "=")
+		if !ok || word == "" || environment == "" {
+			log.Fatalf("Invalid DEPLOY_ENVIRONMENTS entry %q: expected word=environment", entry)
+		}
+		deployEnvironments[strings.ToLower(word)] = environment
+	}
+}
+
+// deployEnvironment returns the environment a workflow deploys to, or ""
+// when it isn't a deploy workflow.
+func deployEnvironment(workflow string) string {
+	words := deployWords.FindAllString(strings.ToLower(workflow), -1)
+	deploy := -1
+	for i, word := range words {
+		if strings.HasPrefix(word, "deploy") {
+			deploy = i
+			break
+		}
+	}
+	if deploy < 0 {
+		return ""
+	}
+	for _, word := range words {
+		if environment, ok := deployEnvironments[word]; ok {
+			return environment
+		}
+	}
+	rest := words[deploy+1:]
+	if len(rest) > 0 && rest[0] == "to" {
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return "default"
+	}
+	return strings.Join(rest, "-")
+}
+
+// deploymentsHandler serves /api/deployments, successive deployments per
+// environment. Deploy workflows come from the period's snapshot; with
+// ?repo=owner/repo the repository's GitHub Deployments are merged in too.
+func deploymentsHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	repo := strings.Trim(r.URL.Query().Get("repo"), "/")
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var records []DeployRecord
+	byRun := make(map[string]int) // repository and run ID to index in records
+	for _, job := range snap.Response.Jobs {
+		environment := deployEnvironment(workflowName(job.Name))
+		if environment == "" || (repo != "" && job.Organization+"/"+job.Pipeline != repo) {
+			continue
+		}
+		byRun[fmt.Sprintf("%s/%s#%d", job.Organization, job.Pipeline, job.RunID)] = len(records)
+		records = append(records, DeployRecord{
+			Repository:    job.Organization + "/" + job.Pipeline,
+			Environment:   environment,
+			Status:        job.Status,
+			Actor:         job.Actor,
+			SHA:           job.HeadSHA,
+			Ref:           job.Branch,
+			CommitMessage: job.CommitMessage,
+			CreatedAt:     job.CreatedAt,
+			Workflow:      workflowName(job.Name),
+			RunID:         job.RunID,
+			HTMLURL:       job.HTMLURL,
+			Sources:       []string{"workflow"},
+		})
+	}
+
+	if owner, name, ok := strings.Cut(repo, "/"); ok && githubClient != nil && !demoMode {
+		deployments, err := fetchDeployments(r.Context(), owner, name, newFetchWindow(period).Start)
+		if err != nil {
+			log.Printf("⚠️  Error listing deployments of %s: %v", repo, err)
+		}
+		for _, d := range deployments {
+			// Jobs with an environment create a deployment whose log points
+			// at their run; that's the same deployment as the workflow run
+			if i, ok := byRun[fmt.Sprintf("%s#%d", repo, d.RunID)]; ok && d.RunID != 0 {
+				records[i].Environment = d.Environment
+				records[i].State = d.State
+				records[i].DeploymentID = d.DeploymentID
+				records[i].Sources = append(records[i].Sources, "deployments_api")
+				if records[i].Actor == "" {
+					records[i].Actor = d.Actor
+				}
+				continue
+			}
+			records = append(records, d)
+		}
+	}
+
+	timelines := make(map[string]*EnvironmentTimeline)
+	for _, record := range records {
+		timeline, ok := timelines[record.Environment]
+		if !ok {
+			timeline = &EnvironmentTimeline{Environment: record.Environment}
+			timelines[record.Environment] = timeline
+		}
+		timeline.Deployments = append(timeline.Deployments, record)
+	}
+	response := DeploymentsResponse{Period: period, Repository: repo, FetchedAt: snap.FetchedAt, Environments: []EnvironmentTimeline{}}
+	for _, timeline := range timelines {
+		sort.Slice(timeline.Deployments, func(i, j int) bool {
+			return timeline.Deployments[i].CreatedAt.After(timeline.Deployments[j].CreatedAt)
+		})
+		for i := range timeline.Deployments {
+			if timeline.Deployments[i].Status == "success" {
+				current := timeline.Deployments[i]
+				timeline.Current = &current
+				break
+			}
+		}
+		response.Environments = append(response.Environments, *timeline)
+	}
+	// Production last, like a promotion pipeline reads
+	sort.Slice(response.Environments, func(i, j int) bool {
+		a, b := response.Environments[i].Environment, response.Environments[j].Environment
+		if (a == "production") != (b == "production") {
+			return b == "production"
+		}
+		return a < b
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
+
+var runIDInURL = regexp.MustCompile(`/actions/runs/([0-9]+)`)
+
+// fetchDeployments reads a repository's deployments since start from the
+// GitHub Deployments API, with their latest status.
+func fetchDeployments(ctx context.Context, owner, repo string, start time.Time) ([]DeployRecord, error) {
+	deployments, resp, err := githubClient.Repositories.ListDeployments(ctx, owner, repo, &github.DeploymentsListOptions{ListOptions: github.ListOptions{PerPage: maxDeployments}})
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DeployRecord
+	for _, d := range deployments {
+		if d.GetCreatedAt().Before(start) {
+			break // newest first
+		}
+		// Same names as the workflow timelines, "prod" and "Production" are
+		// one environment
+		environment := d.GetEnvironment()
+		if known, ok := deployEnvironments[strings.ToLower(environment)]; ok {
+			environment = known
+		}
+		record := DeployRecord{
+			Repository:   owner + "/" + repo,
+			Environment:  environment,
+			Status:       "pending",
+			Actor:        d.GetCreator().GetLogin(),
+			SHA:          d.GetSHA(),
+			Ref:          d.GetRef(),
+			CreatedAt:    d.GetCreatedAt().Time,
+			DeploymentID: d.GetID(),
+			Sources:      []string{"deployments_api"},
+		}
+		statuses, resp, err := githubClient.Repositories.ListDeploymentStatuses(ctx, owner, repo, d.GetID(), &github.ListOptions{PerPage: 1})
+		budget.update(resp)
+		if err != nil {
+			log.Printf("   ⚠️  Error reading status of deployment %d in %s/%s: %v", d.GetID(), owner, repo, err)
+		} else if len(statuses) > 0 {
+			status := statuses[0]
+			record.State = status.GetState()
+			record.Status = deploymentStatus(record.State)
+			record.HTMLURL = status.GetLogURL()
+			if record.HTMLURL == "" {
+				record.HTMLURL = status.GetTargetURL()
+			}
+			if m := runIDInURL.FindStringSubmatch(record.HTMLURL); m != nil {
+				record.RunID, _ = strconv.ParseInt(m[1], 10, 64)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// deploymentStatus maps a Deployments API state to the dashboard statuses.
+// A deployment turns inactive once a newer one succeeded, so it did succeed.
+func deploymentStatus(state string) string {
+	switch state {
+	case "success", "inactive":
+		return "success"
+	case "failure", "error":
+		return "failed"
+	case "in_progress":
+		return "running"
+	}
+	return "pending"
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Deprecated usage: actions older than the oldest supported major version,
+// workflow commands GitHub disabled, and retired runner images, found in
+// the workflow files of every repository (see scanWorkflows).
+
+// minActionVersions is the oldest major version still fine per action.
+// Older majors run on deprecated Node versions or stopped working.
+// DEPRECATED_ACTIONS ("owner/action@v4,...") adds or overrides entries.
+var minActionVersions = map[string]int{
+	"actions/checkout":           4,
+	"actions/setup-node":         4,
+	"actions/setup-python":       5,
+	"actions/setup-go":           5,
+	"actions/setup-java":         4,
+	"actions/setup-dotnet":       4,
+	"actions/cache":              4,
+	"actions/upload-artifact":    4,
+	"actions/download-artifact":  4,
+	"actions/github-script":      7,
+	"actions/labeler":            5,
+	"actions/stale":              9,
+	"github/codeql-action":       3,
+	"docker/login-action":        3,
+	"docker/setup-buildx-action": 3,
+	"docker/setup-qemu-action":   3,
+	"docker/build-push-action":   5,
+	"docker/metadata-action":     5,
+}
+
+// deprecatedCommands are workflow commands replaced by environment files.
+var deprecatedCommands = map[string]string{
+	"set-output": "$GITHUB_OUTPUT",
+	"save-state": "$GITHUB_STATE",
+	"set-env":    "$GITHUB_ENV",
+	"add-path":   "$GITHUB_PATH",
+}
+
+// retiredRunners are GitHub-hosted runner images that were removed.
+var retiredRunners = map[string]string{
+	"ubuntu-16.04": "ubuntu-latest",
+	"ubuntu-18.04": "ubuntu-latest",
+	"ubuntu-20.04": "ubuntu-latest",
+	"macos-10.15":  "macos-latest",
+	"macos-11":     "macos-latest",
+	"macos-12":     "macos-latest",
+	"macos-13":     "macos-latest",
+	"windows-2016": "windows-latest",
+	"windows-2019": "windows-latest",
+}
+
+var (
+	commandPattern = regexp.MustCompile(`::(set-output|save-state|set-env|add-path)\b`)
+	runsOnPattern  = regexp.MustCompile(`^\s*runs-on:`)
+	runnerImage    = regexp.MustCompile(`[a-z]+-[0-9][0-9.]*`)
+	majorVersion   = regexp.MustCompile(`^v?([0-9]+)(\.|$)`)
+)
+
+// DeprecatedUsage is one place a workflow uses something deprecated.
+type DeprecatedUsage struct {
+	Kind        string `json:"kind"` // action, command, or runner
+	Name        string `json:"name"` // e.g. actions/checkout@v2, set-output, ubuntu-20.04
+	Replacement string `json:"replacement"`
+	Repository  string `json:"repository"`
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+}
+
+// DeprecatedCount is how often one deprecated thing is used in an
+// organization.
+type DeprecatedCount struct {
+	Kind         string `json:"kind"`
+	Name         string `json:"name"`
+	Replacement  string `json:"replacement"`
+	Uses         int    `json:"uses"`
+	Repositories int    `json:"repositories"`
+}
+
+type OrgDeprecations struct {
+	Organization  string            `json:"organization"`
+	ReposScanned  int               `json:"repos_scanned"`
+	ReposSkipped  int               `json:"repos_skipped"` // not scanned because the rate limit budget ran out
+	FilesScanned  int               `json:"files_scanned"`
+	ReposAffected int               `json:"repos_affected"`
+	Counts        []DeprecatedCount `json:"counts"` // most used first
+	Usages        []DeprecatedUsage `json:"usages"`
+	Error         string            `json:"error,omitempty"`
+}
+
+type DeprecationsReport struct {
+	Orgs []OrgDeprecations `json:"orgs"`
+}
+
+func loadDeprecationConfig() {
+	for _, entry := range splitList(os.Getenv("DEPRECATED_ACTIONS")) {
+		action, version, _ := strings.Cut(entry, "@")
+		m := majorVersion.FindStringSubmatch(version)
+		if action == "" || m == nil {
+			log.Fatalf("Invalid DEPRECATED_ACTIONS entry %q: expected owner/action@v4", entry)
+		}
+		major, _ := strconv.Atoi(m[1])
+		minActionVersions[strings.ToLower(action)] = major
+	}
+}
+
+// deprecatedHandler serves /api/audit/deprecated, deprecated actions,
+// commands and runners per organization. ?org= limits the report to one
+// organization, ?refresh=true rescans the workflow files.
+func deprecatedHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	report := DeprecationsReport{Orgs: []OrgDeprecations{}}
+	for _, src := range currentSources() {
+		name := src.Provider.Name()
+		if (name != "github" && name != "demo") || (query.Get("org") != "" && src.Org != query.Get("org")) {
+			continue
+		}
+		scan := scanWorkflows(r.Context(), src.Org, query.Get("refresh") == "true")
+		result := findDeprecations(scan.Files)
+		result.Organization = src.Org
+		result.ReposScanned, result.ReposSkipped = scan.Repos, scan.ReposSkipped
+		if scan.Err != nil {
+			result.Error = scan.Err.Error()
+		}
+		report.Orgs = append(report.Orgs, result)
+	}
+	sort.Slice(report.Orgs, func(i, j int) bool { return report.Orgs[i].Organization < report.Orgs[j].Organization })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(report)
+}
+
+func findDeprecations(files []workflowSource) OrgDeprecations {
+	result := OrgDeprecations{FilesScanned: len(files), Counts: []DeprecatedCount{}, Usages: []DeprecatedUsage{}}
+	for _, file := range files {
+		for _, use := range file.uses() {
+			if replacement, ok := outdatedAction(use); ok {
+				result.Usages = append(result.Usages, DeprecatedUsage{Kind: "action", Name: use.Uses, Replacement: replacement, Repository: file.Repository, Path: file.Path, Line: use.Line})
+			}
+		}
+		for i, line := range strings.Split(file.Content, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			for _, m := range commandPattern.FindAllStringSubmatch(line, -1) {
+				result.Usages = append(result.Usages, DeprecatedUsage{Kind: "command", Name: m[1], Replacement: deprecatedCommands[m[1]], Repository: file.Repository, Path: file.Path, Line: i + 1})
+			}
+			if runsOnPattern.MatchString(line) {
+				for _, label := range runnerImage.FindAllString(line, -1) {
+					if replacement, ok := retiredRunners[label]; ok {
+						result.Usages = append(result.Usages, DeprecatedUsage{Kind: "runner", Name: label, Replacement: replacement, Repository: file.Repository, Path: file.Path, Line: i + 1})
+					}
+				}
+			}
+		}
+	}
+
+	counts := make(map[string]*DeprecatedCount)
+	repos := make(map[string]map[string]bool) // count key to repositories
+	affected := make(map[string]bool)
+	for _, usage := range result.Usages {
+		key := usage.Kind + "|" + usage.Name
+		count, ok := counts[key]
+		if !ok {
+			count = &DeprecatedCount{Kind: usage.Kind, Name: usage.Name, Replacement: usage.Replacement}
+			counts[key] = count
+			repos[key] = make(map[string]bool)
+		}
+		count.Uses++
+		repos[key][usage.Repository] = true
+		affected[usage.Repository] = true
+	}
+	for key, count := range counts {
+		count.Repositories = len(repos[key])
+		result.Counts = append(result.Counts, *count)
+	}
+	result.ReposAffected = len(affected)
+
+	sort.Slice(result.Counts, func(i, j int) bool {
+		a, b := result.Counts[i], result.Counts[j]
+		if a.Uses != b.Uses {
+			return a.Uses > b.Uses
+		}
+		return a.Name < b.Name
+	})
+	sort.SliceStable(result.Usages, func(i, j int) bool {
+		a, b := result.Usages[i], result.Usages[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	return result
+}
+
+// outdatedAction reports whether an action is used at a major version
+// older than minActionVersions, with the version to move to. Refs that
+// aren't versions (commit SHAs, branches) can't be judged.
+func outdatedAction(use actionUse) (string, bool) {
+	// Actions in subdirectories share the repository's versions, e.g.
+	// github/codeql-action/init
+	parts := strings.SplitN(strings.ToLower(use.Action), "/", 3)
+	if len(parts) < 2 {
+		return "", false
+	}
+	repo := parts[0] + "/" + parts[1]
+	minimum, ok := minActionVersions[repo]
+	m := majorVersion.FindStringSubmatch(use.Ref)
+	if !ok || m == nil {
+		return "", false
+	}
+	if major, _ := strconv.Atoi(m[1]); major >= minimum {
+		return "", false
+	}
+	return fmt.Sprintf("%s@v%d", use.Action, minimum), true
+}
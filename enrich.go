@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Enrichment plugins: custom logic that adds to jobs before they're cached
+// (a Jira ticket from the branch name, the owning team, ...) runs outside
+// the dashboard, as an HTTP endpoint (ENRICH_URL) or a command
+// (ENRICH_COMMAND). Both get a batch of jobs as JSON and answer with what to
+// add to each:
+//
+//	request:  {"jobs": [<job>, ...]}
+//	response: {"jobs": [{"id": "JOB-000042", "annotations": {"jira": "PAY-123"}, "tags": ["payments"]}]}
+//
+// Jobs left out of the response are left as they are.
+
+// enrichBatchSize caps the jobs sent in one request.
+const enrichBatchSize = 500
+
+var enrichment struct {
+	url     string
+	command []string
+	timeout time.Duration
+	client  *http.Client
+
+	// Results by run state, so runs that haven't changed aren't sent again
+	mu    sync.Mutex
+	cache map[string]JobEnrichment
+}
+
+type enrichRequest struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// JobEnrichment is what a plugin adds to one job.
+type JobEnrichment struct {
+	ID          string            `json:"id"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+}
+
+type enrichResponse struct {
+	Jobs []JobEnrichment `json:"jobs"`
+}
+
+// loadEnrichConfig reads ENRICH_URL or ENRICH_COMMAND (split on spaces,
+// e.g. "python3 /plugins/jira.py") and ENRICH_TIMEOUT.
+func loadEnrichConfig() {
+	enrichment.url = strings.TrimSpace(os.Getenv("ENRICH_URL"))
+	enrichment.command = strings.Fields(os.Getenv("ENRICH_COMMAND"))
+	enrichment.timeout = getEnvDuration("ENRICH_TIMEOUT", 10*time.Second)
+	enrichment.cache = make(map[string]JobEnrichment)
+	switch {
+	case enrichment.url != "" && len(enrichment.command) > 0:
+		log.Fatalf("Set either ENRICH_URL or ENRICH_COMMAND, not both")
+	case enrichment.url != "":
+		enrichment.client = newHTTPClient()
+		log.Printf("🧩 Enriching jobs through %s", enrichment.url)
+	case len(enrichment.command) > 0:
+		log.Printf("🧩 Enriching jobs through command %q", strings.Join(enrichment.command, " "))
+	}
+}
+
+// enrichKey identifies a run in a given state; a plugin's answer for it
+// doesn't change until the run does.
+func enrichKey(job Job) string {
+	return job.ID + "|" + job.Status + "|" + strconv.Itoa(job.Attempt)
+}
+
+// enrichJobs applies the enrichment plugin to the jobs. A failing batch is
+// logged and leaves its jobs as they are, the other batches are still
+// sent; it never fails a fetch.
+func enrichJobs(jobs []Job) {
+	if enrichment.url == "" && len(enrichment.command) == 0 {
+		return
+	}
+
+	var pending []int
+	enrichment.mu.Lock()
+	for i := range jobs {
+		if result, ok := enrichment.cache[enrichKey(jobs[i])]; ok {
+			applyEnrichment(&jobs[i], result)
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	enrichment.mu.Unlock()
+
+	for start := 0; start < len(pending); start += enrichBatchSize {
+		batch := pending[start:min(start+enrichBatchSize, len(pending))]
+		request := enrichRequest{Jobs: make([]Job, len(batch))}
+		for i, index := range batch {
+			request.Jobs[i] = jobs[index]
+		}
+		results, err := callEnrichPlugin(request)
+		if err != nil {
+			log.Printf("⚠️  Error enriching %d jobs (batch %d of %d): %v", len(batch), start/enrichBatchSize+1, (len(pending)+enrichBatchSize-1)/enrichBatchSize, err)
+			continue
+		}
+
+		byID := make(map[string]JobEnrichment, len(results))
+		for _, result := range results {
+			byID[result.ID] = result
+		}
+		enrichment.mu.Lock()
+		if len(enrichment.cache) >= 4*max(maxJobs, enrichBatchSize) {
+			enrichment.cache = make(map[string]JobEnrichment)
+		}
+		for _, index := range batch {
+			result := byID[jobs[index].ID]
+			enrichment.cache[enrichKey(jobs[index])] = result
+			applyEnrichment(&jobs[index], result)
+		}
+		enrichment.mu.Unlock()
+	}
+}
+
+// applyEnrichment adds a plugin's annotations and tags to a job. Tags must
+// look like custom tags, and "maintenance" stays reserved.
+func applyEnrichment(job *Job, result JobEnrichment) {
+	for key, value := range result.Annotations {
+		if job.Annotations == nil {
+			job.Annotations = make(map[string]string)
+		}
+		job.Annotations[key] = value
+	}
+	for _, tag := range result.Tags {
+		if tagPattern.MatchString(tag) && tag != "maintenance" && !hasTag(*job, tag) {
+			job.Tags = append(job.Tags, tag)
+		}
+	}
+}
+
+func callEnrichPlugin(request enrichRequest) ([]JobEnrichment, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), enrichment.timeout)
+	defer cancel()
+
+	var output []byte
+	if enrichment.url != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, enrichment.url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := enrichment.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("POST %s: %s", enrichment.url, resp.Status)
+		}
+		if output, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		cmd := exec.CommandContext(ctx, enrichment.command[0], enrichment.command[1:]...)
+		cmd.Stdin = bytes.NewReader(body)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if output, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	var response enrichResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("invalid plugin response: %v", err)
+	}
+	return response.Jobs, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+	githuboauth "golang.org/x/oauth2/github"
+)
+
+// GitHub Enterprise Server: GITHUB_BASE_URL points the dashboard at an
+// on-prem instance, e.g. https://github.example.com (/api/v3/ is added when
+// missing), with GITHUB_UPLOAD_URL for uploads if they're served elsewhere.
+// Links, OAuth login and GraphQL use the same host. GHES has rate limiting
+// off unless an administrator turns it on, so its responses may carry no
+// rate limit at all; the dashboard then reports the limit as unlimited
+// instead of pacing against a made-up one.
+
+var (
+	// githubWebURL is where repositories, runs and settings are linked to.
+	githubWebURL = "https://github.com"
+
+	// githubEnterprise is set with GITHUB_BASE_URL.
+	githubEnterprise bool
+)
+
+// withEnterpriseURLs points the client at GITHUB_BASE_URL, if set.
+func withEnterpriseURLs(client *github.Client) *github.Client {
+	baseURL, uploadURL := os.Getenv("GITHUB_BASE_URL"), os.Getenv("GITHUB_UPLOAD_URL")
+	if baseURL == "" {
+		if uploadURL != "" {
+			log.Fatal("GITHUB_UPLOAD_URL needs GITHUB_BASE_URL")
+		}
+		return client
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		log.Fatalf("Invalid GITHUB_BASE_URL %q: expected the URL of a GitHub Enterprise Server, e.g. https://github.example.com", baseURL)
+	}
+	if strings.EqualFold(base.Host, "api.github.com") || strings.EqualFold(base.Host, "github.com") {
+		log.Fatalf("Invalid GITHUB_BASE_URL %q: it's for GitHub Enterprise Server, leave it unset for github.com", baseURL)
+	}
+	if uploadURL == "" {
+		uploadURL = baseURL
+	}
+	client, err = client.WithEnterpriseURLs(baseURL, uploadURL)
+	if err != nil {
+		log.Fatalf("Invalid GITHUB_BASE_URL or GITHUB_UPLOAD_URL: %v", err)
+	}
+	githubEnterprise = true
+	githubWebURL = base.Scheme + "://" + base.Host
+	log.Printf("🏢 GitHub Enterprise Server: %s", client.BaseURL)
+	return client
+}
+
+// githubOAuthEndpoint is the OAuth endpoint of github.com, or of the
+// GitHub Enterprise Server.
+func githubOAuthEndpoint() oauth2.Endpoint {
+	if !githubEnterprise {
+		return githuboauth.Endpoint
+	}
+	return oauth2.Endpoint{
+		AuthURL:  githubWebURL + "/login/oauth/authorize",
+		TokenURL: githubWebURL + "/login/oauth/access_token",
+	}
+}
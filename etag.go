@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conditional requests: GitHub answers a GET that carries the ETag of its
+// previous response with 304 Not Modified when nothing changed, and 304s
+// don't count against the rate limit. The bodies of JSON responses are
+// kept by URL, in memory up to ETAG_CACHE_MAX_MB and optionally in
+// ETAG_CACHE_DIR so they survive a restart, and a 304 is answered from
+// them as if GitHub had sent the whole response again.
+
+// etagCacheMaxAge prunes entries of ETAG_CACHE_DIR that weren't written
+// for this long, like those of listings whose created filter moved on.
+const etagCacheMaxAge = 48 * time.Hour
+
+// maxETagBody leaves out large responses, like logs.
+const maxETagBody = 2 << 20
+
+// etagEntry is a cached response.
+type etagEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"` // Content-Type and Link, for pagination
+	Body         []byte      `json:"body"`
+}
+
+func (e *etagEntry) size() int {
+	return len(e.URL) + len(e.Body)
+}
+
+// etagCache keeps the most recently used entries in memory, up to maxBytes.
+type etagCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	order    *list.List // of *etagEntry, most recently used first
+	entries  map[string]*list.Element
+	dir      string
+}
+
+func newETagCache(maxBytes int, dir string) *etagCache {
+	return &etagCache{maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element), dir: dir}
+}
+
+func (c *etagCache) get(url string) *etagEntry {
+	c.mu.Lock()
+	if elem, ok := c.entries[url]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*etagEntry)
+	}
+	c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return nil
+	}
+	var entry etagEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		return nil
+	}
+	c.remember(&entry)
+	return &entry
+}
+
+func (c *etagCache) put(entry *etagEntry) {
+	c.remember(entry)
+	if c.dir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.path(entry.URL), data, 0o600); err != nil {
+		log.Printf("⚠️  Error writing ETag cache entry: %v", err)
+	}
+}
+
+// remember adds an entry to memory, dropping the least recently used ones
+// over maxBytes.
+func (c *etagCache) remember(entry *etagEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.URL]; ok {
+		c.bytes -= elem.Value.(*etagEntry).size()
+		c.order.Remove(elem)
+	}
+	c.entries[entry.URL] = c.order.PushFront(entry)
+	c.bytes += entry.size()
+	for c.bytes > c.maxBytes && c.order.Len() > 0 {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*etagEntry).URL)
+		c.bytes -= oldest.Value.(*etagEntry).size()
+	}
+}
+
+// touch keeps an entry that is still current from being pruned.
+func (c *etagCache) touch(url string) {
+	if c.dir != "" {
+		now := time.Now()
+		os.Chtimes(c.path(url), now, now)
+	}
+}
+
+func (c *etagCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// prune removes the entries of dir that weren't written for maxAge.
+func (c *etagCache) prune(maxAge time.Duration) {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	removed := 0
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !strings.HasSuffix(file.Name(), ".json") || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if os.Remove(filepath.Join(c.dir, file.Name())) == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("🧹 Removed %d old ETag cache entries from %s", removed, c.dir)
+	}
+}
+
+// etagTransport sends the ETag of the cached response along and answers a
+// 304 from the cache.
+type etagTransport struct {
+	base  http.RoundTripper
+	cache *etagCache
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.base.RoundTrip(req)
+	}
+	url := req.URL.String()
+	cached := t.cache.get(url)
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		} else {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		t.cache.touch(url)
+		return cachedResponse(req, resp, cached), nil
+	}
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("ETag") == "" && resp.Header.Get("Last-Modified") == "") ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") || resp.ContentLength > maxETagBody {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxETagBody+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) <= maxETagBody {
+		entry := &etagEntry{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Header: make(http.Header), Body: body}
+		for _, name := range []string{"Content-Type", "Link"} {
+			if values := resp.Header.Values(name); len(values) > 0 {
+				entry.Header[name] = values
+			}
+		}
+		t.cache.put(entry)
+	}
+	return resp, nil
+}
+
+// cachedResponse turns a 304 into the 200 it stands for: the cached body,
+// with the rate limit headers of the 304.
+func cachedResponse(req *http.Request, notModified *http.Response, cached *etagEntry) *http.Response {
+	header := notModified.Header.Clone()
+	for name, values := range cached.Header {
+		header[name] = values
+	}
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       req,
+	}
+}
+
+// withETagCache adds conditional requests to the GitHub client, configured
+// by ETAG_CACHE_MAX_MB (default 64, 0 disables) and ETAG_CACHE_DIR. Recorded
+// fixtures have to hold whole responses, so they go without.
+func withETagCache(client *http.Client) *http.Client {
+	maxMB := getEnvInt("ETAG_CACHE_MAX_MB", 64)
+	if maxMB < 0 {
+		log.Fatalf("Invalid ETAG_CACHE_MAX_MB %d: must be 0 or more", maxMB)
+	}
+	if maxMB == 0 || recordDir != "" || replayDir != "" {
+		return client
+	}
+
+	dir := strings.TrimSpace(os.Getenv("ETAG_CACHE_DIR"))
+	cache := newETagCache(maxMB<<20, dir)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			log.Fatalf("Error creating ETAG_CACHE_DIR %s: %v", dir, err)
+		}
+		go func() {
+			for {
+				cache.prune(etagCacheMaxAge)
+				time.Sleep(24 * time.Hour)
+			}
+		}()
+	}
+
+	wrapped := *client
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped.Transport = &etagTransport{base: base, cache: cache}
+	return &wrapped
+}
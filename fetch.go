@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fetchWindow is the time range a period covers.
+type fetchWindow struct {
+	Period string
+	Now    time.Time
+	Start  time.Time
+	End    time.Time // zero when the window is open-ended
+}
+
+func newFetchWindow(period string) fetchWindow {
+	now := clock()
+	w := fetchWindow{Period: period, Now: now}
+
+	switch period {
+	case "today":
+		// Untuk "today", gunakan dari jam 1 pagi (01:00:00) hingga jam 11 malam (23:00:00) hari ini
+		w.Start = time.Date(now.Year(), now.Month(), now.Day(), 1, 0, 0, 0, now.Location())
+		w.End = time.Date(now.Year(), now.Month(), now.Day(), 23, 0, 0, 0, now.Location())
+		log.Printf("📅 Filter 'today': startTime = %v (now = %v)", w.Start, now)
+	case "week":
+		w.Start = now.AddDate(0, 0, -7) // 7 hari yang lalu
+	case "month":
+		w.Start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()) // Awal bulan ini
+	default:
+		w.Start = now.AddDate(0, 0, -7) // Default: seminggu terakhir
+	}
+	return w
+}
+
+// contains reports whether t falls inside the window. The start is
+// inclusive, and so is the end for "today".
+func (w fetchWindow) contains(t time.Time) bool {
+	// Convert ke timezone lokal untuk perbandingan yang benar
+	local := t.In(w.Now.Location())
+	if local.Before(w.Start) {
+		return false
+	}
+	return w.End.IsZero() || !local.After(w.End)
+}
+
+func (w fetchWindow) name() string {
+	switch w.Period {
+	case "today":
+		return "today"
+	case "month":
+		return "this month"
+	default:
+		return "this week"
+	}
+}
+
+// fetchWorkflowRuns fetches the workflow runs for the period and feeds them
+// into the collector as they arrive. It also returns a summary per
+// organization.
+func fetchWorkflowRuns(ctx context.Context, period string, collector *jobCollector) (*RateLimitInfo, []OrgSummary, error) {
+	var rateLimitInfo *RateLimitInfo
+	var orgs []OrgSummary
+	window := newFetchWindow(period)
+
+	log.Printf("📅 Fetching workflow runs for period: %s (since %v)", period, window.Start)
+
+	for result := range fetchAllOrgs(ctx, window) {
+		if result.Err != nil {
+			log.Printf("❌ Error listing repositories for organization %s: %v", result.Org, result.Err)
+		}
+		rateLimitInfo = lowerRateLimit(rateLimitInfo, result.RateLimit)
+		collector.merge(result.Collector)
+		orgs = append(orgs, result.summary())
+	}
+
+	log.Printf("📊 Total jobs collected from all organizations: %d", collector.len())
+
+	// Return default rate limit if not set
+	if rateLimitInfo == nil {
+		rateLimitInfo = &RateLimitInfo{
+			Remaining: 5000,
+			Limit:     5000,
+			ResetAt:   time.Now().Add(1 * time.Hour),
+		}
+	}
+
+	return rateLimitInfo, orgs, nil
+}
+
+// orgResult is the outcome of fetching a single organization.
+type orgResult struct {
+	Org          string
+	Provider     string
+	Collector    *jobCollector
+	RateLimit    *RateLimitInfo
+	Repos        int // pipelines whose runs were fetched
+	ReposSkipped int // pipelines skipped because the rate limit budget or FETCH_TIMEOUT ran out
+	ReposReused  int // unchanged pipelines whose runs were carried over (INCREMENTAL_SYNC)
+	Err          error
+}
+
+// fetchAllOrgs fetches every configured organization concurrently, so one
+// slow organization doesn't hold up the others. Results are delivered in
+// completion order and the channel is closed once all organizations are done,
+// or FETCH_TIMEOUT has passed and they've returned what they had.
+func fetchAllOrgs(ctx context.Context, window fetchWindow) <-chan orgResult {
+	sources := currentSources()
+	results := make(chan orgResult, len(sources))
+	ctx, cancel := withPhaseTimeout(ctx, fetchTimeout)
+	updateProgress(window.Period, func(p *FetchProgress) { p.OrgsTotal = len(sources) })
+
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		wg.Add(1)
+		go func(src source) {
+			defer wg.Done()
+
+			result := fetchOrgRuns(ctx, window, src)
+			updateProgress(window.Period, func(p *FetchProgress) { p.OrgsDone++ })
+			results <- result
+		}(src)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(results)
+	}()
+	return results
+}
+
+// lowerRateLimit returns whichever rate limit has less budget left. All
+// organizations share the same token, so the lowest remaining count is the
+// most recent one. An unlimited one has the most left.
+func lowerRateLimit(a, b *RateLimitInfo) *RateLimitInfo {
+	if a == nil || (a.Unlimited && b != nil) {
+		return b
+	}
+	if b == nil || b.Unlimited || a.Remaining <= b.Remaining {
+		return a
+	}
+	return b
+}
+
+// fetchOrgRuns fetches the runs of every pipeline of the source that was
+// active during the window, along with the provider's rate limit, if any.
+func fetchOrgRuns(ctx context.Context, window fetchWindow, src source) orgResult {
+	provider, orgName := src.Provider, src.Org
+	collector := newJobCollector(maxJobs)
+	result := orgResult{Org: orgName, Provider: provider.Name(), Collector: collector}
+
+	log.Printf("📦 Fetching %s pipelines for organization: %s", provider.Name(), orgName)
+
+	pipelines, err := provider.ListPipelines(ctx, window, orgName)
+	if err != nil {
+		result.RateLimit, result.Err = providerRateLimit(provider), err
+		collector.errors = append(collector.errors, newFetchError(provider.Name(), orgName, "", err))
+		collector.partial = ctx.Err() != nil
+		return result
+	}
+	// GitHub filters its repositories itself, before checking their workflows
+	pipelines = filterPipelines(pipelines)
+	updateProgress(window.Period, func(p *FetchProgress) { p.ReposTotal += len(pipelines) })
+
+	// With incremental sync only pipelines active since the previous fetch
+	// are fetched, unless a full sync is due
+	var prev, next *syncState
+	if incrementalSync {
+		prev = loadSyncState(ctx, window.Period, src)
+		next = &syncState{FullSyncAt: prev.FullSyncAt, Pipelines: make(map[string]pipelineState)}
+		if prev.fullSyncDue() {
+			prev = nil
+		}
+	}
+
+	// Pipelines are fetched by up to FETCH_CONCURRENCY workers shared with
+	// the other organizations, and merged in order once all are done
+	runs := make([]pipelineRuns, len(pipelines))
+	var exhausted atomic.Bool
+	var wg sync.WaitGroup
+	for i, pipeline := range pipelines {
+		if prev != nil {
+			if jobs, ok := prev.reuse(window, pipeline); ok {
+				runs[i] = pipelineRuns{outcome: pipelineReused, jobs: jobs}
+				updateProgress(window.Period, func(p *FetchProgress) { p.ReposDone++ })
+				continue
+			}
+		}
+		// Once the budget ran out, and past FETCH_TIMEOUT, only unchanged
+		// pipelines are still added
+		if exhausted.Load() {
+			runs[i].outcome = pipelineSkipped
+			continue
+		}
+		if !acquireFetchSlot(ctx) {
+			runs[i].outcome = pipelineTimedOut
+			continue
+		}
+
+		log.Printf("   [%d/%d] Fetching runs for pipeline: %s/%s",
+			i+1, len(pipelines), orgName, pipeline.Name)
+
+		wg.Add(1)
+		go func(i int, pipeline Pipeline) {
+			defer wg.Done()
+			defer releaseFetchSlot()
+
+			jobs, err := provider.ListRuns(ctx, window, pipeline)
+			if errors.Is(err, errBudgetExhausted) || errors.Is(err, errThrottled) {
+				exhausted.Store(true)
+				runs[i] = pipelineRuns{outcome: pipelineSkipped, err: err}
+				return
+			}
+			updateProgress(window.Period, func(p *FetchProgress) { p.ReposDone++ })
+			runs[i] = pipelineRuns{outcome: pipelineFetched, jobs: jobs, err: err}
+		}(i, pipeline)
+	}
+	wg.Wait()
+
+	var skipped, timedOut []string
+	var budgetErr error
+	for i, pipeline := range pipelines {
+		r := runs[i]
+		switch r.outcome {
+		case pipelineReused:
+			result.ReposReused++
+		case pipelineSkipped:
+			skipped = append(skipped, pipeline.Name)
+			if r.err != nil {
+				budgetErr = r.err
+			}
+			continue
+		case pipelineTimedOut:
+			timedOut = append(timedOut, pipeline.Name)
+			continue
+		default:
+			result.Repos++
+			if r.err != nil {
+				log.Printf("   ❌ Error fetching runs for %s/%s: %v", orgName, pipeline.Name, r.err)
+				collector.errors = append(collector.errors, newFetchError(provider.Name(), orgName, pipeline.Name, r.err))
+				queueRetry(window.Period, src, pipeline, r.err)
+				continue
+			}
+			dequeueRetry(window.Period, src, pipeline)
+		}
+		if next != nil {
+			next.remember(pipeline, r.jobs)
+		}
+		for _, job := range r.jobs {
+			collector.add(job)
+		}
+	}
+
+	if len(skipped) > 0 {
+		if budgetErr == nil {
+			budgetErr = errBudgetExhausted
+		}
+		log.Printf("   ⏸️  Skipping %d remaining pipelines in %s: %v", len(skipped), orgName, budgetErr)
+		updateProgress(window.Period, func(p *FetchProgress) { p.ReposSkipped += len(skipped) })
+		result.ReposSkipped = len(skipped)
+		fetchErr := newFetchError(provider.Name(), orgName, "", budgetErr)
+		fetchErr.Skipped = len(skipped)
+		fetchErr.SkippedRepos = skipped
+		collector.errors = append(collector.errors, fetchErr)
+	}
+	if len(timedOut) > 0 {
+		log.Printf("   ⏱️  Skipping %d remaining pipelines in %s: FETCH_TIMEOUT of %v reached", len(timedOut), orgName, fetchTimeout)
+		updateProgress(window.Period, func(p *FetchProgress) { p.ReposSkipped += len(timedOut) })
+		result.ReposSkipped += len(timedOut)
+		fetchErr := newFetchError(provider.Name(), orgName, "", fmt.Errorf("FETCH_TIMEOUT of %v reached: %w", fetchTimeout, ctx.Err()))
+		fetchErr.Skipped = len(timedOut)
+		fetchErr.SkippedRepos = timedOut
+		collector.errors = append(collector.errors, fetchErr)
+	}
+	collector.partial = ctx.Err() != nil
+
+	log.Printf("✅ Completed fetching for organization %s. Total jobs collected: %d",
+		orgName, collector.len())
+
+	if next != nil {
+		if result.ReposReused > 0 {
+			log.Printf("   ♻️  Reused runs of %d unchanged pipelines in %s (incremental sync)", result.ReposReused, orgName)
+		}
+		// A full sync only counts once every pipeline has been fetched
+		if prev == nil && result.ReposSkipped == 0 {
+			next.FullSyncAt = clock()
+		}
+		saveSyncState(context.WithoutCancel(ctx), window.Period, src, next)
+	}
+
+	result.RateLimit = providerRateLimit(provider)
+	return result
+}
+
+// pipelineRuns is what became of one pipeline in fetchOrgRuns.
+type pipelineRuns struct {
+	outcome fetchOutcome
+	jobs    []Job
+	err     error
+}
+
+type fetchOutcome int
+
+const (
+	pipelineFetched  fetchOutcome = iota
+	pipelineReused                // unchanged since the previous fetch (incremental sync)
+	pipelineSkipped               // rate limit budget exhausted
+	pipelineTimedOut              // FETCH_TIMEOUT reached
+)
+
+// fetchConcurrency caps the pipelines fetched at the same time, across all
+// organizations (FETCH_CONCURRENCY).
+var fetchConcurrency = 8
+
+var fetchSlots struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+// acquireFetchSlot waits for one of the FETCH_CONCURRENCY slots; false
+// when ctx ends first.
+func acquireFetchSlot(ctx context.Context) bool {
+	fetchSlots.once.Do(func() { fetchSlots.ch = make(chan struct{}, max(fetchConcurrency, 1)) })
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case fetchSlots.ch <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func releaseFetchSlot() {
+	<-fetchSlots.ch
+}
+
+func pipelineNames(pipelines []Pipeline) []string {
+	names := make([]string, len(pipelines))
+	for i, pipeline := range pipelines {
+		names[i] = pipeline.Name
+	}
+	return names
+}
+
+// providerRateLimit returns the provider's rate limit, or nil if it has none.
+func providerRateLimit(provider Provider) *RateLimitInfo {
+	if limiter, ok := provider.(rateLimiter); ok {
+		return limiter.RateLimit()
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// FetchError is an organization or repository whose runs are missing from
+// a snapshot, so users can tell incomplete data from a quiet period.
+type FetchError struct {
+	Provider     string `json:"provider"`
+	Organization string `json:"organization"`
+	Repository   string `json:"repository,omitempty"` // empty when the organization's repositories couldn't be listed
+	Reason       string `json:"reason"`               // unauthorized, forbidden, not_found, rate_limit, timeout, server_error or error
+	Status       int    `json:"status,omitempty"`     // HTTP status, when the API answered
+	Message      string `json:"message"`
+	Skipped      int    `json:"skipped,omitempty"` // repositories not fetched because the rate limit budget or FETCH_TIMEOUT ran out
+
+	SkippedRepos []string `json:"skipped_repos,omitempty"`
+}
+
+func newFetchError(provider, org, repo string, err error) FetchError {
+	reason, status := classifyFetchError(err)
+	return FetchError{Provider: provider, Organization: org, Repository: repo, Reason: reason, Status: status, Message: err.Error()}
+}
+
+// classifyFetchError tells why a provider call failed, with the HTTP
+// status if there was one.
+func classifyFetchError(err error) (reason string, status int) {
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var ghErr *github.ErrorResponse
+	var providerErr *apiError
+	switch {
+	case errors.Is(err, errBudgetExhausted), errors.Is(err, errThrottled):
+		return "rate_limit", 0
+	case errors.As(err, &rateErr):
+		return "rate_limit", rateErr.Response.StatusCode
+	case errors.As(err, &abuseErr):
+		return "rate_limit", abuseErr.Response.StatusCode
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout", 0
+	case errors.As(err, &ghErr) && ghErr.Response != nil:
+		status = ghErr.Response.StatusCode
+	case errors.As(err, &providerErr):
+		status = providerErr.StatusCode
+	default:
+		return "error", 0
+	}
+
+	switch {
+	case status == http.StatusUnauthorized:
+		return "unauthorized", status
+	case status == http.StatusForbidden && strings.Contains(strings.ToLower(err.Error()), "rate limit"):
+		return "rate_limit", status
+	case status == http.StatusForbidden:
+		return "forbidden", status
+	case status == http.StatusNotFound:
+		return "not_found", status
+	case status == http.StatusTooManyRequests:
+		return "rate_limit", status
+	case status >= 500:
+		return "server_error", status
+	}
+	return "error", status
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Rate limit forecast: how many GitHub API calls the next refresh of a
+// period will need, estimated from the calls the last fetch made per
+// organization, against what will be left of the budget by then.
+
+const jobsEndpoint = "GET /repos/{owner}/{repo}/actions/runs/{id}/jobs"
+
+// maxForecastRepos caps the repositories named per organization.
+const maxForecastRepos = 20
+
+type RefreshForecast struct {
+	EstimatedCalls int           `json:"estimated_calls"`
+	Available      int           `json:"available"` // calls left above RATE_LIMIT_RESERVE when the refresh is due
+	Sufficient     bool          `json:"sufficient"`
+	Warning        string        `json:"warning,omitempty"`
+	Orgs           []OrgForecast `json:"orgs"`
+	Advice         []string      `json:"advice,omitempty"` // how to make the refresh fit, when it doesn't
+}
+
+type OrgForecast struct {
+	Organization   string `json:"organization"`
+	Repos          int    `json:"repos"` // active in the period, fetched, reused or not
+	EstimatedCalls int    `json:"estimated_calls"`
+	ReposAtRisk    int    `json:"repos_at_risk"` // expected to be skipped, least recently active first
+	// Repositories expected to be skipped, as far as the last fetch saw
+	// them; repositories without runs in the period are skipped first
+	SkippedRepos []string `json:"skipped_repos,omitempty"`
+}
+
+// forecastRefresh estimates the next refresh of a period from its current
+// snapshot. It returns nil when there is nothing to base the forecast on:
+// no GitHub organizations, or no rate limit seen yet.
+func forecastRefresh(period string, snap *Snapshot) *RefreshForecast {
+	rate := budget.rateLimit()
+	if rate == nil || snap.Debug == nil {
+		return nil
+	}
+
+	calls := make(map[string]int)
+	listCalls := make(map[string]int)
+	jobCalls := 0
+	for _, call := range snap.Debug.APICalls {
+		calls[call.Org] += call.Calls
+		switch call.Endpoint {
+		case "GET /orgs/{org}/repos", "GET /users/{org}/repos":
+			listCalls[call.Org] += call.Calls
+		case jobsEndpoint:
+			jobCalls += call.Calls
+		}
+	}
+
+	forecast := &RefreshForecast{Orgs: []OrgForecast{}}
+	perRepo := make(map[string]float64)
+	for _, org := range snap.Orgs {
+		if org.Provider != "github" || org.Error != "" {
+			continue
+		}
+		list := max(listCalls[org.Organization], 1)
+		// Each repository costs at least the call listing its runs
+		perRepo[org.Organization] = 1
+		if org.ReposScanned > 0 {
+			perRepo[org.Organization] = math.Max(1, float64(calls[org.Organization]-list)/float64(org.ReposScanned))
+		}
+		// Reused repositories may be fetched again by the next (full) sync
+		repos := org.ReposScanned + org.ReposSkipped + org.ReposReused
+		estimate := list + int(math.Ceil(perRepo[org.Organization]*float64(repos)))
+		forecast.Orgs = append(forecast.Orgs, OrgForecast{Organization: org.Organization, Repos: repos, EstimatedCalls: estimate})
+		forecast.EstimatedCalls += estimate
+	}
+	if len(forecast.Orgs) == 0 {
+		return nil
+	}
+
+	// After the reset the whole limit is available again
+	due := snap.FetchedAt.Add(currentCacheTTL())
+	if due.After(rate.ResetAt) {
+		forecast.Available = max(rate.Limit-reservedCalls(), 0)
+	} else {
+		forecast.Available = max(rate.Remaining-reservedCalls(), 0)
+	}
+	forecast.Sufficient = forecast.EstimatedCalls <= forecast.Available
+	sort.Slice(forecast.Orgs, func(i, j int) bool { return forecast.Orgs[i].EstimatedCalls > forecast.Orgs[j].EstimatedCalls })
+	if forecast.Sufficient {
+		return forecast
+	}
+
+	// Organizations are fetched concurrently, so each gets roughly its
+	// share of the budget and runs out at the tail of its repositories
+	atRisk := 0
+	for i := range forecast.Orgs {
+		org := &forecast.Orgs[i]
+		share := float64(forecast.Available) * float64(org.EstimatedCalls) / float64(forecast.EstimatedCalls)
+		fit := int((share - float64(max(listCalls[org.Organization], 1))) / perRepo[org.Organization])
+		org.ReposAtRisk = org.Repos - max(min(fit, org.Repos), 0)
+		org.SkippedRepos = leastActiveRepos(snap.Response.Jobs, org.Organization, org.Repos, org.ReposAtRisk)
+		atRisk += org.ReposAtRisk
+	}
+	forecast.Warning = fmt.Sprintf("the next refresh needs about %d GitHub API calls but only %d are available before %s; about %d repositories would be skipped",
+		forecast.EstimatedCalls, forecast.Available, rate.ResetAt.Format(time.RFC3339), atRisk)
+	forecast.Advice = refreshAdvice(period, forecast, jobCalls)
+	return forecast
+}
+
+// leastActiveRepos names the repositories of an organization that a fetch
+// running out of budget skips, given how many are at risk. Repositories are
+// fetched most recently active first; the ones without runs in the period
+// aren't in the job list and go first.
+func leastActiveRepos(jobs []Job, org string, repos, atRisk int) []string {
+	latest := make(map[string]time.Time)
+	for _, job := range jobs {
+		if job.Provider == "github" && job.Organization == org && job.CreatedAt.After(latest[job.Pipeline]) {
+			latest[job.Pipeline] = job.CreatedAt
+		}
+	}
+	known := atRisk - (repos - len(latest))
+	if known <= 0 {
+		return nil
+	}
+	names := make([]string, 0, len(latest))
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return latest[names[i]].Before(latest[names[j]]) })
+	return names[:min(known, len(names), maxForecastRepos)]
+}
+
+func refreshAdvice(period string, forecast *RefreshForecast, jobCalls int) []string {
+	var advice []string
+	if jobCalls*4 > forecast.EstimatedCalls && (matrixExpansion != "off" || costEstimation || runnerStats) {
+		advice = append(advice, fmt.Sprintf("%d calls fetch the jobs of runs: set MATRIX_EXPANSION=off and disable COST_ESTIMATION and RUNNER_STATS to save them", jobCalls))
+	}
+	advice = append(advice, fmt.Sprintf("raise CACHE_TTL (now %v) so the dashboard refreshes less often", currentCacheTTL()))
+	if len(forecast.Orgs) > 1 {
+		advice = append(advice, fmt.Sprintf("drop organizations from GITHUB_ORG; %s needs the most calls (%d)",
+			forecast.Orgs[0].Organization, forecast.Orgs[0].EstimatedCalls))
+	}
+	if period != "today" {
+		advice = append(advice, "use a shorter period, which covers fewer active repositories")
+	}
+	return advice
+}
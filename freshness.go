@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Data freshness: wallboards left open for days must be able to tell when
+// they're looking at old data. Responses carry the age of the snapshot
+// they're based on and are marked stale when refreshing it has been
+// failing, or when it's older than staleAfter.
+
+// staleAfter marks data stale once it's this old, whatever the reason
+// (STALE_AFTER, zero disables the age check).
+var staleAfter = 15 * time.Minute
+
+// DataFreshness describes the snapshot behind a response.
+type DataFreshness struct {
+	DataAgeSeconds int        `json:"data_age_seconds"`
+	LastRefreshAt  time.Time  `json:"last_refresh_at"`
+	NextRefreshAt  *time.Time `json:"next_refresh_at,omitempty"` // when POLL_INTERVAL refreshes the period
+	Stale          bool       `json:"stale,omitempty"`
+	RefreshError   string     `json:"refresh_error,omitempty"` // why the latest refresh failed, when stale because of it
+}
+
+// freshnessState is what this replica knows about each period: the newest
+// snapshot it has seen, and the outcome of its latest refresh.
+var freshnessState = struct {
+	sync.Mutex
+	fetchedAt   map[string]time.Time
+	failedAt    map[string]time.Time
+	refreshErrs map[string]string
+}{fetchedAt: make(map[string]time.Time), failedAt: make(map[string]time.Time), refreshErrs: make(map[string]string)}
+
+// noteSnapshot records a snapshot read from or written to the store.
+func noteSnapshot(period string, snap *Snapshot) {
+	if snap == nil {
+		return
+	}
+	freshnessState.Lock()
+	defer freshnessState.Unlock()
+	if snap.FetchedAt.After(freshnessState.fetchedAt[period]) {
+		freshnessState.fetchedAt[period] = snap.FetchedAt
+	}
+}
+
+// noteRefresh records the outcome of a refresh of the period.
+func noteRefresh(period string, err error) {
+	freshnessState.Lock()
+	defer freshnessState.Unlock()
+	if err == nil {
+		delete(freshnessState.failedAt, period)
+		delete(freshnessState.refreshErrs, period)
+		return
+	}
+	freshnessState.failedAt[period] = time.Now()
+	freshnessState.refreshErrs[period] = err.Error()
+}
+
+// freshness describes the data of a period that was fetched at fetchedAt.
+func freshness(period string, fetchedAt time.Time) DataFreshness {
+	f := DataFreshness{LastRefreshAt: fetchedAt, NextRefreshAt: nextPoll(period, fetchedAt), DataAgeSeconds: max(int(time.Since(fetchedAt).Seconds()), 0)}
+	if staleAfter > 0 && time.Since(fetchedAt) > staleAfter {
+		f.Stale = true
+	}
+
+	freshnessState.Lock()
+	defer freshnessState.Unlock()
+	// Failing since the data was fetched: nothing newer is coming
+	if failedAt, ok := freshnessState.failedAt[period]; ok && failedAt.After(fetchedAt) {
+		f.Stale = true
+		f.RefreshError = freshnessState.refreshErrs[period]
+	}
+	return f
+}
+
+// withFreshnessHeaders adds X-Data-Age (seconds), X-Last-Refresh-At and,
+// for stale data, X-Data-Stale to every API response, based on the period
+// the request asks for (default week).
+func withFreshnessHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			period := r.URL.Query().Get("period")
+			if !validPeriod(period) {
+				period = "week"
+			}
+			freshnessState.Lock()
+			fetchedAt, ok := freshnessState.fetchedAt[period]
+			freshnessState.Unlock()
+			if ok {
+				setFreshnessHeaders(w, freshness(period, fetchedAt))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setFreshnessHeaders(w http.ResponseWriter, f DataFreshness) {
+	w.Header().Set("X-Data-Age", strconv.Itoa(f.DataAgeSeconds))
+	w.Header().Set("X-Last-Refresh-At", f.LastRefreshAt.UTC().Format(time.RFC3339))
+	if f.Stale {
+		w.Header().Set("X-Data-Stale", "true")
+	} else {
+		w.Header().Del("X-Data-Stale")
+	}
+}
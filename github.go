@@ -0,0 +1,416 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// githubProvider fetches GitHub Actions workflow runs.
+type githubProvider struct{}
+
+func (githubProvider) Name() string { return "github" }
+
+// RateLimit returns the GitHub rate limit as last reported by the API.
+func (githubProvider) RateLimit() *RateLimitInfo {
+	if budget.rateLimitDisabled() {
+		return &RateLimitInfo{Unlimited: true}
+	}
+	return budget.rateLimit()
+}
+
+// ListPipelines returns the organization's repositories that were pushed
+// to during the window.
+func (githubProvider) ListPipelines(ctx context.Context, window fetchWindow, orgName string) ([]Pipeline, error) {
+	// Get all repositories in the organization (cached, see REPO_CACHE_TTL)
+	repos, err := listOrgRepos(ctx, orgName)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("✅ Found %d repositories in organization %s", len(repos), orgName)
+	if rate := budget.rateLimit(); rate != nil {
+		log.Printf("   Rate limit: %d/%d remaining (resets at %v)",
+			rate.Remaining, rate.Limit, rate.ResetAt)
+	}
+
+	// Filter repositories: hanya yang updated dalam periode yang dipilih
+	// GitHub web menampilkan "Updated X minutes ago" berdasarkan PushedAt, bukan UpdatedAt
+	// Untuk "today" juga, jadi kita prioritaskan PushedAt, lalu UpdatedAt
+	var filteredRepos []orgRepo
+	for _, repo := range repos {
+		if window.contains(repo.activity()) && repoSelected(orgName, repo.Name) {
+			filteredRepos = append(filteredRepos, repo)
+		}
+	}
+
+	log.Printf("   📅 Filtered: %d repositories updated %s (from %d total)", len(filteredRepos), window.name(), len(repos))
+	filteredRepos = skipReposWithoutWorkflows(ctx, orgName, filteredRepos)
+
+	// Most recently active repositories first, so they still get fetched if
+	// the rate limit budget runs out
+	sort.SliceStable(filteredRepos, func(i, j int) bool {
+		return filteredRepos[i].activity().After(filteredRepos[j].activity())
+	})
+
+	pipelines := make([]Pipeline, len(filteredRepos))
+	for i, repo := range filteredRepos {
+		pipelines[i] = Pipeline{Org: orgName, Name: repo.Name, DefaultBranch: repo.DefaultBranch, ActiveAt: repo.activity()}
+	}
+	return pipelines, nil
+}
+
+// rerunLookback widens the created filter of the run listing, so runs
+// created before the window but re-run inside it still show up
+// (RERUN_LOOKBACK).
+var rerunLookback = 72 * time.Hour
+
+// createdFilter has GitHub leave out the runs created before the window,
+// by UTC date. Runs are matched to the window by when they started, which
+// is never before they were created, so the window's end holds as is.
+func createdFilter(window fetchWindow) string {
+	from := window.Start.Add(-rerunLookback).UTC().Format("2006-01-02")
+	if window.End.IsZero() {
+		return ">=" + from
+	}
+	return from + ".." + window.End.UTC().Format("2006-01-02")
+}
+
+// ListRuns returns the repository's workflow runs inside the window, as
+// many as runDepth allows.
+func (githubProvider) ListRuns(ctx context.Context, window fetchWindow, repo Pipeline) ([]Job, error) {
+	if err := budget.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	depth := runDepth(repo.Org, repo.Name)
+	opts := &github.ListWorkflowRunsOptions{
+		Created: createdFilter(window),
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	if depth != runDepthAll {
+		opts.PerPage = min(depth, 100)
+	}
+	// With little budget left only the default branch is fetched, which
+	// is what most people look at first
+	if budget.low() && repo.DefaultBranch != "" {
+		opts.Branch = repo.DefaultBranch
+	}
+
+	// Get workflow runs (will filter by period in the loop). Runs come
+	// newest first, so paging stops at the first page reaching past the
+	// start of the window.
+	var runs []*github.WorkflowRun
+	var resp *github.Response
+	totalCount := 0
+	for page := 1; ; page++ {
+		if page > 1 {
+			if err := budget.acquire(ctx); err != nil {
+				break // keep the pages we have
+			}
+		}
+		runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+		workflowRuns, pageResp, err := githubClient.Actions.ListRepositoryWorkflowRuns(runCtx, repo.Org, repo.Name, opts)
+		cancel()
+		budget.update(pageResp)
+		if err != nil {
+			if page == 1 {
+				return nil, err
+			}
+			log.Printf("   ⚠️  Error listing page %d of workflow runs in %s/%s: %v", page, repo.Org, repo.Name, err)
+			break
+		}
+		resp = pageResp
+		runs = append(runs, workflowRuns.WorkflowRuns...)
+		totalCount = workflowRuns.GetTotalCount()
+
+		if resp == nil || resp.NextPage == 0 || len(workflowRuns.WorkflowRuns) == 0 || page >= maxRunPages || budget.low() ||
+			(depth != runDepthAll && len(runs) >= depth) {
+			break
+		}
+		if oldest := runs[len(runs)-1]; oldest.CreatedAt != nil && oldest.CreatedAt.Before(window.Start) {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if depth != runDepthAll && len(runs) > depth {
+		runs = runs[:depth]
+	}
+
+	if resp != nil {
+		log.Printf("   ✅ Found %d workflow runs in %s/%s (Rate limit: %d/%d remaining)",
+			len(runs), repo.Org, repo.Name,
+			resp.Rate.Remaining, resp.Rate.Limit)
+	} else {
+		log.Printf("   ✅ Found %d workflow runs in %s/%s",
+			len(runs), repo.Org, repo.Name)
+	}
+
+	// A repository without runs in the window may not have workflows at
+	// all
+	if totalCount == 0 && opts.Branch == "" {
+		checkWorkflows(ctx, repo)
+	}
+	return runsToJobs(ctx, window, repo, runs), nil
+}
+
+// runsToJobs converts the repository's workflow runs inside the window into
+// jobs, with as much detail as the budget allows.
+func runsToJobs(ctx context.Context, window fetchWindow, repo Pipeline, runs []*github.WorkflowRun) []Job {
+	var jobs []Job
+	for _, run := range runs {
+		job, ok := runToJob(window, repo.Org, repo.Name, run)
+		if !ok {
+			continue
+		}
+		// Step counts and matrix legs cost one call per run, so
+		// they're the first thing to go when the budget gets low
+		if needsRunJobs(job) && !budget.low() {
+			if err := addRunJobs(ctx, &job); err != nil {
+				log.Printf("   ⚠️  Error fetching jobs of run %d in %s/%s: %v", job.RunID, repo.Org, repo.Name, err)
+			}
+		}
+		// Concurrency groups only matter while a run hasn't finished
+		if job.Status != "success" && job.Status != "failed" && !budget.low() {
+			if err := addConcurrencyGroup(ctx, repo.Org, repo.Name, run, &job); err != nil {
+				log.Printf("   ⚠️  Error reading concurrency group of run %d in %s/%s: %v", job.RunID, repo.Org, repo.Name, err)
+			}
+		}
+		if job.Attempt > 1 && !budget.low() {
+			if err := addSupersededAttempts(ctx, &job); err != nil {
+				log.Printf("   ⚠️  Error fetching earlier attempts of run %d in %s/%s: %v", job.RunID, repo.Org, repo.Name, err)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	addCancelReasons(ctx, jobs)
+	if err := addBranchStates(ctx, repo, runs, jobs); err != nil {
+		log.Printf("   ⚠️  Error checking branches of %s/%s: %v", repo.Org, repo.Name, err)
+	}
+	if err := addOwners(ctx, repo.Org, repo.Name, jobs); err != nil {
+		log.Printf("   ⚠️  Error reading CODEOWNERS of %s/%s: %v", repo.Org, repo.Name, err)
+	}
+	return jobs
+}
+
+// GetLogs downloads the run's log archive and concatenates the log files.
+func (githubProvider) GetLogs(ctx context.Context, repo Pipeline, runID int64) (string, error) {
+	if err := budget.acquire(ctx); err != nil {
+		return "", err
+	}
+	logURL, resp, err := githubClient.Actions.GetWorkflowRunLogs(ctx, repo.Org, repo.Name, runID, 2)
+	budget.update(resp)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", errLogsNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The archive URL is pre-signed and must be fetched without the token
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	archiveResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer archiveResp.Body.Close()
+	if archiveResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading log archive: %s", archiveResp.Status)
+	}
+	archive, err := io.ReadAll(io.LimitReader(archiveResp.Body, 4*maxLogBytes))
+	if err != nil {
+		return "", err
+	}
+	return unzipLogs(archive)
+}
+
+// unzipLogs concatenates the log files of an archive, each preceded by its
+// name, up to maxLogBytes.
+func unzipLogs(archive []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return "", fmt.Errorf("invalid log archive: %v", err)
+	}
+	// The archive has one file per job at the top level and the same logs
+	// split per step in subdirectories; the top-level files are enough
+	var out strings.Builder
+	for _, file := range zr.File {
+		if strings.Contains(file.Name, "/") || file.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "==> %s <==\n", file.Name)
+		_, err = io.Copy(&out, io.LimitReader(rc, int64(maxLogBytes-out.Len())))
+		rc.Close()
+		if err != nil {
+			return "", err
+		}
+		if out.Len() >= maxLogBytes {
+			out.WriteString("\n... (truncated)\n")
+			break
+		}
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+// dashboardStatus maps a GitHub status and conclusion to the dashboard's
+// success/failed/running/pending.
+func dashboardStatus(status, conclusion string) string {
+	status = strings.ToLower(status)
+	conclusion = strings.ToLower(conclusion)
+
+	jobStatus := "pending"
+	if status == "completed" {
+		if conclusion == "success" {
+			jobStatus = "success"
+		} else if conclusion == "failure" || conclusion == "cancelled" {
+			jobStatus = "failed"
+		} else {
+			jobStatus = "failed"
+		}
+	} else if status == "in_progress" || status == "queued" {
+		jobStatus = "running"
+	}
+	return jobStatus
+}
+
+// runToJob converts a workflow run into a dashboard Job. It returns false
+// when the run falls outside the window.
+func runToJob(window fetchWindow, orgName, repoName string, run *github.WorkflowRun) (Job, bool) {
+	// Filter workflow runs berdasarkan waktu untuk semua periode
+	var runTime time.Time
+	if run.RunStartedAt != nil {
+		runTime = run.RunStartedAt.Time
+	} else if run.CreatedAt != nil {
+		runTime = run.CreatedAt.Time
+	} else {
+		return Job{}, false // Skip jika tidak ada timestamp
+	}
+
+	// Cek apakah dalam periode yang dipilih
+	if !window.contains(runTime) {
+		return Job{}, false
+	}
+
+	status := strings.ToLower(*run.Status)
+	jobStatus := dashboardStatus(status, run.GetConclusion())
+
+	// Calculate duration
+	var duration string
+	var durationSeconds int64
+	if run.UpdatedAt != nil && run.RunStartedAt != nil {
+		duration = formatDuration(run.RunStartedAt.Time, run.UpdatedAt.Time)
+		durationSeconds = int64(run.UpdatedAt.Sub(run.RunStartedAt.Time).Seconds())
+	} else if run.CreatedAt != nil {
+		end := clock()
+		if run.UpdatedAt != nil {
+			end = run.UpdatedAt.Time
+		}
+		duration = formatDuration(run.CreatedAt.Time, end)
+		durationSeconds = int64(end.Sub(run.CreatedAt.Time).Seconds())
+	} else {
+		duration = "N/A"
+	}
+
+	// Format started time (re-localized per request, see localizeJobs)
+	var started string
+	var startedAt time.Time
+	if run.RunStartedAt != nil {
+		startedAt = run.RunStartedAt.Time
+	} else if run.CreatedAt != nil {
+		startedAt = run.CreatedAt.Time
+	}
+	if startedAt.IsZero() {
+		started = "N/A"
+	} else {
+		started = formatTimeAgo(startedAt, defaultLocale)
+	}
+
+	jobName := *run.Name
+	if run.RunNumber != nil {
+		jobName = fmt.Sprintf("%s #%d", jobName, *run.RunNumber)
+	}
+
+	jobID := fmt.Sprintf("JOB-%06d", *run.ID)
+
+	branch := "N/A"
+	if run.HeadBranch != nil {
+		branch = *run.HeadBranch
+	}
+
+	var createdAt time.Time
+	if run.CreatedAt != nil {
+		createdAt = run.CreatedAt.Time
+	} else {
+		createdAt = clock()
+	}
+
+	// Get HTML URL for workflow run detail
+	var htmlURL string
+	if run.HTMLURL != nil {
+		htmlURL = *run.HTMLURL
+	} else {
+		// Fallback: construct URL manually
+		htmlURL = fmt.Sprintf("%s/%s/%s/actions/runs/%d", githubWebURL, orgName, repoName, *run.ID)
+	}
+
+	job := Job{
+		ID:           jobID,
+		Provider:     "github",
+		Name:         jobName,
+		Status:       jobStatus,
+		Conclusion:   strings.ToLower(run.GetConclusion()),
+		Pipeline:     repoName, // Repository name instead of workflow name
+		Branch:       branch,
+		Duration:     duration,
+		Started:      started,
+		Organization: orgName,
+		RunID:        *run.ID,
+		HTMLURL:      htmlURL,
+		CreatedAt:    createdAt,
+		WorkflowID:   run.GetWorkflowID(),
+		HeadSHA:      run.GetHeadSHA(),
+		Attempt:      run.GetRunAttempt(),
+
+		// GitHub's status of runs held back by their concurrency group
+		WaitingOnConcurrency: status == "pending",
+
+		Event:         run.GetEvent(),
+		Actor:         run.GetTriggeringActor().GetLogin(),
+		CommitMessage: commitSubject(run.GetHeadCommit().GetMessage()),
+
+		StartedAt:       startedAt,
+		DurationSeconds: durationSeconds,
+	}
+
+	if job.Actor == "" {
+		job.Actor = run.GetActor().GetLogin()
+	}
+
+	return job, true
+}
+
+// commitSubject is the first line of a commit message; the body would bloat
+// every cached snapshot.
+func commitSubject(message string) string {
+	subject, _, _ := strings.Cut(message, "\n")
+	return strings.TrimSpace(subject)
+}
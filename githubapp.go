@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// GitHub App authentication: with APP_ID, INSTALLATION_ID and
+// PRIVATE_KEY_PATH the dashboard authenticates as an installation of a
+// GitHub App instead of with GITHUB_TOKEN. Installation tokens last an
+// hour and are renewed before they expire, so nothing has to be rotated by
+// hand, and the installation gets its own rate limit (up to 15,000 calls
+// per hour on GitHub Enterprise Cloud) instead of sharing a user's.
+
+// appTokenEarlyExpiry is how long before an installation token expires a
+// new one is made, so requests in flight don't run into the expiry.
+const appTokenEarlyExpiry = 5 * time.Minute
+
+// githubApp is set when authenticating as a GitHub App, whose tokens
+// belong to no user.
+var githubApp bool
+
+// appTokenSource makes installation tokens of a GitHub App.
+type appTokenSource struct {
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	client         *github.Client // unauthenticated, see Token
+}
+
+// loadGitHubAppConfig returns the token source of the GitHub App
+// installation, or nil without APP_ID.
+func loadGitHubAppConfig() oauth2.TokenSource {
+	appEnv, installationEnv, keyPath := os.Getenv("APP_ID"), os.Getenv("INSTALLATION_ID"), os.Getenv("PRIVATE_KEY_PATH")
+	if appEnv == "" && installationEnv == "" && keyPath == "" {
+		return nil
+	}
+	if appEnv == "" || installationEnv == "" || keyPath == "" {
+		log.Fatal("APP_ID, INSTALLATION_ID and PRIVATE_KEY_PATH must be set together")
+	}
+	appID, err := strconv.ParseInt(appEnv, 10, 64)
+	if err != nil || appID <= 0 {
+		log.Fatalf("Invalid APP_ID %q: expected the App ID from the app's settings page", appEnv)
+	}
+	installationID, err := strconv.ParseInt(installationEnv, 10, 64)
+	if err != nil || installationID <= 0 {
+		log.Fatalf("Invalid INSTALLATION_ID %q: expected the number at the end of the installation's settings URL", installationEnv)
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		log.Fatalf("Error reading PRIVATE_KEY_PATH: %v", err)
+	}
+	key, err := parseAppPrivateKey(data)
+	if err != nil {
+		log.Fatalf("Invalid private key in %s: %v", keyPath, err)
+	}
+
+	githubApp = true
+	src := &appTokenSource{appID: appID, installationID: installationID, key: key, client: github.NewClient(newGitHubHTTPClient(nil))}
+	log.Printf("🤖 Authenticating as GitHub App %d, installation %d", appID, installationID)
+	return oauth2.ReuseTokenSourceWithExpiry(nil, src, appTokenEarlyExpiry)
+}
+
+// parseAppPrivateKey reads the PEM private key GitHub generates for an
+// app (PKCS #1), or the same key converted to PKCS #8.
+func parseAppPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA key")
+	}
+	return key, nil
+}
+
+// appJWT signs the JWT the app authenticates with. GitHub allows at most
+// ten minutes; issuing it a minute early allows for clock drift.
+func (s *appTokenSource) appJWT() (string, error) {
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"RS256"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Token makes a new installation token, on the API the dashboard reads
+// (see GITHUB_BASE_URL).
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	jwt, err := s.appJWT()
+	if err != nil {
+		return nil, fmt.Errorf("signing GitHub App JWT: %w", err)
+	}
+	client := s.client.WithAuthToken(jwt)
+	client.BaseURL = githubClient.BaseURL
+
+	ctx, cancel := context.WithTimeout(context.Background(), runListTimeout)
+	defer cancel()
+	token, _, err := client.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating installation token of GitHub App %d: %w", s.appID, err)
+	}
+	log.Printf("🤖 New installation token, expires %s", token.GetExpiresAt().Format(time.RFC3339))
+	return &oauth2.Token{AccessToken: token.GetToken(), Expiry: token.GetExpiresAt().Time}, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retries of single GitHub API requests: a 502, 503 or 504, or a secondary
+// rate limit, usually goes away within seconds, so the request is sent
+// again with exponential backoff and jitter instead of failing the whole
+// repository. A Retry-After header is waited for as asked, as long as the
+// request's deadline allows it. The retry queue (retryqueue.go) picks up
+// what still fails. Rate limits also throttle all other requests (see
+// rateBudget.throttle), so they don't hit the same limit meanwhile.
+
+var (
+	// maxRetries is how often a request is sent again (MAX_RETRIES, 0
+	// disables retries).
+	maxRetries = 3
+
+	// retryBaseDelay is the backoff before the first retry, doubled for
+	// every next one.
+	retryBaseDelay = time.Second
+)
+
+// maxRetryDelay caps the backoff of a single retry.
+const maxRetryDelay = 30 * time.Second
+
+// retryTransport sends idempotent requests again when GitHub answers with
+// a transient error.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retry := maxRetries > 0 && (req.Method == http.MethodGet || req.Method == http.MethodHead)
+	// Rate limits of other hosts say nothing about GitHub's
+	github := isGitHubHost(req.URL.Host)
+	for attempt := 0; ; attempt++ {
+		if github {
+			if err := budget.waitThrottle(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		reason, ok := transientFailure(resp)
+		delay, asked := retryAfter(resp)
+		switch {
+		case !github:
+			if !asked {
+				delay = backoffDelay(attempt)
+			}
+		case reason == "secondary rate limit":
+			if !asked {
+				delay = secondaryRateLimitWait
+			}
+			budget.throttle(time.Now().Add(delay), "secondary_rate_limit")
+		case primaryRateLimited(resp) && githubTokens.available():
+			// Another token of the pool takes over right away
+			reason, ok, delay = "rate limit of one token", true, 0
+		case primaryRateLimited(resp) && githubTokens != nil:
+			budget.throttle(githubTokens.nextReset(), "rate_limit")
+		case primaryRateLimited(resp):
+			if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				budget.throttle(time.Unix(reset, 0), "rate_limit")
+			}
+		case !asked:
+			delay = backoffDelay(attempt)
+		}
+		if !ok || !retry || attempt >= maxRetries {
+			return resp, nil
+		}
+
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < delay {
+			return resp, nil // waiting would only end in a timeout
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		log.Printf("🔁 GitHub %s for %s, retry %d/%d in %v", reason, req.URL.Path, attempt+1, maxRetries, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isGitHubHost reports whether host is the GitHub API the dashboard
+// reads, or its upload host.
+func isGitHubHost(host string) bool {
+	if githubClient == nil {
+		return strings.EqualFold(host, "api.github.com")
+	}
+	return strings.EqualFold(host, githubClient.BaseURL.Host) || strings.EqualFold(host, githubClient.UploadURL.Host)
+}
+
+// transientFailure reports whether resp is an error that is likely gone
+// when the request is sent again, and what it was.
+func transientFailure(resp *http.Response) (string, bool) {
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resp.Status, true
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		// An exhausted primary rate limit only resets within the hour,
+		// the rate limit budget deals with that
+		if primaryRateLimited(resp) {
+			return "", false
+		}
+		if resp.Header.Get("Retry-After") != "" {
+			return "secondary rate limit", true
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if err == nil && strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+			return "secondary rate limit", true
+		}
+	}
+	return "", false
+}
+
+// primaryRateLimited reports whether resp was refused because the hourly
+// rate limit is used up.
+func primaryRateLimited(resp *http.Response) bool {
+	return (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// retryAfter returns the wait asked for by a Retry-After header, in
+// seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// backoffDelay is the wait before retry attempt+1: retryBaseDelay doubled
+// per attempt, capped at maxRetryDelay, of which the second half is random
+// so that concurrent fetches don't retry in lockstep.
+func backoffDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 16 {
+		delay = min(retryBaseDelay<<attempt, maxRetryDelay)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func loadRetryConfig() {
+	maxRetries = getEnvInt("MAX_RETRIES", maxRetries)
+	if maxRetries < 0 {
+		log.Fatalf("Invalid MAX_RETRIES %d: must be 0 or more", maxRetries)
+	}
+	retryBaseDelay = getEnvDuration("RETRY_BASE_DELAY", retryBaseDelay)
+	if retryBaseDelay <= 0 {
+		log.Fatalf("Invalid RETRY_BASE_DELAY %v: must be positive", retryBaseDelay)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testResponse(status int, header map[string]string, body string) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	for name, value := range header {
+		resp.Header.Set(name, value)
+	}
+	return resp
+}
+
+func TestTransientFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     map[string]string
+		body       string
+		wantReason string
+		wantOK     bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "bad gateway", status: http.StatusBadGateway, wantReason: "Bad Gateway", wantOK: true},
+		{name: "service unavailable", status: http.StatusServiceUnavailable, wantReason: "Service Unavailable", wantOK: true},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, wantReason: "Gateway Timeout", wantOK: true},
+		{name: "internal server error", status: http.StatusInternalServerError},
+		{name: "not found", status: http.StatusNotFound},
+		{
+			name:   "primary rate limit",
+			status: http.StatusForbidden,
+			header: map[string]string{"X-RateLimit-Remaining": "0", "Retry-After": "60"},
+		},
+		{
+			name:       "secondary rate limit with retry-after",
+			status:     http.StatusTooManyRequests,
+			header:     map[string]string{"Retry-After": "30"},
+			wantReason: "secondary rate limit",
+			wantOK:     true,
+		},
+		{
+			name:       "secondary rate limit in body",
+			status:     http.StatusForbidden,
+			body:       `{"message": "You have exceeded a Secondary Rate Limit."}`,
+			wantReason: "secondary rate limit",
+			wantOK:     true,
+		},
+		{
+			name:   "forbidden",
+			status: http.StatusForbidden,
+			body:   `{"message": "Resource not accessible by integration"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := testResponse(tt.status, tt.header, tt.body)
+			reason, ok := transientFailure(resp)
+			if reason != tt.wantReason || ok != tt.wantOK {
+				t.Errorf("transientFailure() = %q, %v, want %q, %v", reason, ok, tt.wantReason, tt.wantOK)
+			}
+			// The body is still there for the caller
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "missing", value: ""},
+		{name: "seconds", value: "5", want: 5 * time.Second, wantOK: true},
+		{name: "zero", value: "0", want: 0, wantOK: true},
+		{name: "padded", value: " 12 ", want: 12 * time.Second, wantOK: true},
+		{name: "negative", value: "-1"},
+		{name: "garbage", value: "soon"},
+		{name: "past date", value: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfter(testResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": tt.value}, ""))
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// A date is waited for until then
+	at := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	got, ok := retryAfter(testResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": at}, ""))
+	if !ok || got <= 80*time.Second || got > 90*time.Second {
+		t.Errorf("retryAfter(%q) = %v, %v, want about 90s", at, got, ok)
+	}
+}
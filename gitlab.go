@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitlabProvider fetches GitLab CI pipelines from gitlab.com or a
+// self-managed instance. Groups play the role of organizations and
+// projects that of repositories.
+type gitlabProvider struct {
+	baseURL string // e.g. https://gitlab.com/api/v4
+	token   string
+	client  *http.Client
+
+	mu        sync.Mutex
+	rateLimit *RateLimitInfo
+}
+
+// loadGitLabConfig adds a source for every group in GITLAB_GROUPS.
+func loadGitLabConfig() {
+	groups := splitList(os.Getenv("GITLAB_GROUPS"))
+	if len(groups) == 0 {
+		return
+	}
+
+	baseURL := strings.TrimRight(os.Getenv("GITLAB_URL"), "/")
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	provider := &gitlabProvider{
+		baseURL: baseURL + "/api/v4",
+		token:   os.Getenv("GITLAB_TOKEN"),
+		client:  newHTTPClient(),
+	}
+	for _, group := range groups {
+		sources = append(sources, source{Provider: provider, Org: group})
+	}
+	log.Printf("🦊 GitLab enabled: %d group(s) on %s", len(groups), baseURL)
+}
+
+func (p *gitlabProvider) Name() string { return "gitlab" }
+
+func (p *gitlabProvider) RateLimit() *RateLimitInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rateLimit
+}
+
+func (p *gitlabProvider) auth(req *http.Request) {
+	if p.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", p.token)
+	}
+}
+
+// get fetches an API path and records the rate limit headers gitlab.com
+// sends (self-managed instances usually don't).
+func (p *gitlabProvider) get(ctx context.Context, path string, out interface{}) error {
+	header, err := apiGetJSON(ctx, p.client, p.baseURL+path, p.auth, out)
+	if err != nil {
+		return err
+	}
+	remaining, err1 := strconv.Atoi(header.Get("RateLimit-Remaining"))
+	limit, err2 := strconv.Atoi(header.Get("RateLimit-Limit"))
+	reset, err3 := strconv.ParseInt(header.Get("RateLimit-Reset"), 10, 64)
+	if err1 == nil && err2 == nil && err3 == nil {
+		p.mu.Lock()
+		p.rateLimit = &RateLimitInfo{Remaining: remaining, Limit: limit, ResetAt: time.Unix(reset, 0)}
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// projectPath is the URL-encoded full path of a project, which the API
+// accepts in place of the numeric project ID.
+func projectPath(project Pipeline) string {
+	return url.PathEscape(project.Org + "/" + project.Name)
+}
+
+type gitlabProject struct {
+	PathWithNamespace string    `json:"path_with_namespace"`
+	DefaultBranch     string    `json:"default_branch"`
+	LastActivityAt    time.Time `json:"last_activity_at"`
+}
+
+type gitlabPipeline struct {
+	ID        int64     `json:"id"`
+	IID       int64     `json:"iid"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Ref       string    `json:"ref"`
+	WebURL    string    `json:"web_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type gitlabJob struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	WebURL     string     `json:"web_url"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// ListPipelines returns the group's projects, including subgroups, that
+// were active during the window. Projects in subgroups are named by their
+// path below the group, e.g. "backend/api".
+func (p *gitlabProvider) ListPipelines(ctx context.Context, window fetchWindow, group string) ([]Pipeline, error) {
+	query := url.Values{
+		"include_subgroups":   {"true"},
+		"archived":            {"false"},
+		"last_activity_after": {window.Start.UTC().Format(time.RFC3339)},
+		"order_by":            {"last_activity_at"},
+		"sort":                {"desc"},
+		"per_page":            {"100"},
+	}
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	defer cancel()
+
+	var projects []gitlabProject
+	if err := p.get(listCtx, "/groups/"+url.PathEscape(group)+"/projects?"+query.Encode(), &projects); err != nil {
+		return nil, err
+	}
+	log.Printf("✅ Found %d active projects in GitLab group %s", len(projects), group)
+
+	var pipelines []Pipeline
+	for _, project := range projects {
+		if !window.contains(project.LastActivityAt) {
+			continue
+		}
+		name := strings.TrimPrefix(project.PathWithNamespace, group+"/")
+		pipelines = append(pipelines, Pipeline{Org: group, Name: name, DefaultBranch: project.DefaultBranch})
+	}
+	return pipelines, nil
+}
+
+// ListRuns returns the project's pipelines inside the window.
+func (p *gitlabProvider) ListRuns(ctx context.Context, window fetchWindow, project Pipeline) ([]Job, error) {
+	query := url.Values{
+		"updated_after": {window.Start.UTC().Format(time.RFC3339)},
+		"order_by":      {"id"},
+		"sort":          {"desc"},
+		"per_page":      {"100"},
+	}
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	var pipelines []gitlabPipeline
+	err := p.get(runCtx, "/projects/"+projectPath(project)+"/pipelines?"+query.Encode(), &pipelines)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("   ✅ Found %d pipelines in %s/%s", len(pipelines), project.Org, project.Name)
+
+	var jobs []Job
+	for _, pipeline := range pipelines {
+		if !window.contains(pipeline.CreatedAt) {
+			continue
+		}
+		job := p.pipelineToJob(project, pipeline)
+		if job.Status == "running" || expandMatrix(job.Status) {
+			if err := p.addPipelineJobs(ctx, project, &job); err != nil {
+				log.Printf("   ⚠️  Error fetching jobs of pipeline %d in %s/%s: %v", pipeline.ID, project.Org, project.Name, err)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// gitlabStatus maps a GitLab pipeline or job status to the dashboard's
+// success/failed/running/pending, the same way GitHub conclusions are
+// mapped: anything finished without succeeding counts as failed.
+func gitlabStatus(status string) string {
+	switch status {
+	case "success":
+		return "success"
+	case "failed", "canceled", "skipped":
+		return "failed"
+	case "running":
+		return "running"
+	default: // created, waiting_for_resource, preparing, pending, scheduled, manual
+		return "pending"
+	}
+}
+
+// gitlabConclusion maps a finished pipeline's status to GitHub's
+// conclusions, see Job.Conclusion.
+func gitlabConclusion(status string) string {
+	switch status {
+	case "success":
+		return "success"
+	case "failed":
+		return "failure"
+	case "canceled":
+		return "cancelled"
+	case "skipped":
+		return "skipped"
+	}
+	return ""
+}
+
+func (p *gitlabProvider) pipelineToJob(project Pipeline, pipeline gitlabPipeline) Job {
+	name := pipeline.Name
+	if name == "" {
+		name = "Pipeline"
+	}
+	status := gitlabStatus(pipeline.Status)
+
+	// The pipeline list has no start and finish times; the last update is
+	// the finish time of a finished pipeline
+	end := pipeline.UpdatedAt
+	if status == "running" || status == "pending" {
+		end = clock()
+	}
+
+	job := Job{
+		ID:           fmt.Sprintf("GL-%06d", pipeline.ID),
+		Provider:     "gitlab",
+		Name:         fmt.Sprintf("%s #%d", name, pipeline.IID),
+		Status:       status,
+		Conclusion:   gitlabConclusion(pipeline.Status),
+		Pipeline:     project.Name,
+		Branch:       pipeline.Ref,
+		Duration:     formatDuration(pipeline.CreatedAt, end),
+		Started:      formatTimeAgo(pipeline.CreatedAt, defaultLocale),
+		Organization: project.Org,
+		RunID:        pipeline.ID,
+		HTMLURL:      pipeline.WebURL,
+		CreatedAt:    pipeline.CreatedAt,
+
+		StartedAt:       pipeline.CreatedAt,
+		DurationSeconds: int64(end.Sub(pipeline.CreatedAt).Seconds()),
+
+		// GitLab's resource_group is the closest thing to a concurrency group
+		WaitingOnConcurrency: pipeline.Status == "waiting_for_resource",
+	}
+	return job
+}
+
+func (p *gitlabProvider) listPipelineJobs(ctx context.Context, project Pipeline, pipelineID int64) ([]gitlabJob, error) {
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+	var jobs []gitlabJob
+	err := p.get(runCtx, fmt.Sprintf("/projects/%s/pipelines/%d/jobs?per_page=100", projectPath(project), pipelineID), &jobs)
+	return jobs, err
+}
+
+// addPipelineJobs maps the pipeline's jobs onto progress (finished jobs out
+// of all jobs, as GitLab has no steps) and matrix legs.
+func (p *gitlabProvider) addPipelineJobs(ctx context.Context, project Pipeline, job *Job) error {
+	jobs, err := p.listPipelineJobs(ctx, project, job.RunID)
+	if err != nil {
+		return err
+	}
+
+	if job.Status == "running" {
+		completed, total := 0, len(jobs)
+		for _, j := range jobs {
+			if j.FinishedAt != nil {
+				completed++
+			}
+		}
+		job.StepsCompleted = &completed
+		job.StepsTotal = &total
+	}
+
+	if expandMatrix(job.Status) {
+		for _, j := range jobs {
+			base, matrix, ok := splitGitLabMatrixName(j.Name)
+			if !ok {
+				continue
+			}
+			leg := MatrixLeg{Job: base, Matrix: matrix, Status: gitlabStatus(j.Status), Duration: "N/A", HTMLURL: j.WebURL}
+			if j.StartedAt != nil {
+				end := clock()
+				if j.FinishedAt != nil {
+					end = *j.FinishedAt
+				}
+				leg.Duration = formatDuration(*j.StartedAt, end)
+				leg.DurationSeconds = int64(end.Sub(*j.StartedAt).Seconds())
+			}
+			job.MatrixLegs = append(job.MatrixLegs, leg)
+		}
+	}
+	return nil
+}
+
+// splitGitLabMatrixName splits the names GitLab gives parallel jobs:
+// "test: [ruby, 3.2]" for parallel:matrix and "test 2/3" for parallel: N.
+func splitGitLabMatrixName(name string) (job, matrix string, ok bool) {
+	if base, values, found := strings.Cut(name, ": ["); found && strings.HasSuffix(values, "]") {
+		return base, strings.TrimSuffix(values, "]"), true
+	}
+	if i := strings.LastIndex(name, " "); i > 0 {
+		index, total, found := strings.Cut(name[i+1:], "/")
+		if _, err := strconv.Atoi(index); found && err == nil {
+			if _, err := strconv.Atoi(total); err == nil {
+				return name[:i], name[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// GetLogs concatenates the traces of all jobs of the pipeline.
+func (p *gitlabProvider) GetLogs(ctx context.Context, project Pipeline, pipelineID int64) (string, error) {
+	jobs, err := p.listPipelineJobs(ctx, project, pipelineID)
+	if isNotFound(err) {
+		return "", errLogsNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, job := range jobs {
+		trace, err := apiGetText(ctx, p.client, fmt.Sprintf("%s/projects/%s/jobs/%d/trace", p.baseURL, projectPath(project), job.ID), p.auth, int64(maxLogBytes-out.Len()))
+		if err != nil && !isNotFound(err) {
+			return "", err
+		}
+		fmt.Fprintf(&out, "==> %s <==\n%s\n", job.Name, trace)
+		if out.Len() >= maxLogBytes {
+			out.WriteString("... (truncated)\n")
+			break
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGitLabPipelineToJob(t *testing.T) {
+	created := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	project := Pipeline{Org: "acme", Name: "backend/api"}
+	pipeline := func(status string) gitlabPipeline {
+		return gitlabPipeline{ID: 42, IID: 7, Status: status, Ref: "main", WebURL: "https://gitlab.com/acme/backend/api/-/pipelines/42",
+			CreatedAt: created, UpdatedAt: created.Add(3 * time.Minute)}
+	}
+
+	tests := []struct {
+		status         string
+		wantStatus     string
+		wantConclusion string
+		wantWaiting    bool
+	}{
+		{"success", "success", "success", false},
+		{"failed", "failed", "failure", false},
+		{"canceled", "failed", "cancelled", false},
+		{"skipped", "failed", "skipped", false},
+		{"running", "running", "", false},
+		{"waiting_for_resource", "pending", "", true},
+		{"manual", "pending", "", false},
+	}
+	p := &gitlabProvider{}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			job := p.pipelineToJob(project, pipeline(tt.status))
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion || job.WaitingOnConcurrency != tt.wantWaiting {
+				t.Errorf("status, conclusion, waiting = %q, %q, %v, want %q, %q, %v",
+					job.Status, job.Conclusion, job.WaitingOnConcurrency, tt.wantStatus, tt.wantConclusion, tt.wantWaiting)
+			}
+			if job.ID != "GL-000042" || job.Name != "Pipeline #7" || job.Organization != "acme" || job.Pipeline != "backend/api" || job.RunID != 42 {
+				t.Errorf("job = %+v", job)
+			}
+			if finished(job) && job.DurationSeconds != 180 {
+				t.Errorf("duration = %ds, want the time to the last update", job.DurationSeconds)
+			}
+		})
+	}
+}
+
+func TestSplitGitLabMatrixName(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantJob    string
+		wantMatrix string
+		wantOK     bool
+	}{
+		{"test: [ruby, 3.2]", "test", "ruby, 3.2", true},
+		{"rspec 2/3", "rspec", "2/3", true},
+		{"deploy to prod", "", "", false},
+		{"build 2/x", "", "", false},
+		{"lint", "", "", false},
+	}
+	for _, tt := range tests {
+		job, matrix, ok := splitGitLabMatrixName(tt.name)
+		if job != tt.wantJob || matrix != tt.wantMatrix || ok != tt.wantOK {
+			t.Errorf("splitGitLabMatrixName(%q) = %q, %q, %v, want %q, %q, %v", tt.name, job, matrix, ok, tt.wantJob, tt.wantMatrix, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow dependency graph: which workflows start when another one
+// completes (on: workflow_run) and which call reusable workflows
+// (jobs.<id>.uses), read from the scanned workflow files, with the latest
+// run of each workflow so cascading failures stand out.
+
+// GraphNode is a workflow. Reusable workflows of repositories that weren't
+// scanned (e.g. of another organization) are external.
+type GraphNode struct {
+	ID         string     `json:"id"` // org/repo/path
+	Repository string     `json:"repository"`
+	Path       string     `json:"path"`
+	Workflow   string     `json:"workflow"`
+	External   bool       `json:"external,omitempty"`
+	LastStatus string     `json:"last_status,omitempty"` // of the latest run in the period
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastRunURL string     `json:"last_run_url,omitempty"`
+}
+
+// GraphEdge points the way work flows: from the upstream workflow to the
+// one it triggers, or from a caller to the reusable workflow it calls.
+type GraphEdge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Type  string   `json:"type"`            // workflow_run or workflow_call
+	Types []string `json:"types,omitempty"` // workflow_run activity types, e.g. ["completed"]
+	Job   string   `json:"job,omitempty"`   // the calling job, for workflow_call
+	Ref   string   `json:"ref,omitempty"`   // the called ref, for workflow_call
+	// Both workflows' latest runs failed: the downstream failure may just
+	// be the upstream one passed on
+	Cascading bool `json:"cascading,omitempty"`
+}
+
+type WorkflowGraph struct {
+	Organization string      `json:"organization"`
+	ReposScanned int         `json:"repos_scanned"`
+	ReposSkipped int         `json:"repos_skipped"` // not scanned because the rate limit budget ran out
+	Nodes        []GraphNode `json:"nodes"`         // workflows with at least one edge
+	Edges        []GraphEdge `json:"edges"`
+	Error        string      `json:"error,omitempty"`
+}
+
+type GraphResponse struct {
+	Period string          `json:"period"`
+	Orgs   []WorkflowGraph `json:"orgs"`
+}
+
+// graphWorkflowFile is the part of a workflow file the graph needs.
+type graphWorkflowFile struct {
+	Name string    `yaml:"name"`
+	On   yaml.Node `yaml:"on"`
+	Jobs map[string]struct {
+		Uses string `yaml:"uses"`
+	} `yaml:"jobs"`
+}
+
+type workflowRunTrigger struct {
+	Workflows []string `yaml:"workflows"`
+	Types     []string `yaml:"types"`
+}
+
+// workflowRunTrigger returns the file's on: workflow_run trigger, if any.
+// on: can also be a single event or a list, which never has one.
+func (f graphWorkflowFile) workflowRunTrigger() (workflowRunTrigger, bool) {
+	var trigger workflowRunTrigger
+	if f.On.Kind != yaml.MappingNode {
+		return trigger, false
+	}
+	for i := 0; i+1 < len(f.On.Content); i += 2 {
+		if f.On.Content[i].Value == "workflow_run" {
+			return trigger, f.On.Content[i+1].Decode(&trigger) == nil
+		}
+	}
+	return trigger, false
+}
+
+// buildWorkflowGraph links the workflow files of an organization. repo
+// limits the graph to the edges touching one repository.
+func buildWorkflowGraph(org string, files []workflowSource, repo string) WorkflowGraph {
+	graph := WorkflowGraph{Organization: org, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	nodes := make(map[string]*GraphNode)
+	parsed := make(map[string]graphWorkflowFile)
+	byName := make(map[string][]string) // org/repo -> node IDs, to resolve workflow_run names
+	for _, file := range files {
+		var wf graphWorkflowFile
+		if err := yaml.Unmarshal([]byte(file.Content), &wf); err != nil {
+			log.Printf("   ⚠️  Skipping %s/%s in the workflow graph: %v", file.Repository, file.Path, err)
+			continue
+		}
+		id := file.Repository + "/" + file.Path
+		// Without a name GitHub shows a workflow by its path
+		name := wf.Name
+		if name == "" {
+			name = file.Path
+		}
+		nodes[id] = &GraphNode{ID: id, Repository: file.Repository, Path: file.Path, Workflow: name}
+		parsed[id] = wf
+		byName[file.Repository] = append(byName[file.Repository], id)
+	}
+
+	linked := make(map[string]bool)
+	addEdge := func(edge GraphEdge) {
+		if repo != "" && nodes[edge.From].Repository != repo && nodes[edge.To].Repository != repo {
+			return
+		}
+		graph.Edges = append(graph.Edges, edge)
+		linked[edge.From], linked[edge.To] = true, true
+	}
+	for id, wf := range parsed {
+		node := nodes[id]
+		// workflow_run only reacts to workflows of the same repository;
+		// names may be glob patterns
+		if trigger, ok := wf.workflowRunTrigger(); ok {
+			for _, pattern := range trigger.Workflows {
+				for _, upstream := range byName[node.Repository] {
+					name := nodes[upstream].Workflow
+					if matched, err := path.Match(pattern, name); upstream != id && (name == pattern || (err == nil && matched)) {
+						addEdge(GraphEdge{From: upstream, To: id, Type: "workflow_run", Types: trigger.Types})
+					}
+				}
+			}
+		}
+		for jobID, job := range wf.Jobs {
+			target, ref, ok := reusableWorkflow(node.Repository, job.Uses)
+			if !ok {
+				continue
+			}
+			if _, known := nodes[target]; !known {
+				repository, file, _ := strings.Cut(target, "/.github/")
+				nodes[target] = &GraphNode{ID: target, Repository: repository, Path: ".github/" + file, Workflow: ".github/" + file, External: true}
+			}
+			addEdge(GraphEdge{From: id, To: target, Type: "workflow_call", Job: jobID, Ref: ref})
+		}
+	}
+
+	for id := range linked {
+		graph.Nodes = append(graph.Nodes, *nodes[id])
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return graph
+}
+
+// reusableWorkflow resolves a job's uses: to the ID of the called workflow,
+// "./.github/workflows/build.yml" within the same repository or
+// "owner/repo/.github/workflows/build.yml@v1" in another. Actions and
+// docker images aren't workflows.
+func reusableWorkflow(repository, uses string) (id, ref string, ok bool) {
+	if strings.HasPrefix(uses, "./.github/workflows/") {
+		return repository + "/" + strings.TrimPrefix(uses, "./"), "", true
+	}
+	target, ref, _ := strings.Cut(uses, "@")
+	parts := strings.SplitN(target, "/", 3)
+	if len(parts) < 3 || !strings.HasPrefix(parts[2], ".github/workflows/") {
+		return "", "", false
+	}
+	return target, ref, true
+}
+
+// addGraphStatuses sets the latest run of every workflow in the graph and
+// flags workflow_run edges whose both ends failed.
+func addGraphStatuses(graph *WorkflowGraph, jobs []Job) {
+	latest := make(map[string]Job)
+	for _, job := range jobs {
+		key := job.Organization + "/" + job.Pipeline + "|" + workflowName(job.Name)
+		if prev, ok := latest[key]; !ok || job.CreatedAt.After(prev.CreatedAt) {
+			latest[key] = job
+		}
+	}
+
+	status := make(map[string]string)
+	for i := range graph.Nodes {
+		node := &graph.Nodes[i]
+		job, ok := latest[node.Repository+"|"+node.Workflow]
+		if !ok {
+			continue
+		}
+		node.LastStatus = job.Status
+		createdAt := job.CreatedAt
+		node.LastRunAt = &createdAt
+		node.LastRunURL = job.HTMLURL
+		status[node.ID] = job.Status
+	}
+	for i := range graph.Edges {
+		edge := &graph.Edges[i]
+		edge.Cascading = edge.Type == "workflow_run" && status[edge.From] == "failed" && status[edge.To] == "failed"
+	}
+}
+
+// graphHandler serves /api/graph?period=week, the workflow dependency graph
+// per organization. ?org= and ?repo= (org/repo) narrow it down,
+// ?refresh=true rescans the workflow files.
+func graphHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	org, repo := query.Get("org"), query.Get("repo")
+	if repo != "" && org == "" {
+		org, _, _ = strings.Cut(repo, "/")
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := GraphResponse{Period: period, Orgs: []WorkflowGraph{}}
+	for _, src := range currentSources() {
+		name := src.Provider.Name()
+		if (name != "github" && name != "demo") || (org != "" && src.Org != org) {
+			continue
+		}
+		scan := scanWorkflows(r.Context(), src.Org, query.Get("refresh") == "true")
+		graph := buildWorkflowGraph(src.Org, scan.Files, repo)
+		addGraphStatuses(&graph, snap.Response.Jobs)
+		graph.ReposScanned, graph.ReposSkipped = scan.Repos, scan.ReposSkipped
+		if scan.Err != nil {
+			graph.Error = scan.Err.Error()
+		}
+		response.Orgs = append(response.Orgs, graph)
+	}
+	sort.Slice(response.Orgs, func(i, j int) bool { return response.Orgs[i].Organization < response.Orgs[j].Organization })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// GraphQL fetch mode (FETCH_MODE=graphql): the workflow runs of up to
+// graphqlBatchSize repositories are read in one GraphQL query, through the
+// GitHub Actions check suites of the latest commits of their branches,
+// instead of one or more REST calls per repository. Repositories are
+// still listed over REST (and cached, see REPO_CACHE_TTL), and a
+// repository the query couldn't read, or that's fetched on its own like
+// by the retry queue, falls back to REST.
+//
+// What GraphQL can't see: runs of pull requests from forks, runs on
+// commits older than the latest graphqlCommitsPerBranch of a branch, and
+// the triggering actor and attempt of a run. Started times are when the
+// run was created.
+
+const (
+	graphqlBatchSize        = 10
+	graphqlBranches         = 10 // most recently committed branches per repository, besides the default branch
+	graphqlCommitsPerBranch = 30
+	graphqlSuitesPerCommit  = 20
+	githubActionsAppID      = 15368
+)
+
+// fetchMode is how GitHub runs are fetched: "rest" or "graphql"
+// (FETCH_MODE).
+var fetchMode = "rest"
+
+// graphqlRunsQuery is the fragment read for every repository of a batch.
+var graphqlRunsQuery = fmt.Sprintf(`
+fragment commitRuns on Commit {
+  oid
+  messageHeadline
+  checkSuites(first: %[3]d, filterBy: {appId: %[4]d}) {
+    nodes {
+      status
+      conclusion
+      branch { name }
+      workflowRun { databaseId runNumber url createdAt updatedAt event workflow { databaseId name } }
+    }
+  }
+}
+fragment branchRuns on Ref {
+  name
+  target {
+    ... on Commit {
+      ...commitRuns
+      history(first: %[2]d, since: $since) { nodes { ...commitRuns } }
+    }
+  }
+}
+fragment repoRuns on Repository {
+  defaultBranchRef { ...branchRuns }
+  refs(refPrefix: "refs/heads/", first: %[1]d, orderBy: {field: TAG_COMMIT_DATE, direction: DESC}) { nodes { ...branchRuns } }
+}`, graphqlBranches, graphqlCommitsPerBranch, graphqlSuitesPerCommit, githubActionsAppID)
+
+type graphqlCheckSuite struct {
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	Branch     *struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+	WorkflowRun *struct {
+		DatabaseID int64     `json:"databaseId"`
+		RunNumber  int       `json:"runNumber"`
+		URL        string    `json:"url"`
+		CreatedAt  time.Time `json:"createdAt"`
+		UpdatedAt  time.Time `json:"updatedAt"`
+		Event      string    `json:"event"`
+		Workflow   struct {
+			DatabaseID int64  `json:"databaseId"`
+			Name       string `json:"name"`
+		} `json:"workflow"`
+	} `json:"workflowRun"`
+}
+
+type graphqlCommit struct {
+	OID             string `json:"oid"`
+	MessageHeadline string `json:"messageHeadline"`
+	CheckSuites     struct {
+		Nodes []graphqlCheckSuite `json:"nodes"`
+	} `json:"checkSuites"`
+	History *struct {
+		Nodes []graphqlCommit `json:"nodes"`
+	} `json:"history"`
+}
+
+type graphqlRef struct {
+	Name   string         `json:"name"`
+	Target *graphqlCommit `json:"target"`
+}
+
+type graphqlRepo struct {
+	DefaultBranchRef *graphqlRef `json:"defaultBranchRef"`
+	Refs             struct {
+		Nodes []graphqlRef `json:"nodes"`
+	} `json:"refs"`
+}
+
+// workflowRuns returns the distinct workflow runs of the repository's
+// commits, newest first.
+func (r *graphqlRepo) workflowRuns() []*github.WorkflowRun {
+	seen := make(map[int64]bool)
+	var runs []*github.WorkflowRun
+	var addCommit func(ref string, commit *graphqlCommit)
+	addCommit = func(ref string, commit *graphqlCommit) {
+		for _, suite := range commit.CheckSuites.Nodes {
+			wr := suite.WorkflowRun
+			if wr == nil || seen[wr.DatabaseID] {
+				continue
+			}
+			seen[wr.DatabaseID] = true
+			branch := ref
+			if suite.Branch != nil {
+				branch = suite.Branch.Name
+			}
+			run := &github.WorkflowRun{
+				ID:           github.Int64(wr.DatabaseID),
+				WorkflowID:   github.Int64(wr.Workflow.DatabaseID),
+				Name:         github.String(wr.Workflow.Name),
+				RunNumber:    github.Int(wr.RunNumber),
+				HeadBranch:   github.String(branch),
+				HeadSHA:      github.String(commit.OID),
+				Status:       github.String(strings.ToLower(suite.Status)),
+				HTMLURL:      github.String(wr.URL),
+				CreatedAt:    &github.Timestamp{Time: wr.CreatedAt},
+				RunStartedAt: &github.Timestamp{Time: wr.CreatedAt},
+				UpdatedAt:    &github.Timestamp{Time: wr.UpdatedAt},
+				Event:        github.String(strings.ToLower(wr.Event)),
+				HeadCommit:   &github.HeadCommit{Message: github.String(commit.MessageHeadline)},
+			}
+			if suite.Conclusion != "" {
+				run.Conclusion = github.String(strings.ToLower(suite.Conclusion))
+			}
+			runs = append(runs, run)
+		}
+		if commit.History != nil {
+			for i := range commit.History.Nodes {
+				addCommit(ref, &commit.History.Nodes[i])
+			}
+		}
+	}
+
+	refs := r.Refs.Nodes
+	if r.DefaultBranchRef != nil {
+		refs = append([]graphqlRef{*r.DefaultBranchRef}, refs...)
+	}
+	for _, ref := range refs {
+		if ref.Target != nil {
+			addCommit(ref.Name, ref.Target)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt.Time) })
+	return runs
+}
+
+// graphqlBatch is the runs of a group of repositories, read by the first
+// ListRuns that needs one of them.
+type graphqlBatch struct {
+	once   sync.Once
+	window fetchWindow
+	repos  []Pipeline
+	runs   map[string][]*github.WorkflowRun // by repository; missing when the query couldn't read it
+	err    error
+}
+
+// graphqlBatches holds the batches planned by ListPipelines, by period,
+// organization and repository.
+var graphqlBatches = struct {
+	sync.Mutex
+	byRepo map[string]*graphqlBatch
+}{byRepo: make(map[string]*graphqlBatch)}
+
+func graphqlBatchKey(period, org, repo string) string {
+	return period + "|" + strings.ToLower(org+"/"+repo)
+}
+
+// planGraphQLBatches groups the pipelines into batches, in order, so the
+// repositories fetched at about the same time share a query.
+func planGraphQLBatches(window fetchWindow, pipelines []Pipeline) {
+	graphqlBatches.Lock()
+	defer graphqlBatches.Unlock()
+	for start := 0; start < len(pipelines); start += graphqlBatchSize {
+		batch := &graphqlBatch{window: window, repos: pipelines[start:min(start+graphqlBatchSize, len(pipelines))]}
+		for _, repo := range batch.repos {
+			graphqlBatches.byRepo[graphqlBatchKey(window.Period, repo.Org, repo.Name)] = batch
+		}
+	}
+}
+
+// graphqlRuns returns the repository's runs from its batch, loading the
+// batch first if needed; false when REST has to be used instead.
+func graphqlRuns(ctx context.Context, window fetchWindow, repo Pipeline) ([]*github.WorkflowRun, bool) {
+	key := graphqlBatchKey(window.Period, repo.Org, repo.Name)
+	graphqlBatches.Lock()
+	batch := graphqlBatches.byRepo[key]
+	delete(graphqlBatches.byRepo, key)
+	graphqlBatches.Unlock()
+	if batch == nil {
+		return nil, false
+	}
+
+	batch.once.Do(func() { batch.load(ctx) })
+	if batch.err != nil {
+		log.Printf("   ⚠️  GraphQL query for %s/%s failed, using REST: %v", repo.Org, repo.Name, batch.err)
+		return nil, false
+	}
+	runs, ok := batch.runs[repo.Name]
+	return runs, ok
+}
+
+func (b *graphqlBatch) load(ctx context.Context) {
+	var params, fields strings.Builder
+	variables := map[string]interface{}{"since": b.window.Start.Add(-rerunLookback).UTC().Format(time.RFC3339)}
+	params.WriteString("$since: GitTimestamp!")
+	for i, repo := range b.repos {
+		fmt.Fprintf(&params, ", $o%d: String!, $n%d: String!", i, i)
+		fmt.Fprintf(&fields, "  r%d: repository(owner: $o%d, name: $n%d) { ...repoRuns }\n", i, i, i)
+		variables[fmt.Sprintf("o%d", i)] = repo.Org
+		variables[fmt.Sprintf("n%d", i)] = repo.Name
+	}
+	query := fmt.Sprintf("query(%s) {\n%s  rateLimit { cost remaining limit }\n}\n%s", params.String(), fields.String(), graphqlRunsQuery)
+
+	queryCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+	var data map[string]json.RawMessage
+	if b.err = postGraphQL(queryCtx, query, variables, &data); b.err != nil {
+		return
+	}
+
+	b.runs = make(map[string][]*github.WorkflowRun, len(b.repos))
+	for i, repo := range b.repos {
+		raw, ok := data[fmt.Sprintf("r%d", i)]
+		if !ok || string(raw) == "null" {
+			continue // not found or not readable, REST tells why
+		}
+		var result graphqlRepo
+		if err := json.Unmarshal(raw, &result); err != nil {
+			log.Printf("   ⚠️  Error reading GraphQL runs of %s/%s: %v", repo.Org, repo.Name, err)
+			continue
+		}
+		b.runs[repo.Name] = result.workflowRuns()
+	}
+
+	var rate struct {
+		Cost      int `json:"cost"`
+		Remaining int `json:"remaining"`
+		Limit     int `json:"limit"`
+	}
+	if json.Unmarshal(data["rateLimit"], &rate) == nil {
+		log.Printf("   ✅ Read runs of %d repositories with GraphQL (cost %d, %d/%d points remaining)", len(b.runs), rate.Cost, rate.Remaining, rate.Limit)
+	}
+}
+
+// postGraphQL sends a query to the GitHub GraphQL API and decodes its data.
+// Errors of single fields leave them null; only a query without any data
+// fails.
+func postGraphQL(ctx context.Context, query string, variables map[string]interface{}, data interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, graphqlURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := githubClient.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := github.CheckResponse(resp); err != nil {
+		return err
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Data) == 0 || string(result.Data) == "null" {
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("graphql: %s", result.Errors[0].Message)
+		}
+		return fmt.Errorf("graphql: no data")
+	}
+	return json.Unmarshal(result.Data, data)
+}
+
+// graphqlURL is the GraphQL endpoint next to the REST API the client uses:
+// api.github.com/graphql, or /api/graphql on GitHub Enterprise Server.
+func graphqlURL() string {
+	base := *githubClient.BaseURL
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		base.Path = strings.TrimSuffix(base.Path, "v3/") + "graphql"
+	} else {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/graphql"
+	}
+	return base.String()
+}
+
+// githubGraphQLProvider is githubProvider with the runs read in batches
+// over GraphQL.
+type githubGraphQLProvider struct {
+	githubProvider
+}
+
+func (p githubGraphQLProvider) ListPipelines(ctx context.Context, window fetchWindow, orgName string) ([]Pipeline, error) {
+	pipelines, err := p.githubProvider.ListPipelines(ctx, window, orgName)
+	if err == nil {
+		planGraphQLBatches(window, pipelines)
+	}
+	return pipelines, err
+}
+
+func (p githubGraphQLProvider) ListRuns(ctx context.Context, window fetchWindow, repo Pipeline) ([]Job, error) {
+	runs, ok := graphqlRuns(ctx, window, repo)
+	if !ok {
+		return p.githubProvider.ListRuns(ctx, window, repo)
+	}
+	if depth := runDepth(repo.Org, repo.Name); depth != runDepthAll && len(runs) > depth {
+		runs = runs[:depth]
+	}
+	if len(runs) == 0 {
+		checkWorkflows(ctx, repo)
+	}
+	return runsToJobs(ctx, window, repo, runs), nil
+}
+
+func loadFetchModeConfig() {
+	fetchMode = strings.ToLower(getEnvString("FETCH_MODE", fetchMode))
+	switch fetchMode {
+	case "rest":
+	case "graphql":
+		log.Printf("🧬 Fetching workflow runs with GraphQL, %d repositories per query", graphqlBatchSize)
+	default:
+		log.Fatalf("Invalid FETCH_MODE %q: expected rest or graphql", fetchMode)
+	}
+}
+
+// newGitHubProvider returns the GitHub provider for FETCH_MODE.
+func newGitHubProvider() Provider {
+	if fetchMode == "graphql" {
+		return githubGraphQLProvider{}
+	}
+	return githubProvider{}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Run history: finished runs are kept per repository and branch in the
+// shared Store for much longer than snapshots, so questions like "when did
+// this start failing?" can be answered beyond the month period.
+
+var (
+	// historyRetention is how long a repository's history is kept after
+	// its last recorded run.
+	historyRetention = 90 * 24 * time.Hour
+
+	// historyMaxRuns caps the runs kept per repository and branch (all
+	// workflows together), oldest dropped first.
+	historyMaxRuns = 500
+)
+
+// HistoryRun is a finished run as kept in the history.
+type HistoryRun struct {
+	Provider        string    `json:"provider"`
+	ID              string    `json:"id"`
+	RunID           int64     `json:"run_id"`
+	Name            string    `json:"name"`
+	Workflow        string    `json:"workflow"`
+	Status          string    `json:"status"`
+	HeadSHA         string    `json:"head_sha,omitempty"`
+	CommitMessage   string    `json:"commit_message,omitempty"`
+	Actor           string    `json:"actor,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	HTMLURL         string    `json:"html_url"`
+	Tags            []string  `json:"tags,omitempty"`
+}
+
+func historyKey(org, repo, branch string) string {
+	return "history:" + org + "/" + repo + "|" + branch
+}
+
+// recordHistory adds the runs of a fresh snapshot that finished or changed
+// since the previous fetch to the history (see trackChanges).
+func recordHistory(snap *Snapshot) {
+	updates := make(map[string][]HistoryRun)
+	for _, job := range snap.Response.Jobs {
+		if !finished(job) || !job.ChangedAt.Equal(snap.FetchedAt) {
+			continue
+		}
+		key := historyKey(job.Organization, job.Pipeline, job.Branch)
+		updates[key] = append(updates[key], HistoryRun{
+			Provider:        job.Provider,
+			ID:              job.ID,
+			RunID:           job.RunID,
+			Name:            job.Name,
+			Workflow:        workflowName(job.Name),
+			Status:          job.Status,
+			HeadSHA:         job.HeadSHA,
+			CommitMessage:   job.CommitMessage,
+			Actor:           job.Actor,
+			CreatedAt:       job.CreatedAt,
+			DurationSeconds: job.DurationSeconds,
+			HTMLURL:         job.HTMLURL,
+			Tags:            job.Tags,
+		})
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	// Written in the background, waiting for a history lock shouldn't hold
+	// up the fetch
+	go func() {
+		recorded := 0
+		for key, runs := range updates {
+			if err := lockedAppendHistory(context.Background(), key, runs); err != nil {
+				log.Printf("⚠️  Error recording run history for %s: %v", key, err)
+				continue
+			}
+			recorded += len(runs)
+		}
+		log.Printf("🗄️  Recorded %d finished run(s) in history", recorded)
+	}()
+}
+
+// lockedAppendHistory appends under a lock: periods are fetched
+// independently (possibly on other replicas) and record the same runs.
+func lockedAppendHistory(ctx context.Context, key string, runs []HistoryRun) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+key, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if ok {
+			defer release()
+			return appendHistory(ctx, key, runs)
+		}
+		time.Sleep(lockPollInterval)
+	}
+	return fmt.Errorf("timed out waiting for the history lock")
+}
+
+func appendHistory(ctx context.Context, key string, runs []HistoryRun) error {
+	history, err := loadHistoryKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	// A rerun replaces the earlier record of the same run
+	byID := make(map[string]int)
+	for i, run := range history {
+		byID[run.Provider+"|"+run.ID] = i
+	}
+	for _, run := range runs {
+		if i, ok := byID[run.Provider+"|"+run.ID]; ok {
+			history[i] = run
+			continue
+		}
+		byID[run.Provider+"|"+run.ID] = len(history)
+		history = append(history, run)
+	}
+
+	// Newest first
+	sort.Slice(history, func(i, j int) bool { return history[i].CreatedAt.After(history[j].CreatedAt) })
+	if len(history) > historyMaxRuns {
+		history = history[:historyMaxRuns]
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return store.Set(ctx, key, data, historyRetention)
+}
+
+// loadHistory returns the recorded runs of a repository's branch, newest
+// first.
+func loadHistory(ctx context.Context, org, repo, branch string) ([]HistoryRun, error) {
+	return loadHistoryKey(ctx, historyKey(org, repo, branch))
+}
+
+func loadHistoryKey(ctx context.Context, key string) ([]HistoryRun, error) {
+	data, ok, err := store.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var history []HistoryRun
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// Per-phase deadlines so one hung request can't stall a whole fetch
+	repoListTimeout = 60 * time.Second
+	runListTimeout  = 30 * time.Second
+
+	// fetchTimeout bounds a whole fetch of all organizations; what was
+	// collected by then is served as a partial result. Zero is unlimited.
+	fetchTimeout time.Duration
+)
+
+// newGitHubHTTPClient builds the HTTP client used for GitHub API calls, with
+// a per-request timeout. Requests are authenticated with the token source,
+// then go through retryTransport (retries of transient errors and GitHub's
+// rate limit throttle, githubretry.go), the token pool when there is one,
+// countingTransport (API call metrics), the fixture transport when
+// recording or replaying, and finally the tuned connection pool of
+// newTransport. withETagCache wraps the result for conditional requests. A
+// nil token source gives an unauthenticated client, unless a token pool
+// authenticates it (see newTokenPoolHTTPClient).
+func newGitHubHTTPClient(ts oauth2.TokenSource) *http.Client {
+	return buildGitHubHTTPClient(ts, nil)
+}
+
+// newTokenPoolHTTPClient is newGitHubHTTPClient sending every request with
+// a token of the pool. The pool sits below the retries, so a request
+// refused for one token's rate limit is sent again with another.
+func newTokenPoolHTTPClient(pool *tokenPool) *http.Client {
+	return buildGitHubHTTPClient(nil, pool)
+}
+
+func buildGitHubHTTPClient(ts oauth2.TokenSource, pool *tokenPool) *http.Client {
+	var sender http.RoundTripper = &countingTransport{base: wrapFixtureTransport(newTransport())}
+	if pool != nil {
+		pool.base, sender = sender, pool
+	}
+	base := &http.Client{Transport: &retryTransport{base: sender}}
+	timeout := httpTimeout()
+	if ts == nil {
+		// Unauthenticated, e.g. when replaying recorded fixtures, or
+		// authenticated by the pool
+		base.Timeout = timeout
+		return base
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	client := oauth2.NewClient(ctx, ts)
+	client.Timeout = timeout
+	return client
+}
+
+// newHTTPClient builds the HTTP client of the other CI providers and
+// integrations: the same timeouts and connection pool settings as GitHub,
+// without GitHub's retries, rate limit budget, metrics and fixtures.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: newTransport(), Timeout: httpTimeout()}
+}
+
+// newTransport builds a tuned connection pool. All settings can be
+// overridden from the environment:
+//
+//	GITHUB_HTTP_TIMEOUT           per-request timeout (default 30s)
+//	GITHUB_MAX_IDLE_CONNS         idle connections kept in total (default 100)
+//	GITHUB_MAX_CONNS_PER_HOST     open connections per host, 0 = unlimited (default 0)
+//	GITHUB_IDLE_CONN_TIMEOUT      how long idle connections are kept (default 90s)
+//	GITHUB_KEEP_ALIVE             TCP keep-alive interval (default 30s)
+//	GITHUB_TLS_HANDSHAKE_TIMEOUT  TLS handshake timeout (default 10s)
+func newTransport() *http.Transport {
+	maxIdleConns := getEnvInt("GITHUB_MAX_IDLE_CONNS", 100)
+
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: getEnvDuration("GITHUB_KEEP_ALIVE", 30*time.Second),
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns, // nearly all traffic goes to a single host
+		MaxConnsPerHost:       getEnvInt("GITHUB_MAX_CONNS_PER_HOST", 0),
+		IdleConnTimeout:       getEnvDuration("GITHUB_IDLE_CONN_TIMEOUT", 90*time.Second),
+		TLSHandshakeTimeout:   getEnvDuration("GITHUB_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func httpTimeout() time.Duration {
+	return getEnvDuration("GITHUB_HTTP_TIMEOUT", 30*time.Second)
+}
+
+func loadPhaseTimeouts() {
+	repoListTimeout = getEnvDuration("REPO_LIST_TIMEOUT", repoListTimeout)
+	runListTimeout = getEnvDuration("RUN_LIST_TIMEOUT", runListTimeout)
+	fetchTimeout = getEnvDuration("FETCH_TIMEOUT", fetchTimeout)
+}
+
+// withPhaseTimeout derives a context for one fetch phase. A zero timeout
+// leaves the parent deadline untouched.
+func withPhaseTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// pluralForm selects the message variant for a count.
+type pluralForm int
+
+const (
+	pluralOne pluralForm = iota
+	pluralOther
+)
+
+// localeCatalog holds the translated "time ago" strings of one locale. The
+// message maps are keyed by plural form; %d is replaced by the count.
+type localeCatalog struct {
+	plural  func(n int) pluralForm
+	justNow string
+	minutes map[pluralForm]string
+	hours   map[pluralForm]string
+	days    map[pluralForm]string
+}
+
+var catalogs = map[string]localeCatalog{
+	"en": {
+		plural: func(n int) pluralForm {
+			if n == 1 {
+				return pluralOne
+			}
+			return pluralOther
+		},
+		justNow: "just now",
+		minutes: map[pluralForm]string{pluralOne: "%d minute ago", pluralOther: "%d minutes ago"},
+		hours:   map[pluralForm]string{pluralOne: "%d hour ago", pluralOther: "%d hours ago"},
+		days:    map[pluralForm]string{pluralOne: "%d day ago", pluralOther: "%d days ago"},
+	},
+	"id": {
+		// Indonesian nouns don't inflect for number
+		plural:  func(n int) pluralForm { return pluralOther },
+		justNow: "baru saja",
+		minutes: map[pluralForm]string{pluralOther: "%d menit yang lalu"},
+		hours:   map[pluralForm]string{pluralOther: "%d jam yang lalu"},
+		days:    map[pluralForm]string{pluralOther: "%d hari yang lalu"},
+	},
+}
+
+// defaultLocale is used when a request doesn't ask for a locale.
+var defaultLocale = "en"
+
+// resolveLocale maps a requested locale such as "id-ID" or "en_US" to a
+// supported one, falling back to the default locale.
+func resolveLocale(requested string) string {
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if _, ok := catalogs[requested]; ok {
+		return requested
+	}
+	lang, _, _ := strings.Cut(strings.ReplaceAll(requested, "_", "-"), "-")
+	if _, ok := catalogs[lang]; ok {
+		return lang
+	}
+	return defaultLocale
+}
+
+func (c localeCatalog) format(messages map[pluralForm]string, n int) string {
+	msg, ok := messages[c.plural(n)]
+	if !ok {
+		msg = messages[pluralOther]
+	}
+	return fmt.Sprintf(msg, n)
+}
+
+// formatTimeAgo renders how long ago t was in the given locale.
+func formatTimeAgo(t time.Time, locale string) string {
+	catalog := catalogs[resolveLocale(locale)]
+	diff := clock().Sub(t)
+
+	days := int(diff.Hours() / 24)
+	hours := int(diff.Hours())
+	minutes := int(diff.Minutes())
+
+	if days > 0 {
+		return catalog.format(catalog.days, days)
+	} else if hours > 0 {
+		return catalog.format(catalog.hours, hours)
+	} else if minutes > 0 {
+		return catalog.format(catalog.minutes, minutes)
+	}
+	return catalog.justNow
+}
+
+// localizeJobs recomputes the relative "started" strings at response time,
+// so cached jobs don't show how long ago they were when they were fetched.
+func localizeJobs(jobs []Job, locale string) {
+	for i := range jobs {
+		if jobs[i].StartedAt.IsZero() {
+			jobs[i].Started = "N/A"
+			continue
+		}
+		jobs[i].Started = formatTimeAgo(jobs[i].StartedAt, locale)
+	}
+}
+
+func loadLocaleConfig() {
+	env := strings.TrimSpace(os.Getenv("LOCALE"))
+	if env == "" {
+		return
+	}
+	locale := resolveLocale(env)
+	if locale != strings.ToLower(env) && !strings.HasPrefix(strings.ToLower(env), locale) {
+		log.Fatalf("Unsupported LOCALE %q (supported: en, id)", env)
+	}
+	defaultLocale = locale
+}
+
+// requestLocale returns the locale asked for with ?locale=.
+func requestLocale(query string) string {
+	if query == "" {
+		return defaultLocale
+	}
+	return resolveLocale(query)
+}
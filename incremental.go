@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Incremental sync: between full fetches, only the pipelines that were
+// active since the previous fetch of the period are fetched again, the runs
+// of the others are carried over. For GitHub the activity is the
+// repository's pushed_at, which the repository listing reads anyway (see
+// repos.go), so a steady-state refresh costs about one call per
+// organization plus one per changed or still running repository.
+
+var (
+	// incrementalSync enables incremental sync (INCREMENTAL_SYNC).
+	incrementalSync = false
+
+	// fullSyncInterval is how often every pipeline is fetched anyway, to
+	// pick up runs that don't come with a push: schedules, manual runs and
+	// re-runs.
+	fullSyncInterval = 15 * time.Minute
+)
+
+// syncState is what the previous fetch of a period saw of one source.
+type syncState struct {
+	FullSyncAt time.Time                `json:"full_sync_at"`
+	Pipelines  map[string]pipelineState `json:"pipelines"`
+}
+
+type pipelineState struct {
+	ActiveAt time.Time `json:"active_at"`
+	Jobs     []Job     `json:"jobs"`
+}
+
+func syncStateKey(period string, src source) string {
+	return "sync:" + period + ":" + src.Provider.Name() + ":" + src.Org
+}
+
+func pipelineKey(pipeline Pipeline) string {
+	if pipeline.Branch != "" {
+		return pipeline.Name + "@" + pipeline.Branch
+	}
+	return pipeline.Name
+}
+
+// loadSyncState returns the sync state of a source, empty when there is
+// none yet.
+func loadSyncState(ctx context.Context, period string, src source) *syncState {
+	state := &syncState{}
+	data, ok, err := store.Get(ctx, syncStateKey(period, src))
+	if err != nil {
+		log.Printf("⚠️  Error reading sync state of %s from store: %v", src.Org, err)
+	}
+	if ok {
+		if err := json.Unmarshal(data, state); err != nil {
+			log.Printf("⚠️  Invalid sync state of %s, doing a full sync: %v", src.Org, err)
+			state = &syncState{}
+		}
+	}
+	if state.Pipelines == nil {
+		state.Pipelines = make(map[string]pipelineState)
+	}
+	return state
+}
+
+func saveSyncState(ctx context.Context, period string, src source, state *syncState) {
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = store.Set(ctx, syncStateKey(period, src), data, snapshotRetention)
+	}
+	if err != nil {
+		log.Printf("⚠️  Error saving sync state of %s to store: %v", src.Org, err)
+	}
+}
+
+// fullSyncDue reports whether every pipeline should be fetched this time.
+func (s *syncState) fullSyncDue() bool {
+	return clock().Sub(s.FullSyncAt) >= fullSyncInterval
+}
+
+// reuse returns the runs of a pipeline carried over from the previous
+// fetch, still inside the window. It returns false when the pipeline has to
+// be fetched: it is new, has been active since, its activity is unknown, or
+// some of its runs hadn't finished yet.
+func (s *syncState) reuse(window fetchWindow, pipeline Pipeline) ([]Job, bool) {
+	prev, ok := s.Pipelines[pipelineKey(pipeline)]
+	if !ok || pipeline.ActiveAt.IsZero() || pipeline.ActiveAt.After(prev.ActiveAt) {
+		return nil, false
+	}
+	var jobs []Job
+	for _, job := range prev.Jobs {
+		if !finished(job) {
+			return nil, false
+		}
+		runTime := job.StartedAt
+		if runTime.IsZero() {
+			runTime = job.CreatedAt
+		}
+		if window.contains(runTime) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, true
+}
+
+// remember records the runs fetched for a pipeline. Pipelines without a
+// known activity time are always fetched, so they aren't kept.
+func (s *syncState) remember(pipeline Pipeline, jobs []Job) {
+	if !pipeline.ActiveAt.IsZero() {
+		s.Pipelines[pipelineKey(pipeline)] = pipelineState{ActiveAt: pipeline.ActiveAt, Jobs: jobs}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jenkinsProvider fetches builds from Jenkins through its JSON API. Folders
+// listed in JENKINS_FOLDERS play the role of organizations; every job
+// below them (including branch jobs of multibranch pipelines) is a
+// pipeline, and its name is used as the workflow name.
+type jenkinsProvider struct {
+	baseURL string
+	user    string
+	token   string
+	client  *http.Client
+}
+
+// loadJenkinsConfig adds a source for every folder in JENKINS_FOLDERS.
+func loadJenkinsConfig() {
+	folders := splitList(os.Getenv("JENKINS_FOLDERS"))
+	if len(folders) == 0 {
+		return
+	}
+	baseURL := strings.TrimRight(os.Getenv("JENKINS_URL"), "/")
+	if baseURL == "" {
+		log.Fatal("JENKINS_URL environment variable is required when JENKINS_FOLDERS is set")
+	}
+
+	provider := &jenkinsProvider{
+		baseURL: baseURL,
+		user:    os.Getenv("JENKINS_USER"),
+		token:   os.Getenv("JENKINS_TOKEN"),
+		client:  newHTTPClient(),
+	}
+	for _, folder := range folders {
+		sources = append(sources, source{Provider: provider, Org: strings.Trim(folder, "/")})
+	}
+	log.Printf("🤵 Jenkins enabled: %d folder(s) on %s", len(folders), baseURL)
+}
+
+func (p *jenkinsProvider) Name() string { return "jenkins" }
+
+func (p *jenkinsProvider) auth(req *http.Request) {
+	if p.user != "" {
+		req.SetBasicAuth(p.user, p.token)
+	}
+}
+
+// jobURL turns a slash-separated job path such as "team/api/main" into
+// the job's URL, /job/team/job/api/job/main.
+func (p *jenkinsProvider) jobURL(path string) string {
+	var b strings.Builder
+	b.WriteString(p.baseURL)
+	for _, segment := range strings.Split(path, "/") {
+		b.WriteString("/job/")
+		b.WriteString(url.PathEscape(segment))
+	}
+	return b.String()
+}
+
+type jenkinsJob struct {
+	Name      string        `json:"name"`
+	Class     string        `json:"_class"`
+	LastBuild *jenkinsBuild `json:"lastBuild"`
+	Jobs      []jenkinsJob  `json:"jobs"`
+}
+
+type jenkinsBuild struct {
+	Number            int64   `json:"number"`
+	Result            *string `json:"result"`
+	Building          bool    `json:"building"`
+	Timestamp         int64   `json:"timestamp"`         // start, in milliseconds
+	Duration          int64   `json:"duration"`          // milliseconds, 0 while building
+	EstimatedDuration int64   `json:"estimatedDuration"` // milliseconds
+	URL               string  `json:"url"`
+}
+
+func (b jenkinsBuild) startedAt() time.Time {
+	return time.UnixMilli(b.Timestamp)
+}
+
+// jenkinsFolderDepth is how many levels of nested folders and multibranch
+// projects are listed below a configured folder.
+const jenkinsFolderDepth = 4
+
+func jenkinsJobTree(depth int) string {
+	fields := "name,_class,lastBuild[timestamp]"
+	if depth > 1 {
+		fields += ",jobs[" + jenkinsJobTree(depth-1) + "]"
+	}
+	return fields
+}
+
+// ListPipelines returns the jobs below the folder that built during the
+// window, most recently built first.
+func (p *jenkinsProvider) ListPipelines(ctx context.Context, window fetchWindow, folder string) ([]Pipeline, error) {
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	defer cancel()
+
+	var root jenkinsJob
+	query := url.Values{"tree": {"jobs[" + jenkinsJobTree(jenkinsFolderDepth) + "]"}}
+	if _, err := apiGetJSON(listCtx, p.client, p.jobURL(folder)+"/api/json?"+query.Encode(), p.auth, &root); err != nil {
+		return nil, err
+	}
+
+	type activeJob struct {
+		pipeline Pipeline
+		lastRun  time.Time
+	}
+	var active []activeJob
+	var walk func(prefix string, jobs []jenkinsJob, multibranch bool)
+	walk = func(prefix string, jobs []jenkinsJob, multibranch bool) {
+		for _, job := range jobs {
+			path := prefix + job.Name
+			// Folders and multibranch projects have child jobs but no builds
+			if job.Jobs != nil {
+				walk(path+"/", job.Jobs, strings.HasSuffix(job.Class, "MultiBranchProject"))
+				continue
+			}
+			if job.LastBuild == nil || !window.contains(job.LastBuild.startedAt()) {
+				continue
+			}
+			pipeline := Pipeline{Org: folder, Name: path}
+			if multibranch {
+				// Multibranch encodes "/" in branch names as %2F
+				pipeline.Branch, _ = url.PathUnescape(job.Name)
+			}
+			active = append(active, activeJob{pipeline: pipeline, lastRun: job.LastBuild.startedAt()})
+		}
+	}
+	walk("", root.Jobs, false)
+
+	sort.SliceStable(active, func(i, j int) bool { return active[i].lastRun.After(active[j].lastRun) })
+	pipelines := make([]Pipeline, len(active))
+	for i, job := range active {
+		pipelines[i] = job.pipeline
+	}
+	log.Printf("✅ Found %d Jenkins jobs built %s in folder %s", len(pipelines), window.name(), folder)
+	return pipelines, nil
+}
+
+// ListRuns returns the job's builds inside the window.
+func (p *jenkinsProvider) ListRuns(ctx context.Context, window fetchWindow, pipeline Pipeline) ([]Job, error) {
+	runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	defer cancel()
+
+	var job struct {
+		Builds []jenkinsBuild `json:"builds"`
+	}
+	query := url.Values{"tree": {"builds[number,result,building,timestamp,duration,estimatedDuration,url]{0,50}"}}
+	if _, err := apiGetJSON(runCtx, p.client, p.jobURL(pipeline.Org+"/"+pipeline.Name)+"/api/json?"+query.Encode(), p.auth, &job); err != nil {
+		return nil, err
+	}
+	log.Printf("   ✅ Found %d builds in %s/%s", len(job.Builds), pipeline.Org, pipeline.Name)
+
+	var jobs []Job
+	for _, build := range job.Builds {
+		if window.contains(build.startedAt()) {
+			jobs = append(jobs, p.buildToJob(pipeline, build))
+		}
+	}
+	return jobs, nil
+}
+
+// jenkinsStatus maps a build result to the dashboard's statuses. UNSTABLE
+// (failing tests) and ABORTED count as failed, like GitHub's failure and
+// cancelled.
+func jenkinsStatus(build jenkinsBuild) string {
+	if build.Building {
+		return "running"
+	}
+	if build.Result == nil {
+		return "pending"
+	}
+	switch *build.Result {
+	case "SUCCESS":
+		return "success"
+	case "NOT_BUILT":
+		return "pending"
+	default: // FAILURE, UNSTABLE, ABORTED
+		return "failed"
+	}
+}
+
+// jenkinsConclusion maps a finished build's result to GitHub's
+// conclusions, see Job.Conclusion.
+func jenkinsConclusion(build jenkinsBuild) string {
+	if build.Building || build.Result == nil {
+		return ""
+	}
+	switch *build.Result {
+	case "SUCCESS":
+		return "success"
+	case "ABORTED":
+		return "cancelled"
+	case "NOT_BUILT":
+		return "skipped"
+	default: // FAILURE, UNSTABLE
+		return "failure"
+	}
+}
+
+func (p *jenkinsProvider) buildToJob(pipeline Pipeline, build jenkinsBuild) Job {
+	status := jenkinsStatus(build)
+	startedAt := build.startedAt()
+	duration := time.Duration(build.Duration) * time.Millisecond
+	if build.Building {
+		duration = clock().Sub(startedAt)
+	}
+
+	// The job is the workflow; for branch jobs of a multibranch project the
+	// project is the workflow and the job name is the branch
+	workflow, branch := pipeline.Name, "N/A"
+	if pipeline.Branch != "" {
+		workflow, branch = pipeline.Name[:strings.LastIndex(pipeline.Name, "/")], pipeline.Branch
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(pipeline.Org + "/" + pipeline.Name))
+	pathHash := h.Sum32()
+	h.Reset()
+	h.Write([]byte(pipeline.Org + "/" + workflow))
+
+	job := Job{
+		ID:           fmt.Sprintf("JK-%08x-%d", pathHash, build.Number),
+		Provider:     "jenkins",
+		Name:         fmt.Sprintf("%s #%d", workflow, build.Number),
+		Status:       status,
+		Conclusion:   jenkinsConclusion(build),
+		Pipeline:     pipeline.Name,
+		Branch:       branch,
+		Duration:     formatDuration(startedAt, startedAt.Add(duration)),
+		Started:      formatTimeAgo(startedAt, defaultLocale),
+		Organization: pipeline.Org,
+		RunID:        build.Number,
+		HTMLURL:      build.URL,
+		CreatedAt:    startedAt,
+
+		StartedAt:       startedAt,
+		DurationSeconds: int64(duration.Seconds()),
+		WorkflowID:      int64(h.Sum32()),
+	}
+	// Jenkins estimates the duration from recent builds, which serves the
+	// same purpose as the median of successful runs
+	if build.Building && build.EstimatedDuration > 0 {
+		estimate := build.EstimatedDuration / 1000
+		job.MedianDurationSeconds = &estimate
+	}
+	return job
+}
+
+// GetLogs returns the build's console output.
+func (p *jenkinsProvider) GetLogs(ctx context.Context, pipeline Pipeline, buildNumber int64) (string, error) {
+	logURL := fmt.Sprintf("%s/%d/consoleText", p.jobURL(pipeline.Org+"/"+pipeline.Name), buildNumber)
+	text, err := apiGetText(ctx, p.client, logURL, p.auth, maxLogBytes)
+	if isNotFound(err) {
+		return "", errLogsNotFound
+	}
+	return text, err
+}
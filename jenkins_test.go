@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJenkinsBuildToJob(t *testing.T) {
+	started := time.Date(2025, 11, 10, 9, 0, 0, 0, time.UTC)
+	result := func(r string) *string { return &r }
+
+	tests := []struct {
+		name           string
+		pipeline       Pipeline
+		build          jenkinsBuild
+		wantStatus     string
+		wantConclusion string
+		wantName       string
+		wantBranch     string
+	}{
+		{
+			name:       "success",
+			pipeline:   Pipeline{Org: "platform", Name: "api"},
+			build:      jenkinsBuild{Number: 12, Result: result("SUCCESS"), Duration: 90000},
+			wantStatus: "success", wantConclusion: "success", wantName: "api #12", wantBranch: "N/A",
+		},
+		{
+			name:       "unstable",
+			pipeline:   Pipeline{Org: "platform", Name: "api"},
+			build:      jenkinsBuild{Number: 12, Result: result("UNSTABLE"), Duration: 90000},
+			wantStatus: "failed", wantConclusion: "failure", wantName: "api #12", wantBranch: "N/A",
+		},
+		{
+			name:       "aborted",
+			pipeline:   Pipeline{Org: "platform", Name: "api"},
+			build:      jenkinsBuild{Number: 12, Result: result("ABORTED"), Duration: 90000},
+			wantStatus: "failed", wantConclusion: "cancelled", wantName: "api #12", wantBranch: "N/A",
+		},
+		{
+			name:       "not built",
+			pipeline:   Pipeline{Org: "platform", Name: "api"},
+			build:      jenkinsBuild{Number: 12, Result: result("NOT_BUILT")},
+			wantStatus: "pending", wantConclusion: "skipped", wantName: "api #12", wantBranch: "N/A",
+		},
+		{
+			name:       "queued",
+			pipeline:   Pipeline{Org: "platform", Name: "api"},
+			build:      jenkinsBuild{Number: 12},
+			wantStatus: "pending", wantName: "api #12", wantBranch: "N/A",
+		},
+		{
+			name:       "branch of a multibranch project",
+			pipeline:   Pipeline{Org: "platform", Name: "web/feature%2Flogin", Branch: "feature/login"},
+			build:      jenkinsBuild{Number: 3, Building: true, EstimatedDuration: 120000},
+			wantStatus: "running", wantName: "web #3", wantBranch: "feature/login",
+		},
+	}
+	p := &jenkinsProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.build.Timestamp = started.UnixMilli()
+			job := p.buildToJob(tt.pipeline, tt.build)
+			if job.Status != tt.wantStatus || job.Conclusion != tt.wantConclusion {
+				t.Errorf("status, conclusion = %q, %q, want %q, %q", job.Status, job.Conclusion, tt.wantStatus, tt.wantConclusion)
+			}
+			if job.Name != tt.wantName || job.Branch != tt.wantBranch || job.Pipeline != tt.pipeline.Name || !job.StartedAt.Equal(started) {
+				t.Errorf("job = %+v", job)
+			}
+			if tt.build.Building {
+				if job.MedianDurationSeconds == nil || *job.MedianDurationSeconds != 120 {
+					t.Errorf("median duration = %v, want Jenkins' estimate", job.MedianDurationSeconds)
+				}
+			} else if job.DurationSeconds != tt.build.Duration/1000 {
+				t.Errorf("duration = %ds, want %dms", job.DurationSeconds, tt.build.Duration)
+			}
+		})
+	}
+
+	// Branches of one project share its workflow
+	main := p.buildToJob(Pipeline{Org: "platform", Name: "web/main", Branch: "main"}, jenkinsBuild{Number: 1})
+	feature := p.buildToJob(Pipeline{Org: "platform", Name: "web/feature", Branch: "feature"}, jenkinsBuild{Number: 1})
+	if main.WorkflowID != feature.WorkflowID || main.ID == feature.ID {
+		t.Errorf("branches: workflows %d and %d, IDs %s and %s", main.WorkflowID, feature.WorkflowID, main.ID, feature.ID)
+	}
+}
+
+func TestJenkinsJobURL(t *testing.T) {
+	p := &jenkinsProvider{baseURL: "https://jenkins.example.com"}
+	if got, want := p.jobURL("platform/web/feature%2Flogin"), "https://jenkins.example.com/job/platform/job/web/job/feature%252Flogin"; got != want {
+		t.Errorf("jobURL() = %q, want %q", got, want)
+	}
+}
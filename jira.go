@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Jira issues for persistent failures: when a workflow on a repository's
+// default branch has failed JIRA_FAILURE_THRESHOLD times in a row, an issue
+// is opened in JIRA_PROJECT with the failed runs and an excerpt of the
+// latest failure. It's commented on and closed when the workflow passes
+// again. Only GitHub Actions workflows are tracked.
+
+var jiraConfig struct {
+	url        string // https://acme.atlassian.net
+	user       string // empty uses token as a personal access token (Jira Server / Data Center)
+	token      string
+	project    string
+	issueType  string
+	labels     []string
+	threshold  int
+	transition string // workflow transition that closes an issue
+	client     *http.Client
+}
+
+// jiraIssue is the open issue of a workflow, kept in the Store.
+type jiraIssue struct {
+	Key      string    `json:"key"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+func loadJiraConfig() {
+	jiraConfig.url = strings.TrimRight(strings.TrimSpace(os.Getenv("JIRA_URL")), "/")
+	if jiraConfig.url == "" {
+		return
+	}
+	jiraConfig.user = os.Getenv("JIRA_USER")
+	jiraConfig.token = os.Getenv("JIRA_TOKEN")
+	jiraConfig.project = strings.TrimSpace(os.Getenv("JIRA_PROJECT"))
+	if jiraConfig.token == "" || jiraConfig.project == "" {
+		log.Fatal("JIRA_TOKEN and JIRA_PROJECT must be set together with JIRA_URL")
+	}
+	jiraConfig.issueType = getEnvString("JIRA_ISSUE_TYPE", "Bug")
+	jiraConfig.labels = splitList(getEnvString("JIRA_LABELS", "ci-failure"))
+	jiraConfig.threshold = getEnvInt("JIRA_FAILURE_THRESHOLD", 3)
+	if jiraConfig.threshold < 1 {
+		log.Fatalf("Invalid JIRA_FAILURE_THRESHOLD %d: expected at least 1", jiraConfig.threshold)
+	}
+	jiraConfig.transition = getEnvString("JIRA_DONE_TRANSITION", "Done")
+	jiraConfig.client = newHTTPClient()
+	log.Printf("🎫 Opening Jira issues in %s after %d consecutive failures on default branches", jiraConfig.project, jiraConfig.threshold)
+}
+
+func jiraIssueKey(job Job) string {
+	return "jira-issue:" + job.Organization + "/" + job.Pipeline + "|" + strings.ToLower(workflowName(job.Name))
+}
+
+// trackJiraIssues opens and closes issues for the workflows whose runs
+// just finished on their default branch, outside maintenance windows.
+func trackJiraIssues(ctx context.Context, finished []Job, snap *Snapshot) {
+	if jiraConfig.url == "" {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, job := range finished {
+		key := jiraIssueKey(job)
+		if job.Provider != "github" || hasTag(job, "maintenance") || seen[key] {
+			continue
+		}
+		seen[key] = true
+		defaultBranch, err := repoDefaultBranch(ctx, job.Organization, job.Pipeline)
+		if err != nil || job.Branch != defaultBranch {
+			continue
+		}
+		if err := trackJiraIssue(ctx, key, job, snap); err != nil {
+			log.Printf("⚠️  Error updating Jira issue of %s/%s %s: %v", job.Organization, job.Pipeline, workflowName(job.Name), err)
+		}
+	}
+}
+
+func trackJiraIssue(ctx context.Context, key string, job Job, snap *Snapshot) error {
+	// Periods and replicas see the same runs finish
+	release, ok, err := store.Lock(ctx, "lock:"+key, time.Minute)
+	if err != nil || !ok {
+		return err
+	}
+	defer release()
+
+	var issue *jiraIssue
+	if data, ok, err := store.Get(ctx, key); err != nil {
+		return err
+	} else if ok {
+		json.Unmarshal(data, &issue)
+	}
+	runs, err := workflowRuns(ctx, job, snap)
+	if err != nil || len(runs) == 0 {
+		return err
+	}
+	latest := runs[0]
+
+	switch {
+	case issue == nil && latest.Status == "failed":
+		streak := failureStreak(runs)
+		if len(streak) < jiraConfig.threshold {
+			return nil
+		}
+		excerpt, err := failureExcerpt(ctx, job.Organization, job.Pipeline, latest.RunID)
+		if err != nil {
+			log.Printf("⚠️  Error reading why run %d of %s/%s failed: %v", latest.RunID, job.Organization, job.Pipeline, err)
+		}
+		issue, err = openJiraIssue(ctx, job, streak, excerpt)
+		if err != nil {
+			return err
+		}
+		data, _ := json.Marshal(issue)
+		if err := store.Set(ctx, key, data, 0); err != nil {
+			return err
+		}
+		log.Printf("🎫 Opened %s: %s/%s %s failed %d times on %s", issue.Key, job.Organization, job.Pipeline, latest.Workflow, len(streak), job.Branch)
+
+	case issue != nil && latest.Status == "success":
+		if err := closeJiraIssue(ctx, issue.Key, job, latest); err != nil {
+			return err
+		}
+		// The store can't delete; a null issue is as good as none
+		if err := store.Set(ctx, key, []byte("null"), time.Second); err != nil {
+			return err
+		}
+		log.Printf("🎫 Closed %s: %s/%s %s passes again", issue.Key, job.Organization, job.Pipeline, latest.Workflow)
+	}
+	return nil
+}
+
+// openJiraIssue files the issue, in Jira wiki markup (REST API v2).
+func openJiraIssue(ctx context.Context, job Job, streak []HistoryRun, excerpt string) (*jiraIssue, error) {
+	latest := streak[0]
+	var description strings.Builder
+	fmt.Fprintf(&description, "Workflow *%s* on the default branch *%s* of [%s/%s|%s/%s/%s] has failed %d times in a row.\n\n",
+		latest.Workflow, job.Branch, job.Organization, job.Pipeline, githubWebURL, job.Organization, job.Pipeline, len(streak))
+	description.WriteString("h3. Failed runs\n")
+	for i, run := range streak {
+		if i == 10 {
+			fmt.Fprintf(&description, "* ... and %d earlier\n", len(streak)-i)
+			break
+		}
+		fmt.Fprintf(&description, "* [%s|%s] (%s)", run.Name, run.HTMLURL, run.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"))
+		if run.Actor != "" {
+			fmt.Fprintf(&description, " by %s", run.Actor)
+		}
+		if run.CommitMessage != "" {
+			fmt.Fprintf(&description, ": %s", run.CommitMessage)
+		}
+		description.WriteString("\n")
+	}
+	if excerpt != "" {
+		fmt.Fprintf(&description, "\nh3. Failure excerpt (%s)\n{noformat}\n%s\n{noformat}\n", latest.Name, excerpt)
+	}
+	description.WriteString("\nThis issue is closed automatically when the workflow passes again.")
+
+	request := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": jiraConfig.project},
+			"issuetype":   map[string]string{"name": jiraConfig.issueType},
+			"summary":     fmt.Sprintf("%s failing on %s in %s/%s", latest.Workflow, job.Branch, job.Organization, job.Pipeline),
+			"description": description.String(),
+			"labels":      jiraConfig.labels,
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := jiraRequest(ctx, http.MethodPost, "/rest/api/2/issue", request, &created); err != nil {
+		return nil, err
+	}
+	return &jiraIssue{Key: created.Key, OpenedAt: clock()}, nil
+}
+
+// closeJiraIssue comments on the issue with the passing run and moves it
+// through the JIRA_DONE_TRANSITION transition.
+func closeJiraIssue(ctx context.Context, key string, job Job, passed HistoryRun) error {
+	comment := map[string]string{
+		"body": fmt.Sprintf("Workflow *%s* passes again on *%s*: [%s|%s]. Closed automatically.", passed.Workflow, job.Branch, passed.Name, passed.HTMLURL),
+	}
+	if err := jiraRequest(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/comment", comment, nil); err != nil {
+		return err
+	}
+
+	var transitions struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"transitions"`
+	}
+	if err := jiraRequest(ctx, http.MethodGet, "/rest/api/2/issue/"+url.PathEscape(key)+"/transitions", nil, &transitions); err != nil {
+		return err
+	}
+	for _, transition := range transitions.Transitions {
+		if strings.EqualFold(transition.Name, jiraConfig.transition) {
+			return jiraRequest(ctx, http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(key)+"/transitions",
+				map[string]interface{}{"transition": map[string]string{"id": transition.ID}}, nil)
+		}
+	}
+	// Already closed by hand, or a workflow without that transition:
+	// the comment is all we can do
+	log.Printf("⚠️  Jira issue %s has no %q transition, left open", key, jiraConfig.transition)
+	return nil
+}
+
+// jiraRequest calls the Jira REST API, with a JSON body and response when
+// given.
+func jiraRequest(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, jiraConfig.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if jiraConfig.user != "" {
+		req.SetBasicAuth(jiraConfig.user, jiraConfig.token) // Jira Cloud: email and API token
+	} else {
+		req.Header.Set("Authorization", "Bearer "+jiraConfig.token)
+	}
+
+	resp, err := jiraConfig.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -2,12 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,83 +18,312 @@ import (
 
 type Job struct {
 	ID           string    `json:"id"`
+	Provider     string    `json:"provider"` // CI system the run comes from, e.g. "github"
 	Name         string    `json:"name"`
 	Status       string    `json:"status"`
+	Conclusion   string    `json:"conclusion,omitempty"`    // the outcome of a finished run in GitHub's terms, e.g. "cancelled", for every CI system
+	CancelReason string    `json:"cancel_reason,omitempty"` // of cancelled runs: superseded, timeout, user or unknown
 	Pipeline     string    `json:"pipeline"`
 	Branch       string    `json:"branch"`
+	BranchState  string    `json:"branch_state,omitempty"` // "merged" or "deleted" since the run, see BRANCH_CLEANUP
 	Duration     string    `json:"duration"`
 	Started      string    `json:"started"`
 	Organization string    `json:"organization"`
 	RunID        int64     `json:"run_id"`
 	HTMLURL      string    `json:"html_url"`
 	CreatedAt    time.Time `json:"created_at"`
+	Tags         []string  `json:"tags,omitempty"`
+
+	// Raw values behind Started and Duration, so clients can localize them
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds int64     `json:"duration_seconds"`
+
+	// Progress of running jobs; nil when unknown
+	WorkflowID            int64  `json:"workflow_id,omitempty"`
+	StepsCompleted        *int   `json:"steps_completed,omitempty"`
+	StepsTotal            *int   `json:"steps_total,omitempty"`
+	ElapsedSeconds        *int64 `json:"elapsed_seconds,omitempty"`         // as of the response, not the fetch
+	MedianDurationSeconds *int64 `json:"median_duration_seconds,omitempty"` // of successful runs of the same workflow
+
+	// Pending runs blocked by another run in the same concurrency group, as
+	// opposed to runs queued for a runner
+	ConcurrencyGroup     string `json:"concurrency_group,omitempty"`
+	WaitingOnConcurrency bool   `json:"waiting_on_concurrency,omitempty"`
+	WaitingOnRunID       int64  `json:"waiting_on_run_id,omitempty"`
+
+	MatrixLegs []MatrixLeg `json:"matrix_legs,omitempty"` // one entry per matrix combination
+
+	RunnerMinutes map[string]int64 `json:"runner_minutes,omitempty"` // billable minutes per runner label, see COST_ESTIMATION
+	Runners       []RunnerUsage    `json:"runners,omitempty"`        // jobs per runner label, see /api/stats/runners
+	RunnerJobs    []RunnerJob      `json:"runner_jobs,omitempty"`    // the self-hosted runner of each job
+
+	HeadSHA string         `json:"head_sha,omitempty"`
+	ArgoCD  []ArgoCDStatus `json:"argocd,omitempty"` // applications deploying this run's output
+
+	Event string `json:"event,omitempty"` // what triggered the run, e.g. "push" or "release"
+
+	// Who triggered the run and the head commit's subject line, see /api/search
+	Actor         string `json:"actor,omitempty"`
+	CommitMessage string `json:"commit_message,omitempty"`
+
+	ChangedAt time.Time `json:"changed_at"` // fetch that first saw the run's current state, see /api/dashboard/delta
+
+	// Re-runs: the job has the status of the latest attempt, the earlier
+	// ones are only counted in the stats with ?attempts=all
+	Attempt              int      `json:"attempt,omitempty"`
+	SupersededAttempts   []string `json:"superseded_attempts,omitempty"`    // statuses, oldest first
+	FailedAttemptSeconds int64    `json:"failed_attempt_seconds,omitempty"` // spent in the failed ones
+
+	Annotations map[string]string `json:"annotations,omitempty"` // added by the enrichment plugin, see ENRICH_URL
+
+	// The run's workflow file and who owns it according to CODEOWNERS, see
+	// CODEOWNERS_ENABLED
+	WorkflowPath string   `json:"workflow_path,omitempty"`
+	Owners       []string `json:"owners,omitempty"`
 }
 
 type DashboardStats struct {
-	Success int `json:"success"`
-	Failed  int `json:"failed"`
-	Running int `json:"running"`
-	Pending int `json:"pending"`
-	Total   int `json:"total"`
+	Success     int `json:"success"`
+	Failed      int `json:"failed"`
+	Running     int `json:"running"`
+	Pending     int `json:"pending"`
+	Maintenance int `json:"maintenance"` // failures inside a maintenance window, not counted in Failed
+	Total       int `json:"total"`
+
+	// Successes that needed a re-run of a failed attempt, counted in
+	// Success, and the time their failed attempts took
+	PassedOnRerun        int   `json:"passed_on_rerun"`
+	PassedOnRerunSeconds int64 `json:"passed_on_rerun_seconds"`
+
+	Buckets map[string]int `json:"buckets,omitempty"` // custom counters, see STATS_BUCKETS
 }
 
 type RateLimitInfo struct {
 	Remaining int       `json:"remaining"`
 	Limit     int       `json:"limit"`
 	ResetAt   time.Time `json:"reset_at"`
+
+	// All GitHub requests wait until then after GitHub asked to back off
+	ThrottledUntil *time.Time `json:"throttled_until,omitempty"`
+	ThrottleReason string     `json:"throttle_reason,omitempty"` // secondary_rate_limit or rate_limit
+
+	// GitHub Enterprise Server with rate limiting off; the counts are zero
+	Unlimited bool `json:"unlimited,omitempty"`
+
+	// Several GITHUB_TOKENs rotated between; the counts are their sum
+	Tokens int `json:"tokens,omitempty"`
 }
 
 type DashboardResponse struct {
-	Stats     DashboardStats `json:"stats"`
-	Jobs      []Job          `json:"jobs"`
-	RateLimit RateLimitInfo  `json:"rate_limit"`
+	Stats           DashboardStats   `json:"stats"`
+	Jobs            []Job            `json:"jobs"`
+	RateLimit       RateLimitInfo    `json:"rate_limit"`
+	Truncated       bool             `json:"truncated,omitempty"`         // jobs capped at MAX_JOBS, stats still cover all runs
+	Partial         bool             `json:"partial,omitempty"`           // FETCH_TIMEOUT reached, the skipped repositories are in errors
+	Deduplicated    int              `json:"deduplicated,omitempty"`      // older runs of the same workflow and commit left out, with ?dedupe=commit
+	StaleBranchRuns int              `json:"stale_branch_runs,omitempty"` // runs of merged and deleted branches left out, see EXCLUDE_STALE_BRANCHES
+	Forecast        *RefreshForecast `json:"forecast,omitempty"`          // GitHub API calls the next refresh needs
+	Errors          []FetchError     `json:"errors,omitempty"`            // organizations and repositories missing from the data
+	Debug           *DebugInfo       `json:"debug,omitempty"`             // only with ?debug=true
+
+	Periods map[string]*PeriodStats `json:"periods,omitempty"` // with ?period=today,week,month
+
+	*DataFreshness // set when served
 }
 
-var (
-	githubClient *github.Client
-	orgNames     []string
-)
+var githubClient *github.Client
 
-func init() {
-	// Load .env file if it exists
-	_ = godotenv.Load()
+// configure reads the configuration from the environment and flags and
+// sets up the GitHub client and store.
+func configure() {
+	setupFixtures()
 
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		log.Fatal("GITHUB_TOKEN environment variable is required")
-	}
+	demoMode = os.Getenv("DEMO_MODE") == "true"
+	if demoMode {
+		loadDemoConfig()
+		for _, org := range demoOrgs {
+			sources = append(sources, source{Provider: demoProvider{}, Org: org})
+		}
+		githubClient = github.NewClient(nil)
+		log.Printf("🎭 DEMO_MODE enabled: serving generated data for %d organization(s)", len(demoOrgs))
+	} else {
+		loadGitLabConfig()
+		loadJenkinsConfig()
+		loadCircleCIConfig()
+		loadBuildkiteConfig()
+		loadAzureConfig()
+		loadBitbucketConfig()
+
+		orgEnv := os.Getenv("GITHUB_ORG")
+		usersEnv := os.Getenv("GITHUB_USERS")
+		if orgEnv == "" && usersEnv == "" && len(sources) == 0 {
+			log.Fatal("GITHUB_ORG environment variable is required (can be comma-separated for multiple orgs), or GITHUB_USERS for personal accounts")
+		}
 
-	orgEnv := os.Getenv("GITHUB_ORG")
-	if orgEnv == "" {
-		log.Fatal("GITHUB_ORG environment variable is required (can be comma-separated for multiple orgs)")
-	}
+		token := os.Getenv("GITHUB_TOKEN")
+		tokens := splitList(token)
+		appTokens := loadGitHubAppConfig()
+		if appTokens != nil && token != "" {
+			log.Fatal("Set either GITHUB_TOKEN or a GitHub App (APP_ID), not both")
+		}
+		if (orgEnv != "" || usersEnv != "") && len(tokens) == 0 && appTokens == nil && replayDir == "" {
+			log.Fatal("GITHUB_TOKEN environment variable is required (or APP_ID, INSTALLATION_ID and PRIVATE_KEY_PATH for a GitHub App)")
+		}
 
-	// Parse organizations (support comma-separated)
-	orgNames = parseOrganizations(orgEnv)
-	if len(orgNames) == 0 {
-		log.Fatal("At least one organization must be specified in GITHUB_ORG")
+		// Parse organizations (support comma-separated) and personal accounts
+		accounts := append(parseOrganizations(orgEnv), userAccounts(usersEnv)...)
+		if (orgEnv != "" || usersEnv != "") && len(accounts) == 0 {
+			log.Fatal("At least one organization must be specified in GITHUB_ORG")
+		}
+		loadFetchModeConfig()
+		orgNames, users := splitAccounts(accounts)
+		for _, org := range orgNames {
+			if org == "" || strings.ContainsAny(org, "/ ") {
+				log.Fatalf("Invalid GitHub account %q in GITHUB_ORG or GITHUB_USERS", org)
+			}
+			sources = append(sources, source{Provider: newGitHubProvider(), Org: org})
+		}
+		githubUsers = users
+		if len(users) > 0 {
+			log.Printf("👤 %d personal GitHub account(s)", len(users))
+		}
+
+		ts := appTokens
+		if len(tokens) == 1 {
+			ts = oauth2.StaticTokenSource(
+				&oauth2.Token{AccessToken: tokens[0]},
+			)
+		}
+		httpClient := newGitHubHTTPClient(ts)
+		if githubTokens = newTokenPool(tokens); githubTokens != nil {
+			httpClient = newTokenPoolHTTPClient(githubTokens)
+		}
+		githubClient = withEnterpriseURLs(github.NewClient(withETagCache(httpClient)))
 	}
+	loadPhaseTimeouts()
+	loadRetryConfig()
+	loadBudgetConfig()
+	loadMatrixConfig()
+	loadRunDepthConfig()
+	loadRepoFilterConfig()
+	staleAfter = getEnvDuration("STALE_AFTER", staleAfter)
+	loadCostConfig()
+	loadStatBucketsConfig()
+	loadRunnerStatsConfig()
+	loadEnrichConfig()
+	loadCodeownersConfig()
+	loadBranchCleanupConfig()
+	loadAuthConfig()
+	loadRunnerTokenConfig()
+	loadNotifyConfig()
+	loadWebPushConfig()
+	loadAlertConfig()
+	loadRunnerAlertConfig()
+	loadJiraConfig()
+	loadNightlyIssueConfig()
+	loadArgoCDConfig()
+	loadARCConfig()
+	loadPublishConfig()
+	loadReleaseConfig()
+	loadNightlyConfig()
+	loadDeployConfig()
+	loadComplianceConfig()
+	loadPermissionsConfig()
+	loadDeprecationConfig()
+	loadPinningConfig()
+
+	loadMaintenanceWindows()
+	loadLocaleConfig()
+
+	cacheTTL = getEnvDuration("CACHE_TTL", cacheTTL)
+	cacheStaleTTL = getEnvDuration("CACHE_STALE_TTL", cacheStaleTTL)
+	pollInterval = getEnvDuration("POLL_INTERVAL", pollInterval)
+	fetchRetryAttempts = getEnvInt("FETCH_RETRY_ATTEMPTS", fetchRetryAttempts)
+	fetchRetryBackoff = getEnvDuration("FETCH_RETRY_BACKOFF", fetchRetryBackoff)
+	if fetchRetryBackoff <= 0 {
+		log.Fatalf("Invalid FETCH_RETRY_BACKOFF %v: must be positive", fetchRetryBackoff)
+	}
+	repoCacheTTL = getEnvDuration("REPO_CACHE_TTL", repoCacheTTL)
+	maxReposPerOrg = getEnvInt("MAX_REPOS_PER_ORG", maxReposPerOrg)
+	incrementalSync = os.Getenv("INCREMENTAL_SYNC") == "true"
+	fullSyncInterval = getEnvDuration("FULL_SYNC_INTERVAL", fullSyncInterval)
+	noWorkflowsTTL = getEnvDuration("NO_WORKFLOWS_TTL", noWorkflowsTTL)
+	rerunLookback = getEnvDuration("RERUN_LOOKBACK", rerunLookback)
+	fetchLockTTL = getEnvDuration("FETCH_LOCK_TTL", fetchLockTTL)
+	maxJobs = getEnvInt("MAX_JOBS", maxJobs)
+	fetchConcurrency = getEnvInt("FETCH_CONCURRENCY", fetchConcurrency)
+	if fetchConcurrency < 1 {
+		log.Fatalf("Invalid FETCH_CONCURRENCY %d: expected at least 1", fetchConcurrency)
+	}
+	historyRetention = getEnvDuration("HISTORY_RETENTION", historyRetention)
+	historyMaxRuns = getEnvInt("HISTORY_MAX_RUNS", historyMaxRuns)
+	loadPrewarmConfig()
 
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	githubClient = github.NewClient(tc)
+	var err error
+	store, err = newStore(os.Getenv("STORE_URL"))
+	if err != nil {
+		log.Fatalf("Error initializing store: %v", err)
+	}
+	loadAdminConfig()
 }
 
 func parseOrganizations(orgEnv string) []string {
-	orgs := strings.Split(orgEnv, ",")
+	return splitList(orgEnv)
+}
+
+// splitList splits a comma-separated value, dropping empty entries.
+func splitList(value string) []string {
 	var result []string
-	for _, org := range orgs {
-		org = strings.TrimSpace(org)
-		if org != "" {
-			result = append(result, org)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
 		}
 	}
 	return result
 }
 
+func validPeriod(period string) bool {
+	return period == "today" || period == "week" || period == "month"
+}
+
+// getEnvDuration reads a duration such as "30s" or "5m" from the environment,
+// falling back to def when the variable is unset.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, value, err)
+	}
+	return d
+}
+
+// getEnvString reads a string from the environment, falling back to def
+// when the variable is unset.
+func getEnvString(key string, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvInt reads an integer from the environment, falling back to def when
+// the variable is unset.
+func getEnvInt(key string, def int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, value, err)
+	}
+	return n
+}
+
 func formatDuration(start, end time.Time) string {
 	duration := end.Sub(start)
 	hours := int(duration.Hours())
@@ -109,383 +338,236 @@ func formatDuration(start, end time.Time) string {
 	return fmt.Sprintf("%ds", seconds)
 }
 
-func formatTimeAgo(t time.Time) string {
-	now := time.Now()
-	diff := now.Sub(t)
-
-	days := int(diff.Hours() / 24)
-	hours := int(diff.Hours())
-	minutes := int(diff.Minutes())
-
-	if days > 0 {
-		return fmt.Sprintf("%d day%s ago", days, pluralize(days))
-	} else if hours > 0 {
-		return fmt.Sprintf("%d hour%s ago", hours, pluralize(hours))
-	} else if minutes > 0 {
-		return fmt.Sprintf("%d minute%s ago", minutes, pluralize(minutes))
-	}
-	return "just now"
-}
-
-func pluralize(n int) string {
-	if n == 1 {
-		return ""
+func calculateStats(jobs []Job) DashboardStats {
+	var stats DashboardStats
+	for _, job := range jobs {
+		addToStats(&stats, job)
 	}
-	return "s"
+	return stats
 }
 
-func fetchWorkflowRuns(ctx context.Context, period string) ([]Job, *RateLimitInfo, error) {
-	var allJobs []Job
-	var rateLimitInfo *RateLimitInfo
-
-	// Determine time range based on period
-	now := time.Now()
-	var startTime time.Time
-
-	switch period {
-	case "today":
-		// Untuk "today", gunakan dari jam 1 pagi (01:00:00) hingga jam 11 malam (23:00:00) hari ini
-		startTime = time.Date(now.Year(), now.Month(), now.Day(), 1, 0, 0, 0, now.Location())
-		log.Printf("📅 Filter 'today': startTime = %v (now = %v)", startTime, now)
-	case "week":
-		startTime = now.AddDate(0, 0, -7) // 7 hari yang lalu
-	case "month":
-		startTime = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()) // Awal bulan ini
-	default:
-		startTime = now.AddDate(0, 0, -7) // Default: seminggu terakhir
-	}
-
-	log.Printf("📅 Fetching workflow runs for period: %s (since %v)", period, startTime)
-
-	// Loop through all organizations
-	for _, orgName := range orgNames {
-		log.Printf("📦 Fetching repositories for organization: %s", orgName)
-
-		// Get all repositories in the organization
-		repos, resp, err := githubClient.Repositories.ListByOrg(ctx, orgName, &github.RepositoryListByOrgOptions{
-			Type: "all",
-			ListOptions: github.ListOptions{
-				PerPage: 100,
-			},
-		})
-		if err != nil {
-			log.Printf("❌ Error listing repositories for organization %s: %v", orgName, err)
-			continue
-		}
-
-		log.Printf("✅ Found %d repositories in organization %s", len(repos), orgName)
-		if resp != nil {
-			log.Printf("   Rate limit: %d/%d remaining (resets at %v)",
-				resp.Rate.Remaining, resp.Rate.Limit, resp.Rate.Reset.Time)
+func addToStats(stats *DashboardStats, job Job) {
+	stats.Total++
+	countBuckets(stats, job)
 
-			// Store rate limit info (use the latest one)
-			rateLimitInfo = &RateLimitInfo{
-				Remaining: resp.Rate.Remaining,
-				Limit:     resp.Rate.Limit,
-				ResetAt:   resp.Rate.Reset.Time,
-			}
+	switch job.Status {
+	case "success":
+		stats.Success++
+		if passedOnRerun(job) {
+			stats.PassedOnRerun++
+			stats.PassedOnRerunSeconds += job.FailedAttemptSeconds
 		}
-
-		// Filter repositories: hanya yang updated dalam periode yang dipilih
-		// GitHub web menampilkan "Updated X minutes ago" berdasarkan PushedAt, bukan UpdatedAt
-		// Jadi kita perlu cek PushedAt juga, atau gunakan yang lebih baru antara UpdatedAt dan PushedAt
-		var filteredRepos []*github.Repository
-
-		for _, repo := range repos {
-			var checkTime time.Time
-			var hasTime bool
-
-			// Untuk "today", GitHub web biasanya menggunakan PushedAt (waktu commit terakhir)
-			// Jadi kita prioritaskan PushedAt, lalu UpdatedAt
-			if repo.PushedAt != nil {
-				checkTime = repo.PushedAt.Time
-				hasTime = true
-			} else if repo.UpdatedAt != nil {
-				checkTime = repo.UpdatedAt.Time
-				hasTime = true
-			}
-
-			if hasTime {
-				// Convert checkTime ke timezone lokal untuk perbandingan yang benar
-				checkTimeLocal := checkTime.In(now.Location())
-
-				// Cek apakah repository di-update dalam periode yang dipilih
-				// Gunakan !Before untuk include waktu yang sama dengan startTime
-				if !checkTimeLocal.Before(startTime) {
-					// Untuk "today", juga cek apakah sebelum jam 11 malam (23:00:00) hari ini
-					if period == "today" {
-						endTime := time.Date(now.Year(), now.Month(), now.Day(), 23, 0, 0, 0, now.Location())
-						if !checkTimeLocal.After(endTime) {
-							filteredRepos = append(filteredRepos, repo)
-						}
-					} else {
-						filteredRepos = append(filteredRepos, repo)
-					}
-				}
-			}
-		}
-
-		periodName := map[string]string{
-			"today": "today",
-			"week":  "this week",
-			"month": "this month",
-		}[period]
-		if periodName == "" {
-			periodName = "this week"
-		}
-		log.Printf("   📅 Filtered: %d repositories updated %s (from %d total)", len(filteredRepos), periodName, len(repos))
-
-		// Fetch workflow runs from repositories updated in selected period
-		for i, repo := range filteredRepos {
-			log.Printf("   [%d/%d] Fetching workflow runs for repository: %s/%s",
-				i+1, len(filteredRepos), orgName, *repo.Name)
-
-			// Get workflow runs (will filter by period in the loop)
-			workflowRuns, resp, err := githubClient.Actions.ListRepositoryWorkflowRuns(ctx, orgName, *repo.Name, &github.ListWorkflowRunsOptions{
-				ListOptions: github.ListOptions{
-					PerPage: 50,
-				},
-			})
-			if err != nil {
-				log.Printf("   ❌ Error fetching workflow runs for %s/%s: %v", orgName, *repo.Name, err)
-				continue
-			}
-
-			if resp != nil {
-				log.Printf("   ✅ Found %d workflow runs in %s/%s (Rate limit: %d/%d remaining)",
-					len(workflowRuns.WorkflowRuns), orgName, *repo.Name,
-					resp.Rate.Remaining, resp.Rate.Limit)
-
-				// Update rate limit info (use the latest one)
-				rateLimitInfo = &RateLimitInfo{
-					Remaining: resp.Rate.Remaining,
-					Limit:     resp.Rate.Limit,
-					ResetAt:   resp.Rate.Reset.Time,
-				}
-			} else {
-				log.Printf("   ✅ Found %d workflow runs in %s/%s",
-					len(workflowRuns.WorkflowRuns), orgName, *repo.Name)
-			}
-
-			for _, run := range workflowRuns.WorkflowRuns {
-				// Filter workflow runs berdasarkan waktu untuk semua periode
-				var runTime time.Time
-				if run.RunStartedAt != nil {
-					runTime = run.RunStartedAt.Time
-				} else if run.CreatedAt != nil {
-					runTime = run.CreatedAt.Time
-				} else {
-					continue // Skip jika tidak ada timestamp
-				}
-
-				// Convert runTime ke timezone lokal untuk perbandingan yang benar
-				runTimeLocal := runTime.In(now.Location())
-
-				// Cek apakah dalam periode yang dipilih
-				if runTimeLocal.Before(startTime) {
-					continue // Skip jika sebelum startTime
-				}
-
-				// Untuk "today", juga cek apakah sebelum jam 11 malam (23:00:00) hari ini
-				if period == "today" {
-					endTime := time.Date(now.Year(), now.Month(), now.Day(), 23, 0, 0, 0, now.Location())
-					if runTimeLocal.After(endTime) {
-						continue // Skip jika setelah jam 11 malam hari ini
-					}
-				}
-
-				status := strings.ToLower(*run.Status)
-				conclusion := ""
-				if run.Conclusion != nil {
-					conclusion = strings.ToLower(*run.Conclusion)
-				}
-
-				// Determine job status
-				jobStatus := "pending"
-				if status == "completed" {
-					if conclusion == "success" {
-						jobStatus = "success"
-					} else if conclusion == "failure" || conclusion == "cancelled" {
-						jobStatus = "failed"
-					} else {
-						jobStatus = "failed"
-					}
-				} else if status == "in_progress" || status == "queued" {
-					jobStatus = "running"
-				}
-
-				// Calculate duration
-				var duration string
-				if run.UpdatedAt != nil && run.RunStartedAt != nil {
-					duration = formatDuration(run.RunStartedAt.Time, run.UpdatedAt.Time)
-				} else if run.CreatedAt != nil {
-					if run.UpdatedAt != nil {
-						duration = formatDuration(run.CreatedAt.Time, run.UpdatedAt.Time)
-					} else {
-						duration = formatDuration(run.CreatedAt.Time, time.Now())
-					}
-				} else {
-					duration = "N/A"
-				}
-
-				// Format started time
-				var started string
-				if run.RunStartedAt != nil {
-					started = formatTimeAgo(run.RunStartedAt.Time)
-				} else if run.CreatedAt != nil {
-					started = formatTimeAgo(run.CreatedAt.Time)
-				} else {
-					started = "N/A"
-				}
-
-				jobName := *run.Name
-				if run.RunNumber != nil {
-					jobName = fmt.Sprintf("%s #%d", jobName, *run.RunNumber)
-				}
-
-				jobID := fmt.Sprintf("JOB-%06d", *run.ID)
-
-				branch := "N/A"
-				if run.HeadBranch != nil {
-					branch = *run.HeadBranch
-				}
-
-				var createdAt time.Time
-				if run.CreatedAt != nil {
-					createdAt = run.CreatedAt.Time
-				} else {
-					createdAt = time.Now()
-				}
-
-				// Get HTML URL for workflow run detail
-				var htmlURL string
-				if run.HTMLURL != nil {
-					htmlURL = *run.HTMLURL
-				} else {
-					// Fallback: construct URL manually
-					htmlURL = fmt.Sprintf("https://github.com/%s/%s/actions/runs/%d", orgName, *repo.Name, *run.ID)
-				}
-
-				job := Job{
-					ID:           jobID,
-					Name:         jobName,
-					Status:       jobStatus,
-					Pipeline:     *repo.Name, // Repository name instead of workflow name
-					Branch:       branch,
-					Duration:     duration,
-					Started:      started,
-					Organization: orgName,
-					RunID:        *run.ID,
-					HTMLURL:      htmlURL,
-					CreatedAt:    createdAt,
-				}
-
-				allJobs = append(allJobs, job)
-			}
+	case "failed":
+		if hasTag(job, "maintenance") {
+			stats.Maintenance++
+		} else {
+			stats.Failed++
 		}
-
-		log.Printf("✅ Completed fetching for organization %s. Total jobs collected: %d",
-			orgName, len(allJobs))
+	case "running":
+		stats.Running++
+	case "pending":
+		stats.Pending++
 	}
+}
 
-	log.Printf("📊 Total jobs collected from all organizations: %d", len(allJobs))
-
-	// Sort jobs by CreatedAt (newest first)
-	sort.Slice(allJobs, func(i, j int) bool {
-		return allJobs[i].CreatedAt.After(allJobs[j].CreatedAt)
-	})
-
-	// Return default rate limit if not set
-	if rateLimitInfo == nil {
-		rateLimitInfo = &RateLimitInfo{
-			Remaining: 5000,
-			Limit:     5000,
-			ResetAt:   time.Now().Add(1 * time.Hour),
+// copyJobs copies jobs and their tags before they're changed for one
+// request: snapshots are shared by coalesced requests, long pollers and the
+// cache.
+func copyJobs(jobs []Job) []Job {
+	copied := make([]Job, len(jobs))
+	for i, job := range jobs {
+		if job.Tags != nil {
+			job.Tags = append([]string(nil), job.Tags...)
 		}
+		copied[i] = job
 	}
-
-	return allJobs, rateLimitInfo, nil
+	return copied
 }
 
-func calculateStats(jobs []Job) DashboardStats {
-	stats := DashboardStats{
-		Total: len(jobs),
+// filterDashboard applies the filters of the request to a copy of the
+// snapshot's response, recounting the stats of what's left.
+func filterDashboard(ctx context.Context, r *http.Request, snap *Snapshot) DashboardResponse {
+	response := snap.Response
+	response.Jobs = copyJobs(response.Jobs)
+	applyCustomTags(ctx, response.Jobs)
+	superseded := snap.Superseded
+	filtered := false
+	// Filter by tag, custom or built-in (e.g. "maintenance")
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		response.Jobs = filterByTag(response.Jobs, tag)
+		filtered = true
 	}
-
-	for _, job := range jobs {
-		switch job.Status {
-		case "success":
-			stats.Success++
-		case "failed":
-			stats.Failed++
-		case "running":
-			stats.Running++
-		case "pending":
-			stats.Pending++
+	// Filter by CODEOWNERS owner, e.g. ?owner=@acme/payments
+	if owner := r.URL.Query().Get("owner"); owner != "" {
+		response.Jobs = filterByOwner(response.Jobs, owner)
+		filtered = true
+	}
+	// Leave out runs of merged and deleted branches, see BRANCH_CLEANUP
+	if excludesStaleBranches(r) {
+		jobs := withoutStaleBranches(response.Jobs)
+		response.StaleBranchRuns = len(response.Jobs) - len(jobs)
+		response.Jobs = jobs
+		filtered = true
+	}
+	if r.URL.Query().Get("dedupe") == "commit" {
+		jobs := latestPerCommit(response.Jobs)
+		response.Deduplicated = len(response.Jobs) - len(jobs)
+		response.Jobs = jobs
+		// On its own, the stats counted over every run, including the ones
+		// MAX_JOBS left out of the job list
+		if deduped := snap.Deduped; !filtered && deduped != nil {
+			response.Stats, superseded, response.Deduplicated = deduped.Stats, deduped.Superseded, deduped.Deduplicated
+		} else {
+			filtered = true
 		}
 	}
-
-	return stats
+	if filtered {
+		response.Stats = calculateStats(response.Jobs)
+		superseded = supersededStats(response.Jobs)
+	}
+	// Only the latest attempt of a re-run counts, unless asked otherwise
+	if r.URL.Query().Get("attempts") == "all" {
+		addStats(&response.Stats, superseded)
+	}
+	return response
 }
 
 func dashboardHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("🌐 Dashboard API request from %s", r.RemoteAddr)
 	ctx := context.Background()
 
-	// Get period parameter from query string (default: week)
-	period := r.URL.Query().Get("period")
-	if period == "" {
-		period = "week" // Default: seminggu terakhir
-	}
+	// Get period parameter from query string (default: week). With a
+	// list like ?period=today,week,month the jobs are those of the first,
+	// the others only add their stats.
+	periods := parsePeriods(r.URL.Query().Get("period"))
+	period := periods[0]
 
-	// Validate period
-	if period != "today" && period != "week" && period != "month" {
-		period = "week"
+	// Stream org by org as newline-delimited JSON
+	if r.URL.Query().Get("stream") == "true" {
+		streamDashboard(w, period, requestLocale(r.URL.Query().Get("locale")), viewerFrom(r))
+		return
 	}
 
-	startTime := time.Now()
-	jobs, rateLimit, err := fetchWorkflowRuns(ctx, period)
-	duration := time.Since(startTime)
-
+	// All periods come from the fetch of the longest, the source
+	snaps, source, err := loadPeriods(ctx, r, periods)
 	if err != nil {
-		log.Printf("❌ Error fetching workflow runs: %v (took %v)", err, duration)
 		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
 		return
 	}
-
-	stats := calculateStats(jobs)
-	log.Printf("📈 Dashboard stats: Success=%d, Failed=%d, Running=%d, Pending=%d, Total=%d (took %v)",
-		stats.Success, stats.Failed, stats.Running, stats.Pending, stats.Total, duration)
-
-	// Set default rate limit if nil
-	if rateLimit == nil {
-		rateLimit = &RateLimitInfo{
-			Remaining: 5000,
-			Limit:     5000,
-			ResetAt:   time.Now().Add(1 * time.Hour),
+	snap := viewerFrom(r).snapshot(snaps[0])
+	response := filterDashboard(ctx, r, snap)
+	f := freshness(periods[source], snap.FetchedAt)
+	if len(periods) > 1 {
+		response.Periods = make(map[string]*PeriodStats, len(periods))
+		for i, p := range periods {
+			stats := PeriodStats{Stats: response.Stats, DataFreshness: f}
+			if i > 0 {
+				stats.Stats = filterDashboard(ctx, r, viewerFrom(r).snapshot(snaps[i])).Stats
+			}
+			response.Periods[p] = &stats
 		}
 	}
-
-	response := DashboardResponse{
-		Stats:     stats,
-		Jobs:      jobs,
-		RateLimit: *rateLimit,
+	response.Forecast = forecastRefresh(periods[source], viewerFrom(r).snapshot(snaps[source]))
+	response.DataFreshness = &f
+	setFreshnessHeaders(w, f)
+	localizeJobs(response.Jobs, requestLocale(r.URL.Query().Get("locale")))
+	updateElapsed(response.Jobs)
+	if r.URL.Query().Get("debug") == "true" {
+		response.Debug = snap.Debug
 	}
 
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Vary", "Accept")
+	if wantsMsgpack(r) {
+		w.Header().Set("Content-Type", msgpackContentType)
+		if err := writeMsgpack(w, response); err != nil {
+			log.Printf("❌ Error writing dashboard response: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeDashboardJSON(w, response); err != nil {
+		log.Printf("❌ Error writing dashboard response: %v", err)
+	}
 }
 
 func main() {
+	// Load .env file if it exists
+	_ = godotenv.Load()
+
+	flag.StringVar(&recordDir, "record", os.Getenv("RECORD_DIR"), "record GitHub API responses into this directory")
+	flag.StringVar(&replayDir, "replay", os.Getenv("REPLAY_DIR"), "serve GitHub API responses recorded in this directory instead of calling GitHub")
+	flag.Parse()
+
+	if flag.Arg(0) == "snapshot" {
+		if err := runSnapshotCommand(flag.Args()[1:]); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		return
+	}
+	if flag.Arg(0) == "vapid-keys" {
+		if err := runVAPIDKeysCommand(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		return
+	}
+
+	configure()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
 	http.HandleFunc("/api/dashboard", dashboardHandler)
+	http.HandleFunc("/api/dashboard/delta", deltaHandler)
+	http.HandleFunc("/api/status", statusHandler)
+	http.HandleFunc("/api/refresh", refreshHandler)
+	http.HandleFunc("/api/logs", logsHandler)
+	http.HandleFunc("/api/runners", runnersHandler)
+	http.HandleFunc("/api/costs", costsHandler)
+	http.HandleFunc("/api/orgs", orgsHandler)
+	http.HandleFunc("/api/runs/", runHandler)
+	http.HandleFunc("/api/runs/compare", compareHandler)
+	http.HandleFunc("/api/branches", branchesHandler)
+	http.HandleFunc("/api/branches/cleanup", branchCleanupHandler)
+	http.HandleFunc("/api/bisect", bisectHandler)
+	http.HandleFunc("/api/releases", releasesHandler)
+	http.HandleFunc("/api/nightly", nightlyHandler)
+	http.HandleFunc("/api/deployments", deploymentsHandler)
+	http.HandleFunc("/api/compliance", complianceHandler)
+	http.HandleFunc("/api/audit/permissions", permissionsAuditHandler)
+	http.HandleFunc("/api/audit/deprecated", deprecatedHandler)
+	http.HandleFunc("/api/audit/pinning", pinningHandler)
+	http.HandleFunc("/api/tags", tagsHandler)
+	http.HandleFunc("/api/watches", watchesHandler)
+	http.HandleFunc("/api/watches/confirm", watchConfirmHandler)
+	http.HandleFunc("/api/view-tokens", viewTokensHandler)
+	http.HandleFunc("/api/admin/config", adminConfigHandler)
+	http.HandleFunc("/api/admin/orgs", adminOrgsHandler)
+	http.HandleFunc("/api/admin/runner-tokens", runnerTokensHandler)
+	http.HandleFunc("/api/push/key", pushKeyHandler)
+	http.HandleFunc("/api/push/subscriptions", pushSubscriptionsHandler)
+	http.HandleFunc("/api/stats/actors", actorsHandler)
+	http.HandleFunc("/api/stats/runners", runnerStatsHandler)
+	http.HandleFunc("/api/stats/workflows", workflowStatsHandler)
+	http.HandleFunc("/api/stats/time-to-green", timeToGreenHandler)
+	http.HandleFunc("/api/summary/weekly", weeklySummaryHandler)
+	http.HandleFunc("/api/graph", graphHandler)
+	http.HandleFunc("/api/search", searchHandler)
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("/auth/login", loginHandler)
+	http.HandleFunc("/auth/callback", callbackHandler)
+	http.HandleFunc("/auth/logout", logoutHandler)
+	http.HandleFunc("/auth/me", meHandler)
 	http.Handle("/", http.FileServer(http.Dir("./static")))
 
+	go checkToken(context.Background())
+	go prewarm()
+	go pollDashboards()
+	go watchRuntimeConfig()
+	go watchRunners()
+
 	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	log.Fatal(http.ListenAndServe(":"+port, withFreshnessHeaders(requireLogin(http.DefaultServeMux))))
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowStore holds reads back, so concurrent requests for a period are
+// coalesced into one and share its snapshot.
+type slowStore struct {
+	Store
+}
+
+func (s slowStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if key == snapshotKey("week") {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return s.Store.Get(ctx, key)
+}
+
+// useTestStore gives a test an empty store with caching on and a custom
+// tag for acme/api's CI workflow, restored after the test.
+func useTestStore(t *testing.T) {
+	t.Helper()
+	previous, ttl := store, cacheTTL
+	store, cacheTTL = slowStore{newMemoryStore()}, time.Hour
+	t.Cleanup(func() { store, cacheTTL = previous, ttl })
+	tags, _ := json.Marshal([]CustomTag{{Tag: "flaky", Repository: "acme/api", Workflow: "CI"}})
+	if err := store.Set(context.Background(), customTagsKey, tags, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testSnapshot(fetchedAt time.Time) *Snapshot {
+	job := func(id, status string, started time.Time) Job {
+		return Job{
+			ID: id, Provider: "github", Organization: "acme", Pipeline: "api", Name: "CI", Status: status,
+			Tags:      append(make([]string, 0, 4), "deploy"), // room to append to in place
+			StartedAt: started, CreatedAt: started, ChangedAt: fetchedAt,
+		}
+	}
+	jobs := []Job{job("2", "running", fetchedAt.Add(-5*time.Minute)), job("1", "success", fetchedAt.Add(-3*time.Hour))}
+	return &Snapshot{Response: DashboardResponse{Jobs: jobs, Stats: calculateStats(jobs)}, FetchedAt: fetchedAt}
+}
+
+// Concurrent requests share the snapshot they're served from, so each
+// has to localize its own copy of the jobs (run with -race).
+func TestDashboardLocalesDontLeak(t *testing.T) {
+	useTestStore(t)
+	now := time.Now()
+	if err := saveSnapshot(context.Background(), "week", testSnapshot(now)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"en": "3 hours ago", "id": "3 jam yang lalu"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		locale := []string{"en", "id"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			dashboardHandler(rec, httptest.NewRequest(http.MethodGet, "/api/dashboard?locale="+locale, nil))
+			var response DashboardResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Errorf("locale %s: %v", locale, err)
+				return
+			}
+			if len(response.Jobs) != 2 || response.Jobs[1].Started != want[locale] {
+				t.Errorf("locale %s: jobs = %+v, want started %q", locale, response.Jobs, want[locale])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Long pollers are all handed the same announced snapshot.
+func TestDeltaLocalesDontLeak(t *testing.T) {
+	useTestStore(t)
+	before := time.Now().Add(-time.Minute)
+	if err := saveSnapshot(context.Background(), "week", testSnapshot(before)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"en": "3 hours ago", "id": "3 jam yang lalu"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		locale := []string{"en", "id"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			url := fmt.Sprintf("/api/dashboard/delta?since=%s&wait=10s&locale=%s", formatCursor(before), locale)
+			deltaHandler(rec, httptest.NewRequest(http.MethodGet, url, nil))
+			var response DeltaResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Errorf("locale %s: %v", locale, err)
+				return
+			}
+			if len(response.Jobs) != 2 || response.Jobs[1].Started != want[locale] {
+				t.Errorf("locale %s: jobs = %+v, want started %q", locale, response.Jobs, want[locale])
+			}
+		}()
+	}
+	// Let the pollers start waiting
+	time.Sleep(200 * time.Millisecond)
+	next := testSnapshot(time.Now())
+	announceSnapshot("week", next)
+	wg.Wait()
+
+	for _, job := range next.Response.Jobs {
+		if job.Started != "" || job.ElapsedSeconds != nil || len(job.Tags) != 1 || job.Tags[:2][1] != "" {
+			t.Errorf("announced snapshot was changed: %+v", job)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a planned time range for an organization or a single
+// repository during which failures are expected and should not count
+// against the pipeline health numbers.
+type MaintenanceWindow struct {
+	Org   string
+	Repo  string // empty means the whole organization
+	Start time.Time
+	End   time.Time
+}
+
+var maintenanceWindows []MaintenanceWindow
+
+// parseMaintenanceWindows parses MAINTENANCE_WINDOWS, a semicolon-separated
+// list of "scope=start/end" entries where scope is "org" or "org/repo" and
+// start/end are RFC3339 timestamps, e.g.
+//
+//	MAINTENANCE_WINDOWS=acme=2025-11-10T22:00:00+07:00/2025-11-11T02:00:00+07:00;acme/api=...
+func parseMaintenanceWindows(env string) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	for _, entry := range strings.Split(env, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		scope, timeRange, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid maintenance window %q: expected scope=start/end", entry)
+		}
+		startStr, endStr, ok := strings.Cut(timeRange, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid maintenance window %q: expected start/end", entry)
+		}
+
+		start, err := time.Parse(time.RFC3339, strings.TrimSpace(startStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window start %q: %v", startStr, err)
+		}
+		end, err := time.Parse(time.RFC3339, strings.TrimSpace(endStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window end %q: %v", endStr, err)
+		}
+		if !end.After(start) {
+			return nil, fmt.Errorf("invalid maintenance window %q: end must be after start", entry)
+		}
+
+		org, repo, _ := strings.Cut(strings.TrimSpace(scope), "/")
+		if org == "" {
+			return nil, fmt.Errorf("invalid maintenance window %q: missing organization", entry)
+		}
+
+		windows = append(windows, MaintenanceWindow{
+			Org:   org,
+			Repo:  repo,
+			Start: start,
+			End:   end,
+		})
+	}
+	return windows, nil
+}
+
+// inMaintenance reports whether a run of org/repo started at t falls inside
+// one of the configured maintenance windows.
+func inMaintenance(org, repo string, t time.Time) bool {
+	for _, w := range maintenanceWindows {
+		if !strings.EqualFold(w.Org, org) {
+			continue
+		}
+		if w.Repo != "" && !strings.EqualFold(w.Repo, repo) {
+			continue
+		}
+		if !t.Before(w.Start) && t.Before(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMaintenance tags a failed job that started inside a maintenance window,
+// so it's kept out of the failure numbers and alerts.
+func tagMaintenance(job *Job) {
+	if job.Status == "failed" && !hasTag(*job, "maintenance") && inMaintenance(job.Organization, job.Pipeline, job.StartedAt) {
+		job.Tags = append(job.Tags, "maintenance")
+	}
+}
+
+// hasTag reports whether the job carries the given tag.
+func hasTag(job Job, tag string) bool {
+	for _, t := range job.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func loadMaintenanceWindows() {
+	env := strings.TrimSpace(os.Getenv("MAINTENANCE_WINDOWS"))
+	if env == "" {
+		return
+	}
+
+	windows, err := parseMaintenanceWindows(env)
+	if err != nil {
+		log.Fatalf("Invalid MAINTENANCE_WINDOWS: %v", err)
+	}
+	maintenanceWindows = windows
+	log.Printf("🛠️  Loaded %d maintenance window(s)", len(maintenanceWindows))
+}
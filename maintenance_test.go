@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTagMaintenance(t *testing.T) {
+	start := time.Date(2025, 11, 10, 22, 0, 0, 0, time.UTC)
+	defer func(w []MaintenanceWindow) { maintenanceWindows = w }(maintenanceWindows)
+	maintenanceWindows = []MaintenanceWindow{
+		{Org: "acme", Start: start, End: start.Add(4 * time.Hour)},
+		{Org: "globex", Repo: "api", Start: start, End: start.Add(time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		job      Job
+		wantTags []string
+	}{
+		{"failed in an org window", Job{Organization: "ACME", Pipeline: "web", Status: "failed", StartedAt: start.Add(time.Hour)}, []string{"maintenance"}},
+		{"failed in a repo window", Job{Organization: "globex", Pipeline: "api", Status: "failed", StartedAt: start}, []string{"maintenance"}},
+		{"other repo of the org", Job{Organization: "globex", Pipeline: "web", Status: "failed", StartedAt: start}, nil},
+		{"window has ended", Job{Organization: "acme", Pipeline: "web", Status: "failed", StartedAt: start.Add(4 * time.Hour)}, nil},
+		{"before the window", Job{Organization: "acme", Pipeline: "web", Status: "failed", StartedAt: start.Add(-time.Minute)}, nil},
+		{"passed in a window", Job{Organization: "acme", Pipeline: "web", Status: "success", StartedAt: start}, nil},
+		{"already tagged", Job{Organization: "acme", Pipeline: "web", Status: "failed", StartedAt: start, Tags: []string{"maintenance"}}, []string{"maintenance"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := tt.job
+			tagMaintenance(&job)
+			if !reflect.DeepEqual(job.Tags, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", job.Tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+// Runs are tagged as they're collected, before they're counted, whichever
+// provider they come from.
+func TestCollectorCountsMaintenance(t *testing.T) {
+	start := time.Date(2025, 11, 10, 22, 0, 0, 0, time.UTC)
+	defer func(w []MaintenanceWindow) { maintenanceWindows = w }(maintenanceWindows)
+	maintenanceWindows = []MaintenanceWindow{{Org: "acme", Start: start, End: start.Add(time.Hour)}}
+
+	c := newJobCollector(1)
+	for i, provider := range []string{"github", "gitlab", "jenkins", "circleci", "buildkite", "azure", "bitbucket"} {
+		c.add(Job{Provider: provider, Organization: "acme", Pipeline: "api", Status: "failed", StartedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	c.add(Job{Provider: "github", Organization: "acme", Pipeline: "api", Status: "failed", StartedAt: start.Add(2 * time.Hour)})
+
+	if c.stats.Maintenance != 7 || c.stats.Failed != 1 {
+		t.Errorf("maintenance = %d, failed = %d, want 7 and 1", c.stats.Maintenance, c.stats.Failed)
+	}
+}
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	start := time.Date(2025, 11, 10, 22, 0, 0, 0, time.FixedZone("", 7*3600))
+	tests := []struct {
+		env     string
+		want    []MaintenanceWindow
+		wantErr bool
+	}{
+		{env: "", want: nil},
+		{
+			env: "acme=2025-11-10T22:00:00+07:00/2025-11-11T02:00:00+07:00; acme/api=2025-11-10T22:00:00+07:00/2025-11-10T23:00:00+07:00",
+			want: []MaintenanceWindow{
+				{Org: "acme", Start: start, End: start.Add(4 * time.Hour)},
+				{Org: "acme", Repo: "api", Start: start, End: start.Add(time.Hour)},
+			},
+		},
+		{env: "acme", wantErr: true},
+		{env: "acme=2025-11-10T22:00:00+07:00", wantErr: true},
+		{env: "acme=yesterday/2025-11-11T02:00:00+07:00", wantErr: true},
+		{env: "acme=2025-11-11T02:00:00+07:00/2025-11-10T22:00:00+07:00", wantErr: true},
+		{env: "/api=2025-11-10T22:00:00+07:00/2025-11-11T02:00:00+07:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseMaintenanceWindows(tt.env)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMaintenanceWindows(%q) error = %v, want error %v", tt.env, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMaintenanceWindows(%q) = %+v, want %+v", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// MatrixLeg is one combination of a matrix job, e.g. "test (windows-latest, 3.11)".
+type MatrixLeg struct {
+	Job             string `json:"job"`    // job name without the matrix values, e.g. "test"
+	Matrix          string `json:"matrix"` // the matrix values, e.g. "windows-latest, 3.11"
+	Status          string `json:"status"`
+	Duration        string `json:"duration"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	HTMLURL         string `json:"html_url,omitempty"`
+}
+
+// matrixExpansion selects the runs whose matrix legs are fetched: "failed"
+// (default) only for failed and running runs, "all" for every run, "off"
+// for none. A successful run's legs all succeeded, so "failed" saves most
+// of the API calls.
+var matrixExpansion = "failed"
+
+func loadMatrixConfig() {
+	env := strings.ToLower(strings.TrimSpace(os.Getenv("MATRIX_EXPANSION")))
+	switch env {
+	case "":
+	case "failed", "all", "off":
+		matrixExpansion = env
+	default:
+		log.Fatalf("Invalid MATRIX_EXPANSION %q (expected failed, all or off)", env)
+	}
+}
+
+func expandMatrix(status string) bool {
+	switch matrixExpansion {
+	case "all":
+		return true
+	case "failed":
+		return status == "failed" || status == "running"
+	default:
+		return false
+	}
+}
+
+// splitMatrixName splits "test (windows-latest, 3.11)" into "test" and
+// "windows-latest, 3.11". GitHub names matrix jobs this way unless the
+// workflow sets a custom name.
+func splitMatrixName(name string) (job, matrix string, ok bool) {
+	if !strings.HasSuffix(name, ")") {
+		return "", "", false
+	}
+	open := strings.LastIndex(name, " (")
+	if open <= 0 {
+		return "", "", false
+	}
+	return name[:open], name[open+2 : len(name)-1], true
+}
+
+// matrixLegs returns the legs of the run's matrix jobs. Jobs not part of a
+// matrix are left out; a job name only counts as a matrix when at least
+// two jobs share it, since a single "(...)" may just be part of the name.
+func matrixLegs(jobs []*github.WorkflowJob) []MatrixLeg {
+	counts := make(map[string]int)
+	for _, job := range jobs {
+		if base, _, ok := splitMatrixName(job.GetName()); ok {
+			counts[base]++
+		}
+	}
+
+	var legs []MatrixLeg
+	for _, job := range jobs {
+		base, matrix, ok := splitMatrixName(job.GetName())
+		if !ok || counts[base] < 2 {
+			continue
+		}
+		leg := MatrixLeg{
+			Job:      base,
+			Matrix:   matrix,
+			Status:   dashboardStatus(job.GetStatus(), job.GetConclusion()),
+			Duration: "N/A",
+			HTMLURL:  job.GetHTMLURL(),
+		}
+		if job.StartedAt != nil && job.CompletedAt != nil {
+			leg.Duration = formatDuration(job.StartedAt.Time, job.CompletedAt.Time)
+			leg.DurationSeconds = int64(job.CompletedAt.Sub(job.StartedAt.Time).Seconds())
+		} else if job.StartedAt != nil {
+			leg.Duration = formatDuration(job.StartedAt.Time, clock())
+			leg.DurationSeconds = int64(clock().Sub(job.StartedAt.Time).Seconds())
+		}
+		legs = append(legs, leg)
+	}
+	return legs
+}
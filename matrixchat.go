@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Matrix (the chat network, not matrix jobs): alerts posted to Matrix
+// rooms through the client-server API of a homeserver, as the account of
+// MATRIX_ACCESS_TOKEN, which has to be a member of the rooms.
+
+type matrixTarget struct {
+	homeserver string
+	token      string
+	rooms      []string // room IDs (!abc:example.org) or aliases (#ci:example.org)
+	client     *http.Client
+
+	mu      sync.Mutex
+	roomIDs map[string]string // alias -> resolved room ID
+}
+
+// loadMatrixTarget reads MATRIX_HOMESERVER (https://matrix.example.org),
+// MATRIX_ACCESS_TOKEN and MATRIX_ROOMS.
+func loadMatrixTarget() alertTarget {
+	homeserver := strings.TrimRight(strings.TrimSpace(os.Getenv("MATRIX_HOMESERVER")), "/")
+	if homeserver == "" {
+		return nil
+	}
+	target := &matrixTarget{
+		homeserver: homeserver,
+		token:      os.Getenv("MATRIX_ACCESS_TOKEN"),
+		rooms:      splitList(os.Getenv("MATRIX_ROOMS")),
+		client:     newHTTPClient(),
+		roomIDs:    make(map[string]string),
+	}
+	// Without MATRIX_ROOMS, the homeserver may only serve the rooms of
+	// OWNER_ALERT_TARGETS
+	if len(target.rooms) == 0 && target.token != "" && os.Getenv("OWNER_ALERT_TARGETS") != "" {
+		return nil
+	}
+	if target.token == "" || len(target.rooms) == 0 {
+		log.Fatal("MATRIX_ACCESS_TOKEN and MATRIX_ROOMS must be set together with MATRIX_HOMESERVER")
+	}
+	for _, room := range target.rooms {
+		if !strings.HasPrefix(room, "!") && !strings.HasPrefix(room, "#") {
+			log.Fatalf("Invalid room %q in MATRIX_ROOMS: expected !id:server or #alias:server", room)
+		}
+	}
+	return target
+}
+
+func (t *matrixTarget) Name() string {
+	return "matrix"
+}
+
+// Send posts to every room; a room that fails doesn't stop the others.
+func (t *matrixTarget) Send(ctx context.Context, n notification, failed bool) error {
+	message := map[string]string{
+		"msgtype":        "m.text",
+		"body":           n.Title + "\n" + n.Body,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": matrixHTML(n),
+	}
+	if !failed {
+		message["msgtype"] = "m.notice" // bots' convention for messages that need no attention
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, room := range t.rooms {
+		roomID, err := t.roomID(ctx, room)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %v", room, err)
+			continue
+		}
+		endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", t.homeserver, url.PathEscape(roomID), randomToken()[:16])
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+t.token)
+		if err := doNotifyRequest(t.client, req); err != nil {
+			lastErr = fmt.Errorf("%s: %v", room, err)
+		}
+	}
+	return lastErr
+}
+
+// roomID resolves a room alias into its ID, once.
+func (t *matrixTarget) roomID(ctx context.Context, room string) (string, error) {
+	if strings.HasPrefix(room, "!") {
+		return room, nil
+	}
+	t.mu.Lock()
+	roomID, ok := t.roomIDs[room]
+	t.mu.Unlock()
+	if ok {
+		return roomID, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.homeserver+"/_matrix/client/v3/directory/room/"+url.PathEscape(room), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		RoomID string `json:"room_id"`
+		Error  string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("resolving alias: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || result.RoomID == "" {
+		return "", fmt.Errorf("resolving alias: %s %s", resp.Status, result.Error)
+	}
+
+	t.mu.Lock()
+	t.roomIDs[room] = result.RoomID
+	t.mu.Unlock()
+	return result.RoomID, nil
+}
+
+// matrixHTML formats a notification for Matrix clients: the title in bold
+// and linked to the run.
+func matrixHTML(n notification) string {
+	title := "<strong>" + html.EscapeString(n.Title) + "</strong>"
+	if n.URL != "" {
+		title = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(n.URL), title)
+	}
+	return title + "<br>" + strings.ReplaceAll(html.EscapeString(n.Body), "\n", "<br>")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Alerts reach every Matrix room, resolving aliases once, and leave out
+// maintenance failures.
+func TestSendAlertsToMatrix(t *testing.T) {
+	var mu sync.Mutex
+	var resolved int
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer bot-token" {
+			http.Error(w, `{"error":"unknown token"}`, http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/_matrix/client/v3/directory/room/#ci:example.org":
+			resolved++
+			w.Write([]byte(`{"room_id":"!resolved:example.org"}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/rooms/"):
+			room := strings.Split(strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3/rooms/"), "/")[0]
+			var message map[string]string
+			json.NewDecoder(r.Body).Decode(&message)
+			got = append(got, room+" "+message["msgtype"])
+			w.Write([]byte(`{"event_id":"$1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	defer func(s Store, targets []alertTarget) { store, alerts.targets = s, targets }(store, alerts.targets)
+	defer func(on string, branches []string) { setAlertRules(on, branches) }(alertRules())
+	store = newMemoryStore()
+	alerts.targets = []alertTarget{&matrixTarget{
+		homeserver: server.URL, token: "bot-token", rooms: []string{"!room:example.org", "#ci:example.org"},
+		client: server.Client(), roomIDs: make(map[string]string),
+	}}
+	if err := setAlertRules("finished", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	job := func(id, status string, tags ...string) Job {
+		return Job{Provider: "github", ID: id, Organization: "acme", Pipeline: "api", Name: "CI", Branch: "main", Status: status, Tags: tags}
+	}
+	sendAlerts(context.Background(), []Job{job("1", "failed"), job("2", "success"), job("3", "failed", "maintenance")})
+
+	want := []string{"!room:example.org m.text", "!resolved:example.org m.text", "!room:example.org m.notice", "!resolved:example.org m.notice"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+	if resolved != 1 {
+		t.Errorf("alias resolved %d times, want once", resolved)
+	}
+}
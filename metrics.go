@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// APICallCount is the number of GitHub API calls made to one endpoint for
+// one organization.
+type APICallCount struct {
+	Endpoint string `json:"endpoint"`
+	Org      string `json:"org"`
+	Calls    int    `json:"calls"`
+}
+
+type DebugInfo struct {
+	APICalls      []APICallCount `json:"api_calls"`       // calls made by the fetch that produced this data
+	TotalAPICalls int            `json:"total_api_calls"` // sum of APICalls
+}
+
+type callKey struct {
+	endpoint string
+	org      string
+	status   string
+}
+
+// callCounter counts API calls by endpoint, organization and status class.
+type callCounter struct {
+	mu     sync.Mutex
+	counts map[callKey]int
+}
+
+func newCallCounter() *callCounter {
+	return &callCounter{counts: make(map[callKey]int)}
+}
+
+func (c *callCounter) add(key callKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]++
+}
+
+// summary returns the counts per endpoint and org, ignoring status, sorted
+// by most calls first.
+func (c *callCounter) summary() []APICallCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	merged := make(map[callKey]int)
+	for key, n := range c.counts {
+		merged[callKey{endpoint: key.endpoint, org: key.org}] += n
+	}
+
+	result := make([]APICallCount, 0, len(merged))
+	for key, n := range merged {
+		result = append(result, APICallCount{Endpoint: key.endpoint, Org: key.org, Calls: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Calls != result[j].Calls {
+			return result[i].Calls > result[j].Calls
+		}
+		if result[i].Endpoint != result[j].Endpoint {
+			return result[i].Endpoint < result[j].Endpoint
+		}
+		return result[i].Org < result[j].Org
+	})
+	return result
+}
+
+func debugInfo(c *callCounter) *DebugInfo {
+	info := &DebugInfo{APICalls: c.summary()}
+	for _, call := range info.APICalls {
+		info.TotalAPICalls += call.Calls
+	}
+	return info
+}
+
+// apiCalls counts every GitHub API call made by the process.
+var apiCalls = newCallCounter()
+
+type callCounterKey struct{}
+
+// withCallCounter attaches a counter to ctx that additionally counts the
+// calls made with that context, e.g. by a single dashboard fetch.
+func withCallCounter(ctx context.Context, c *callCounter) context.Context {
+	return context.WithValue(ctx, callCounterKey{}, c)
+}
+
+// countingTransport records every request sent to the GitHub API.
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	endpoint, org := classifyEndpoint(req.Method, req.URL.EscapedPath())
+	status := "error"
+	if resp != nil {
+		status = fmt.Sprintf("%dxx", resp.StatusCode/100)
+	}
+	key := callKey{endpoint: endpoint, org: org, status: status}
+
+	apiCalls.add(key)
+	countConditionalRequest(req, resp)
+	if c, ok := req.Context().Value(callCounterKey{}).(*callCounter); ok {
+		c.add(key)
+	}
+	return resp, err
+}
+
+var numericSegment = regexp.MustCompile(`^[0-9]+$`)
+
+// classifyEndpoint turns a request path into an endpoint template such as
+// "GET /repos/{owner}/{repo}/actions/runs" and the organization it targets.
+func classifyEndpoint(method, path string) (endpoint, org string) {
+	// GitHub Enterprise Server serves the API under /api/v3, GitLab under /api/v4
+	path = strings.TrimPrefix(path, "/api/v3")
+	path = strings.TrimPrefix(path, "/api/v4")
+	if path == "/api/graphql" {
+		path = "/graphql" // GitHub Enterprise Server
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(segments) >= 2 {
+		switch segments[0] {
+		case "groups", "projects":
+			// GitLab: URL-encoded full path such as "group%2Fsub%2Fproject"
+			full, _ := url.PathUnescape(segments[1])
+			org, _, _ = strings.Cut(full, "/")
+			segments[1] = "{" + strings.TrimSuffix(segments[0], "s") + "}"
+		case "orgs", "users":
+			org = segments[1]
+			segments[1] = "{org}"
+		case "repos":
+			org = segments[1]
+			segments[1] = "{owner}"
+			if len(segments) >= 3 {
+				segments[2] = "{repo}"
+			}
+		}
+	}
+	for i, segment := range segments {
+		if numericSegment.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return method + " /" + strings.Join(segments, "/"), org
+}
+
+// metricsHandler exposes counters in the Prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	apiCalls.mu.Lock()
+	keys := make([]callKey, 0, len(apiCalls.counts))
+	for key := range apiCalls.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.endpoint != b.endpoint {
+			return a.endpoint < b.endpoint
+		}
+		if a.org != b.org {
+			return a.org < b.org
+		}
+		return a.status < b.status
+	})
+
+	fmt.Fprintln(w, "# HELP github_api_calls_total GitHub API calls by endpoint, organization and status class.")
+	fmt.Fprintln(w, "# TYPE github_api_calls_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "github_api_calls_total{endpoint=%q,org=%q,status=%q} %d\n",
+			key.endpoint, key.org, key.status, apiCalls.counts[key])
+	}
+	apiCalls.mu.Unlock()
+
+	writeCacheMetrics(w)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MessagePack encoding of API responses, for bandwidth-sensitive clients
+// such as embedded wallboard devices. The response goes through its JSON
+// form first, so field names, omitempty and nesting stay identical to the
+// JSON API and there is no second schema to keep in sync.
+
+const msgpackContentType = "application/msgpack"
+
+// wantsMsgpack reports whether the client asked for MessagePack with
+// Accept: application/msgpack (or the older application/x-msgpack).
+func wantsMsgpack(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(accept, ";")
+		switch strings.TrimSpace(strings.ToLower(mediaType)) {
+		case msgpackContentType, "application/x-msgpack":
+			return true
+		}
+	}
+	return false
+}
+
+// writeMsgpack encodes v as MessagePack.
+func writeMsgpack(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, value); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// encodeMsgpack encodes a value decoded from JSON (with UseNumber).
+func encodeMsgpack(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			encodeMsgpackInt(buf, n)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		encodeMsgpackString(buf, v)
+	case []interface{}:
+		encodeMsgpackLength(buf, len(v), 0x90, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := encodeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// Sorted keys keep the encoding stable between requests
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encodeMsgpackLength(buf, len(keys), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			encodeMsgpackString(buf, key)
+			if err := encodeMsgpack(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", value)
+	}
+	return nil
+}
+
+func encodeMsgpackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		buf.WriteByte(byte(n)) // positive fixint
+	case n < 0 && n >= -32:
+		buf.WriteByte(byte(n)) // negative fixint
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+func encodeMsgpackString(buf *bytes.Buffer, s string) {
+	switch {
+	case len(s) <= 31:
+		buf.WriteByte(0xa0 | byte(len(s))) // fixstr
+	case len(s) <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(len(s)))
+	default:
+		encodeMsgpackLength(buf, len(s), 0, 0xda, 0xdb)
+	}
+	buf.WriteString(s)
+}
+
+// encodeMsgpackLength writes the header of an array, map or long string:
+// the fix form for up to 15 entries (arrays and maps), otherwise the 16 or
+// 32 bit form.
+func encodeMsgpackLength(buf *bytes.Buffer, n int, fix, code16, code32 byte) {
+	switch {
+	case fix != 0 && n <= 15:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(code32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
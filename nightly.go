@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nightlyWorkflows are scheduled workflows declared in NIGHTLY_WORKFLOWS
+// ("org/repo:Workflow"), reported as missing even when they haven't run at
+// all during the last week.
+var nightlyWorkflows []nightlyWorkflow
+
+type nightlyWorkflow struct {
+	org, repo, workflow string
+}
+
+// NightlyWorkflow is the last day of one scheduled workflow.
+type NightlyWorkflow struct {
+	Repository string `json:"repository"`
+	Provider   string `json:"provider,omitempty"`
+	Workflow   string `json:"workflow"`
+	// success or failed (latest run in the window), missing when a run was
+	// due but none happened, not_due for workflows scheduled less often
+	Status          string `json:"status"`
+	Runs            int    `json:"runs"`
+	Failed          int    `json:"failed"`
+	LastRun         *Job   `json:"last_run,omitempty"` // may be older than the window
+	IntervalSeconds int64  `json:"interval_seconds,omitempty"`
+	Declared        bool   `json:"declared,omitempty"` // listed in NIGHTLY_WORKFLOWS
+}
+
+type NightlyReport struct {
+	Since     time.Time         `json:"since"`
+	FetchedAt time.Time         `json:"fetched_at"`
+	Ran       int               `json:"ran"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Missing   int               `json:"missing"`
+	Workflows []NightlyWorkflow `json:"workflows"`
+}
+
+// nightlyGrace is how late a scheduled run may be before it counts as
+// missing; GitHub delays scheduled runs under load.
+const nightlyGrace = time.Hour
+
+func loadNightlyConfig() {
+	for _, entry := range splitList(os.Getenv("NIGHTLY_WORKFLOWS")) {
+		repo, workflow, ok := strings.Cut(entry, ":")
+		org, name, okRepo := strings.Cut(repo, "/")
+		if !ok || !okRepo || workflow == "" {
+			log.Fatalf("Invalid NIGHTLY_WORKFLOWS entry %q: expected org/repo:Workflow", entry)
+		}
+		nightlyWorkflows = append(nightlyWorkflows, nightlyWorkflow{org: org, repo: name, workflow: workflow})
+	}
+	if len(nightlyWorkflows) > 0 {
+		log.Printf("🌙 Expecting %d declared nightly workflow(s)", len(nightlyWorkflows))
+	}
+}
+
+// nightlyHandler serves /api/nightly, the scheduled (cron) workflows of the
+// last 24 hours: which ran, which failed, and which didn't run at all.
+// Scheduled workflows are recognized from their runs in the week snapshot,
+// plus the ones declared in NIGHTLY_WORKFLOWS.
+func nightlyHandler(w http.ResponseWriter, r *http.Request) {
+	window := 24 * time.Hour
+	if value := r.URL.Query().Get("hours"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 1 || hours > 7*24 {
+			http.Error(w, fmt.Sprintf("Invalid hours %q (1 to 168)", value), http.StatusBadRequest)
+			return
+		}
+		window = time.Duration(hours) * time.Hour
+	}
+
+	snap, err := getDashboard(context.Background(), "week")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	report := nightlyReport(snap, clock().Add(-window))
+
+	locale := requestLocale(r.URL.Query().Get("locale"))
+	for i := range report.Workflows {
+		if last := report.Workflows[i].LastRun; last != nil {
+			jobs := []Job{*last}
+			localizeJobs(jobs, locale)
+			report.Workflows[i].LastRun = &jobs[0]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(report)
+}
+
+func nightlyReport(snap *Snapshot, since time.Time) NightlyReport {
+	type scheduled struct {
+		summary NightlyWorkflow
+		times   []time.Time
+	}
+	workflows := make(map[string]*scheduled)
+	key := func(org, repo, workflow string) string {
+		return strings.ToLower(org + "/" + repo + ":" + workflow)
+	}
+
+	for _, job := range snap.Response.Jobs {
+		if job.Event != "schedule" {
+			continue
+		}
+		name := workflowName(job.Name)
+		k := key(job.Organization, job.Pipeline, name)
+		s, ok := workflows[k]
+		if !ok {
+			s = &scheduled{summary: NightlyWorkflow{Repository: job.Organization + "/" + job.Pipeline, Provider: job.Provider, Workflow: name}}
+			workflows[k] = s
+		}
+		s.times = append(s.times, job.CreatedAt)
+		if s.summary.LastRun == nil || job.CreatedAt.After(s.summary.LastRun.CreatedAt) {
+			last := job
+			s.summary.LastRun = &last
+		}
+		if !job.CreatedAt.Before(since) {
+			s.summary.Runs++
+			if job.Status == "failed" {
+				s.summary.Failed++
+			}
+		}
+	}
+	for _, declared := range nightlyWorkflows {
+		k := key(declared.org, declared.repo, declared.workflow)
+		if s, ok := workflows[k]; ok {
+			s.summary.Declared = true
+			continue
+		}
+		workflows[k] = &scheduled{summary: NightlyWorkflow{Repository: declared.org + "/" + declared.repo, Workflow: declared.workflow, Declared: true}}
+	}
+
+	report := NightlyReport{Since: since, FetchedAt: snap.FetchedAt, Workflows: []NightlyWorkflow{}}
+	for _, s := range workflows {
+		summary := s.summary
+		interval := scheduleInterval(s.times)
+		summary.IntervalSeconds = int64(interval.Seconds())
+		switch {
+		case summary.Runs > 0:
+			summary.Status = summary.LastRun.Status
+			report.Ran++
+			switch summary.Status {
+			case "success":
+				report.Succeeded++
+			case "failed":
+				report.Failed++
+			}
+		case summary.Declared || (interval > 0 && interval <= snap.FetchedAt.Sub(since)+nightlyGrace):
+			// Runs at least once per window, but not in this one
+			summary.Status = "missing"
+			report.Missing++
+		default:
+			summary.Status = "not_due"
+		}
+		report.Workflows = append(report.Workflows, summary)
+	}
+
+	// Problems first: missing, then failed, then the rest by name
+	rank := map[string]int{"missing": 0, "failed": 1}
+	sort.Slice(report.Workflows, func(i, j int) bool {
+		a, b := report.Workflows[i], report.Workflows[j]
+		ra, okA := rank[a.Status]
+		rb, okB := rank[b.Status]
+		if !okA {
+			ra = 2
+		}
+		if !okB {
+			rb = 2
+		}
+		if ra != rb {
+			return ra < rb
+		}
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Workflow < b.Workflow
+	})
+	return report
+}
+
+// scheduleInterval estimates how often a workflow is scheduled from the
+// median gap between its scheduled runs; zero with fewer than two runs.
+func scheduleInterval(times []time.Time) time.Duration {
+	if len(times) < 2 {
+		return 0
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	gaps := make([]time.Duration, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, times[i].Sub(times[i-1]))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return gaps[len(gaps)/2]
+}
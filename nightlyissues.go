@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Issues for broken nightly jobs (NIGHTLY_ISSUES=true): when a scheduled
+// workflow fails, an issue is filed in its repository, or commented on
+// when one is already open, and closed when the workflow next succeeds.
+// Issues are found again by their label plus a marker naming the workflow,
+// so several nightly workflows of one repository get an issue each. The
+// token needs write access to issues.
+
+const (
+	defaultNightlyIssueTitle = `Nightly workflow {{.Workflow}} is failing`
+	defaultNightlyIssueBody  = `The scheduled workflow **{{.Workflow}}** failed on ` + "`{{.Branch}}`" + `: [{{.Run.Name}}]({{.Run.HTMLURL}}){{if gt .Failures 1}}, {{.Failures}} times in a row{{end}}.
+{{if .Excerpt}}
+` + "```" + `
+{{.Excerpt}}
+` + "```" + `
+{{end}}
+This issue is closed automatically when the workflow succeeds again.`
+)
+
+var nightlyIssues struct {
+	enabled bool
+	label   string
+	title   *template.Template
+	body    *template.Template
+}
+
+// nightlyIssueData is what the title and body templates get.
+type nightlyIssueData struct {
+	Repository string // org/repo
+	Workflow   string
+	Branch     string
+	Run        HistoryRun // the failed run
+	Failures   int        // in a row, including Run
+	Excerpt    string     // failed jobs and steps and their error annotations
+}
+
+// loadNightlyIssueConfig reads NIGHTLY_ISSUES, NIGHTLY_ISSUE_LABEL and the
+// templates (text/template) NIGHTLY_ISSUE_TITLE and NIGHTLY_ISSUE_BODY_FILE.
+func loadNightlyIssueConfig() {
+	nightlyIssues.enabled = os.Getenv("NIGHTLY_ISSUES") == "true"
+	if !nightlyIssues.enabled {
+		return
+	}
+	nightlyIssues.label = getEnvString("NIGHTLY_ISSUE_LABEL", "nightly-failure")
+
+	var err error
+	nightlyIssues.title, err = template.New("title").Parse(getEnvString("NIGHTLY_ISSUE_TITLE", defaultNightlyIssueTitle))
+	if err != nil {
+		log.Fatalf("Invalid NIGHTLY_ISSUE_TITLE: %v", err)
+	}
+	body := defaultNightlyIssueBody
+	if path := os.Getenv("NIGHTLY_ISSUE_BODY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error reading NIGHTLY_ISSUE_BODY_FILE: %v", err)
+		}
+		body = string(data)
+	}
+	nightlyIssues.body, err = template.New("body").Parse(body)
+	if err != nil {
+		log.Fatalf("Invalid NIGHTLY_ISSUE_BODY_FILE: %v", err)
+	}
+	log.Printf("🌙 Filing issues labeled %q for failing nightly workflows", nightlyIssues.label)
+}
+
+// nightlyIssueMarker identifies the workflow of an issue, invisibly.
+func nightlyIssueMarker(workflow string) string {
+	return fmt.Sprintf("<!-- ci-dashboard nightly workflow: %s -->", strings.ReplaceAll(workflow, "--", "- -"))
+}
+
+// trackNightlyIssues files and closes issues for the scheduled runs that
+// just finished.
+func trackNightlyIssues(ctx context.Context, finished []Job, snap *Snapshot) {
+	if !nightlyIssues.enabled || githubClient == nil {
+		return
+	}
+	for _, job := range nightlyRuns(finished) {
+		if err := trackNightlyIssue(ctx, job, snap); err != nil {
+			log.Printf("⚠️  Error updating the nightly issue of %s/%s %s: %v", job.Organization, job.Pipeline, workflowName(job.Name), err)
+		}
+	}
+}
+
+// nightlyRuns returns the scheduled GitHub Actions runs among finished ones.
+// Failures during maintenance windows don't file or update an issue.
+func nightlyRuns(finished []Job) []Job {
+	var runs []Job
+	for _, job := range finished {
+		if job.Provider == "github" && job.Event == "schedule" && !hasTag(job, "maintenance") {
+			runs = append(runs, job)
+		}
+	}
+	return runs
+}
+
+// trackNightlyIssue updates the issue of a run's workflow once. The run is
+// only marked done after its issue was written, under the workflow's lock,
+// so a failed update is tried again by the next replica or refresh that
+// sees the run finish.
+func trackNightlyIssue(ctx context.Context, job Job, snap *Snapshot) error {
+	workflow := workflowName(job.Name)
+	release, ok, err := store.Lock(ctx, "lock:nightly-issue:"+job.Organization+"/"+job.Pipeline+"|"+workflow, time.Minute)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("issue is being updated elsewhere")
+	}
+	defer release()
+
+	done := notificationKey("nightly-issue", job)
+	if _, ok, err := store.Get(ctx, done); err != nil || ok {
+		return err
+	}
+	if err := updateNightlyIssue(ctx, job, workflow, snap); err != nil {
+		return err
+	}
+	return store.Set(ctx, done, []byte("1"), notificationSentTTL)
+}
+
+func updateNightlyIssue(ctx context.Context, job Job, workflow string, snap *Snapshot) error {
+	issue, err := findNightlyIssue(ctx, job.Organization, job.Pipeline, workflow)
+	if err != nil {
+		return err
+	}
+
+	if job.Status == "success" {
+		if issue == nil {
+			return nil
+		}
+		comment := fmt.Sprintf("The workflow succeeded again: [%s](%s). Closing.", job.Name, job.HTMLURL)
+		if err := budget.acquire(ctx); err != nil {
+			return err
+		}
+		_, resp, err := githubClient.Issues.CreateComment(ctx, job.Organization, job.Pipeline, issue.GetNumber(), &github.IssueComment{Body: &comment})
+		budget.update(resp)
+		if err != nil {
+			return err
+		}
+		if err := budget.acquire(ctx); err != nil {
+			return err
+		}
+		_, resp, err = githubClient.Issues.Edit(ctx, job.Organization, job.Pipeline, issue.GetNumber(), &github.IssueRequest{
+			State:       github.String("closed"),
+			StateReason: github.String("completed"),
+		})
+		budget.update(resp)
+		if err != nil {
+			return err
+		}
+		log.Printf("🌙 Closed issue #%d of %s/%s: %s succeeds again", issue.GetNumber(), job.Organization, job.Pipeline, workflow)
+		return nil
+	}
+
+	data := nightlyIssueData{Repository: job.Organization + "/" + job.Pipeline, Workflow: workflow, Branch: job.Branch, Failures: 1}
+	data.Run = HistoryRun{Provider: job.Provider, ID: job.ID, RunID: job.RunID, Name: job.Name, Workflow: workflow, Status: job.Status,
+		HeadSHA: job.HeadSHA, CommitMessage: job.CommitMessage, Actor: job.Actor, CreatedAt: job.CreatedAt, DurationSeconds: job.DurationSeconds, HTMLURL: job.HTMLURL}
+	if runs, err := workflowRuns(ctx, job, snap); err == nil {
+		data.Failures = max(len(failureStreak(runs)), 1)
+	}
+	if data.Excerpt, err = failureExcerpt(ctx, job.Organization, job.Pipeline, job.RunID); err != nil {
+		log.Printf("⚠️  Error reading why run %d of %s/%s failed: %v", job.RunID, job.Organization, job.Pipeline, err)
+	}
+	var body strings.Builder
+	if err := nightlyIssues.body.Execute(&body, data); err != nil {
+		return err
+	}
+
+	if issue != nil {
+		comment := body.String()
+		if err := budget.acquire(ctx); err != nil {
+			return err
+		}
+		_, resp, err := githubClient.Issues.CreateComment(ctx, job.Organization, job.Pipeline, issue.GetNumber(), &github.IssueComment{Body: &comment})
+		budget.update(resp)
+		if err != nil {
+			return err
+		}
+		log.Printf("🌙 Commented on issue #%d of %s/%s: %s failed again", issue.GetNumber(), job.Organization, job.Pipeline, workflow)
+		return nil
+	}
+
+	var title strings.Builder
+	if err := nightlyIssues.title.Execute(&title, data); err != nil {
+		return err
+	}
+	body.WriteString("\n\n" + nightlyIssueMarker(workflow))
+	if err := budget.acquire(ctx); err != nil {
+		return err
+	}
+	created, resp, err := githubClient.Issues.Create(ctx, job.Organization, job.Pipeline, &github.IssueRequest{
+		Title:  github.String(strings.TrimSpace(title.String())),
+		Body:   github.String(body.String()),
+		Labels: &[]string{nightlyIssues.label},
+	})
+	budget.update(resp)
+	if err != nil {
+		return err
+	}
+	log.Printf("🌙 Filed issue #%d in %s/%s: %s failed", created.GetNumber(), job.Organization, job.Pipeline, workflow)
+	return nil
+}
+
+// findNightlyIssue returns the open issue of a workflow, nil when there's
+// none.
+func findNightlyIssue(ctx context.Context, org, repo, workflow string) (*github.Issue, error) {
+	marker := nightlyIssueMarker(workflow)
+	opts := &github.IssueListByRepoOptions{State: "open", Labels: []string{nightlyIssues.label}, ListOptions: github.ListOptions{PerPage: 100}}
+	if err := budget.acquire(ctx); err != nil {
+		return nil, err
+	}
+	issues, resp, err := githubClient.Issues.ListByRepo(ctx, org, repo, opts)
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		if !issue.IsPullRequest() && strings.Contains(issue.GetBody(), marker) {
+			return issue, nil
+		}
+	}
+	return nil, nil
+}
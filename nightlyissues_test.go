@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNightlyRuns(t *testing.T) {
+	job := func(id, provider, event, status string, tags ...string) Job {
+		return Job{ID: id, Provider: provider, Event: event, Status: status, Tags: tags}
+	}
+	tests := []struct {
+		name     string
+		finished []Job
+		wantIDs  []string
+	}{
+		{"no runs", nil, nil},
+		{"scheduled runs", []Job{job("1", "github", "schedule", "failed"), job("2", "github", "schedule", "success")}, []string{"1", "2"}},
+		{"pushes", []Job{job("1", "github", "push", "failed")}, nil},
+		{"other providers", []Job{job("1", "gitlab", "schedule", "failed")}, nil},
+		{
+			"maintenance failures",
+			[]Job{job("1", "github", "schedule", "failed", "maintenance"), job("2", "github", "schedule", "failed", "flaky")},
+			[]string{"2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, job := range nightlyRuns(tt.finished) {
+				ids = append(ids, job.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("nightlyRuns() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
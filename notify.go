@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Notifications: messages about finished runs sent to people rather than
+// shown on the dashboard, to the personal subscriptions of watch.go and the
+// alert targets of alerts.go. Email goes out through the SMTP server in
+// SMTP_HOST.
+
+var smtpConfig struct {
+	addr     string // host:port
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func loadNotifyConfig() {
+	smtpConfig.host = strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	if smtpConfig.host == "" {
+		return
+	}
+	smtpConfig.addr = net.JoinHostPort(smtpConfig.host, getEnvString("SMTP_PORT", "587"))
+	smtpConfig.username = os.Getenv("SMTP_USERNAME")
+	smtpConfig.password = os.Getenv("SMTP_PASSWORD")
+	smtpConfig.from = strings.TrimSpace(os.Getenv("SMTP_FROM"))
+	if smtpConfig.from == "" {
+		log.Fatal("SMTP_FROM must be set together with SMTP_HOST")
+	}
+	log.Printf("✉️  Email notifications through %s as %s", smtpConfig.addr, smtpConfig.from)
+}
+
+func emailEnabled() bool {
+	return smtpConfig.host != ""
+}
+
+// notificationSentTTL is how long a notification is remembered, so the
+// same run isn't announced again by the fetch of another period or
+// replica. It covers the longest period.
+const notificationSentTTL = 31 * 24 * time.Hour
+
+// finishedRuns returns the runs of a fresh snapshot that finished since
+// the previous one: finished now, and running, pending or not there yet
+// before. Without a previous snapshot there's nothing to compare, so
+// nothing is reported rather than every run.
+func finishedRuns(previous, snap *Snapshot) []Job {
+	if previous == nil {
+		return nil
+	}
+	before := make(map[string]Job, len(previous.Response.Jobs))
+	for _, job := range previous.Response.Jobs {
+		before[jobKey(&job)] = job
+	}
+
+	var finished []Job
+	for _, job := range snap.Response.Jobs {
+		if job.Status != "success" && job.Status != "failed" {
+			continue
+		}
+		old, ok := before[jobKey(&job)]
+		switch {
+		case !ok:
+			// New to the snapshot, but it may just be old enough to have
+			// been left out before (MAX_JOBS); only count runs that ended
+			// after the previous fetch
+			end := job.StartedAt.Add(time.Duration(job.DurationSeconds) * time.Second)
+			if end.Before(previous.FetchedAt) {
+				continue
+			}
+		case old.Status == job.Status && old.Attempt == job.Attempt:
+			continue
+		}
+		finished = append(finished, job)
+	}
+	return finished
+}
+
+// notifyFinishedRuns sends the notifications about the runs that finished
+// since the previous snapshot, in the background: to the users watching
+// them, to the alert targets and to the issue trackers.
+func notifyFinishedRuns(previous, snap *Snapshot) {
+	finished := finishedRuns(previous, snap)
+	if len(finished) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		notifyWatchers(ctx, finished)
+		sendAlerts(ctx, finished)
+		trackJiraIssues(ctx, finished, snap)
+		trackNightlyIssues(ctx, finished, snap)
+	}()
+}
+
+// claimNotification reports whether the notification of a run's current
+// state to recipient is still to be sent, claiming it for good: whoever
+// gets it first sends it.
+func claimNotification(ctx context.Context, recipient string, job Job) bool {
+	_, ok, err := store.Lock(ctx, notificationKey(recipient, job), notificationSentTTL)
+	return err == nil && ok
+}
+
+// notificationKey names a run's notification to a recipient, per attempt
+// and outcome.
+func notificationKey(recipient string, job Job) string {
+	return fmt.Sprintf("%s|%s|%d|%s", recipient, jobKey(&job), job.Attempt, job.Status)
+}
+
+// notification is a message about one run.
+type notification struct {
+	Title string
+	Body  string
+	URL   string
+}
+
+// runNotification describes a finished run.
+func runNotification(job Job) notification {
+	verb := "succeeded"
+	if job.Status == "failed" {
+		verb = "failed"
+	}
+	n := notification{
+		Title: fmt.Sprintf("%s %s/%s: %s %s on %s", statusEmoji(job.Status), job.Organization, job.Pipeline, job.Name, verb, job.Branch),
+		URL:   job.HTMLURL,
+	}
+
+	lines := []string{
+		fmt.Sprintf("Repository: %s/%s", job.Organization, job.Pipeline),
+		fmt.Sprintf("Workflow:   %s", job.Name),
+		fmt.Sprintf("Branch:     %s", job.Branch),
+		fmt.Sprintf("Status:     %s", job.Status),
+		fmt.Sprintf("Duration:   %s", job.Duration),
+	}
+	if job.Actor != "" {
+		lines = append(lines, fmt.Sprintf("Actor:      %s", job.Actor))
+	}
+	if job.CommitMessage != "" {
+		lines = append(lines, fmt.Sprintf("Commit:     %s", job.CommitMessage))
+	}
+	if job.HTMLURL != "" {
+		lines = append(lines, "", job.HTMLURL)
+	}
+	n.Body = strings.Join(lines, "\n")
+	return n
+}
+
+func statusEmoji(status string) string {
+	if status == "failed" {
+		return "❌"
+	}
+	return "✅"
+}
+
+// sendEmail mails a notification to one address.
+func sendEmail(to string, n notification) error {
+	// Names of repositories and branches end up in the headers
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Title)
+	msg := strings.Join([]string{
+		"From: " + smtpConfig.from,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		n.Body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if smtpConfig.username != "" {
+		auth = smtp.PlainAuth("", smtpConfig.username, smtpConfig.password, smtpConfig.host)
+	}
+	return smtp.SendMail(smtpConfig.addr, auth, smtpConfig.from, []string{to}, []byte(msg))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Repositories without GitHub Actions workflows (forks, docs, archives of
+// old projects) never have runs, yet each costs a call on every fetch. When
+// a repository has no runs in the period, the workflows endpoint is asked;
+// if it has no workflows either, the repository is skipped until it is
+// pushed to again or noWorkflowsTTL passes.
+
+// noWorkflowsTTL is how long a repository without workflows is skipped.
+// Zero never skips.
+var noWorkflowsTTL = 24 * time.Hour
+
+// hasWorkflows remembers when repositories were found to have workflows
+// (org/repo -> time.Time), so one without runs in the period isn't asked
+// again on every fetch.
+var hasWorkflows sync.Map
+
+// noWorkflows is what is remembered of a repository without workflows.
+type noWorkflows struct {
+	CheckedAt time.Time `json:"checked_at"`
+	ActiveAt  time.Time `json:"active_at"` // the repository's activity when it was checked
+}
+
+func noWorkflowsKey(org, repo string) string {
+	return "noworkflows:" + org + "/" + repo
+}
+
+// skipReposWithoutWorkflows drops the repositories known to have no
+// workflows and not pushed to since.
+func skipReposWithoutWorkflows(ctx context.Context, org string, repos []orgRepo) []orgRepo {
+	if noWorkflowsTTL <= 0 {
+		return repos
+	}
+	kept := repos[:0]
+	skipped := 0
+	for _, repo := range repos {
+		data, ok, err := store.Get(ctx, noWorkflowsKey(org, repo.Name))
+		var known noWorkflows
+		if err == nil && ok && json.Unmarshal(data, &known) == nil && !repo.activity().After(known.ActiveAt) {
+			skipped++
+			continue
+		}
+		kept = append(kept, repo)
+	}
+	if skipped > 0 {
+		log.Printf("   🚫 Skipping %d repositories without workflows in %s", skipped, org)
+	}
+	return kept
+}
+
+// checkWorkflows asks whether a repository without runs in the period has
+// workflows at all, and remembers it if not. It costs one call, so it is
+// left out when the budget is low, and for noWorkflowsTTL after the
+// repository was found to have workflows.
+func checkWorkflows(ctx context.Context, repo Pipeline) {
+	if noWorkflowsTTL <= 0 || budget.low() {
+		return
+	}
+	key := repo.Org + "/" + repo.Name
+	if checked, ok := hasWorkflows.Load(key); ok && clock().Sub(checked.(time.Time)) < noWorkflowsTTL {
+		return
+	}
+	if err := budget.acquire(ctx); err != nil {
+		return
+	}
+	workflows, resp, err := githubClient.Actions.ListWorkflows(ctx, repo.Org, repo.Name, &github.ListOptions{PerPage: 1})
+	budget.update(resp)
+	notFound := resp != nil && resp.StatusCode == http.StatusNotFound
+	if err != nil && !notFound {
+		log.Printf("   ⚠️  Error listing workflows of %s/%s: %v", repo.Org, repo.Name, err)
+		return
+	}
+	if !notFound && workflows.GetTotalCount() > 0 {
+		hasWorkflows.Store(key, clock())
+		return
+	}
+
+	data, err := json.Marshal(noWorkflows{CheckedAt: clock(), ActiveAt: repo.ActiveAt})
+	if err == nil {
+		err = store.Set(ctx, noWorkflowsKey(repo.Org, repo.Name), data, noWorkflowsTTL)
+	}
+	if err != nil {
+		log.Printf("⚠️  Error saving workflows of %s/%s to store: %v", repo.Org, repo.Name, err)
+		return
+	}
+	log.Printf("   🚫 %s/%s has no workflows, skipping it for %v or until it is pushed to", repo.Org, repo.Name, noWorkflowsTTL)
+}
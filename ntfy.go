@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ntfy (https://ntfy.sh) and Gotify: lightweight, often self-hosted push
+// services, as alert targets.
+
+// ntfyTarget publishes to an ntfy topic, NTFY_URL=https://ntfy.sh/<topic>,
+// with NTFY_TOKEN for protected topics.
+type ntfyTarget struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func loadNtfyTarget() alertTarget {
+	topicURL := strings.TrimSpace(os.Getenv("NTFY_URL"))
+	if topicURL == "" {
+		return nil
+	}
+	if u, err := url.Parse(topicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || strings.Trim(u.Path, "/") == "" {
+		log.Fatalf("Invalid NTFY_URL %q: expected http(s)://<server>/<topic>", topicURL)
+	}
+	return &ntfyTarget{url: topicURL, token: os.Getenv("NTFY_TOKEN"), client: newHTTPClient()}
+}
+
+func (t *ntfyTarget) Name() string {
+	return "ntfy"
+}
+
+func (t *ntfyTarget) Send(ctx context.Context, n notification, failed bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, strings.NewReader(n.Body))
+	if err != nil {
+		return err
+	}
+	// Headers are ASCII; ntfy decodes RFC 2047 for the emoji and names
+	req.Header.Set("Title", mime.BEncoding.Encode("utf-8", n.Title))
+	if n.URL != "" {
+		req.Header.Set("Click", n.URL)
+	}
+	if failed {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "x")
+	} else {
+		req.Header.Set("Tags", "white_check_mark")
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return doNotifyRequest(t.client, req)
+}
+
+// gotifyTarget posts to a Gotify server, GOTIFY_URL, with the token of an
+// application created there (GOTIFY_TOKEN).
+type gotifyTarget struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func loadGotifyTarget() alertTarget {
+	serverURL := strings.TrimRight(strings.TrimSpace(os.Getenv("GOTIFY_URL")), "/")
+	if serverURL == "" {
+		return nil
+	}
+	token := os.Getenv("GOTIFY_TOKEN")
+	if token == "" {
+		log.Fatal("GOTIFY_TOKEN must be set together with GOTIFY_URL")
+	}
+	return &gotifyTarget{url: serverURL + "/message", token: token, client: newHTTPClient()}
+}
+
+func (t *gotifyTarget) Name() string {
+	return "gotify"
+}
+
+func (t *gotifyTarget) Send(ctx context.Context, n notification, failed bool) error {
+	message := map[string]interface{}{
+		"title":    n.Title,
+		"message":  n.Body,
+		"priority": 4,
+	}
+	if failed {
+		message["priority"] = 8
+	}
+	if n.URL != "" {
+		message["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": n.URL}},
+		}
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", t.token)
+	return doNotifyRequest(t.client, req)
+}
+
+// doNotifyRequest sends a request to a notification service, failing on
+// anything but a 2xx answer.
+func doNotifyRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
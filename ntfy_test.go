@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// Alerts reach ntfy and Gotify through sendAlerts, which leaves out the
+// runs alerts aren't on, maintenance failures included.
+func TestSendAlertsToNtfyAndGotify(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/alerts":
+			got = append(got, "ntfy "+r.Header.Get("Priority"))
+		case "/message":
+			got = append(got, "gotify "+r.Header.Get("X-Gotify-Key"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	defer func(s Store, targets []alertTarget) { store, alerts.targets = s, targets }(store, alerts.targets)
+	defer func(on string, branches []string) { setAlertRules(on, branches) }(alertRules())
+	store = newMemoryStore()
+	alerts.targets = []alertTarget{
+		&ntfyTarget{url: server.URL + "/alerts", client: server.Client()},
+		&gotifyTarget{url: server.URL + "/message", token: "app-token", client: server.Client()},
+	}
+	if err := setAlertRules("failed", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	job := func(id, status string, tags ...string) Job {
+		return Job{Provider: "github", ID: id, Organization: "acme", Pipeline: "api", Name: "CI", Branch: "main", Status: status, Tags: tags}
+	}
+	finished := []Job{job("1", "failed"), job("2", "success"), job("3", "failed", "maintenance")}
+	sendAlerts(context.Background(), finished)
+	// Sent once, even when the run is seen finishing again
+	sendAlerts(context.Background(), finished)
+
+	sort.Strings(got)
+	if want := []string{"gotify app-token", "ntfy high"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alerts = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Organization onboarding: /api/admin/orgs checks a GitHub organization
+// with the dashboard's token before it's added to the runtime config (see
+// adminconfig.go): whether the token can read it (scopes, SAML SSO), how
+// many repositories it has and what a refresh will cost. Problems come back
+// with what to do about them.
+
+// OrgCheck is what checking an organization found.
+type OrgCheck struct {
+	Organization   string   `json:"organization"`
+	OK             bool     `json:"ok"` // no errors, it can be added
+	Added          bool     `json:"added,omitempty"`
+	Errors         []string `json:"errors,omitempty"`          // what keeps it from being added, and how to fix it
+	Warnings       []string `json:"warnings,omitempty"`        // what it can be added with, but will be missing
+	TokenScopes    []string `json:"token_scopes,omitempty"`    // of a classic personal access token
+	Repos          int      `json:"repos"`                     // visible to the token
+	ActiveRepos    int      `json:"active_repos"`              // pushed to in the last 7 days
+	EstimatedCalls int      `json:"estimated_calls,omitempty"` // GitHub API calls a refresh of the week adds
+}
+
+func (c *OrgCheck) fail(format string, args ...interface{}) {
+	c.Errors = append(c.Errors, fmt.Sprintf(format, args...))
+}
+
+func (c *OrgCheck) warn(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// checkOrg checks an organization that isn't configured yet.
+func checkOrg(ctx context.Context, org string) *OrgCheck {
+	check := &OrgCheck{Organization: org}
+	defer func() { check.OK = len(check.Errors) == 0 }()
+
+	if demoMode {
+		check.fail("organizations can't be added in DEMO_MODE")
+		return check
+	}
+	if login, _ := parseAccount(org); configuredOrg(login) {
+		check.fail("%s is already configured", org)
+		return check
+	}
+	if !checkOrgAccess(ctx, check) {
+		return check
+	}
+
+	check.EstimatedCalls = estimateOrgCalls(ctx, check.Repos, check.ActiveRepos)
+	if rate := budget.rateLimit(); rate != nil {
+		existing := 0
+		if snap, err := loadSnapshot(ctx, "week"); err == nil && snap != nil {
+			if forecast := forecastRefresh("week", snap); forecast != nil {
+				existing = forecast.EstimatedCalls
+			}
+		}
+		if available := rate.Limit - reservedCalls(); existing+check.EstimatedCalls > available {
+			check.warn("a refresh of the week would need about %d GitHub API calls with %s, more than the %d per hour the token has: repositories will be skipped, unless RUNS_PER_REPO is lowered or fewer organizations are configured",
+				existing+check.EstimatedCalls, org, available)
+		}
+	}
+	return check
+}
+
+// checkOrgAccess checks what the token can read of check.Organization: the
+// organization (or user:<login>), its repositories and their Actions runs.
+// It returns false when a check failed and the rest were left out.
+func checkOrgAccess(ctx context.Context, check *OrgCheck) bool {
+	org, user := parseAccount(check.Organization)
+	if err := budget.acquire(ctx); err != nil {
+		check.fail("%v: try again after the rate limit resets", err)
+		return false
+	}
+	var resp *github.Response
+	var err error
+	if user {
+		var details *github.User
+		details, resp, err = githubClient.Users.Get(ctx, org)
+		if err == nil && details.GetType() == "Organization" {
+			check.fail("%s is an organization: add it as %s, without user:", org, details.GetLogin())
+			return false
+		}
+		check.Repos = details.GetPublicRepos() + int(details.GetOwnedPrivateRepos())
+	} else {
+		var details *github.Organization
+		details, resp, err = githubClient.Organizations.Get(ctx, org)
+		check.Repos = details.GetPublicRepos() + int(details.GetTotalPrivateRepos())
+	}
+	budget.update(resp)
+	if err != nil {
+		check.fail("%s", orgAccessProblem(check.Organization, resp, err))
+		return false
+	}
+	// Only classic tokens have scopes, possibly none
+	if resp.Header.Values("X-OAuth-Scopes") != nil {
+		check.TokenScopes = splitList(resp.Header.Get("X-OAuth-Scopes"))
+		if !hasScope(check.TokenScopes, "repo") {
+			check.warn("GITHUB_TOKEN has no repo scope, so the private repositories of %s and their runs are left out: add the repo scope to the token", org)
+		}
+	}
+	// Other users' private repositories aren't listed, even when shared
+	if user {
+		if own, err := authenticatedLogin(ctx); err == nil && !strings.EqualFold(own, org) {
+			check.warn("GITHUB_TOKEN belongs to %s, so only the public repositories of %s are listed: use a token of %s for its private ones", own, org, org)
+		} else if githubTokens != nil {
+			check.warn("GITHUB_TOKEN holds several tokens, so only the public repositories of %s are listed: use a single token of %s for its private ones", org, org)
+		}
+	}
+	if maxReposPerOrg > 0 && check.Repos > maxReposPerOrg {
+		check.warn("%s has %d repositories, only the %d most recently pushed are listed: raise MAX_REPOS_PER_ORG or set it to 0", org, check.Repos, maxReposPerOrg)
+	}
+
+	// Repositories pushed to in the last week, most recent first, up to
+	// the first one that wasn't
+	window := newFetchWindow("week")
+	var active []*github.Repository
+	page := 1
+listing:
+	for {
+		if err := budget.acquire(ctx); err != nil {
+			check.warn("stopped counting active repositories: %v", err)
+			break
+		}
+		repos, resp, err := listAccountRepos(ctx, org, user, "pushed", page)
+		budget.update(resp)
+		if err != nil {
+			check.fail("%s", orgAccessProblem(check.Organization, resp, err))
+			return false
+		}
+		if sso := resp.Header.Get("X-GitHub-SSO"); strings.HasPrefix(sso, "partial-results") {
+			check.warn("GITHUB_TOKEN isn't authorized for the SAML SSO of every organization, so some repositories of %s may be missing: authorize it under the token's Configure SSO", org)
+		}
+		for _, repo := range repos {
+			if !window.contains(newOrgRepo(repo).activity()) {
+				break listing
+			}
+			active = append(active, repo)
+		}
+		if resp.NextPage == 0 || (maxReposPerOrg > 0 && len(active) >= maxReposPerOrg) {
+			break
+		}
+		page = resp.NextPage
+	}
+	check.ActiveRepos = len(active)
+	if check.Repos < check.ActiveRepos {
+		check.Repos = check.ActiveRepos // private repositories aren't counted for outside collaborators
+	}
+	if check.Repos == 0 {
+		check.fail("GITHUB_TOKEN sees no repositories in %s: for a fine-grained token, select the organization as resource owner with Actions and Metadata read access", org)
+		return false
+	}
+
+	// The token has to read Actions too, which fine-grained tokens and
+	// GitHub Apps get separately
+	if len(active) == 0 {
+		check.warn("no repository of %s was pushed to in the last 7 days, so there's nothing to show yet", org)
+	} else if err := budget.acquire(ctx); err == nil {
+		repo := active[0].GetName()
+		_, resp, err := githubClient.Actions.ListRepositoryWorkflowRuns(ctx, org, repo, &github.ListWorkflowRunsOptions{ListOptions: github.ListOptions{PerPage: 1}})
+		budget.update(resp)
+		if err != nil {
+			check.fail("GITHUB_TOKEN can't read the Actions runs of %s/%s (%v): give a fine-grained token Actions read access, or a classic token the repo scope", org, repo, err)
+			return false
+		}
+	}
+	return true
+}
+
+// estimateOrgCalls estimates the GitHub API calls an organization adds to
+// a refresh of the week: listing its repositories, plus the calls per
+// active repository the configured organizations take on average.
+func estimateOrgCalls(ctx context.Context, repos, active int) int {
+	list := 1 // the most recently pushed page while the repository list is cached
+	if repoCacheTTL <= 0 {
+		list = max(int(math.Ceil(float64(repos)/100)), 1)
+	}
+	perRepo := 1.0
+	if snap, err := loadSnapshot(ctx, "week"); err == nil && snap != nil {
+		if forecast := forecastRefresh("week", snap); forecast != nil {
+			calls, fetched := 0, 0
+			for _, org := range forecast.Orgs {
+				calls += org.EstimatedCalls - 1
+				fetched += org.Repos
+			}
+			if fetched > 0 {
+				perRepo = math.Max(1, float64(calls)/float64(fetched))
+			}
+		}
+	}
+	return list + int(math.Ceil(perRepo*float64(active)))
+}
+
+// orgAccessProblem explains why the token couldn't read an organization.
+func orgAccessProblem(org string, resp *github.Response, err error) string {
+	if resp == nil {
+		return fmt.Sprintf("error reading %s: %v", org, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "GITHUB_TOKEN is invalid or expired: create a new token"
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-GitHub-SSO") != "":
+		_, url, _ := strings.Cut(resp.Header.Get("X-GitHub-SSO"), "url=")
+		return fmt.Sprintf("%s enforces SAML SSO and GITHUB_TOKEN isn't authorized for it: authorize the token at %s", org, url)
+	case resp.StatusCode == http.StatusNotFound:
+		if login, user := parseAccount(org); user {
+			return fmt.Sprintf("user %s doesn't exist: check the login", login)
+		}
+		return fmt.Sprintf("organization %s doesn't exist or GITHUB_TOKEN can't see it: check the name, for a fine-grained token select %s as resource owner, and add a personal account as user:%s", org, org, org)
+	case resp.StatusCode == http.StatusForbidden:
+		return fmt.Sprintf("GITHUB_TOKEN may not read %s (%v): an owner may have to approve the token under Settings → Personal access tokens", org, err)
+	}
+	return fmt.Sprintf("error reading %s: %v", org, err)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// adminOrgsHandler serves /api/admin/orgs:
+//
+//	GET  ?org=acme  check an organization
+//	POST ?org=acme  check it and, when nothing's wrong, add it to github_orgs
+func adminOrgsHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+	org := strings.TrimSpace(r.URL.Query().Get("org"))
+	if org == "" || strings.ContainsAny(org, "/ ,") {
+		http.Error(w, "Expected ?org=<organization>", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	check := checkOrg(ctx, org)
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		status = http.StatusUnprocessableEntity
+		if check.OK {
+			err := updateRuntimeConfig(ctx, admin, func(cfg *RuntimeConfig) error {
+				orgs := append([]string{}, currentSettings().GitHubOrgs...)
+				orgs = append(orgs, org)
+				cfg.GitHubOrgs = &orgs
+				return nil
+			})
+			var invalid invalidConfigError
+			if err != nil && !errors.As(err, &invalid) {
+				http.Error(w, err.Error(), runtimeConfigErrorStatus(err))
+				return
+			}
+			if err != nil {
+				check.fail("%v", err)
+				check.OK = false
+			} else {
+				check.Added, status = true, http.StatusCreated
+				log.Printf("🛠️  %s added organization %s (%d repositories, %d active)", admin, org, check.Repos, check.ActiveRepos)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(check)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// OrgSummary is the rollup of one organization in a snapshot.
+type OrgSummary struct {
+	Organization string         `json:"organization"`
+	Provider     string         `json:"provider"`
+	ReposScanned int            `json:"repos_scanned"`
+	ReposSkipped int            `json:"repos_skipped"`          // not fetched because the rate limit budget ran out
+	ReposReused  int            `json:"repos_reused,omitempty"` // unchanged since the previous fetch, runs carried over (INCREMENTAL_SYNC)
+	Runs         int            `json:"runs"`
+	Stats        DashboardStats `json:"stats"`
+	SuccessRate  *float64       `json:"success_rate,omitempty"` // percentage of finished runs that succeeded
+	RateLimit    *RateLimitInfo `json:"rate_limit,omitempty"`   // of the token used for the organization
+	Error        string         `json:"error,omitempty"`
+}
+
+func (r orgResult) summary() OrgSummary {
+	summary := OrgSummary{
+		Organization: r.Org,
+		Provider:     r.Provider,
+		ReposScanned: r.Repos,
+		ReposSkipped: r.ReposSkipped,
+		ReposReused:  r.ReposReused,
+		Runs:         r.Collector.stats.Total,
+		Stats:        r.Collector.stats,
+		RateLimit:    r.RateLimit,
+	}
+	summary.SuccessRate = successRate(summary.Stats)
+	if r.Err != nil {
+		summary.Error = r.Err.Error()
+	}
+	return summary
+}
+
+type OrgsResponse struct {
+	Period    string       `json:"period"`
+	FetchedAt time.Time    `json:"fetched_at"`
+	Orgs      []OrgSummary `json:"orgs"`
+}
+
+// orgsHandler serves the per-organization rollups of a period, so
+// multi-org deployments can compare organizations at a glance.
+func orgsHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	orgs := append([]OrgSummary{}, snap.Orgs...)
+	for i := range orgs {
+		// Prefer the token's current rate limit over the one at fetch time
+		if src, ok := findSource(orgs[i].Provider, orgs[i].Organization); ok {
+			if rate := providerRateLimit(src.Provider); rate != nil {
+				orgs[i].RateLimit = rate
+			}
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Organization < orgs[j].Organization })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(OrgsResponse{Period: period, FetchedAt: snap.FetchedAt, Orgs: orgs})
+}
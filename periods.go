@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// PeriodStats is the stats of one of the periods of
+// /api/dashboard?period=today,week,month, so period tabs can show their
+// numbers without a request each.
+type PeriodStats struct {
+	Stats DashboardStats `json:"stats"`
+	DataFreshness
+}
+
+// parsePeriods reads a period or comma-separated list of periods, in
+// order and without duplicates. Unknown periods are replaced by "week",
+// like a missing one.
+func parsePeriods(value string) []string {
+	var periods []string
+	seen := make(map[string]bool)
+	for _, period := range strings.Split(value, ",") {
+		period = strings.TrimSpace(period)
+		if !validPeriod(period) {
+			period = "week" // Default: seminggu terakhir
+		}
+		if !seen[period] {
+			seen[period] = true
+			periods = append(periods, period)
+		}
+	}
+	return periods
+}
+
+// loadPeriods loads the snapshots of the periods from one fetch: that of
+// the period reaching back the furthest (week or month, depending on the
+// day of the month), fetched again first with ?refresh=true, which it
+// returns as source. The other periods are narrowed down from its runs.
+func loadPeriods(ctx context.Context, r *http.Request, periods []string) (snaps []*Snapshot, source int, err error) {
+	longest := periods[0]
+	for _, period := range periods[1:] {
+		if newFetchWindow(period).Start.Before(newFetchWindow(longest).Start) {
+			longest = period
+		}
+	}
+
+	var snap *Snapshot
+	// ?refresh=true skips the cache, like POST /api/refresh
+	if r.URL.Query().Get("refresh") == "true" {
+		log.Printf("🔄 Refresh requested for period %s from %s", longest, r.RemoteAddr)
+		snap, _, err = refreshDashboard(withRefreshTrigger(ctx, "refresh"), longest)
+	} else {
+		snap, err = getDashboard(ctx, longest)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	snaps = make([]*Snapshot, len(periods))
+	for i, period := range periods {
+		snaps[i] = snap
+		if period == longest {
+			source = i
+		} else {
+			snaps[i] = periodSnapshot(snap, period)
+		}
+	}
+	return snaps, source, nil
+}
+
+// periodSnapshot narrows a snapshot down to the runs of a shorter period,
+// by the time runToJob filters runs on. Stats are recomputed from those
+// runs, and the per-organization rollups and debug info left out.
+func periodSnapshot(snap *Snapshot, period string) *Snapshot {
+	window := newFetchWindow(period)
+	scoped := *snap
+	scoped.Response.Jobs = []Job{}
+	for _, job := range snap.Response.Jobs {
+		if window.contains(job.StartedAt) {
+			scoped.Response.Jobs = append(scoped.Response.Jobs, job)
+		}
+	}
+	scoped.Response.Stats = calculateStats(scoped.Response.Jobs)
+	scoped.Superseded = supersededStats(scoped.Response.Jobs)
+	scoped.Deduped, scoped.Runners = nil, nil
+	scoped.Debug, scoped.Orgs = nil, nil
+	return &scoped
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePeriods(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", []string{"week"}},
+		{"today", []string{"today"}},
+		{"today,week,month", []string{"today", "week", "month"}},
+		{"month, today", []string{"month", "today"}},
+		{"week,week,today", []string{"week", "today"}},
+		{"year,today", []string{"week", "today"}},
+		{"year,week", []string{"week"}},
+		{"today,,", []string{"today", "week"}},
+	}
+	for _, tt := range tests {
+		if got := parsePeriods(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePeriods(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
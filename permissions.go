@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions permissions audit: each GitHub organization's and repository's
+// Actions settings compared against a baseline, so repositories that
+// loosened them (write tokens by default, any action allowed, ...) stand out.
+
+// actionsBaseline is the accepted values per setting, from ACTIONS_BASELINE
+// ("setting=value|value,..."). Settings not in the baseline aren't checked.
+var actionsBaseline = map[string][]string{
+	"allowed_actions":                  {"selected", "local_only"},
+	"default_workflow_permissions":     {"read"},
+	"can_approve_pull_request_reviews": {"false"},
+	"fork_pr_approval":                 {"all_external_contributors", "first_time_contributors"},
+	"fork_pr_write_tokens":             {"false"},
+	"fork_pr_secrets":                  {"false"},
+}
+
+// permissionsAuditTTL is how long an organization's audit is reused; each
+// repository costs up to four calls.
+const permissionsAuditTTL = time.Hour
+
+var permissionsAudits = struct {
+	sync.Mutex
+	orgs map[string]OrgPermissions
+}{orgs: make(map[string]OrgPermissions)}
+
+// SettingDeviation is a setting whose value isn't in the baseline.
+type SettingDeviation struct {
+	Setting  string   `json:"setting"`
+	Value    string   `json:"value"`
+	Expected []string `json:"expected"`
+}
+
+type RepoPermissions struct {
+	Repository string             `json:"repository"`
+	Settings   map[string]string  `json:"settings"`
+	Deviations []SettingDeviation `json:"deviations"`
+	Error      string             `json:"error,omitempty"`
+}
+
+type OrgPermissions struct {
+	Organization   string             `json:"organization"`
+	Settings       map[string]string  `json:"settings"`
+	Deviations     []SettingDeviation `json:"deviations"`
+	ReposAudited   int                `json:"repos_audited"`
+	ReposDeviating int                `json:"repos_deviating"`
+	ReposSkipped   int                `json:"repos_skipped"` // not audited because the rate limit budget ran out
+	Repositories   []RepoPermissions  `json:"repositories"`  // deviating ones, or all with ?all=true
+	AuditedAt      time.Time          `json:"audited_at"`
+	Error          string             `json:"error,omitempty"`
+}
+
+type PermissionsAuditReport struct {
+	Baseline map[string][]string `json:"baseline"`
+	Orgs     []OrgPermissions    `json:"orgs"`
+}
+
+// loadPermissionsConfig reads ACTIONS_BASELINE, which replaces the default
+// baseline as a whole.
+func loadPermissionsConfig() {
+	env := os.Getenv("ACTIONS_BASELINE")
+	if env == "" {
+		return
+	}
+	actionsBaseline = make(map[string][]string)
+	for _, entry := range splitList(env) {
+		setting, values, ok := strings.Cut(entry, "=")
+		if !ok || setting == "" || values == "" {
+			log.Fatalf("Invalid ACTIONS_BASELINE entry %q: expected setting=value|value", entry)
+		}
+		actionsBaseline[strings.TrimSpace(setting)] = strings.Split(values, "|")
+	}
+}
+
+// deviations compares settings against the baseline, in setting order.
+func deviations(settings map[string]string) []SettingDeviation {
+	found := []SettingDeviation{}
+	for setting, expected := range actionsBaseline {
+		value, ok := settings[setting]
+		if !ok {
+			continue // not readable or not applicable, e.g. fork settings of public repositories
+		}
+		accepted := false
+		for _, candidate := range expected {
+			accepted = accepted || candidate == value
+		}
+		if !accepted {
+			found = append(found, SettingDeviation{Setting: setting, Value: value, Expected: expected})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Setting < found[j].Setting })
+	return found
+}
+
+// permissionsAuditHandler serves /api/audit/permissions. ?org= limits the
+// audit to one organization, ?all=true lists every repository instead of
+// only the deviating ones, and ?refresh=true skips the cached audit.
+func permissionsAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	all, refresh := query.Get("all") == "true", query.Get("refresh") == "true"
+
+	report := PermissionsAuditReport{Baseline: actionsBaseline, Orgs: []OrgPermissions{}}
+	for _, src := range currentSources() {
+		name := src.Provider.Name()
+		if (name != "github" && name != "demo") || (query.Get("org") != "" && src.Org != query.Get("org")) {
+			continue
+		}
+		audit := auditOrgPermissions(r.Context(), src, refresh)
+		if !all {
+			deviating := []RepoPermissions{}
+			for _, repo := range audit.Repositories {
+				if len(repo.Deviations) > 0 || repo.Error != "" {
+					deviating = append(deviating, repo)
+				}
+			}
+			audit.Repositories = deviating
+		}
+		report.Orgs = append(report.Orgs, audit)
+	}
+	sort.Slice(report.Orgs, func(i, j int) bool { return report.Orgs[i].Organization < report.Orgs[j].Organization })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(report)
+}
+
+// auditOrgPermissions returns the organization's audit, cached for
+// permissionsAuditTTL. Deviations are recomputed so a changed baseline
+// applies right away.
+func auditOrgPermissions(ctx context.Context, src source, refresh bool) OrgPermissions {
+	permissionsAudits.Lock()
+	audit, ok := permissionsAudits.orgs[src.Org]
+	permissionsAudits.Unlock()
+	if !ok || refresh || clock().Sub(audit.AuditedAt) >= permissionsAuditTTL {
+		audit = fetchOrgPermissions(ctx, src)
+		if audit.Error == "" {
+			permissionsAudits.Lock()
+			permissionsAudits.orgs[src.Org] = audit
+			permissionsAudits.Unlock()
+		}
+	}
+
+	result := audit
+	result.Deviations = deviations(audit.Settings)
+	result.ReposDeviating = 0
+	result.Repositories = make([]RepoPermissions, len(audit.Repositories))
+	for i, repo := range audit.Repositories {
+		repo.Deviations = deviations(repo.Settings)
+		if len(repo.Deviations) > 0 {
+			result.ReposDeviating++
+		}
+		result.Repositories[i] = repo
+	}
+	return result
+}
+
+func fetchOrgPermissions(ctx context.Context, src source) OrgPermissions {
+	audit := OrgPermissions{Organization: src.Org, AuditedAt: clock(), Repositories: []RepoPermissions{}}
+	if demoMode {
+		audit.Settings = demoActionsSettings(src.Org, "")
+		for _, repo := range demoRepos {
+			audit.Repositories = append(audit.Repositories, RepoPermissions{Repository: src.Org + "/" + repo, Settings: demoActionsSettings(src.Org, repo)})
+		}
+		audit.ReposAudited = len(audit.Repositories)
+		return audit
+	}
+
+	log.Printf("🔐 Auditing Actions permissions of %s", src.Org)
+	// Personal accounts only have repository settings
+	if !isGitHubUser(src.Org) {
+		settings, err := orgActionsSettings(ctx, src.Org)
+		audit.Settings = settings
+		if err != nil {
+			audit.Error = err.Error()
+			return audit
+		}
+	}
+	repos, err := listComplianceRepos(ctx, src.Org)
+	if err != nil {
+		audit.Error = err.Error()
+		return audit
+	}
+	for i, repo := range repos {
+		settings, err := repoActionsSettings(ctx, src.Org, repo)
+		if errors.Is(err, errBudgetExhausted) {
+			audit.ReposSkipped = len(repos) - i
+			log.Printf("   ⏸️  Skipping the permissions audit of %d remaining repositories in %s: %v", audit.ReposSkipped, src.Org, err)
+			break
+		}
+		result := RepoPermissions{Repository: src.Org + "/" + repo.Name, Settings: settings}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		audit.Repositories = append(audit.Repositories, result)
+		audit.ReposAudited++
+	}
+	log.Printf("✅ Audited Actions permissions of %d repositories in %s", audit.ReposAudited, src.Org)
+	return audit
+}
+
+// orgActionsSettings reads the organization-wide Actions settings.
+func orgActionsSettings(ctx context.Context, org string) (map[string]string, error) {
+	settings := make(map[string]string)
+	permissions, resp, err := githubClient.Actions.GetActionsPermissions(ctx, org)
+	budget.update(resp)
+	if err != nil {
+		return settings, err
+	}
+	settings["enabled_repositories"] = permissions.GetEnabledRepositories()
+	settings["allowed_actions"] = permissions.GetAllowedActions()
+
+	if err := readSettings(ctx, "orgs/"+org+"/actions/permissions/workflow", settings, workflowPermissionSettings); err != nil {
+		return settings, err
+	}
+	err = readSettings(ctx, "orgs/"+org+"/actions/permissions/fork-pr-contributor-approval", settings, forkApprovalSettings)
+	return settings, err
+}
+
+// repoActionsSettings reads a repository's Actions settings. Fork pull
+// request settings differ between public and private repositories.
+func repoActionsSettings(ctx context.Context, org string, repo complianceRepo) (map[string]string, error) {
+	settings := make(map[string]string)
+	if err := budget.acquire(ctx); err != nil {
+		return settings, err
+	}
+	permissions, resp, err := githubClient.Repositories.GetActionsPermissions(ctx, org, repo.Name)
+	budget.update(resp)
+	if err != nil {
+		return settings, err
+	}
+	settings["enabled"] = strconv.FormatBool(permissions.GetEnabled())
+	if !permissions.GetEnabled() {
+		return settings, nil // nothing else applies
+	}
+	if permissions.AllowedActions != nil {
+		settings["allowed_actions"] = permissions.GetAllowedActions()
+	}
+
+	base := "repos/" + org + "/" + repo.Name + "/actions/permissions/"
+	if err := readSettings(ctx, base+"workflow", settings, workflowPermissionSettings); err != nil {
+		return settings, err
+	}
+	if repo.Private {
+		return settings, readSettings(ctx, base+"fork-pr-workflows-private-repos", settings, privateForkSettings)
+	}
+	return settings, readSettings(ctx, base+"fork-pr-contributor-approval", settings, forkApprovalSettings)
+}
+
+// Settings endpoints go-github doesn't cover, by response field.
+var (
+	workflowPermissionSettings = map[string]string{
+		"default_workflow_permissions":     "default_workflow_permissions",
+		"can_approve_pull_request_reviews": "can_approve_pull_request_reviews",
+	}
+	forkApprovalSettings = map[string]string{
+		"approval_policy": "fork_pr_approval",
+	}
+	privateForkSettings = map[string]string{
+		"run_workflows_from_fork_pull_requests": "fork_pr_workflows",
+		"send_write_tokens_to_workflows":        "fork_pr_write_tokens",
+		"send_secrets_and_variables":            "fork_pr_secrets",
+	}
+)
+
+// readSettings reads a settings endpoint into settings. Endpoints the
+// GitHub version doesn't have (404) are skipped.
+func readSettings(ctx context.Context, url string, settings map[string]string, fields map[string]string) error {
+	req, err := githubClient.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	var body map[string]interface{}
+	resp, err := githubClient.Do(ctx, req, &body)
+	budget.update(resp)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	for field, setting := range fields {
+		if value, ok := body[field]; ok && value != nil {
+			settings[setting] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
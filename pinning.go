@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Pinning audit: third-party actions referenced by a tag or branch, which
+// their owner can move to different code at any time, instead of by a full
+// commit SHA.
+
+// trustedActionOwners are owners whose actions may be used unpinned. The
+// organization's own actions are always trusted. PINNING_TRUSTED_OWNERS
+// replaces the list.
+var trustedActionOwners = []string{"actions", "github"}
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// UnpinnedUsage is one reference to a third-party action by tag or branch.
+type UnpinnedUsage struct {
+	Action     string `json:"action"`
+	Ref        string `json:"ref"`
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+}
+
+// UnpinnedAction sums up the unpinned references to one action.
+type UnpinnedAction struct {
+	Action       string   `json:"action"`
+	Refs         []string `json:"refs"`
+	Uses         int      `json:"uses"`
+	Repositories int      `json:"repositories"`
+}
+
+type OrgPinning struct {
+	Organization  string           `json:"organization"`
+	ReposScanned  int              `json:"repos_scanned"`
+	ReposSkipped  int              `json:"repos_skipped"` // not scanned because the rate limit budget ran out
+	FilesScanned  int              `json:"files_scanned"`
+	References    int              `json:"references"` // to third-party actions
+	Pinned        int              `json:"pinned"`
+	Unpinned      int              `json:"unpinned"`
+	ReposAffected int              `json:"repos_affected"`
+	Actions       []UnpinnedAction `json:"actions"` // most used first
+	Usages        []UnpinnedUsage  `json:"usages"`
+	Error         string           `json:"error,omitempty"`
+}
+
+type PinningReport struct {
+	TrustedOwners []string     `json:"trusted_owners"`
+	Orgs          []OrgPinning `json:"orgs"`
+}
+
+func loadPinningConfig() {
+	if env := os.Getenv("PINNING_TRUSTED_OWNERS"); env != "" {
+		trustedActionOwners = splitList(strings.ToLower(env))
+	}
+}
+
+// pinningHandler serves /api/audit/pinning, the third-party actions used
+// without a commit SHA. ?org= limits the report to one organization,
+// ?refresh=true rescans the workflow files.
+func pinningHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	report := PinningReport{TrustedOwners: trustedActionOwners, Orgs: []OrgPinning{}}
+	for _, src := range currentSources() {
+		name := src.Provider.Name()
+		if (name != "github" && name != "demo") || (query.Get("org") != "" && src.Org != query.Get("org")) {
+			continue
+		}
+		scan := scanWorkflows(r.Context(), src.Org, query.Get("refresh") == "true")
+		result := findUnpinned(src.Org, scan.Files)
+		result.ReposScanned, result.ReposSkipped = scan.Repos, scan.ReposSkipped
+		if scan.Err != nil {
+			result.Error = scan.Err.Error()
+		}
+		report.Orgs = append(report.Orgs, result)
+	}
+	sort.Slice(report.Orgs, func(i, j int) bool { return report.Orgs[i].Organization < report.Orgs[j].Organization })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(report)
+}
+
+func findUnpinned(org string, files []workflowSource) OrgPinning {
+	result := OrgPinning{Organization: org, FilesScanned: len(files), Actions: []UnpinnedAction{}, Usages: []UnpinnedUsage{}}
+	actions := make(map[string]*UnpinnedAction)
+	refs := make(map[string]map[string]bool)
+	repos := make(map[string]map[string]bool)
+	affected := make(map[string]bool)
+
+	for _, file := range files {
+		for _, use := range file.uses() {
+			owner, _, _ := strings.Cut(strings.ToLower(use.Action), "/")
+			if owner == strings.ToLower(org) || slices.Contains(trustedActionOwners, owner) {
+				continue
+			}
+			result.References++
+			if commitSHA.MatchString(use.Ref) {
+				result.Pinned++
+				continue
+			}
+			result.Unpinned++
+			result.Usages = append(result.Usages, UnpinnedUsage{Action: use.Action, Ref: use.Ref, Repository: file.Repository, Path: file.Path, Line: use.Line})
+
+			action, ok := actions[use.Action]
+			if !ok {
+				action = &UnpinnedAction{Action: use.Action}
+				actions[use.Action] = action
+				refs[use.Action] = make(map[string]bool)
+				repos[use.Action] = make(map[string]bool)
+			}
+			action.Uses++
+			refs[use.Action][use.Ref] = true
+			repos[use.Action][file.Repository] = true
+			affected[file.Repository] = true
+		}
+	}
+
+	for name, action := range actions {
+		for ref := range refs[name] {
+			action.Refs = append(action.Refs, ref)
+		}
+		sort.Strings(action.Refs)
+		action.Repositories = len(repos[name])
+		result.Actions = append(result.Actions, *action)
+	}
+	result.ReposAffected = len(affected)
+	sort.Slice(result.Actions, func(i, j int) bool {
+		a, b := result.Actions[i], result.Actions[j]
+		if a.Uses != b.Uses {
+			return a.Uses > b.Uses
+		}
+		return a.Action < b.Action
+	})
+	sort.SliceStable(result.Usages, func(i, j int) bool {
+		a, b := result.Usages[i], result.Usages[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	return result
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Background polling (POLL_INTERVAL): the prewarmed periods are refreshed
+// on a schedule instead of when a request finds them expired, so requests
+// are served from the store without waiting for GitHub. Every replica
+// polls, but a period another replica refreshed less than half an interval
+// ago is left alone, and the fetch lock keeps two replicas from fetching
+// it at once.
+
+// pollInterval is how often the prewarmed periods are refreshed. Zero
+// disables polling. It can be changed at runtime, under runtimeMu (see
+// adminconfig.go).
+var pollInterval time.Duration
+
+func currentPollInterval() time.Duration {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return pollInterval
+}
+
+// pollDashboards refreshes the prewarmed periods every poll interval, after
+// prewarm fetched them on startup. POLL_INTERVAL and CACHE_TTL can be
+// changed at runtime, so they're checked on every tick, like nextPoll does;
+// while polling is off, every runtimeConfigPoll.
+func pollDashboards() {
+	lastInterval, lastTTL := time.Duration(0), time.Duration(-1)
+	for {
+		interval := currentPollInterval()
+		if interval != lastInterval {
+			if interval > 0 {
+				log.Printf("⏱️  Refreshing %v every %v", prewarmPeriods, interval)
+			} else {
+				log.Printf("⏱️  Stopped refreshing %v", prewarmPeriods)
+			}
+			lastInterval, lastTTL = interval, -1
+		}
+		if interval <= 0 {
+			time.Sleep(runtimeConfigPoll)
+			continue
+		}
+		time.Sleep(interval)
+
+		ttl := currentCacheTTL()
+		if ttl != lastTTL {
+			switch {
+			case ttl <= 0:
+				log.Printf("⚠️  POLL_INTERVAL is ignored with CACHE_TTL=0: nothing is cached")
+			case ttl < interval:
+				log.Printf("⚠️  CACHE_TTL (%v) is shorter than POLL_INTERVAL (%v): requests in between still start refreshes", ttl, interval)
+			}
+			lastTTL = ttl
+		}
+		if ttl <= 0 {
+			continue
+		}
+		for _, period := range prewarmPeriods {
+			pollPeriod(period, interval)
+		}
+	}
+}
+
+func pollPeriod(period string, interval time.Duration) {
+	ctx, cancel := context.WithTimeout(withRefreshTrigger(context.Background(), "poll"), max(interval, fetchLockTTL))
+	defer cancel()
+	if _, err := loadDashboard(ctx, period, time.Now().Add(-interval/2)); err != nil {
+		log.Printf("❌ Polling %s failed: %v", period, err)
+	}
+}
+
+// nextPoll returns when the period is next refreshed by polling, nil when
+// it isn't polled.
+func nextPoll(period string, fetchedAt time.Time) *time.Time {
+	interval := currentPollInterval()
+	if interval <= 0 || currentCacheTTL() <= 0 {
+		return nil
+	}
+	for _, polled := range prewarmPeriods {
+		if polled == period {
+			next := fetchedAt.Add(interval)
+			return &next
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// fetchRunJobs lists all jobs of a workflow run (latest attempt).
+func fetchRunJobs(ctx context.Context, owner, repo string, runID int64) ([]*github.WorkflowJob, error) {
+	var jobs []*github.WorkflowJob
+	opts := &github.ListWorkflowJobsOptions{
+		Filter:      "latest",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		if err := budget.acquire(ctx); err != nil {
+			return nil, err
+		}
+		runCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+		page, resp, err := githubClient.Actions.ListWorkflowJobs(runCtx, owner, repo, runID, opts)
+		cancel()
+		budget.update(resp)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, page.Jobs...)
+		if resp.NextPage == 0 {
+			return jobs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// countSteps counts the finished and total steps over all jobs of a run.
+func countSteps(jobs []*github.WorkflowJob) (completed, total int) {
+	for _, job := range jobs {
+		for _, step := range job.Steps {
+			total++
+			if strings.EqualFold(step.GetStatus(), "completed") {
+				completed++
+			}
+		}
+	}
+	return completed, total
+}
+
+// needsRunJobs reports whether the jobs of a run are worth fetching: for
+// step progress of running runs, for matrix legs (see MATRIX_EXPANSION),
+// or for the runner minutes of finished runs (see COST_ESTIMATION).
+func needsRunJobs(job Job) bool {
+	return job.Status == "running" || expandMatrix(job.Status) || ((costEstimation || runnerStats) && finished(job))
+}
+
+func finished(job Job) bool {
+	return job.Status == "success" || job.Status == "failed"
+}
+
+// addRunJobs fetches the jobs of a run and derives its step progress,
+// matrix legs, runner minutes, runner usage and self-hosted runners from
+// them.
+func addRunJobs(ctx context.Context, job *Job) error {
+	jobs, err := fetchRunJobs(ctx, job.Organization, job.Pipeline, job.RunID)
+	if err != nil {
+		return err
+	}
+	if job.Status == "running" {
+		completed, total := countSteps(jobs)
+		job.StepsCompleted = &completed
+		job.StepsTotal = &total
+	}
+	if expandMatrix(job.Status) {
+		job.MatrixLegs = matrixLegs(jobs)
+	}
+	if costEstimation && finished(*job) {
+		job.RunnerMinutes = runnerMinutes(jobs)
+	}
+	if finished(*job) {
+		job.Runners = runnerUsage(jobs)
+		job.RunnerJobs = runnerJobs(jobs)
+	}
+	return nil
+}
+
+type workflowKey struct {
+	org        string
+	repo       string
+	workflowID int64
+}
+
+// addMedianDurations sets MedianDurationSeconds on running jobs from the
+// successful runs of the same workflow, so clients can show an ETA.
+func addMedianDurations(jobs []Job) {
+	durations := make(map[workflowKey][]int64)
+	for _, job := range jobs {
+		if job.Status == "success" && job.DurationSeconds > 0 {
+			key := workflowKey{job.Organization, job.Pipeline, job.WorkflowID}
+			durations[key] = append(durations[key], job.DurationSeconds)
+		}
+	}
+
+	for i := range jobs {
+		if jobs[i].Status != "running" {
+			continue
+		}
+		values := durations[workflowKey{jobs[i].Organization, jobs[i].Pipeline, jobs[i].WorkflowID}]
+		if len(values) == 0 {
+			continue
+		}
+		median := medianInt64(values)
+		jobs[i].MedianDurationSeconds = &median
+	}
+}
+
+func medianInt64(values []int64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// updateElapsed sets how long running jobs have been running as of now.
+func updateElapsed(jobs []Job) {
+	now := clock()
+	for i := range jobs {
+		if jobs[i].Status != "running" || jobs[i].StartedAt.IsZero() {
+			jobs[i].ElapsedSeconds = nil
+			continue
+		}
+		elapsed := int64(now.Sub(jobs[i].StartedAt).Seconds())
+		if elapsed < 0 {
+			elapsed = 0 // queued, not started yet
+		}
+		jobs[i].ElapsedSeconds = &elapsed
+	}
+}
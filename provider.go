@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Pipeline is what a CI system runs builds for: a GitHub repository, a
+// GitLab project or a Jenkins job. Its runs are shown under Job.Pipeline.
+type Pipeline struct {
+	Org           string
+	Name          string
+	DefaultBranch string
+	Branch        string    // set when the pipeline only builds one branch, e.g. a Jenkins multibranch job
+	ID            string    // provider-specific ID, when the name isn't enough to query runs
+	ActiveAt      time.Time // last activity, e.g. a push; zero when unknown (see INCREMENTAL_SYNC)
+}
+
+// Provider is a CI system the dashboard shows runs from. Providers convert
+// their runs into the common Job model, so everything after fetching
+// (stats, caching, streaming) works the same for every CI system.
+type Provider interface {
+	// Name identifies the provider in Job.Provider, e.g. "github".
+	Name() string
+
+	// ListPipelines returns the organization's pipelines that were active
+	// during the window, most recently active first.
+	ListPipelines(ctx context.Context, window fetchWindow, org string) ([]Pipeline, error)
+
+	// ListRuns returns the runs of a pipeline that fall inside the window.
+	// It returns errBudgetExhausted when the provider's API budget is used
+	// up, which skips the remaining pipelines of the organization.
+	ListRuns(ctx context.Context, window fetchWindow, pipeline Pipeline) ([]Job, error)
+
+	// GetLogs returns the log output of a run as plain text.
+	GetLogs(ctx context.Context, pipeline Pipeline, runID int64) (string, error)
+}
+
+// rateLimiter is implemented by providers whose API has a rate limit worth
+// showing on the dashboard.
+type rateLimiter interface {
+	RateLimit() *RateLimitInfo
+}
+
+// source is one organization of one provider. Every source is fetched
+// concurrently.
+type source struct {
+	Provider Provider
+	Org      string
+}
+
+// sources is set up from the environment; the GitHub organizations can be
+// changed at runtime (see adminconfig.go), so it's read with
+// currentSources.
+var sources []source
+
+func currentSources() []source {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return sources
+}
+
+// maxLogBytes caps the log output returned by GetLogs.
+const maxLogBytes = 5 << 20
+
+var errLogsNotFound = errors.New("logs not found")
+
+// findSource returns the source for a provider name and organization.
+func findSource(provider, org string) (source, bool) {
+	for _, src := range currentSources() {
+		if src.Provider.Name() == provider && src.Org == org {
+			return src, true
+		}
+	}
+	return source{}, false
+}
+
+// logsHandler serves the logs of a run:
+// /api/logs?provider=github&org=...&pipeline=...&run_id=...
+func logsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	runID, err := strconv.ParseInt(query.Get("run_id"), 10, 64)
+	if err != nil || query.Get("pipeline") == "" {
+		http.Error(w, "pipeline and a numeric run_id are required", http.StatusBadRequest)
+		return
+	}
+	providerName := query.Get("provider")
+	if providerName == "" {
+		providerName = "github"
+	}
+	src, ok := findSource(providerName, query.Get("org"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown organization %q for provider %q", query.Get("org"), providerName), http.StatusNotFound)
+		return
+	}
+
+	if !viewerFrom(r).canSee(Job{Provider: providerName, Organization: src.Org, Pipeline: query.Get("pipeline")}) {
+		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
+		return
+	}
+
+	logs, err := src.Provider.GetLogs(r.Context(), Pipeline{Org: src.Org, Name: query.Get("pipeline")}, runID)
+	if errors.Is(err, errLogsNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error fetching logs of run %d in %s/%s: %v", runID, src.Org, query.Get("pipeline"), err)
+		http.Error(w, fmt.Sprintf("Error fetching logs: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	fmt.Fprint(w, logs)
+}
+
+// apiError is a non-2xx response from a provider's REST API.
+type apiError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URL, e.Status)
+}
+
+// apiGet sends an authenticated GET request to a provider's REST API. The
+// caller must close the body of the returned response.
+func apiGet(ctx context.Context, client *http.Client, url string, auth func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if auth != nil {
+		auth(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &apiError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp, nil
+}
+
+// apiGetJSON is apiGet decoding the JSON response into out. It returns the
+// response headers, which carry pagination and rate limits.
+func apiGetJSON(ctx context.Context, client *http.Client, url string, auth func(*http.Request), out interface{}) (http.Header, error) {
+	resp, err := apiGet(ctx, client, url, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", url, err)
+	}
+	return resp.Header, nil
+}
+
+// apiGetText is apiGet returning the body as text, up to limit bytes.
+func apiGetText(ctx context.Context, client *http.Client, url string, auth func(*http.Request), limit int64) (string, error) {
+	resp, err := apiGet(ctx, client, url, auth)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	return string(body), err
+}
+
+// isNotFound reports whether err is a 404 from a provider's API.
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
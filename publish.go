@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// publishConfig publishes an org-health summary back to GitHub as a commit
+// status or check run on a designated repository, so build health shows up
+// inside GitHub and can gate e.g. a release train branch.
+var publishConfig struct {
+	owner, repo    string
+	ref            string  // branch whose head commit gets the status
+	context        string  // status context, or check run name
+	mode           string  // "status" or "check"
+	period         string  // snapshot period the summary is computed from
+	maxFailureRate float64 // above this the status is a failure
+
+	mu   sync.Mutex
+	last string // last published commit, state and description, to skip no-op updates
+}
+
+// loadPublishConfig enables publishing when PUBLISH_STATUS_REPO is set.
+func loadPublishConfig() {
+	target := strings.TrimSpace(os.Getenv("PUBLISH_STATUS_REPO"))
+	if target == "" {
+		return
+	}
+	owner, repo, ok := strings.Cut(target, "/")
+	if !ok || owner == "" || repo == "" {
+		log.Fatalf("Invalid PUBLISH_STATUS_REPO %q: expected owner/repo", target)
+	}
+	publishConfig.owner, publishConfig.repo = owner, repo
+	publishConfig.ref = getEnvString("PUBLISH_STATUS_REF", "main")
+	publishConfig.context = getEnvString("PUBLISH_STATUS_CONTEXT", "ci-dashboard/org-health")
+	publishConfig.period = getEnvString("PUBLISH_STATUS_PERIOD", "today")
+	if !validPeriod(publishConfig.period) {
+		log.Fatalf("Invalid PUBLISH_STATUS_PERIOD %q", publishConfig.period)
+	}
+	publishConfig.mode = getEnvString("PUBLISH_STATUS_MODE", "status")
+	if publishConfig.mode != "status" && publishConfig.mode != "check" {
+		log.Fatalf("Invalid PUBLISH_STATUS_MODE %q (expected status or check)", publishConfig.mode)
+	}
+	publishConfig.maxFailureRate = 0.1
+	if env := os.Getenv("PUBLISH_STATUS_MAX_FAILURE_RATE"); env != "" {
+		rate, err := strconv.ParseFloat(env, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			log.Fatalf("Invalid PUBLISH_STATUS_MAX_FAILURE_RATE %q (expected 0 to 1)", env)
+		}
+		publishConfig.maxFailureRate = rate
+	}
+	log.Printf("📣 Publishing org health as %s %q on %s@%s", publishConfig.mode, publishConfig.context, target, publishConfig.ref)
+}
+
+// orgHealth is the summary that gets published.
+type orgHealth struct {
+	state       string // success or failure
+	description string
+	summary     string // markdown table per organization, for check runs
+}
+
+func summarizeHealth(snap *Snapshot) orgHealth {
+	stats := snap.Response.Stats
+	finished := stats.Success + stats.Failed
+	rate := 0.0
+	if finished > 0 {
+		rate = float64(stats.Failed) / float64(finished)
+	}
+
+	health := orgHealth{state: "success"}
+	if rate > publishConfig.maxFailureRate {
+		health.state = "failure"
+	}
+	health.description = fmt.Sprintf("%.0f%% success (%d failed / %d runs, %s)", (1-rate)*100, stats.Failed, finished, publishConfig.period)
+	if finished == 0 {
+		health.description = fmt.Sprintf("No finished runs (%s)", publishConfig.period)
+	}
+
+	type counts struct{ success, failed int }
+	orgs := make(map[string]*counts)
+	for _, job := range snap.Response.Jobs {
+		c, ok := orgs[job.Organization]
+		if !ok {
+			c = &counts{}
+			orgs[job.Organization] = c
+		}
+		switch job.Status {
+		case "success":
+			c.success++
+		case "failed":
+			c.failed++
+		}
+	}
+	names := make([]string, 0, len(orgs))
+	for name := range orgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("| Organization | Success | Failed | Success rate |\n|---|---|---|---|\n")
+	for _, name := range names {
+		c := orgs[name]
+		successRate := "-"
+		if c.success+c.failed > 0 {
+			successRate = fmt.Sprintf("%.0f%%", float64(c.success)/float64(c.success+c.failed)*100)
+		}
+		fmt.Fprintf(&b, "| %s | %d | %d | %s |\n", name, c.success, c.failed, successRate)
+	}
+	fmt.Fprintf(&b, "\nThreshold: at most %.0f%% failed runs. Fetched %s.\n", publishConfig.maxFailureRate*100, snap.FetchedAt.UTC().Format(time.RFC3339))
+	health.summary = b.String()
+	return health
+}
+
+// publishHealth publishes the summary of a freshly fetched snapshot in the
+// background. A summary already published on the branch's head commit isn't
+// published again.
+func publishHealth(period string, snap *Snapshot) {
+	if publishConfig.owner == "" || period != publishConfig.period || githubClient == nil {
+		return
+	}
+	health := summarizeHealth(snap)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := publish(ctx, health); err != nil {
+			log.Printf("⚠️  Error publishing org health to %s/%s: %v", publishConfig.owner, publishConfig.repo, err)
+		}
+	}()
+}
+
+func publish(ctx context.Context, health orgHealth) error {
+	branch, _, err := githubClient.Repositories.GetBranch(ctx, publishConfig.owner, publishConfig.repo, publishConfig.ref, 1)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", publishConfig.ref, err)
+	}
+	sha := branch.GetCommit().GetSHA()
+
+	key := sha + "|" + health.state + "|" + health.description
+	publishConfig.mu.Lock()
+	if key == publishConfig.last {
+		publishConfig.mu.Unlock()
+		return nil
+	}
+	publishConfig.mu.Unlock()
+
+	if publishConfig.mode == "check" {
+		// Check runs can only be created with a GitHub App token
+		conclusion := health.state
+		_, _, err = githubClient.Checks.CreateCheckRun(ctx, publishConfig.owner, publishConfig.repo, github.CreateCheckRunOptions{
+			Name:        publishConfig.context,
+			HeadSHA:     sha,
+			Status:      github.String("completed"),
+			Conclusion:  &conclusion,
+			CompletedAt: &github.Timestamp{Time: time.Now()},
+			Output: &github.CheckRunOutput{
+				Title:   github.String(health.description),
+				Summary: github.String(health.summary),
+			},
+		})
+	} else {
+		_, _, err = githubClient.Repositories.CreateStatus(ctx, publishConfig.owner, publishConfig.repo, sha, &github.RepoStatus{
+			State:       github.String(health.state),
+			Context:     github.String(publishConfig.context),
+			Description: github.String(truncateDescription(health.description)),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	publishConfig.mu.Lock()
+	publishConfig.last = key
+	publishConfig.mu.Unlock()
+	log.Printf("📣 Published org health to %s/%s@%s: %s, %s", publishConfig.owner, publishConfig.repo, sha[:7], health.state, health.description)
+	return nil
+}
+
+// truncateDescription keeps a commit status description within GitHub's
+// 140 character limit.
+func truncateDescription(description string) string {
+	if len(description) <= 140 {
+		return description
+	}
+	return description[:137] + "..."
+}
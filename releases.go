@@ -0,0 +1,296 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// releaseTagPattern recognizes tag pushes: GitHub reports the tag as the
+// run's head branch, so a ref that looks like a version is taken as a tag.
+// Runs of the release event are always release runs.
+var releaseTagPattern = regexp.MustCompile(`^v?[0-9]+\.[0-9]+`)
+
+// releaseArtifacts caches the artifacts of finished release runs, which
+// don't change anymore until they expire: up to maxCachedArtifactRuns
+// runs, the least recently used dropped first, each for
+// releaseArtifactsTTL.
+var releaseArtifacts = newArtifactCache(maxCachedArtifactRuns, releaseArtifactsTTL)
+
+const (
+	maxCachedArtifactRuns = 1000
+	// releaseArtifactsTTL re-lists the artifacts now and then, which
+	// expire after the repository's retention period
+	releaseArtifactsTTL = 24 * time.Hour
+)
+
+// artifactEntry is the cached artifact listing of a run.
+type artifactEntry struct {
+	runID     int64
+	artifacts []ReleaseArtifact
+	cachedAt  time.Time
+}
+
+// artifactCache keeps the artifacts of the most recently used runs, like
+// etagCache.
+type artifactCache struct {
+	mu      sync.Mutex
+	maxRuns int
+	ttl     time.Duration
+	order   *list.List // of *artifactEntry, most recently used first
+	byRunID map[int64]*list.Element
+}
+
+func newArtifactCache(maxRuns int, ttl time.Duration) *artifactCache {
+	return &artifactCache{maxRuns: maxRuns, ttl: ttl, order: list.New(), byRunID: make(map[int64]*list.Element)}
+}
+
+func (c *artifactCache) get(runID int64) ([]ReleaseArtifact, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.byRunID[runID]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*artifactEntry)
+	if time.Since(entry.cachedAt) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.byRunID, runID)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.artifacts, true
+}
+
+func (c *artifactCache) put(runID int64, artifacts []ReleaseArtifact) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.byRunID[runID]; ok {
+		c.order.Remove(elem)
+	}
+	c.byRunID[runID] = c.order.PushFront(&artifactEntry{runID: runID, artifacts: artifacts, cachedAt: time.Now()})
+	for c.order.Len() > c.maxRuns {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byRunID, oldest.Value.(*artifactEntry).runID)
+	}
+}
+
+// maxArtifactFetches caps the artifact listings fetched per request.
+const maxArtifactFetches = 30
+
+type Release struct {
+	Repository string            `json:"repository"`
+	Provider   string            `json:"provider"`
+	Tag        string            `json:"tag"`
+	Status     string            `json:"status"` // failed if any workflow failed, running while any is unfinished
+	CreatedAt  time.Time         `json:"created_at"`
+	HTMLURL    string            `json:"html_url"`
+	Workflows  []ReleaseWorkflow `json:"workflows"`
+	Artifacts  []ReleaseArtifact `json:"artifacts"`
+}
+
+type ReleaseWorkflow struct {
+	Workflow        string `json:"workflow"`
+	Event           string `json:"event"`
+	Status          string `json:"status"`
+	RunID           int64  `json:"run_id"`
+	DurationSeconds int64  `json:"duration_seconds"`
+	HTMLURL         string `json:"html_url"`
+}
+
+type ReleaseArtifact struct {
+	Name        string `json:"name"`
+	Workflow    string `json:"workflow"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Expired     bool   `json:"expired"`
+	DownloadURL string `json:"download_url,omitempty"` // API URL, needs a token
+}
+
+type ReleasesResponse struct {
+	Period    string    `json:"period"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Releases  []Release `json:"releases"`
+}
+
+// loadReleaseConfig reads RELEASE_TAG_PATTERN, the regular expression tag
+// names are recognized by.
+func loadReleaseConfig() {
+	if env := os.Getenv("RELEASE_TAG_PATTERN"); env != "" {
+		pattern, err := regexp.Compile(env)
+		if err != nil {
+			log.Fatalf("Invalid RELEASE_TAG_PATTERN %q: %v", env, err)
+		}
+		releaseTagPattern = pattern
+	}
+}
+
+// releaseTag returns the tag a run built, or "" for branch builds.
+func releaseTag(job Job) string {
+	switch job.Event {
+	case "release":
+		return job.Branch
+	case "push", "workflow_dispatch", "create":
+		if releaseTagPattern.MatchString(job.Branch) {
+			return job.Branch
+		}
+	}
+	return ""
+}
+
+// releasesHandler serves /api/releases, every release tag built in the
+// period with the outcome of its workflows and the artifacts they produced.
+func releasesHandler(w http.ResponseWriter, r *http.Request) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	repo := strings.Trim(r.URL.Query().Get("repo"), "/") // optional org/repo
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	releases := make(map[string]*Release)
+	latest := make(map[string]map[string]Job) // newest run per release and workflow, reruns replace earlier runs
+	for _, job := range snap.Response.Jobs {
+		tag := releaseTag(job)
+		if tag == "" || (repo != "" && job.Organization+"/"+job.Pipeline != repo) {
+			continue
+		}
+		key := job.Provider + "|" + job.Organization + "/" + job.Pipeline + "|" + tag
+		release, ok := releases[key]
+		if !ok {
+			release = &Release{
+				Repository: job.Organization + "/" + job.Pipeline,
+				Provider:   job.Provider,
+				Tag:        tag,
+				CreatedAt:  job.CreatedAt,
+			}
+			if job.Provider == "github" {
+				release.HTMLURL = fmt.Sprintf("%s/%s/releases/tag/%s", githubWebURL, release.Repository, tag)
+			}
+			releases[key] = release
+			latest[key] = make(map[string]Job)
+		}
+		if job.CreatedAt.Before(release.CreatedAt) {
+			release.CreatedAt = job.CreatedAt
+		}
+		workflow := workflowName(job.Name)
+		if previous, ok := latest[key][workflow]; !ok || job.CreatedAt.After(previous.CreatedAt) {
+			latest[key][workflow] = job
+		}
+	}
+	for key, workflows := range latest {
+		for workflow, job := range workflows {
+			releases[key].Workflows = append(releases[key].Workflows, ReleaseWorkflow{
+				Workflow:        workflow,
+				Event:           job.Event,
+				Status:          job.Status,
+				RunID:           job.RunID,
+				DurationSeconds: job.DurationSeconds,
+				HTMLURL:         job.HTMLURL,
+			})
+		}
+	}
+
+	response := ReleasesResponse{Period: period, FetchedAt: snap.FetchedAt, Releases: []Release{}}
+	for _, release := range releases {
+		sort.Slice(release.Workflows, func(i, j int) bool { return release.Workflows[i].Workflow < release.Workflows[j].Workflow })
+		release.Status = releaseStatus(release.Workflows)
+		release.Artifacts = []ReleaseArtifact{}
+		response.Releases = append(response.Releases, *release)
+	}
+	// Newest release first
+	sort.Slice(response.Releases, func(i, j int) bool {
+		return response.Releases[i].CreatedAt.After(response.Releases[j].CreatedAt)
+	})
+	addReleaseArtifacts(r.Context(), response.Releases)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
+
+func releaseStatus(workflows []ReleaseWorkflow) string {
+	status := "success"
+	for _, workflow := range workflows {
+		switch workflow.Status {
+		case "failed":
+			return "failed"
+		case "running", "pending":
+			status = "running"
+		}
+	}
+	return status
+}
+
+// addReleaseArtifacts lists the artifacts of the GitHub release runs, newest
+// releases first, up to maxArtifactFetches uncached listings per request.
+func addReleaseArtifacts(ctx context.Context, releases []Release) {
+	if githubClient == nil || demoMode {
+		return
+	}
+	fetches := 0
+	for i := range releases {
+		if releases[i].Provider != "github" {
+			continue
+		}
+		owner, repo, _ := strings.Cut(releases[i].Repository, "/")
+		for _, workflow := range releases[i].Workflows {
+			artifacts, ok := releaseArtifacts.get(workflow.RunID)
+			if !ok {
+				if fetches >= maxArtifactFetches {
+					continue
+				}
+				fetches++
+				var err error
+				artifacts, err = fetchArtifacts(ctx, owner, repo, workflow)
+				if err != nil {
+					log.Printf("⚠️  Error listing artifacts of run %d in %s: %v", workflow.RunID, releases[i].Repository, err)
+					continue
+				}
+				if workflow.Status == "success" || workflow.Status == "failed" {
+					releaseArtifacts.put(workflow.RunID, artifacts)
+				}
+			}
+			releases[i].Artifacts = append(releases[i].Artifacts, artifacts...)
+		}
+	}
+}
+
+func fetchArtifacts(ctx context.Context, owner, repo string, workflow ReleaseWorkflow) ([]ReleaseArtifact, error) {
+	list, resp, err := githubClient.Actions.ListWorkflowRunArtifacts(ctx, owner, repo, workflow.RunID, &github.ListOptions{PerPage: 100})
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := []ReleaseArtifact{}
+	for _, artifact := range list.Artifacts {
+		artifacts = append(artifacts, ReleaseArtifact{
+			Name:        artifact.GetName(),
+			Workflow:    workflow.Workflow,
+			SizeBytes:   artifact.GetSizeInBytes(),
+			Expired:     artifact.GetExpired(),
+			DownloadURL: artifact.GetArchiveDownloadURL(),
+		})
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// Repository filters (REPO_INCLUDE, REPO_EXCLUDE): comma-separated glob
+// patterns that scope the dashboard to some repositories of the
+// organizations, e.g. REPO_INCLUDE=platform-*,!*-deprecated. A pattern
+// with a slash matches org/repo, others the repository name, ignoring
+// case. A leading ! negates a pattern, and the last matching pattern of a
+// list wins. Without REPO_INCLUDE every repository is included, and
+// REPO_EXCLUDE leaves out what it matches. Repositories that are filtered
+// out are left out before anything is fetched for them.
+
+// repoInclude and repoExclude can be changed at runtime, under runtimeMu
+// (see adminconfig.go).
+var repoInclude, repoExclude []repoPattern
+
+type repoPattern struct {
+	glob    string
+	negated bool
+}
+
+func loadRepoFilterConfig() {
+	var err error
+	if repoInclude, err = parseRepoPatterns(splitList(os.Getenv("REPO_INCLUDE"))); err != nil {
+		log.Fatalf("Invalid REPO_INCLUDE: %v", err)
+	}
+	if repoExclude, err = parseRepoPatterns(splitList(os.Getenv("REPO_EXCLUDE"))); err != nil {
+		log.Fatalf("Invalid REPO_EXCLUDE: %v", err)
+	}
+	if len(repoInclude) > 0 || len(repoExclude) > 0 {
+		log.Printf("🔎 Repository filter: %d include and %d exclude pattern(s)", len(repoInclude), len(repoExclude))
+	}
+}
+
+func parseRepoPatterns(entries []string) ([]repoPattern, error) {
+	var patterns []repoPattern
+	for _, entry := range entries {
+		pattern := repoPattern{glob: strings.ToLower(strings.TrimPrefix(entry, "!")), negated: strings.HasPrefix(entry, "!")}
+		if _, err := path.Match(pattern.glob, ""); err != nil || pattern.glob == "" {
+			return nil, fmt.Errorf("invalid pattern %q", entry)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// String is the pattern as it's written in REPO_INCLUDE or REPO_EXCLUDE.
+func (p repoPattern) String() string {
+	if p.negated {
+		return "!" + p.glob
+	}
+	return p.glob
+}
+
+// repoFilters returns REPO_INCLUDE and REPO_EXCLUDE as they're in effect.
+func repoFilters() (include, exclude []repoPattern) {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return repoInclude, repoExclude
+}
+
+// matchRepoPatterns returns whether the last pattern matching the
+// repository is a positive one, and whether any matched at all.
+func matchRepoPatterns(patterns []repoPattern, org, repo string) (result, matched bool) {
+	name := strings.ToLower(repo)
+	fullName := strings.ToLower(org + "/" + repo)
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern.glob, "/") {
+			target = fullName
+		}
+		if ok, _ := path.Match(pattern.glob, target); ok {
+			result, matched = !pattern.negated, true
+		}
+	}
+	return result, matched
+}
+
+// repoSelected reports whether the repository passes REPO_INCLUDE and
+// REPO_EXCLUDE.
+func repoSelected(org, repo string) bool {
+	include, exclude := repoFilters()
+	if len(include) > 0 {
+		// Only negated patterns include everything else
+		included, matched := matchRepoPatterns(include, org, repo)
+		if !matched {
+			included = true
+			for _, pattern := range include {
+				included = included && pattern.negated
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	excluded, _ := matchRepoPatterns(exclude, org, repo)
+	return !excluded
+}
+
+// filterPipelines leaves out the pipelines of repositories that don't
+// pass the filters.
+func filterPipelines(pipelines []Pipeline) []Pipeline {
+	if include, exclude := repoFilters(); len(include) == 0 && len(exclude) == 0 {
+		return pipelines
+	}
+	var selected []Pipeline
+	for _, pipeline := range pipelines {
+		if repoSelected(pipeline.Org, pipeline.Name) {
+			selected = append(selected, pipeline)
+		}
+	}
+	return selected
+}
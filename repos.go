@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Repository discovery: the repositories of a GitHub organization change
+// rarely, so the full listing is kept in the Store for repoCacheTTL instead
+// of being paginated on every fetch. Activity does change all the time, so
+// each fetch still reads the most recently pushed page to keep pushed_at
+// current.
+
+// repoCacheTTL is how long an organization's repository list is reused.
+// Zero lists every page on every fetch.
+var repoCacheTTL = 30 * time.Minute
+
+// maxReposPerOrg caps the repository listing per organization, listed 100
+// per page (MAX_REPOS_PER_ORG). Zero lists every page; with a cap the most
+// recently pushed repositories are the ones kept.
+var maxReposPerOrg = 0
+
+type orgRepo struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	DefaultBranch string    `json:"default_branch"`
+	Private       bool      `json:"private,omitempty"`
+	Archived      bool      `json:"archived,omitempty"`
+	PushedAt      time.Time `json:"pushed_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func newOrgRepo(repo *github.Repository) orgRepo {
+	return orgRepo{
+		ID:            repo.GetID(),
+		Name:          repo.GetName(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Private:       repo.GetPrivate(),
+		Archived:      repo.GetArchived(),
+		PushedAt:      repo.GetPushedAt().Time,
+		UpdatedAt:     repo.GetUpdatedAt().Time,
+	}
+}
+
+// activity is the last time anything happened in the repository. GitHub
+// web shows "Updated X minutes ago" based on pushed_at, so that comes first.
+func (r orgRepo) activity() time.Time {
+	if !r.PushedAt.IsZero() {
+		return r.PushedAt
+	}
+	return r.UpdatedAt
+}
+
+type cachedRepoList struct {
+	ListedAt time.Time `json:"listed_at"`
+	Repos    []orgRepo `json:"repos"`
+}
+
+func repoListKey(org string) string {
+	return "repos:" + org
+}
+
+// listOrgRepos returns every repository of a GitHub organization or
+// personal account, from the Store while the listing is younger than
+// repoCacheTTL.
+func listOrgRepos(ctx context.Context, org string) ([]orgRepo, error) {
+	if repoCacheTTL > 0 {
+		data, ok, err := store.Get(ctx, repoListKey(org))
+		if err != nil {
+			log.Printf("⚠️  Error reading repository list of %s from store: %v", org, err)
+		}
+		var cached cachedRepoList
+		if ok && json.Unmarshal(data, &cached) == nil && clock().Sub(cached.ListedAt) < repoCacheTTL {
+			return freshenRepos(ctx, org, cached.Repos)
+		}
+	}
+
+	var repos []orgRepo
+	user := isGitHubUser(org)
+	sort := ""
+	if maxReposPerOrg > 0 {
+		sort = "pushed"
+	}
+	for page := 1; ; {
+		if err := budget.acquire(ctx); err != nil {
+			return repos, err
+		}
+		listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+		list, resp, err := listAccountRepos(listCtx, org, user, sort, page)
+		cancel()
+		budget.update(resp)
+		if err != nil {
+			return repos, err
+		}
+		for _, repo := range list {
+			repos = append(repos, newOrgRepo(repo))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		if maxReposPerOrg > 0 && len(repos) >= maxReposPerOrg {
+			log.Printf("⚠️  %s has more repositories than MAX_REPOS_PER_ORG=%d, listing only the %d most recently pushed", org, maxReposPerOrg, len(repos))
+			break
+		}
+		page = resp.NextPage
+	}
+
+	if repoCacheTTL > 0 {
+		data, err := json.Marshal(cachedRepoList{ListedAt: clock(), Repos: repos})
+		if err == nil {
+			err = store.Set(ctx, repoListKey(org), data, repoCacheTTL)
+		}
+		if err != nil {
+			log.Printf("⚠️  Error saving repository list of %s to store: %v", org, err)
+		}
+	}
+	return repos, nil
+}
+
+// freshenRepos updates the activity of cached repositories from the most
+// recently pushed page, which also picks up repositories created since the
+// listing. If that fails the cached activity is used as is.
+func freshenRepos(ctx context.Context, org string, cached []orgRepo) ([]orgRepo, error) {
+	repos := append([]orgRepo{}, cached...)
+	if err := budget.acquire(ctx); err != nil {
+		return repos, nil
+	}
+	listCtx, cancel := withPhaseTimeout(ctx, repoListTimeout)
+	list, resp, err := listAccountRepos(listCtx, org, isGitHubUser(org), "pushed", 1)
+	cancel()
+	budget.update(resp)
+	if err != nil {
+		log.Printf("⚠️  Error refreshing repository activity of %s, using the cached list: %v", org, err)
+		return repos, nil
+	}
+
+	byName := make(map[string]int, len(repos))
+	for i, repo := range repos {
+		byName[repo.Name] = i
+	}
+	for _, repo := range list {
+		if i, ok := byName[repo.GetName()]; ok {
+			repos[i] = newOrgRepo(repo)
+		} else {
+			repos = append(repos, newOrgRepo(repo))
+		}
+	}
+	log.Printf("♻️  Using cached repository list of %s (%d repositories)", org, len(repos))
+	return repos, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retry queue: a repository whose runs couldn't be fetched because of a
+// server error, a timeout or a rate limit is fetched again on its own, with
+// backoff, and its runs are merged into the period's snapshot, instead of
+// being missing until the next refresh. Errors that won't go away by
+// themselves (unauthorized, forbidden, not found) aren't retried. The
+// queue is per replica; /api/status shows it.
+
+var (
+	// fetchRetryAttempts is how often a repository is retried before it's
+	// left to the next refresh (FETCH_RETRY_ATTEMPTS, 0 disables retries).
+	fetchRetryAttempts = 5
+
+	// fetchRetryBackoff is the wait before the first retry, doubled after
+	// every failed one (FETCH_RETRY_BACKOFF).
+	fetchRetryBackoff = 30 * time.Second
+)
+
+// retryQueueTick is how often the queue is checked for due retries.
+const retryQueueTick = 5 * time.Second
+
+// RetryEntry is a repository waiting to be fetched again.
+type RetryEntry struct {
+	Period        string    `json:"period"`
+	Provider      string    `json:"provider"`
+	Organization  string    `json:"organization"`
+	Repository    string    `json:"repository"`
+	Attempts      int       `json:"attempts"` // retries so far
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LastError     string    `json:"last_error"`
+
+	src      source
+	pipeline Pipeline
+}
+
+var retryQueue = struct {
+	sync.Mutex
+	entries map[string]*RetryEntry
+	started sync.Once
+}{entries: make(map[string]*RetryEntry)}
+
+func retryKey(period string, src source, pipeline Pipeline) string {
+	return period + "|" + src.Provider.Name() + "|" + src.Org + "|" + pipeline.Name
+}
+
+// retryable reports whether fetching again may fix err.
+func retryable(err error) bool {
+	if errors.Is(err, errBudgetExhausted) {
+		return false // the repository was skipped, not failed
+	}
+	switch reason, _ := classifyFetchError(err); reason {
+	case "unauthorized", "forbidden", "not_found":
+		return false
+	}
+	return true
+}
+
+// queueRetry queues a pipeline whose runs failed to fetch. A pipeline
+// that's queued already keeps its place in the backoff.
+func queueRetry(period string, src source, pipeline Pipeline, err error) {
+	if fetchRetryAttempts <= 0 || !retryable(err) {
+		return
+	}
+	retryQueue.started.Do(func() { go processRetries() })
+
+	retryQueue.Lock()
+	defer retryQueue.Unlock()
+	key := retryKey(period, src, pipeline)
+	if entry, ok := retryQueue.entries[key]; ok {
+		entry.LastError = err.Error()
+		return
+	}
+	retryQueue.entries[key] = &RetryEntry{
+		Period: period, Provider: src.Provider.Name(), Organization: src.Org, Repository: pipeline.Name,
+		NextAttemptAt: clock().Add(fetchRetryBackoff), LastError: err.Error(),
+		src: src, pipeline: pipeline,
+	}
+}
+
+// dequeueRetry drops a pipeline that a refresh fetched after all.
+func dequeueRetry(period string, src source, pipeline Pipeline) {
+	retryQueue.Lock()
+	defer retryQueue.Unlock()
+	delete(retryQueue.entries, retryKey(period, src, pipeline))
+}
+
+// pendingRetries returns the queue, soonest retry first.
+func pendingRetries() []RetryEntry {
+	retryQueue.Lock()
+	defer retryQueue.Unlock()
+	entries := make([]RetryEntry, 0, len(retryQueue.entries))
+	for _, entry := range retryQueue.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NextAttemptAt.Before(entries[j].NextAttemptAt) })
+	return entries
+}
+
+func processRetries() {
+	for range time.Tick(retryQueueTick) {
+		for _, entry := range pendingRetries() {
+			if !entry.NextAttemptAt.After(clock()) {
+				retryFetch(entry)
+			}
+		}
+	}
+}
+
+// retryFetch fetches a queued pipeline again and merges its runs into the
+// snapshot, or backs off.
+func retryFetch(entry RetryEntry) {
+	key := retryKey(entry.Period, entry.src, entry.pipeline)
+	ctx, cancel := context.WithTimeout(context.Background(), runListTimeout)
+	defer cancel()
+
+	jobs, err := entry.src.Provider.ListRuns(ctx, newFetchWindow(entry.Period), entry.pipeline)
+	if err == nil {
+		err = mergeRetriedRuns(ctx, entry, jobs)
+	}
+
+	retryQueue.Lock()
+	defer retryQueue.Unlock()
+	queued, ok := retryQueue.entries[key]
+	if !ok {
+		return // a refresh got to it first
+	}
+	switch {
+	case err == nil:
+		delete(retryQueue.entries, key)
+		log.Printf("🔁 Fetched %s/%s for %s on retry %d: %d runs", entry.Organization, entry.Repository, entry.Period, queued.Attempts+1, len(jobs))
+	case errors.Is(err, errBudgetExhausted) || errors.Is(err, errThrottled) || errors.Is(err, errSnapshotBusy):
+		queued.NextAttemptAt = clock().Add(fetchRetryBackoff) // not the repository's fault
+	case queued.Attempts+1 >= fetchRetryAttempts || !retryable(err):
+		delete(retryQueue.entries, key)
+		log.Printf("❌ Giving up on %s/%s for %s after %d retries: %v", entry.Organization, entry.Repository, entry.Period, queued.Attempts+1, err)
+	default:
+		queued.Attempts++
+		queued.LastError = err.Error()
+		queued.NextAttemptAt = clock().Add(fetchRetryBackoff << queued.Attempts)
+		log.Printf("⚠️  Retry %d of %s/%s for %s failed, next in %v: %v", queued.Attempts, entry.Organization, entry.Repository, entry.Period, fetchRetryBackoff<<queued.Attempts, err)
+	}
+}
+
+var errSnapshotBusy = errors.New("snapshot is being refreshed")
+
+// mergeRetriedRuns adds the runs of a retried pipeline to the period's
+// snapshot and drops its fetch error. The snapshot keeps its fetch time,
+// since the rest of it is as old as before.
+func mergeRetriedRuns(ctx context.Context, entry RetryEntry, jobs []Job) error {
+	release, ok, err := store.Lock(ctx, "lock:"+snapshotKey(entry.Period), fetchLockTTL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errSnapshotBusy
+	}
+	defer release()
+
+	snap, err := loadSnapshot(ctx, entry.Period)
+	if err != nil || snap == nil {
+		return err // nothing to merge into, the next fetch gets the runs
+	}
+	// Without the error, a refresh since has fetched the runs
+	errs := []FetchError{}
+	for _, fetchErr := range snap.Response.Errors {
+		if fetchErr.Provider == entry.Provider && strings.EqualFold(fetchErr.Organization, entry.Organization) && fetchErr.Repository == entry.Repository {
+			continue
+		}
+		errs = append(errs, fetchErr)
+	}
+	if len(errs) == len(snap.Response.Errors) {
+		return nil
+	}
+	snap.Response.Errors = errs
+
+	prepareJobs(jobs)
+	collector := newJobCollector(maxJobs)
+	for _, job := range snap.Response.Jobs {
+		collector.keep(job)
+	}
+	for _, job := range jobs {
+		collector.add(job)
+	}
+	addStats(&snap.Response.Stats, collector.stats)
+	addStats(&snap.Superseded, collector.superseded)
+	if snap.Deduped != nil {
+		deduped, retried := *snap.Deduped, collector.deduped.result()
+		addStats(&deduped.Stats, retried.Stats)
+		addStats(&deduped.Superseded, retried.Superseded)
+		deduped.Deduplicated += retried.Deduplicated
+		snap.Deduped = &deduped
+	}
+	if snap.Runners != nil {
+		tally := &RunnerTally{}
+		tally.merge(snap.Runners)
+		tally.merge(&collector.runners)
+		snap.Runners = tally
+	}
+	snap.Response.Truncated = snap.Response.Truncated || collector.truncated
+	snap.Response.Jobs = collector.result()
+
+	if err := saveSnapshot(ctx, entry.Period, snap); err != nil {
+		return err
+	}
+	persistSnapshot(entry.Period, snap)
+	announceSnapshot(entry.Period, snap)
+	return nil
+}
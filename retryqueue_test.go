@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeRetriedRuns(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	job := func(id, repo, status string, minutes int) Job {
+		return Job{ID: id, Provider: "github", Organization: "acme", Pipeline: repo, Status: status, CreatedAt: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+	failedRepo := FetchError{Provider: "github", Organization: "acme", Repository: "api", Reason: "server_error"}
+	otherRepo := FetchError{Provider: "github", Organization: "acme", Repository: "web", Reason: "timeout"}
+	entry := RetryEntry{Period: "week", Provider: "github", Organization: "ACME", Repository: "api"}
+
+	tests := []struct {
+		name          string
+		maxJobs       int
+		errors        []FetchError
+		retried       []Job
+		wantIDs       []string
+		wantStats     DashboardStats
+		wantErrors    []FetchError
+		wantTruncated bool
+	}{
+		{
+			name:       "adds the runs and drops the error",
+			errors:     []FetchError{failedRepo, otherRepo},
+			retried:    []Job{job("3", "api", "failed", 30), job("4", "api", "success", 5)},
+			wantIDs:    []string{"3", "2", "1", "4"},
+			wantStats:  DashboardStats{Success: 2, Failed: 2, Total: 4},
+			wantErrors: []FetchError{otherRepo},
+		},
+		{
+			name:       "refreshed since",
+			errors:     []FetchError{otherRepo},
+			retried:    []Job{job("3", "api", "failed", 30)},
+			wantIDs:    []string{"2", "1"},
+			wantStats:  DashboardStats{Success: 1, Failed: 1, Total: 2},
+			wantErrors: []FetchError{otherRepo},
+		},
+		{
+			name:          "keeps MAX_JOBS, counts every run",
+			maxJobs:       3,
+			errors:        []FetchError{failedRepo},
+			retried:       []Job{job("3", "api", "success", 30), job("4", "api", "success", 5)},
+			wantIDs:       []string{"3", "2", "1"},
+			wantStats:     DashboardStats{Success: 3, Failed: 1, Total: 4},
+			wantTruncated: true,
+		},
+	}
+	defer func(s Store, limit int) { store, maxJobs = s, limit }(store, maxJobs)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, maxJobs = newMemoryStore(), tt.maxJobs
+			jobs := []Job{job("2", "web", "success", 20), job("1", "web", "failed", 10)}
+			snap := &Snapshot{
+				Response:  DashboardResponse{Jobs: jobs, Stats: calculateStats(jobs), Errors: tt.errors},
+				FetchedAt: base,
+			}
+			if err := saveSnapshot(ctx, entry.Period, snap); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := mergeRetriedRuns(ctx, entry, tt.retried); err != nil {
+				t.Fatalf("mergeRetriedRuns() = %v", err)
+			}
+			merged, err := loadSnapshot(ctx, entry.Period)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, job := range merged.Response.Jobs {
+				ids = append(ids, job.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("jobs = %v, want %v", ids, tt.wantIDs)
+			}
+			if !reflect.DeepEqual(merged.Response.Stats, tt.wantStats) {
+				t.Errorf("stats = %+v, want %+v", merged.Response.Stats, tt.wantStats)
+			}
+			if !reflect.DeepEqual(merged.Response.Errors, tt.wantErrors) {
+				t.Errorf("errors = %+v, want %+v", merged.Response.Errors, tt.wantErrors)
+			}
+			if merged.Response.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", merged.Response.Truncated, tt.wantTruncated)
+			}
+			if !merged.FetchedAt.Equal(base) {
+				t.Errorf("fetched at %v, want the snapshot's %v", merged.FetchedAt, base)
+			}
+		})
+	}
+}
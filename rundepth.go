@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Run fetch depth: how many workflow runs are listed per repository and
+// fetch. By default every page inside the period is listed, up to
+// maxRunPages, like MAX_REPOS_PER_ORG lists every page of repositories;
+// quiet repositories stop at their first page anyway. The depth can be
+// lowered to save API calls, globally or for single repositories.
+
+// runDepthAll lists every page of runs inside the period.
+const runDepthAll = 0
+
+// maxRunPages caps the pages listed per repository (100 runs per page, so
+// 5000 runs), whatever the depth, so a repository with runaway automation
+// can't eat the budget.
+const maxRunPages = 50
+
+var (
+	// runsPerRepo is the default depth (RUNS_PER_REPO), every page inside
+	// the period unless set.
+	runsPerRepo = runDepthAll
+	// runDepthOverrides sets the depth of single repositories, by "org/repo"
+	// (RUNS_PER_REPO_OVERRIDES=acme/monorepo=all,acme/web=200).
+	runDepthOverrides = make(map[string]int)
+)
+
+func loadRunDepthConfig() {
+	if env := strings.TrimSpace(os.Getenv("RUNS_PER_REPO")); env != "" {
+		depth, ok := parseRunDepth(env)
+		if !ok {
+			log.Fatalf("Invalid RUNS_PER_REPO %q: expected a number, or 0 or all for every page", env)
+		}
+		runsPerRepo = depth
+	}
+	for _, entry := range splitList(os.Getenv("RUNS_PER_REPO_OVERRIDES")) {
+		repo, value, _ := strings.Cut(entry, "=")
+		depth, ok := parseRunDepth(value)
+		if !strings.Contains(repo, "/") || !ok {
+			log.Fatalf("Invalid RUNS_PER_REPO_OVERRIDES entry %q: expected org/repo=<number|0|all>", entry)
+		}
+		runDepthOverrides[strings.ToLower(strings.TrimSpace(repo))] = depth
+	}
+	if runsPerRepo != runDepthAll || len(runDepthOverrides) > 0 {
+		log.Printf("📄 Runs per repository: %s (%d override(s))", formatRunDepth(runsPerRepo), len(runDepthOverrides))
+	}
+}
+
+func parseRunDepth(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "all") {
+		return runDepthAll, true
+	}
+	depth, err := strconv.Atoi(value)
+	return depth, err == nil && depth >= 0
+}
+
+func formatRunDepth(depth int) string {
+	if depth == runDepthAll {
+		return fmt.Sprintf("all in period (up to %d)", maxRunPages*100)
+	}
+	return strconv.Itoa(depth)
+}
+
+// runDepth returns how many runs to list for a repository, runDepthAll for
+// every page inside the period.
+func runDepth(org, repo string) int {
+	if depth, ok := runDepthOverrides[strings.ToLower(org+"/"+repo)]; ok {
+		return depth
+	}
+	return runsPerRepo
+}
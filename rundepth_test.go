@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestParseRunDepth(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   int
+		wantOK bool
+	}{
+		{"200", 200, true},
+		{" 30 ", 30, true},
+		{"0", runDepthAll, true},
+		{"all", runDepthAll, true},
+		{"ALL", runDepthAll, true},
+		{"-1", 0, false},
+		{"many", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRunDepth(tt.value)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("parseRunDepth(%q) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRunDepth(t *testing.T) {
+	defer func(depth int, overrides map[string]int) { runsPerRepo, runDepthOverrides = depth, overrides }(runsPerRepo, runDepthOverrides)
+	runDepthOverrides = map[string]int{"acme/monorepo": 200, "acme/web": runDepthAll}
+
+	tests := []struct {
+		name        string
+		runsPerRepo int
+		org, repo   string
+		want        int
+	}{
+		{"every page by default", runDepthAll, "acme", "api", runDepthAll},
+		{"RUNS_PER_REPO", 50, "acme", "api", 50},
+		{"override", runDepthAll, "ACME", "Monorepo", 200},
+		{"override to every page", 50, "acme", "web", runDepthAll},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runsPerRepo = tt.runsPerRepo
+			if got := runDepth(tt.org, tt.repo); got != tt.want {
+				t.Errorf("runDepth(%q, %q) = %d, want %d", tt.org, tt.repo, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// RunDetail is the full record of a single GitHub Actions run, for the
+// drill-down page.
+type RunDetail struct {
+	Job
+	Event           string           `json:"event"`
+	Actor           string           `json:"actor,omitempty"`
+	TriggeringActor string           `json:"triggering_actor,omitempty"`
+	Commit          RunCommit        `json:"commit"`
+	PullRequests    []RunPullRequest `json:"pull_requests"`
+	Attempt         int              `json:"attempt"`
+	Attempts        []RunAttempt     `json:"attempts"` // earlier attempts first, the current one last
+	Timing          RunTiming        `json:"timing"`
+	Jobs            []RunJob         `json:"jobs"` // of the current attempt
+	// Set for failures that followed an edit of the workflow file
+	WorkflowChange *WorkflowChange `json:"workflow_change,omitempty"`
+}
+
+type RunCommit struct {
+	SHA     string    `json:"sha"`
+	Message string    `json:"message"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	HTMLURL string    `json:"html_url"`
+}
+
+type RunPullRequest struct {
+	Number     int    `json:"number"`
+	HeadBranch string `json:"head_branch"`
+	BaseBranch string `json:"base_branch"`
+	HTMLURL    string `json:"html_url"`
+}
+
+type RunAttempt struct {
+	Attempt    int        `json:"attempt"`
+	Status     string     `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	HTMLURL    string     `json:"html_url"`
+}
+
+type RunTiming struct {
+	CreatedAt       time.Time `json:"created_at"`
+	StartedAt       time.Time `json:"started_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	QueuedSeconds   int64     `json:"queued_seconds"` // from creation until the current attempt started
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+type RunJob struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	Status          string     `json:"status"`
+	Conclusion      string     `json:"conclusion,omitempty"` // GitHub's own, e.g. "cancelled" or "skipped"
+	StartedAt       time.Time  `json:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	DurationSeconds int64      `json:"duration_seconds"`
+	RunnerName      string     `json:"runner_name,omitempty"`
+	Labels          []string   `json:"labels,omitempty"`
+	Steps           []RunStep  `json:"steps"`
+	HTMLURL         string     `json:"html_url"`
+}
+
+type RunStep struct {
+	Number          int64  `json:"number"`
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	Conclusion      string `json:"conclusion,omitempty"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// runHandler serves /api/runs/{owner}/{repo}/{run_id}.
+func runHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/runs/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Expected /api/runs/{owner}/{repo}/{run_id}", http.StatusBadRequest)
+		return
+	}
+	runID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid run_id %q", parts[2]), http.StatusBadRequest)
+		return
+	}
+	if githubClient == nil || demoMode {
+		http.Error(w, "Run details are only available for GitHub Actions", http.StatusNotFound)
+		return
+	}
+	if !viewerFrom(r).canSee(Job{Provider: "github", Organization: parts[0], Pipeline: parts[1]}) {
+		http.Error(w, "You don't have access to this repository", http.StatusForbidden)
+		return
+	}
+
+	detail, err := fetchRunDetail(r.Context(), parts[0], parts[1], runID)
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusNotFound {
+		http.Error(w, fmt.Sprintf("Run %d not found in %s/%s", runID, parts[0], parts[1]), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error fetching run %d in %s/%s: %v", runID, parts[0], parts[1], err)
+		http.Error(w, fmt.Sprintf("Error fetching run: %v", err), http.StatusBadGateway)
+		return
+	}
+	jobs := []Job{detail.Job}
+	localizeJobs(jobs, requestLocale(r.URL.Query().Get("locale")))
+	updateElapsed(jobs)
+	detail.Job = jobs[0]
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func fetchRunDetail(ctx context.Context, owner, repo string, runID int64) (*RunDetail, error) {
+	run, resp, err := githubClient.Actions.GetWorkflowRunByID(ctx, owner, repo, runID)
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open-ended window, the run is wanted whenever it ran
+	job, _ := runToJob(fetchWindow{Now: clock()}, owner, repo, run)
+	detail := &RunDetail{
+		Job:             job,
+		Event:           run.GetEvent(),
+		Actor:           run.GetActor().GetLogin(),
+		TriggeringActor: run.GetTriggeringActor().GetLogin(),
+		Attempt:         run.GetRunAttempt(),
+		PullRequests:    []RunPullRequest{},
+		Jobs:            []RunJob{},
+	}
+
+	commit := run.GetHeadCommit()
+	detail.Commit = RunCommit{
+		SHA:     run.GetHeadSHA(),
+		Message: commit.GetMessage(),
+		Author:  commit.GetAuthor().GetName(),
+		Date:    commit.GetTimestamp().Time,
+		HTMLURL: fmt.Sprintf("%s/%s/%s/commit/%s", githubWebURL, owner, repo, run.GetHeadSHA()),
+	}
+	for _, pr := range run.PullRequests {
+		detail.PullRequests = append(detail.PullRequests, RunPullRequest{
+			Number:     pr.GetNumber(),
+			HeadBranch: pr.GetHead().GetRef(),
+			BaseBranch: pr.GetBase().GetRef(),
+			HTMLURL:    fmt.Sprintf("%s/%s/%s/pull/%d", githubWebURL, owner, repo, pr.GetNumber()),
+		})
+	}
+
+	detail.Timing = RunTiming{
+		CreatedAt: run.GetCreatedAt().Time,
+		StartedAt: run.GetRunStartedAt().Time,
+		UpdatedAt: run.GetUpdatedAt().Time,
+	}
+	if !detail.Timing.StartedAt.IsZero() {
+		detail.Timing.QueuedSeconds = int64(detail.Timing.StartedAt.Sub(detail.Timing.CreatedAt).Seconds())
+	}
+	detail.Timing.DurationSeconds = job.DurationSeconds
+
+	// Earlier attempts are fetched one by one; reruns are rare, so this
+	// stays cheap
+	for attempt := 1; attempt < detail.Attempt; attempt++ {
+		previous, resp, err := githubClient.Actions.GetWorkflowRunAttempt(ctx, owner, repo, runID, attempt, &github.WorkflowRunAttemptOptions{ExcludePullRequests: github.Bool(true)})
+		budget.update(resp)
+		if err != nil {
+			log.Printf("   ⚠️  Error fetching attempt %d of run %d in %s/%s: %v", attempt, runID, owner, repo, err)
+			continue
+		}
+		detail.Attempts = append(detail.Attempts, runAttempt(previous))
+	}
+	detail.Attempts = append(detail.Attempts, runAttempt(run))
+
+	jobs, err := fetchRunJobs(ctx, owner, repo, runID)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		detail.Jobs = append(detail.Jobs, runJob(j))
+	}
+
+	if job.Status == "failed" {
+		detail.WorkflowChange, err = runWorkflowChange(ctx, owner, repo, run)
+		if err != nil {
+			log.Printf("   ⚠️  Error checking workflow changes for run %d in %s/%s: %v", runID, owner, repo, err)
+		}
+	}
+	return detail, nil
+}
+
+func runAttempt(run *github.WorkflowRun) RunAttempt {
+	attempt := RunAttempt{
+		Attempt:   run.GetRunAttempt(),
+		Status:    dashboardStatus(run.GetStatus(), run.GetConclusion()),
+		StartedAt: run.GetRunStartedAt().Time,
+		HTMLURL:   run.GetHTMLURL(),
+	}
+	if run.UpdatedAt != nil && (attempt.Status == "success" || attempt.Status == "failed") {
+		attempt.FinishedAt = &run.UpdatedAt.Time
+	}
+	return attempt
+}
+
+func runJob(j *github.WorkflowJob) RunJob {
+	job := RunJob{
+		ID:         j.GetID(),
+		Name:       j.GetName(),
+		Status:     dashboardStatus(j.GetStatus(), j.GetConclusion()),
+		Conclusion: j.GetConclusion(),
+		StartedAt:  j.GetStartedAt().Time,
+		RunnerName: j.GetRunnerName(),
+		Labels:     j.Labels,
+		Steps:      []RunStep{},
+		HTMLURL:    j.GetHTMLURL(),
+	}
+	if j.CompletedAt != nil {
+		job.CompletedAt = &j.CompletedAt.Time
+	}
+	job.DurationSeconds = stepSeconds(j.StartedAt, j.CompletedAt)
+	for _, step := range j.Steps {
+		job.Steps = append(job.Steps, RunStep{
+			Number:          step.GetNumber(),
+			Name:            step.GetName(),
+			Status:          dashboardStatus(step.GetStatus(), step.GetConclusion()),
+			Conclusion:      step.GetConclusion(),
+			DurationSeconds: stepSeconds(step.StartedAt, step.CompletedAt),
+		})
+	}
+	return job
+}
+
+// stepSeconds is the duration between two timestamps, up to now while the
+// job or step is still running.
+func stepSeconds(started, completed *github.Timestamp) int64 {
+	if started == nil {
+		return 0
+	}
+	end := clock()
+	if completed != nil {
+		end = completed.Time
+	}
+	return int64(end.Sub(started.Time).Seconds())
+}
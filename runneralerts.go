@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Runner alerts (RUNNER_ALERTS): rules about the self-hosted runners of
+// the GitHub organizations, checked every RUNNER_ALERT_INTERVAL and sent
+// to the alert targets of alerts.go when they start and stop firing:
+//
+//	min_online:<labels>=<n>        fewer than n online runners with all labels
+//	min_idle:<labels>=<n>          fewer than n online runners with all labels that aren't busy
+//	offline[:<labels>]=<duration>  a runner (with all labels) offline for longer than duration
+//
+// Labels are joined with +, e.g. min_online:linux+x64=2. GitHub doesn't
+// say since when a runner is offline, so that's when a check first saw it
+// offline. One replica checks per interval; what's firing is kept in the
+// Store, so each alert is sent once.
+
+const runnerAlertStateKey = "runner-alerts"
+
+var runnerAlerts struct {
+	rules    []runnerRule
+	orgs     []string // RUNNER_ALERT_ORGS; empty checks every GitHub organization
+	interval time.Duration
+}
+
+// runnerRule is one rule of RUNNER_ALERTS.
+type runnerRule struct {
+	raw     string
+	kind    string // min_online, min_idle or offline
+	labels  []string
+	min     int
+	offline time.Duration
+}
+
+// runnerAlertState is what the previous check left: when runners were
+// first seen offline, by "org/runner ID", and the firing alerts with
+// their message, by key.
+type runnerAlertState struct {
+	OfflineSince map[string]time.Time   `json:"offline_since"`
+	Firing       map[string]runnerAlert `json:"firing"`
+}
+
+type runnerAlert struct {
+	Org   string    `json:"org"`
+	Title string    `json:"title"`
+	Since time.Time `json:"since"`
+}
+
+func loadRunnerAlertConfig() {
+	runnerAlerts.rules = nil
+	for _, entry := range splitList(os.Getenv("RUNNER_ALERTS")) {
+		rule, err := parseRunnerRule(entry)
+		if err != nil {
+			log.Fatalf("Invalid RUNNER_ALERTS entry %q: %v", entry, err)
+		}
+		runnerAlerts.rules = append(runnerAlerts.rules, rule)
+	}
+	runnerAlerts.orgs = splitList(os.Getenv("RUNNER_ALERT_ORGS"))
+	runnerAlerts.interval = getEnvDuration("RUNNER_ALERT_INTERVAL", time.Minute)
+	if runnerAlerts.interval <= 0 {
+		log.Fatalf("Invalid RUNNER_ALERT_INTERVAL %v: must be positive", runnerAlerts.interval)
+	}
+	if len(runnerAlerts.rules) == 0 {
+		return
+	}
+	if len(alerts.targets) == 0 {
+		log.Printf("⚠️  RUNNER_ALERTS is set but no alert target is configured: runner alerts are only logged")
+	}
+	log.Printf("🏃 %d runner alert rule(s), checked every %v", len(runnerAlerts.rules), runnerAlerts.interval)
+}
+
+func parseRunnerRule(entry string) (runnerRule, error) {
+	key, value, ok := strings.Cut(entry, "=")
+	if !ok {
+		return runnerRule{}, fmt.Errorf("expected <rule>[:<labels>]=<value>")
+	}
+	kind, labels, _ := strings.Cut(strings.TrimSpace(key), ":")
+	rule := runnerRule{raw: entry, kind: kind}
+	for _, label := range strings.Split(labels, "+") {
+		if label = strings.ToLower(strings.TrimSpace(label)); label != "" {
+			rule.labels = append(rule.labels, label)
+		}
+	}
+	value = strings.TrimSpace(value)
+	switch kind {
+	case "min_online", "min_idle":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return rule, fmt.Errorf("%s needs a number of runners of 1 or more", kind)
+		}
+		if len(rule.labels) == 0 {
+			return rule, fmt.Errorf("%s needs labels, e.g. %s:linux=2", kind, kind)
+		}
+		rule.min = n
+	case "offline":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return rule, fmt.Errorf("offline needs a duration, e.g. offline=15m")
+		}
+		rule.offline = d
+	default:
+		return rule, fmt.Errorf("unknown rule %q, expected min_online, min_idle or offline", kind)
+	}
+	return rule, nil
+}
+
+// matches reports whether a runner has all of the rule's labels.
+func (rule runnerRule) matches(runner *github.Runner) bool {
+	for _, want := range rule.labels {
+		found := false
+		for _, label := range runner.Labels {
+			found = found || strings.EqualFold(label.GetName(), want)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule runnerRule) labelText() string {
+	if len(rule.labels) == 0 {
+		return ""
+	}
+	return " with " + strings.Join(rule.labels, "+")
+}
+
+// watchRunners checks the runner alert rules every RUNNER_ALERT_INTERVAL.
+func watchRunners() {
+	if len(runnerAlerts.rules) == 0 {
+		return
+	}
+	if demoMode {
+		log.Printf("⚠️  RUNNER_ALERTS is ignored in DEMO_MODE")
+		return
+	}
+	ticker := time.NewTicker(runnerAlerts.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), runnerAlerts.interval)
+		checkRunnerAlerts(ctx)
+		cancel()
+	}
+}
+
+// checkRunnerAlerts checks the rules once, unless another replica already
+// did in this interval, and sends what started or stopped firing.
+func checkRunnerAlerts(ctx context.Context) {
+	// Not released: the lock expires just before the next check
+	if _, ok, err := store.Lock(ctx, "lock:"+runnerAlertStateKey, runnerAlerts.interval*9/10); err != nil || !ok {
+		return
+	}
+	if budget.low() {
+		return
+	}
+
+	prev := runnerAlertState{OfflineSince: map[string]time.Time{}, Firing: map[string]runnerAlert{}}
+	if data, ok, err := store.Get(ctx, runnerAlertStateKey); err == nil && ok {
+		json.Unmarshal(data, &prev)
+	}
+	next := runnerAlertState{OfflineSince: map[string]time.Time{}, Firing: map[string]runnerAlert{}}
+	now := clock()
+
+	for _, org := range runnerAlertOrgs() {
+		runners, err := listOrgRunners(ctx, org)
+		if err != nil {
+			// Keep what's firing, nothing is known to have changed
+			log.Printf("⚠️  Error listing runners of %s: %v", org, err)
+			for key, alert := range prev.Firing {
+				if alert.Org == org {
+					next.Firing[key] = alert
+				}
+			}
+			for key, since := range prev.OfflineSince {
+				if strings.HasPrefix(key, org+"/") {
+					next.OfflineSince[key] = since
+				}
+			}
+			continue
+		}
+		for _, runner := range runners {
+			if runner.GetStatus() != "offline" {
+				continue
+			}
+			key := fmt.Sprintf("%s/%d", org, runner.GetID())
+			since, ok := prev.OfflineSince[key]
+			if !ok {
+				since = now
+			}
+			next.OfflineSince[key] = since
+		}
+		for _, rule := range runnerAlerts.rules {
+			for key, title := range evalRunnerRule(rule, org, runners, next.OfflineSince, now) {
+				alert := runnerAlert{Org: org, Title: title, Since: now}
+				if old, ok := prev.Firing[key]; ok {
+					alert.Since = old.Since
+				}
+				next.Firing[key] = alert
+			}
+		}
+	}
+
+	data, err := json.Marshal(next)
+	if err == nil {
+		err = store.Set(ctx, runnerAlertStateKey, data, 0)
+	}
+	if err != nil {
+		// Sending without the state saved would send it again next time
+		log.Printf("⚠️  Error saving runner alert state: %v", err)
+		return
+	}
+	sendRunnerAlerts(ctx, prev.Firing, next.Firing)
+}
+
+// runnerAlertOrgs returns the organizations whose runners are checked.
+// Personal accounts have no organization runners.
+func runnerAlertOrgs() []string {
+	if len(runnerAlerts.orgs) > 0 {
+		return runnerAlerts.orgs
+	}
+	var orgs []string
+	for _, src := range currentSources() {
+		if src.Provider.Name() == "github" && !isGitHubUser(src.Org) {
+			orgs = append(orgs, src.Org)
+		}
+	}
+	return orgs
+}
+
+// evalRunnerRule returns the alerts a rule fires for an organization's
+// runners, with their title, by key.
+func evalRunnerRule(rule runnerRule, org string, runners []*github.Runner, offlineSince map[string]time.Time, now time.Time) map[string]string {
+	firing := make(map[string]string)
+	switch rule.kind {
+	case "min_online", "min_idle":
+		n := 0
+		for _, runner := range runners {
+			if rule.matches(runner) && runner.GetStatus() == "online" && (rule.kind == "min_online" || !runner.GetBusy()) {
+				n++
+			}
+		}
+		if n < rule.min {
+			state := "online"
+			if rule.kind == "min_idle" {
+				state = "idle"
+			}
+			firing[rule.raw+"|"+org] = fmt.Sprintf("%s: %d %s runner(s)%s, expected at least %d", org, n, state, rule.labelText(), rule.min)
+		}
+	case "offline":
+		for _, runner := range runners {
+			since, ok := offlineSince[fmt.Sprintf("%s/%d", org, runner.GetID())]
+			if !ok || !rule.matches(runner) || now.Sub(since) < rule.offline {
+				continue
+			}
+			firing[fmt.Sprintf("%s|%s|%d", rule.raw, org, runner.GetID())] = fmt.Sprintf("%s: runner %s%s offline since %s",
+				org, runner.GetName(), rule.labelText(), since.UTC().Format("15:04 MST"))
+		}
+	}
+	return firing
+}
+
+// listOrgRunners lists all self-hosted runners of an organization.
+func listOrgRunners(ctx context.Context, org string) ([]*github.Runner, error) {
+	var all []*github.Runner
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		if err := budget.acquire(ctx); err != nil {
+			return nil, err
+		}
+		listCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+		runners, resp, err := githubClient.Actions.ListOrganizationRunners(listCtx, org, opts)
+		cancel()
+		budget.update(resp)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, runners.Runners...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// sendRunnerAlerts sends the alerts that started firing, and those that
+// stopped, to every alert target.
+func sendRunnerAlerts(ctx context.Context, prev, next map[string]runnerAlert) {
+	var keys []string
+	for key := range prev {
+		keys = append(keys, key)
+	}
+	for key := range next {
+		if _, ok := prev[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		old, wasFiring := prev[key]
+		alert, firing := next[key]
+		if wasFiring == firing {
+			continue
+		}
+		rule, _, _ := strings.Cut(key, "|")
+		var n notification
+		if firing {
+			n.URL = githubWebURL + "/organizations/" + alert.Org + "/settings/actions/runners"
+			n.Title = "🚨 " + alert.Title
+			n.Body = fmt.Sprintf("Runner alert: %s\n\n%s", rule, n.URL)
+		} else {
+			n.URL = githubWebURL + "/organizations/" + old.Org + "/settings/actions/runners"
+			n.Title = "✅ Resolved: " + old.Title
+			n.Body = fmt.Sprintf("Runner alert: %s\nFiring since %s\n\n%s", rule, old.Since.UTC().Format(time.RFC3339), n.URL)
+		}
+		log.Printf("🏃 %s", n.Title)
+		for _, target := range alerts.targets {
+			if err := target.Send(ctx, n, firing); err != nil {
+				log.Printf("⚠️  Error sending runner alert to %s: %v", target.Name(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// runnerStats enables fetching the jobs of every finished run (RUNNER_STATS)
+// so /api/stats/runners covers all runs, not just the ones whose jobs are
+// fetched anyway (running, failed with MATRIX_EXPANSION, COST_ESTIMATION).
+var runnerStats bool
+
+func loadRunnerStatsConfig() {
+	runnerStats = os.Getenv("RUNNER_STATS") == "true"
+	if runnerStats {
+		log.Printf("🏃 Runner label stats enabled")
+	}
+}
+
+// RunnerUsage is how the jobs of a run that ran on one runner label went.
+type RunnerUsage struct {
+	Label           string `json:"label"`
+	Jobs            int    `json:"jobs"`
+	Failed          int    `json:"failed"`
+	QueueSeconds    int64  `json:"queue_seconds"`     // summed over the jobs, from creation until a runner picked them up
+	MaxQueueSeconds int64  `json:"max_queue_seconds"` // of the longest waiting job
+}
+
+// RunnerJob is a job of a run that ran on a self-hosted runner, so a
+// machine that keeps failing jobs stands out. GitHub-hosted runners are
+// fresh machines for every job and aren't recorded.
+type RunnerJob struct {
+	Job    string `json:"job"`
+	Runner string `json:"runner"`
+	Group  string `json:"group,omitempty"` // runner group
+	Failed bool   `json:"failed,omitempty"`
+}
+
+// runnerGroup is the label a job's runner is counted under: "self-hosted"
+// for self-hosted runners, whatever their other labels, otherwise the
+// hosted runner label from runs-on, e.g. "ubuntu-latest".
+func runnerGroup(labels []string) string {
+	for _, label := range labels {
+		if strings.EqualFold(label, "self-hosted") {
+			return "self-hosted"
+		}
+	}
+	if len(labels) == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(labels[0])
+}
+
+// runnerUsage sums the finished jobs of a run per runner label. Skipped
+// jobs never got a runner and are left out.
+func runnerUsage(jobs []*github.WorkflowJob) []RunnerUsage {
+	byLabel := make(map[string]*RunnerUsage)
+	var order []string
+	for _, job := range jobs {
+		if job.GetStatus() != "completed" || job.GetConclusion() == "skipped" || job.StartedAt == nil {
+			continue
+		}
+		label := runnerGroup(job.Labels)
+		usage, ok := byLabel[label]
+		if !ok {
+			usage = &RunnerUsage{Label: label}
+			byLabel[label] = usage
+			order = append(order, label)
+		}
+		usage.Jobs++
+		if dashboardStatus(job.GetStatus(), job.GetConclusion()) == "failed" {
+			usage.Failed++
+		}
+		if job.CreatedAt != nil {
+			queued := max(int64(job.StartedAt.Sub(job.CreatedAt.Time).Seconds()), 0)
+			usage.QueueSeconds += queued
+			usage.MaxQueueSeconds = max(usage.MaxQueueSeconds, queued)
+		}
+	}
+
+	usages := make([]RunnerUsage, len(order))
+	for i, label := range order {
+		usages[i] = *byLabel[label]
+	}
+	return usages
+}
+
+// runnerJobs returns the finished jobs of a run that ran on a self-hosted
+// runner. Cancelled jobs count as jobs, not as failures of the runner.
+func runnerJobs(jobs []*github.WorkflowJob) []RunnerJob {
+	var result []RunnerJob
+	for _, job := range jobs {
+		if job.GetStatus() != "completed" || job.GetRunnerName() == "" || runnerGroup(job.Labels) != "self-hosted" {
+			continue
+		}
+		result = append(result, RunnerJob{
+			Job:    job.GetName(),
+			Runner: job.GetRunnerName(),
+			Group:  job.GetRunnerGroupName(),
+			Failed: job.GetConclusion() == "failure" || job.GetConclusion() == "timed_out",
+		})
+	}
+	return result
+}
+
+// RunnerLabelStats aggregates the jobs that ran on one runner label.
+type RunnerLabelStats struct {
+	Label           string   `json:"label"`
+	Runs            int      `json:"runs"` // runs with at least one job on the label
+	Jobs            int      `json:"jobs"`
+	Failed          int      `json:"failed"`
+	FailureRate     *float64 `json:"failure_rate,omitempty"` // percentage of jobs that failed
+	AvgQueueSeconds int64    `json:"avg_queue_seconds"`
+	MaxQueueSeconds int64    `json:"max_queue_seconds"`
+	queueSeconds    int64
+}
+
+// SelfHostedRunnerStats aggregates the jobs that ran on one self-hosted
+// runner, compared with the other runners of its group.
+type SelfHostedRunnerStats struct {
+	Organization    string   `json:"organization"`
+	Runner          string   `json:"runner"`
+	Group           string   `json:"group,omitempty"`
+	Jobs            int      `json:"jobs"`
+	Failed          int      `json:"failed"`
+	FailureRate     *float64 `json:"failure_rate,omitempty"`      // percentage of jobs that failed
+	PeerFailureRate *float64 `json:"peer_failure_rate,omitempty"` // of the other runners of the group
+	PassedElsewhere int      `json:"passed_elsewhere"`            // failed jobs that passed on another runner in the period
+	Suspect         bool     `json:"suspect,omitempty"`           // fails far more often than its peers, see suspectRunner
+}
+
+type RunnerStatsResponse struct {
+	Period      string                  `json:"period"`
+	RunsCovered int                     `json:"runs_covered"`
+	RunsMissing int                     `json:"runs_missing"` // finished GitHub runs whose jobs weren't fetched, e.g. on a low budget
+	Labels      []RunnerLabelStats      `json:"labels"`       // most jobs first
+	Runners     []SelfHostedRunnerStats `json:"runners"`      // suspects first, then by failure rate
+}
+
+// RunnerTally adds up the runner usage of every run as it's collected, per
+// organization, so /api/stats/runners covers the runs MAX_JOBS leaves out
+// of the job list too.
+type RunnerTally struct {
+	Orgs map[string]*orgRunnerTally `json:"orgs"`
+}
+
+type orgRunnerTally struct {
+	RunsCovered int                       `json:"runs_covered"`
+	RunsMissing int                       `json:"runs_missing"`
+	Labels      map[string]*labelTally    `json:"labels,omitempty"`
+	Runners     map[string]*runnerTally   `json:"runners,omitempty"`  // self-hosted, by name
+	Failures    map[string]map[string]int `json:"failures,omitempty"` // repo/job -> runner -> failed jobs outside maintenance windows
+	Passes      map[string][]string       `json:"passes,omitempty"`   // repo/job -> runners it passed on
+}
+
+type labelTally struct {
+	Runs            int   `json:"runs"`
+	Jobs            int   `json:"jobs"`
+	Failed          int   `json:"failed"`
+	QueueSeconds    int64 `json:"queue_seconds"`
+	MaxQueueSeconds int64 `json:"max_queue_seconds"`
+}
+
+type runnerTally struct {
+	Group  string `json:"group,omitempty"`
+	Jobs   int    `json:"jobs"`
+	Failed int    `json:"failed"`
+}
+
+func (t *RunnerTally) org(name string) *orgRunnerTally {
+	if t.Orgs == nil {
+		t.Orgs = make(map[string]*orgRunnerTally)
+	}
+	org, ok := t.Orgs[name]
+	if !ok {
+		org = &orgRunnerTally{
+			Labels:   make(map[string]*labelTally),
+			Runners:  make(map[string]*runnerTally),
+			Failures: make(map[string]map[string]int),
+			Passes:   make(map[string][]string),
+		}
+		t.Orgs[name] = org
+	}
+	return org
+}
+
+// add counts the runner usage recorded on a job. Failures during
+// maintenance windows aren't counted as failures.
+func (t *RunnerTally) add(job Job) {
+	maintenance := hasTag(job, "maintenance")
+	if job.Runners == nil {
+		if (job.Provider == "github" || job.Provider == "demo") && finished(job) {
+			t.org(job.Organization).RunsMissing++
+		}
+	} else {
+		org := t.org(job.Organization)
+		org.RunsCovered++
+		for _, usage := range job.Runners {
+			failed := usage.Failed
+			if maintenance {
+				failed = 0
+			}
+			org.addLabel(usage.Label, labelTally{Runs: 1, Jobs: usage.Jobs, Failed: failed, QueueSeconds: usage.QueueSeconds, MaxQueueSeconds: usage.MaxQueueSeconds})
+		}
+	}
+
+	for _, runJob := range job.RunnerJobs {
+		org := t.org(job.Organization)
+		runner := runnerTally{Group: runJob.Group, Jobs: 1}
+		name := job.Pipeline + "/" + runJob.Job
+		switch {
+		case !runJob.Failed:
+			org.addPass(name, runJob.Runner)
+		case !maintenance:
+			runner.Failed = 1
+			org.addFailures(name, runJob.Runner, 1)
+		}
+		org.addRunner(runJob.Runner, runner)
+	}
+}
+
+func (o *orgRunnerTally) addLabel(label string, other labelTally) {
+	stats, ok := o.Labels[label]
+	if !ok {
+		stats = &labelTally{}
+		o.Labels[label] = stats
+	}
+	stats.Runs += other.Runs
+	stats.Jobs += other.Jobs
+	stats.Failed += other.Failed
+	stats.QueueSeconds += other.QueueSeconds
+	stats.MaxQueueSeconds = max(stats.MaxQueueSeconds, other.MaxQueueSeconds)
+}
+
+func (o *orgRunnerTally) addRunner(name string, other runnerTally) {
+	stats, ok := o.Runners[name]
+	if !ok {
+		stats = &runnerTally{Group: other.Group}
+		o.Runners[name] = stats
+	}
+	stats.Jobs += other.Jobs
+	stats.Failed += other.Failed
+}
+
+func (o *orgRunnerTally) addFailures(job, runner string, n int) {
+	if o.Failures[job] == nil {
+		o.Failures[job] = make(map[string]int)
+	}
+	o.Failures[job][runner] += n
+}
+
+func (o *orgRunnerTally) addPass(job, runner string) {
+	for _, passed := range o.Passes[job] {
+		if passed == runner {
+			return
+		}
+	}
+	o.Passes[job] = append(o.Passes[job], runner)
+}
+
+// merge adds the tally of other, without sharing anything with it.
+func (t *RunnerTally) merge(other *RunnerTally) {
+	if other == nil {
+		return
+	}
+	for name, from := range other.Orgs {
+		org := t.org(name)
+		org.RunsCovered += from.RunsCovered
+		org.RunsMissing += from.RunsMissing
+		for label, stats := range from.Labels {
+			org.addLabel(label, *stats)
+		}
+		for runner, stats := range from.Runners {
+			org.addRunner(runner, *stats)
+		}
+		for job, runners := range from.Failures {
+			for runner, n := range runners {
+				org.addFailures(job, runner, n)
+			}
+		}
+		for job, runners := range from.Passes {
+			for _, runner := range runners {
+				org.addPass(job, runner)
+			}
+		}
+	}
+}
+
+// tallyRunners tallies the jobs of a snapshot that has no tally of its own.
+func tallyRunners(jobs []Job) *RunnerTally {
+	tally := &RunnerTally{}
+	for _, job := range jobs {
+		tally.add(job)
+	}
+	return tally
+}
+
+// stats returns the runner stats of one organization, or all of them.
+func (t *RunnerTally) stats(org string) RunnerStatsResponse {
+	response := RunnerStatsResponse{Labels: []RunnerLabelStats{}, Runners: []SelfHostedRunnerStats{}}
+	byLabel := make(map[string]*RunnerLabelStats)
+	for name, tally := range t.Orgs {
+		if org != "" && name != org {
+			continue
+		}
+		response.RunsCovered += tally.RunsCovered
+		response.RunsMissing += tally.RunsMissing
+		for label, usage := range tally.Labels {
+			stats, ok := byLabel[label]
+			if !ok {
+				stats = &RunnerLabelStats{Label: label}
+				byLabel[label] = stats
+			}
+			stats.Runs += usage.Runs
+			stats.Jobs += usage.Jobs
+			stats.Failed += usage.Failed
+			stats.queueSeconds += usage.QueueSeconds
+			stats.MaxQueueSeconds = max(stats.MaxQueueSeconds, usage.MaxQueueSeconds)
+		}
+		response.Runners = append(response.Runners, tally.selfHostedRunners(name)...)
+	}
+
+	for _, stats := range byLabel {
+		if stats.Jobs > 0 {
+			rate := math.Round(float64(stats.Failed)/float64(stats.Jobs)*1000) / 10
+			stats.FailureRate = &rate
+			stats.AvgQueueSeconds = stats.queueSeconds / int64(stats.Jobs)
+		}
+		response.Labels = append(response.Labels, *stats)
+	}
+	sort.Slice(response.Labels, func(i, j int) bool {
+		if response.Labels[i].Jobs != response.Labels[j].Jobs {
+			return response.Labels[i].Jobs > response.Labels[j].Jobs
+		}
+		return response.Labels[i].Label < response.Labels[j].Label
+	})
+	sort.Slice(response.Runners, func(i, j int) bool {
+		a, b := response.Runners[i], response.Runners[j]
+		if a.Suspect != b.Suspect {
+			return a.Suspect
+		}
+		if *a.FailureRate != *b.FailureRate {
+			return *a.FailureRate > *b.FailureRate
+		}
+		if a.Jobs != b.Jobs {
+			return a.Jobs > b.Jobs
+		}
+		return a.Organization+"/"+a.Runner < b.Organization+"/"+b.Runner
+	})
+	return response
+}
+
+// suspectMinFailures is how many jobs a runner has to fail before it can
+// be a suspect, so one unlucky job doesn't make one.
+const suspectMinFailures = 3
+
+// suspectRunner reports whether a runner looks like a bad machine rather
+// than running bad jobs: it failed at least suspectMinFailures jobs, at
+// least twice as often as the other runners of its group, and some of the
+// jobs it failed passed on another runner.
+func suspectRunner(stats SelfHostedRunnerStats) bool {
+	if stats.Failed < suspectMinFailures || stats.PassedElsewhere == 0 || stats.FailureRate == nil {
+		return false
+	}
+	if stats.PeerFailureRate == nil {
+		return true
+	}
+	rate, peerRate := *stats.FailureRate, *stats.PeerFailureRate
+	return rate >= 2*peerRate
+}
+
+// selfHostedRunners returns the stats of an organization's self-hosted
+// runners. Runner names are only unique within an organization.
+func (o *orgRunnerTally) selfHostedRunners(org string) []SelfHostedRunnerStats {
+	groups := make(map[string]runnerTally) // totals per runner group
+	for _, runner := range o.Runners {
+		group := groups[runner.Group]
+		group.Jobs += runner.Jobs
+		group.Failed += runner.Failed
+		groups[runner.Group] = group
+	}
+	passedElsewhere := make(map[string]int)
+	for job, runners := range o.Failures {
+		for runner, n := range runners {
+			for _, passed := range o.Passes[job] {
+				if passed != runner {
+					passedElsewhere[runner] += n
+					break
+				}
+			}
+		}
+	}
+
+	var runners []SelfHostedRunnerStats
+	for name, runner := range o.Runners {
+		stats := SelfHostedRunnerStats{Organization: org, Runner: name, Group: runner.Group, Jobs: runner.Jobs, Failed: runner.Failed, PassedElsewhere: passedElsewhere[name]}
+		rate := math.Round(float64(stats.Failed)/float64(stats.Jobs)*1000) / 10
+		stats.FailureRate = &rate
+		group := groups[runner.Group]
+		if peerJobs := group.Jobs - stats.Jobs; peerJobs > 0 {
+			peerRate := math.Round(float64(group.Failed-stats.Failed)/float64(peerJobs)*1000) / 10
+			stats.PeerFailureRate = &peerRate
+		}
+		stats.Suspect = suspectRunner(stats)
+		runners = append(runners, stats)
+	}
+	return runners
+}
+
+// runnerStatsHandler serves /api/stats/runners?period=week&org=, job
+// counts, queue times and failure rates per runner label, and the failure
+// rates of the self-hosted runners.
+func runnerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !runnerStats {
+		http.Error(w, "Runner label stats are not enabled (set RUNNER_STATS=true)", http.StatusNotFound)
+		return
+	}
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	tally := snap.Runners
+	if tally == nil {
+		tally = tallyRunners(snap.Response.Jobs)
+	}
+	response := tally.stats(r.URL.Query().Get("org"))
+	response.Period = period
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
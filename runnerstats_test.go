@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestSuspectRunner(t *testing.T) {
+	rate := func(r float64) *float64 { return &r }
+	tests := []struct {
+		name  string
+		stats SelfHostedRunnerStats
+		want  bool
+	}{
+		{
+			name:  "fails twice as often as its peers",
+			stats: SelfHostedRunnerStats{Jobs: 100, Failed: 10, FailureRate: rate(10), PeerFailureRate: rate(5), PassedElsewhere: 4},
+			want:  true,
+		},
+		{
+			name:  "fails a bit more often",
+			stats: SelfHostedRunnerStats{Jobs: 100, Failed: 10, FailureRate: rate(10), PeerFailureRate: rate(6), PassedElsewhere: 4},
+		},
+		{
+			name:  "too few failures",
+			stats: SelfHostedRunnerStats{Jobs: 10, Failed: 2, FailureRate: rate(20), PeerFailureRate: rate(1), PassedElsewhere: 2},
+		},
+		{
+			name:  "failed jobs never passed elsewhere",
+			stats: SelfHostedRunnerStats{Jobs: 100, Failed: 10, FailureRate: rate(10), PeerFailureRate: rate(1)},
+		},
+		{
+			name:  "no peers",
+			stats: SelfHostedRunnerStats{Jobs: 20, Failed: 3, FailureRate: rate(15), PassedElsewhere: 1},
+			want:  true,
+		},
+		{
+			name:  "peers never fail",
+			stats: SelfHostedRunnerStats{Jobs: 20, Failed: 3, FailureRate: rate(15), PeerFailureRate: rate(0), PassedElsewhere: 1},
+			want:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := suspectRunner(tt.stats); got != tt.want {
+				t.Errorf("suspectRunner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
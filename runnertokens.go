@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Runner tokens: /api/admin/runner-tokens hands out the short-lived
+// registration and removal tokens of an organization's self-hosted
+// runners, made with the dashboard's token (which needs admin:org), so
+// runner provisioning doesn't need a personal access token of its own.
+// Admins may get them for every configured organization; others only for
+// the organizations RUNNER_TOKEN_ACCESS grants them, signed in with OAuth
+// or, for automation, with a key from RUNNER_TOKEN_KEYS. Every token
+// handed out is recorded in an audit log in the Store.
+
+const runnerTokenAuditKey = "runner-token-audit"
+
+// maxRunnerTokenAudit caps the audit log, the oldest entries go first.
+const maxRunnerTokenAudit = 1000
+
+var (
+	// runnerTokenAccess grants logins and keys ("key:<name>") the
+	// organizations they may get tokens for (RUNNER_TOKEN_ACCESS); "*" is
+	// every configured one.
+	runnerTokenAccess map[string][]string
+
+	// runnerTokenKeys are the secrets of named keys, by name
+	// (RUNNER_TOKEN_KEYS).
+	runnerTokenKeys map[string]string
+)
+
+// RunnerTokenAudit is one token handed out. The token itself isn't kept.
+type RunnerTokenAudit struct {
+	Organization string    `json:"organization"`
+	Kind         string    `json:"kind"` // "registration" or "remove"
+	IssuedTo     string    `json:"issued_to"`
+	RemoteAddr   string    `json:"remote_addr"`
+	IssuedAt     time.Time `json:"issued_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type RunnerToken struct {
+	Organization string    `json:"organization"`
+	Kind         string    `json:"kind"`
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// loadRunnerTokenConfig reads RUNNER_TOKEN_ACCESS, a comma-separated list
+// of login=org|org or key:name=org|org, and RUNNER_TOKEN_KEYS, a
+// comma-separated list of name:secret.
+func loadRunnerTokenConfig() {
+	runnerTokenAccess = make(map[string][]string)
+	runnerTokenKeys = make(map[string]string)
+	for _, entry := range splitList(os.Getenv("RUNNER_TOKEN_KEYS")) {
+		name, secret, ok := strings.Cut(entry, ":")
+		name, secret = strings.TrimSpace(name), strings.TrimSpace(secret)
+		if !ok || name == "" || len(secret) < 16 {
+			log.Fatalf("Invalid RUNNER_TOKEN_KEYS entry for %q: expected name:secret with a secret of 16 characters or more", name)
+		}
+		runnerTokenKeys[strings.ToLower(name)] = secret
+	}
+	for _, entry := range splitList(os.Getenv("RUNNER_TOKEN_ACCESS")) {
+		subject, orgs, ok := strings.Cut(entry, "=")
+		subject = strings.ToLower(strings.TrimSpace(subject))
+		var granted []string
+		for _, org := range strings.Split(orgs, "|") {
+			if org = strings.TrimSpace(org); org != "" {
+				granted = append(granted, org)
+			}
+		}
+		if !ok || subject == "" || len(granted) == 0 {
+			log.Fatalf("Invalid RUNNER_TOKEN_ACCESS entry %q: expected login=org|org", entry)
+		}
+		runnerTokenAccess[subject] = append(runnerTokenAccess[subject], granted...)
+	}
+	for name := range runnerTokenKeys {
+		if _, ok := runnerTokenAccess["key:"+name]; !ok {
+			log.Fatalf("Invalid RUNNER_TOKEN_KEYS: key %q has no organizations in RUNNER_TOKEN_ACCESS (key:%s=org)", name, name)
+		}
+	}
+	if len(runnerTokenAccess) > 0 {
+		log.Printf("🎫 Runner tokens for %d login(s) and key(s) besides admins", len(runnerTokenAccess))
+	}
+}
+
+// runnerTokenRequester returns who asks for a runner token, and whether
+// they're an admin: a key from RUNNER_TOKEN_KEYS as "key:<name>", or an
+// admin or signed-in user.
+func runnerTokenRequester(r *http.Request) (who string, admin, ok bool) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		secret := []byte(strings.TrimPrefix(auth, "Bearer "))
+		for name, key := range runnerTokenKeys {
+			if subtle.ConstantTimeCompare(secret, []byte(key)) == 1 {
+				return "key:" + name, false, true
+			}
+		}
+	}
+	if who, ok := adminFrom(r); ok {
+		return who, true, true
+	}
+	if oauthConfig != nil {
+		if sess := loadSession(r); sess != nil {
+			return sess.Login, false, true
+		}
+	}
+	return "", false, false
+}
+
+// mayGetRunnerToken reports whether a login or key may get the runner
+// tokens of an organization.
+func mayGetRunnerToken(who string, admin bool, org string) bool {
+	if admin {
+		return true
+	}
+	for _, granted := range runnerTokenAccess[strings.ToLower(who)] {
+		if granted == "*" || strings.EqualFold(granted, org) {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredGitHubOrg reports whether org is one of the GitHub
+// organizations on the dashboard, not a personal account.
+func configuredGitHubOrg(org string) bool {
+	for _, src := range currentSources() {
+		if src.Provider.Name() == "github" && strings.EqualFold(src.Org, org) && !isGitHubUser(org) {
+			return true
+		}
+	}
+	return false
+}
+
+// createRunnerToken makes a registration or removal token of an
+// organization.
+func createRunnerToken(ctx context.Context, org, kind string) (*RunnerToken, error) {
+	if err := budget.acquire(ctx); err != nil {
+		return nil, err
+	}
+	token := &RunnerToken{Organization: org, Kind: kind}
+	if kind == "remove" {
+		created, resp, err := githubClient.Actions.CreateOrganizationRemoveToken(ctx, org)
+		budget.update(resp)
+		if err != nil {
+			return nil, err
+		}
+		token.Token, token.ExpiresAt = created.GetToken(), created.GetExpiresAt().Time
+		return token, nil
+	}
+	created, resp, err := githubClient.Actions.CreateOrganizationRegistrationToken(ctx, org)
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+	token.Token, token.ExpiresAt = created.GetToken(), created.GetExpiresAt().Time
+	return token, nil
+}
+
+func loadRunnerTokenAudit(ctx context.Context) ([]RunnerTokenAudit, error) {
+	data, ok, err := store.Get(ctx, runnerTokenAuditKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var audit []RunnerTokenAudit
+	if err := json.Unmarshal(data, &audit); err != nil {
+		return nil, err
+	}
+	return audit, nil
+}
+
+// recordRunnerToken adds an entry to the audit log under a lock, like
+// updateViewTokens.
+func recordRunnerToken(ctx context.Context, entry RunnerTokenAudit) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+runnerTokenAuditKey, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			time.Sleep(lockPollInterval)
+			continue
+		}
+		defer release()
+
+		audit, err := loadRunnerTokenAudit(ctx)
+		if err != nil {
+			return err
+		}
+		audit = append(audit, entry)
+		if len(audit) > maxRunnerTokenAudit {
+			audit = audit[len(audit)-maxRunnerTokenAudit:]
+		}
+		data, err := json.Marshal(audit)
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, runnerTokenAuditKey, data, 0)
+	}
+	return fmt.Errorf("timed out waiting for the runner token audit lock")
+}
+
+// runnerTokensHandler serves /api/admin/runner-tokens:
+//
+//	POST ?org=acme&kind=registration  a registration token (the default kind)
+//	POST ?org=acme&kind=remove        a removal token
+//	GET  [?org=acme]                  the audit log, newest first (admins only)
+func runnerTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if adminToken == "" && len(oauthAdmins) == 0 && len(runnerTokenAccess) == 0 {
+		http.Error(w, "Runner tokens are not enabled (set ADMIN_TOKEN, OAUTH_ADMINS or RUNNER_TOKEN_ACCESS)", http.StatusNotFound)
+		return
+	}
+	who, admin, ok := runnerTokenRequester(r)
+	if !ok {
+		http.Error(w, "Runner tokens need an admin, a login or a key from RUNNER_TOKEN_KEYS as bearer token", http.StatusUnauthorized)
+		return
+	}
+	org := strings.TrimSpace(r.URL.Query().Get("org"))
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case http.MethodGet:
+		if !admin {
+			http.Error(w, "Only admins can read the runner token audit log", http.StatusForbidden)
+			return
+		}
+		audit, err := loadRunnerTokenAudit(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading runner token audit log: %v", err), http.StatusInternalServerError)
+			return
+		}
+		entries := []RunnerTokenAudit{}
+		for i := len(audit) - 1; i >= 0; i-- {
+			if org == "" || strings.EqualFold(audit[i].Organization, org) {
+				entries = append(entries, audit[i])
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+
+	case http.MethodPost:
+		kind := r.URL.Query().Get("kind")
+		if kind == "" {
+			kind = "registration"
+		}
+		if kind != "registration" && kind != "remove" {
+			http.Error(w, fmt.Sprintf("Invalid kind %q: expected registration or remove", kind), http.StatusBadRequest)
+			return
+		}
+		if org == "" || strings.ContainsAny(org, "/ ,") {
+			http.Error(w, "Expected ?org=<organization>", http.StatusBadRequest)
+			return
+		}
+		if demoMode || !configuredGitHubOrg(org) {
+			http.Error(w, fmt.Sprintf("%s is not a GitHub organization on the dashboard", org), http.StatusNotFound)
+			return
+		}
+		if !mayGetRunnerToken(who, admin, org) {
+			log.Printf("🎫 %s was refused a runner %s token for %s", who, kind, org)
+			http.Error(w, fmt.Sprintf("%s may not get runner tokens for %s", who, org), http.StatusForbidden)
+			return
+		}
+
+		ctx, cancel := withPhaseTimeout(r.Context(), runListTimeout)
+		defer cancel()
+		token, err := createRunnerToken(ctx, org, kind)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creating runner %s token for %s: %v", kind, org, err), http.StatusBadGateway)
+			return
+		}
+		// No audit, no token
+		entry := RunnerTokenAudit{Organization: org, Kind: kind, IssuedTo: who, RemoteAddr: r.RemoteAddr, IssuedAt: clock(), ExpiresAt: token.ExpiresAt}
+		if err := recordRunnerToken(r.Context(), entry); err != nil {
+			http.Error(w, fmt.Sprintf("Error recording runner token: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("🎫 %s got a runner %s token for %s (expires %s)", who, kind, org, token.ExpiresAt.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(token)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Workflow scans: the workflow files of every repository in an
+// organization, read from the default branch, for audits that look at how
+// workflows are written rather than how they ran.
+
+// workflowScanTTL is how long an organization's scanned workflow files are
+// reused.
+const workflowScanTTL = time.Hour
+
+// workflowSource is one workflow file as scanned.
+type workflowSource struct {
+	Repository string // org/repo
+	Path       string
+	Content    string
+}
+
+// workflowScan is the result of scanning one organization.
+type workflowScan struct {
+	Files        []workflowSource
+	Repos        int // repositories scanned
+	ReposSkipped int // not scanned because the rate limit budget ran out
+	ScannedAt    time.Time
+	Err          error
+}
+
+var workflowScans = struct {
+	sync.Mutex
+	orgs map[string]workflowScan
+}{orgs: make(map[string]workflowScan)}
+
+// workflowBlobs caches file contents by blob SHA, so rescans only download
+// files that changed.
+var workflowBlobs = struct {
+	sync.Mutex
+	content map[string]string
+}{content: make(map[string]string)}
+
+const maxCachedWorkflowBlobs = 5000
+
+// scanWorkflows returns the workflow files of an organization's GitHub
+// repositories, cached for workflowScanTTL unless refresh is set.
+func scanWorkflows(ctx context.Context, org string, refresh bool) workflowScan {
+	workflowScans.Lock()
+	scan, ok := workflowScans.orgs[org]
+	workflowScans.Unlock()
+	if ok && !refresh && clock().Sub(scan.ScannedAt) < workflowScanTTL {
+		return scan
+	}
+
+	if demoMode {
+		scan = workflowScan{Files: demoWorkflowSources(org), Repos: len(demoRepos), ScannedAt: clock()}
+	} else {
+		scan = fetchWorkflowSources(ctx, org)
+	}
+	if scan.Err == nil {
+		workflowScans.Lock()
+		workflowScans.orgs[org] = scan
+		workflowScans.Unlock()
+	}
+	return scan
+}
+
+func fetchWorkflowSources(ctx context.Context, org string) workflowScan {
+	scan := workflowScan{ScannedAt: clock()}
+	log.Printf("🔎 Scanning workflow files of %s", org)
+	repos, err := listComplianceRepos(ctx, org)
+	if err != nil {
+		scan.Err = err
+		return scan
+	}
+	for i, repo := range repos {
+		files, err := repoWorkflowSources(ctx, org, repo.Name)
+		if errors.Is(err, errBudgetExhausted) {
+			scan.ReposSkipped = len(repos) - i
+			log.Printf("   ⏸️  Skipping the workflow scan of %d remaining repositories in %s: %v", scan.ReposSkipped, org, err)
+			break
+		}
+		scan.Repos++
+		if err != nil {
+			log.Printf("   ⚠️  Error scanning workflows of %s/%s: %v", org, repo.Name, err)
+			continue
+		}
+		scan.Files = append(scan.Files, files...)
+	}
+	log.Printf("✅ Scanned %d workflow files in %d repositories of %s", len(scan.Files), scan.Repos, org)
+	return scan
+}
+
+// repoWorkflowSources reads the files in .github/workflows of a
+// repository's default branch. Repositories without workflows have none.
+func repoWorkflowSources(ctx context.Context, org, repo string) ([]workflowSource, error) {
+	if err := budget.acquire(ctx); err != nil {
+		return nil, err
+	}
+	_, entries, resp, err := githubClient.Repositories.GetContents(ctx, org, repo, ".github/workflows", nil)
+	budget.update(resp)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var files []workflowSource
+	for _, entry := range entries {
+		name := entry.GetName()
+		if entry.GetType() != "file" || !(strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml")) {
+			continue
+		}
+		content, err := workflowBlob(ctx, org, repo, entry)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, workflowSource{Repository: org + "/" + repo, Path: entry.GetPath(), Content: content})
+	}
+	return files, nil
+}
+
+func workflowBlob(ctx context.Context, org, repo string, entry *github.RepositoryContent) (string, error) {
+	workflowBlobs.Lock()
+	content, ok := workflowBlobs.content[entry.GetSHA()]
+	workflowBlobs.Unlock()
+	if ok {
+		return content, nil
+	}
+
+	if err := budget.acquire(ctx); err != nil {
+		return "", err
+	}
+	file, _, resp, err := githubClient.Repositories.GetContents(ctx, org, repo, entry.GetPath(), nil)
+	budget.update(resp)
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", fmt.Errorf("%s is not a file", entry.GetPath())
+	}
+	content, err = file.GetContent()
+	if err != nil {
+		return "", err
+	}
+
+	workflowBlobs.Lock()
+	if len(workflowBlobs.content) >= maxCachedWorkflowBlobs {
+		workflowBlobs.content = make(map[string]string)
+	}
+	workflowBlobs.content[entry.GetSHA()] = content
+	workflowBlobs.Unlock()
+	return content, nil
+}
+
+// actionUse is a "uses:" reference to an action or reusable workflow.
+type actionUse struct {
+	Line   int
+	Uses   string // as written, e.g. "actions/checkout@v4"
+	Action string // "actions/checkout"
+	Ref    string // "v4"
+}
+
+var usesPattern = regexp.MustCompile(`^\s*(?:-\s+)?uses:\s*["']?([^"'\s#]+)`)
+
+// uses returns the actions a workflow file references, except local
+// actions ("./...") and docker:// images which have no ref.
+func (f workflowSource) uses() []actionUse {
+	var uses []actionUse
+	for i, line := range strings.Split(f.Content, "\n") {
+		m := usesPattern.FindStringSubmatch(line)
+		if m == nil || strings.HasPrefix(m[1], "./") || strings.HasPrefix(m[1], "docker://") {
+			continue
+		}
+		action, ref, _ := strings.Cut(m[1], "@")
+		uses = append(uses, actionUse{Line: i + 1, Uses: m[1], Action: action, Ref: ref})
+	}
+	return uses
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchResult is a cached run matching a search, with the fields it
+// matched on.
+type SearchResult struct {
+	Job
+	Score   int      `json:"score"`
+	Matches []string `json:"matches"` // e.g. "repository", "branch"
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"` // matches before the limit
+	Results []SearchResult `json:"results"`
+}
+
+// searchField is a searchable field of a job and how much a match on it
+// counts; a repository match ranks above a word somewhere in a commit message.
+type searchField struct {
+	name   string
+	weight int
+	value  func(job *Job) string
+}
+
+var searchFields = []searchField{
+	{"repository", 5, func(job *Job) string { return job.Organization + "/" + job.Pipeline }},
+	{"workflow", 4, func(job *Job) string { return workflowName(job.Name) }},
+	{"branch", 3, func(job *Job) string { return job.Branch }},
+	{"actor", 3, func(job *Job) string { return job.Actor }},
+	{"commit_message", 1, func(job *Job) string { return job.CommitMessage }},
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchHandler serves /api/search?q=, a quick-jump search over the runs in
+// the cached snapshots. It never triggers a fetch.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	terms := strings.Fields(strings.ToLower(query))
+	response := SearchResponse{Query: query, Results: []SearchResult{}}
+	for _, job := range viewerFrom(r).jobs(cachedJobs(r)) {
+		if score, matches := scoreJob(&job, terms); score > 0 {
+			response.Results = append(response.Results, SearchResult{Job: job, Score: score, Matches: matches})
+		}
+	}
+	// Best match first, then most recent
+	sort.Slice(response.Results, func(i, j int) bool {
+		a, b := response.Results[i], response.Results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	response.Total = len(response.Results)
+	if len(response.Results) > limit {
+		response.Results = response.Results[:limit]
+	}
+
+	jobs := make([]Job, len(response.Results))
+	for i := range response.Results {
+		jobs[i] = response.Results[i].Job
+	}
+	localizeJobs(jobs, requestLocale(r.URL.Query().Get("locale")))
+	updateElapsed(jobs)
+	for i := range jobs {
+		response.Results[i].Job = jobs[i]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
+
+// cachedJobs returns the runs of every cached snapshot, once each. A run in
+// several periods is taken from the most recently fetched snapshot.
+func cachedJobs(r *http.Request) []Job {
+	type cached struct {
+		job       Job
+		fetchedAt time.Time
+	}
+	byID := make(map[string]cached)
+	for _, period := range []string{"today", "week", "month"} {
+		snap, err := loadSnapshot(r.Context(), period)
+		if err != nil || snap == nil {
+			continue
+		}
+		for _, job := range snap.Response.Jobs {
+			key := job.Provider + "|" + job.ID
+			if c, ok := byID[key]; ok && !snap.FetchedAt.After(c.fetchedAt) {
+				continue
+			}
+			byID[key] = cached{job: job, fetchedAt: snap.FetchedAt}
+		}
+	}
+
+	jobs := make([]Job, 0, len(byID))
+	for _, c := range byID {
+		jobs = append(jobs, c.job)
+	}
+	return jobs
+}
+
+// scoreJob ranks a job against the lowercased query terms. Every term has to
+// match some field; per term the best field counts, and an exact match
+// scores above a prefix match, which scores above a substring.
+func scoreJob(job *Job, terms []string) (int, []string) {
+	values := make([]string, len(searchFields))
+	for i, field := range searchFields {
+		values[i] = strings.ToLower(field.value(job))
+	}
+
+	score := 0
+	matched := make(map[string]bool)
+	for _, term := range terms {
+		best, bestField := 0, ""
+		for i, field := range searchFields {
+			value := values[i]
+			var s int
+			switch {
+			case value == term:
+				s = 3 * field.weight
+			case strings.HasPrefix(value, term) || strings.Contains(value, "/"+term) || strings.Contains(value, " "+term):
+				s = 2 * field.weight
+			case strings.Contains(value, term):
+				s = field.weight
+			}
+			if s > best {
+				best, bestField = s, field.name
+			}
+		}
+		if best == 0 {
+			return 0, nil
+		}
+		score += best
+		matched[bestField] = true
+	}
+
+	var matches []string
+	for _, field := range searchFields {
+		if matched[field.name] {
+			matches = append(matches, field.name)
+		}
+	}
+	return score, matches
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// `snapshot export` and `snapshot import` dump and restore everything the
+// dashboard keeps in the store (snapshots, run history, weekly summaries,
+// custom tags, ...) as a portable file, for backups and for moving to
+// another Redis. The file is newline-delimited JSON: a header line, then
+// one line per key.
+
+const storeExportFormat = "monitoring-cicd-store"
+
+type storeExportHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+type storeExportEntry struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"` // nil for keys that don't expire
+}
+
+const snapshotUsage = `usage:
+  main snapshot export [file]   dump the store to file (default: stdout)
+  main snapshot import <file>   restore a dump into the store ("-" reads stdin)`
+
+// runSnapshotCommand runs the snapshot subcommand against the store
+// configured by STORE_URL.
+func runSnapshotCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") || len(args) > 2 || (args[0] == "import" && len(args) != 2) {
+		return errors.New(snapshotUsage)
+	}
+	st, err := newStore(os.Getenv("STORE_URL"))
+	if err != nil {
+		return fmt.Errorf("error initializing store: %v", err)
+	}
+	scanner, ok := st.(storeScanner)
+	if !ok {
+		return errors.New("the in-memory store only lives inside the server process; set STORE_URL to a redis:// URL (use SNAPSHOT_FILE to keep snapshots of an in-memory store)")
+	}
+
+	file := "-"
+	if len(args) == 2 {
+		file = args[1]
+	}
+	ctx := context.Background()
+	if args[0] == "export" {
+		out := io.Writer(os.Stdout)
+		if file != "-" {
+			f, err := os.Create(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		exported, err := exportStore(ctx, scanner, out)
+		if err != nil {
+			return fmt.Errorf("export failed after %d keys: %v", exported, err)
+		}
+		log.Printf("✅ Exported %d keys to %s", exported, file)
+		return nil
+	}
+
+	in := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	imported, expired, err := importStore(ctx, st, in)
+	if err != nil {
+		return fmt.Errorf("import failed after %d keys: %v", imported, err)
+	}
+	log.Printf("✅ Imported %d keys from %s (%d already expired, skipped)", imported, file, expired)
+	return nil
+}
+
+// exportStore writes every key of the store except fetch locks, which only
+// mean something to the replicas holding them, login sessions and users'
+// stored tokens.
+func exportStore(ctx context.Context, scanner storeScanner, out io.Writer) (int, error) {
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(storeExportHeader{Format: storeExportFormat, Version: 1, ExportedAt: clock()}); err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	err := scanner.Scan(ctx, func(key string, value []byte, ttl time.Duration) error {
+		// Sessions hold users' GitHub tokens and don't belong in backups
+		if strings.HasPrefix(key, "lock:") || strings.HasPrefix(key, "session:") || strings.HasPrefix(key, "user-token:") {
+			return nil
+		}
+		// Everything the dashboard stores is JSON; anything else belongs to
+		// someone sharing the Redis database
+		if !json.Valid(value) {
+			log.Printf("⚠️  Skipping key %q: not written by the dashboard", key)
+			return nil
+		}
+		entry := storeExportEntry{Key: key, Value: value}
+		if ttl > 0 {
+			expiresAt := clock().Add(ttl)
+			entry.ExpiresAt = &expiresAt
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, w.Flush()
+}
+
+// importStore writes the keys of a dump into the store, overwriting keys
+// that already exist. Keys keep the expiry they had when exported.
+func importStore(ctx context.Context, st Store, in io.Reader) (imported, expired int, err error) {
+	dec := json.NewDecoder(bufio.NewReader(in))
+	var header storeExportHeader
+	if err := dec.Decode(&header); err != nil || header.Format != storeExportFormat {
+		return 0, 0, errors.New("not a store export file")
+	}
+	if header.Version != 1 {
+		return 0, 0, fmt.Errorf("unsupported export version %d", header.Version)
+	}
+
+	for {
+		var entry storeExportEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return imported, expired, nil
+		} else if err != nil {
+			return imported, expired, err
+		}
+		var ttl time.Duration
+		if entry.ExpiresAt != nil {
+			ttl = entry.ExpiresAt.Sub(clock())
+			if ttl <= 0 {
+				expired++
+				continue
+			}
+		}
+		if err := st.Set(ctx, entry.Key, entry.Value, ttl); err != nil {
+			return imported, expired, err
+		}
+		imported++
+	}
+}
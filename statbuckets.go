@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// Custom stats buckets (STATS_BUCKETS): extra counters next to the fixed
+// ones, so the tiles can use a team's own vocabulary, e.g. cancelled and
+// skipped runs as "neutral" or timed out runs on their own. A bucket counts
+// the runs whose conclusion (in GitHub's terms, like "cancelled", "skipped"
+// or "timed_out", which every provider maps its outcomes to) or dashboard
+// status ("success", "failed", "running", "pending") it lists. Buckets may
+// overlap and don't change the fixed counters.
+
+// statBucket is a named counter of the runs with one of the given
+// conclusions or statuses.
+type statBucket struct {
+	name    string
+	matches []string
+}
+
+var statBuckets []statBucket
+
+// loadStatBucketsConfig reads STATS_BUCKETS, a comma-separated list of
+// name=value|value, e.g. neutral=cancelled|skipped,timed_out=timed_out.
+func loadStatBucketsConfig() {
+	statBuckets = nil
+	seen := make(map[string]bool)
+	for _, entry := range splitList(os.Getenv("STATS_BUCKETS")) {
+		name, values, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		var matches []string
+		for _, value := range strings.Split(values, "|") {
+			if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+				matches = append(matches, value)
+			}
+		}
+		if !ok || name == "" || len(matches) == 0 {
+			log.Fatalf("Invalid STATS_BUCKETS entry %q: expected name=conclusion|conclusion", entry)
+		}
+		if seen[name] {
+			log.Fatalf("Invalid STATS_BUCKETS: bucket %q is defined twice", name)
+		}
+		seen[name] = true
+		statBuckets = append(statBuckets, statBucket{name: name, matches: matches})
+	}
+	if len(statBuckets) > 0 {
+		log.Printf("🪣 %d custom stats buckets", len(statBuckets))
+	}
+}
+
+// countBuckets adds the job to the buckets it falls in. Every bucket is
+// listed, empty ones with 0, so tiles don't come and go.
+func countBuckets(stats *DashboardStats, job Job) {
+	if len(statBuckets) == 0 {
+		return
+	}
+	if stats.Buckets == nil {
+		stats.Buckets = make(map[string]int, len(statBuckets))
+	}
+	for _, bucket := range statBuckets {
+		n := stats.Buckets[bucket.name]
+		if bucket.contains(job) {
+			n++
+		}
+		stats.Buckets[bucket.name] = n
+	}
+}
+
+func (b statBucket) contains(job Job) bool {
+	for _, match := range b.matches {
+		if match == job.Conclusion || match == job.Status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// Drill-down page for a single GitHub Actions run:
+// run.html?owner=...&repo=...&run_id=...
+
+async function fetchRunDetail() {
+    const params = new URLSearchParams(window.location.search);
+    const owner = params.get('owner');
+    const repo = params.get('repo');
+    const runId = params.get('run_id');
+    const container = document.getElementById('runDetail');
+
+    if (!owner || !repo || !runId) {
+        container.innerHTML = '<div class="loading">Missing owner, repo or run_id.</div>';
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/runs/${encodeURIComponent(owner)}/${encodeURIComponent(repo)}/${encodeURIComponent(runId)}`);
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        renderRunDetail(await response.json());
+    } catch (error) {
+        console.error('Error fetching run details:', error);
+        container.innerHTML = `<div class="loading">Error loading run: ${escapeHtml(error.message)}</div>`;
+    }
+}
+
+function renderRunDetail(run) {
+    document.title = `${run.name} - Run Details`;
+    document.getElementById('runTitle').textContent = `${run.organization}/${run.pipeline} · ${run.name}`;
+    document.getElementById('githubLink').href = run.html_url || '#';
+
+    const pullRequests = run.pull_requests.length === 0 ? '-' : run.pull_requests.map(pr =>
+        `<a href="${pr.html_url}" target="_blank">#${pr.number}</a> (${escapeHtml(pr.head_branch)} → ${escapeHtml(pr.base_branch)})`
+    ).join(', ');
+
+    const attempts = run.attempts.map(attempt => `
+        <li>
+            <a href="${attempt.html_url || '#'}" target="_blank">Attempt ${attempt.attempt}</a>
+            <span class="status-badge ${attempt.status}">${attempt.status}</span>
+            ${attempt.started_at ? new Date(attempt.started_at).toLocaleString() : ''}
+        </li>
+    `).join('');
+
+    const change = run.workflow_change;
+    // github.com or the GitHub Enterprise Server the run is on
+    const webURL = run.html_url ? new URL(run.html_url).origin : 'https://github.com';
+    const workflowChange = !change ? '' : `
+        <div class="run-warning">
+            ⚠️ ${escapeHtml(change.message)}:
+            <code>${escapeHtml(change.path)}</code> changed since the last successful run
+            (${change.commits.map(commit => `<a href="${webURL}/${run.organization}/${run.pipeline}/commit/${commit.sha}" target="_blank"><code>${commit.sha.slice(0, 7)}</code></a> ${escapeHtml(commit.message)}`).join(', ')})
+        </div>
+    `;
+
+    document.getElementById('runDetail').innerHTML = `
+        ${workflowChange}
+        <div class="run-summary">
+            <div class="run-field"><span class="run-label">Status</span><span class="status-badge ${run.status}">${run.status}</span></div>
+            <div class="run-field"><span class="run-label">Branch</span>${escapeHtml(run.branch)}</div>
+            <div class="run-field"><span class="run-label">Event</span>${escapeHtml(run.event)}</div>
+            <div class="run-field"><span class="run-label">Actor</span>${escapeHtml(run.triggering_actor || run.actor || '-')}</div>
+            <div class="run-field"><span class="run-label">Started</span>${run.started}</div>
+            <div class="run-field"><span class="run-label">Queued</span>${formatSeconds(run.timing.queued_seconds)}</div>
+            <div class="run-field"><span class="run-label">Duration</span>${run.duration}</div>
+            <div class="run-field"><span class="run-label">Pull Requests</span>${pullRequests}</div>
+        </div>
+
+        <h2>Commit</h2>
+        <div class="run-commit">
+            <a href="${run.commit.html_url}" target="_blank"><code>${escapeHtml(run.commit.sha.slice(0, 7))}</code></a>
+            ${escapeHtml(run.commit.author || '')}
+            <pre>${escapeHtml(run.commit.message || '')}</pre>
+        </div>
+
+        <h2>Attempts</h2>
+        <ul class="run-attempts">${attempts}</ul>
+
+        <h2>Jobs</h2>
+        <div class="table-container">
+            <table class="jobs-table">
+                <thead>
+                    <tr>
+                        <th>JOB</th>
+                        <th>STATUS</th>
+                        <th>DURATION</th>
+                        <th>RUNNER</th>
+                    </tr>
+                </thead>
+                <tbody>${run.jobs.map(renderRunJob).join('')}</tbody>
+            </table>
+        </div>
+    `;
+}
+
+function renderRunJob(job) {
+    const steps = job.steps.map(step => `
+        <li class="${step.status}">
+            ${step.number}. ${escapeHtml(step.name)}
+            <span class="run-step-duration">${step.conclusion || step.status} · ${formatSeconds(step.duration_seconds)}</span>
+        </li>
+    `).join('');
+    return `
+        <tr>
+            <td>
+                <details>
+                    <summary><a href="${job.html_url}" target="_blank">${escapeHtml(job.name)}</a></summary>
+                    <ol class="run-steps">${steps}</ol>
+                </details>
+            </td>
+            <td><span class="status-badge ${job.status}">${job.conclusion || job.status}</span></td>
+            <td>${formatSeconds(job.duration_seconds)}</td>
+            <td>${escapeHtml(job.runner_name || (job.labels || []).join(', '))}</td>
+        </tr>
+    `;
+}
+
+function formatSeconds(seconds) {
+    const minutes = Math.floor(seconds / 60);
+    if (minutes > 0) {
+        return `${minutes}m ${seconds % 60}s`;
+    }
+    return `${seconds}s`;
+}
+
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+document.addEventListener('DOMContentLoaded', fetchRunDetail);
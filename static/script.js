@@ -5,36 +5,70 @@ let itemsPerPage = 25;
 let autoRefreshInterval = null;
 let isAutoRefreshEnabled = false;
 let organizations = [];
+let serverStats = null;
 
-// Fetch data from API
+// Fetch data from API. The dashboard is streamed org by org, so the first
+// organization's jobs show up before the slower ones finish fetching.
 async function fetchDashboardData() {
     try {
         // Show loading state
         document.getElementById('jobsTableBody').innerHTML = 
-            '<tr><td colspan="8" class="loading">Loading...</td></tr>';
+            '<tr><td colspan="9" class="loading">Loading...</td></tr>';
         
         // Get selected period
         const period = document.getElementById('periodFilter').value;
+        fetchRunners();
         
         // Fetch with period parameter
-        const response = await fetch(`/api/dashboard?period=${period}`);
-        if (!response.ok) {
+        const response = await fetch(`/api/dashboard?period=${period}&stream=true`);
+        if (!response.ok || !response.body) {
             throw new Error('Failed to fetch dashboard data');
         }
-        const data = await response.json();
-        
-        allJobs = data.jobs || [];
-        
-        // Extract unique organizations and populate filter
-        organizations = [...new Set(allJobs.map(job => job.organization).filter(org => org))].sort();
-        populateOrgFilter();
         
-        // Sort by CreatedAt (newest first) - already sorted in backend, but ensure it
-        allJobs.sort((a, b) => new Date(b.created_at) - new Date(a.created_at));
+        const jobs = [];
+        const partialStats = { success: 0, failed: 0, running: 0, pending: 0, maintenance: 0, total: 0 };
+        const partialBuckets = {};
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = '';
         
-        updateStats(data.stats);
-        updateRateLimit(data.rate_limit);
-        applyFilters();
+        while (true) {
+            const { value, done } = await reader.read();
+            if (done) {
+                break;
+            }
+            buffer += decoder.decode(value, { stream: true });
+            
+            let newline;
+            while ((newline = buffer.indexOf('\n')) >= 0) {
+                const line = buffer.slice(0, newline).trim();
+                buffer = buffer.slice(newline + 1);
+                if (!line) {
+                    continue;
+                }
+                
+                const chunk = JSON.parse(line);
+                if (chunk.error) {
+                    console.error(`Error fetching ${chunk.organization || 'dashboard'}:`, chunk.error);
+                }
+                if (chunk.done) {
+                    renderDashboardData(jobs, chunk.stats, chunk.rate_limit);
+                    renderFetchErrors(chunk.errors || []);
+                    renderFreshness(chunk);
+                    fetchPeriodStats();
+                    continue;
+                }
+                
+                jobs.push(...(chunk.jobs || []));
+                Object.keys(partialStats).forEach(key => {
+                    partialStats[key] += (chunk.stats && chunk.stats[key]) || 0;
+                });
+                for (const [name, count] of Object.entries((chunk.stats && chunk.stats.buckets) || {})) {
+                    partialBuckets[name] = (partialBuckets[name] || 0) + count;
+                }
+                renderDashboardData(jobs, { ...partialStats, buckets: { ...partialBuckets } }, null);
+            }
+        }
     } catch (error) {
         console.error('Error fetching dashboard data:', error);
         document.getElementById('jobsTableBody').innerHTML = 
@@ -42,6 +76,97 @@ async function fetchDashboardData() {
     }
 }
 
+// Compare the periods on their tabs: the runs and success rate of each,
+// from one request once the selected period is loaded.
+async function fetchPeriodStats() {
+    const select = document.getElementById('periodFilter');
+    const periods = [...select.options].map(option => option.value);
+    try {
+        const response = await fetch(`/api/dashboard?period=${periods.join(',')}`);
+        if (!response.ok) {
+            return;
+        }
+        const data = await response.json();
+        for (const option of select.options) {
+            option.dataset.label = option.dataset.label || option.textContent;
+            const stats = data.periods && data.periods[option.value] && data.periods[option.value].stats;
+            if (!stats) {
+                continue;
+            }
+            const finished = stats.success + stats.failed;
+            const rate = finished > 0 ? ` · ${Math.round(stats.success / finished * 100)}%` : '';
+            option.textContent = `${option.dataset.label} (${stats.total} runs${rate})`;
+        }
+    } catch (error) {
+        console.error('Error fetching period stats:', error);
+    }
+}
+
+// Render (partial) dashboard data
+function renderDashboardData(jobs, stats, rateLimit) {
+    allJobs = [...jobs];
+    
+    // Extract unique organizations and populate filter
+    organizations = [...new Set(allJobs.map(job => job.organization).filter(org => org))].sort();
+    populateOrgFilter();
+    
+    // Sort by CreatedAt (newest first) - already sorted in backend, but ensure it
+    allJobs.sort((a, b) => new Date(b.created_at) - new Date(a.created_at));
+    
+    serverStats = stats;
+    updateStats(stats);
+    updateRateLimit(rateLimit);
+    applyFilters();
+}
+
+// Show actions-runner-controller runners next to the queued jobs. The card
+// stays hidden when ARC visibility isn't enabled on the server.
+async function fetchRunners() {
+    const card = document.getElementById('runnersCard');
+    try {
+        const response = await fetch('/api/runners');
+        if (!response.ok) {
+            card.style.display = 'none';
+            return;
+        }
+        const data = await response.json();
+        const sets = data.scale_sets || [];
+        const sum = key => sets.reduce((total, set) => total + (set[key] || 0), 0);
+
+        document.getElementById('runnersCount').textContent = `${sum('running_runners')} / ${sum('current_runners')}`;
+        document.getElementById('runnersDetail').textContent =
+            `${sum('pending_runners')} pending scale-ups · ${sum('pods_failed')} failed pods · ${data.queued_jobs} queued jobs`;
+        card.title = sets.map(set => {
+            const failed = (set.failed_pods || []).map(pod => `  ${pod.name}: ${pod.reason || pod.phase}`).join('\n');
+            return `${set.namespace}/${set.name}: ${set.running_runners}/${set.current_runners} running, ` +
+                `${set.pending_runners} pending, ${set.queued_jobs} queued` + (failed ? `\n${failed}` : '');
+        }).join('\n');
+        card.classList.toggle('alert', sum('pods_failed') > 0 || (data.queued_jobs > 0 && sum('pending_runners') > 0));
+        card.style.display = '';
+    } catch (error) {
+        console.error('Error fetching runners:', error);
+        card.style.display = 'none';
+    }
+}
+
+// Force the server to re-fetch from GitHub, then reload the dashboard
+async function forceRefresh() {
+    const btn = document.getElementById('refreshBtn');
+    btn.disabled = true;
+    try {
+        const period = document.getElementById('periodFilter').value;
+        const response = await fetch(`/api/refresh?period=${period}`, { method: 'POST' });
+        if (!response.ok) {
+            throw new Error('Failed to refresh dashboard data');
+        }
+        await fetchDashboardData();
+    } catch (error) {
+        console.error('Error refreshing dashboard data:', error);
+    } finally {
+        btn.disabled = false;
+    }
+}
+
 // Populate organization filter dropdown
 function populateOrgFilter() {
     const orgFilter = document.getElementById('orgFilter');
@@ -67,10 +192,41 @@ function populateOrgFilter() {
 // Update stats cards
 function updateStats(stats) {
     document.getElementById('successCount').textContent = stats.success || 0;
+    // Flaky: green only after re-running a failed attempt
+    const rerun = document.getElementById('passedOnRerunDetail');
+    rerun.textContent = stats.passed_on_rerun ? `${stats.passed_on_rerun} passed on rerun (${formatSeconds(stats.passed_on_rerun_seconds || 0)} lost)` : '';
     document.getElementById('failedCount').textContent = stats.failed || 0;
     document.getElementById('runningCount').textContent = stats.running || 0;
     document.getElementById('pendingCount').textContent = stats.pending || 0;
+    document.getElementById('maintenanceCount').textContent = stats.maintenance || 0;
     document.getElementById('totalCount').textContent = stats.total || 0;
+    updateBucketCards(stats.buckets || {});
+}
+
+// Custom buckets from STATS_BUCKETS, one card each before Total
+function updateBucketCards(buckets) {
+    const totalCard = document.getElementById('totalCard');
+    document.querySelectorAll('.stat-card.bucket').forEach(card => {
+        if (!(card.dataset.bucket in buckets)) {
+            card.remove();
+        }
+    });
+    for (const [name, count] of Object.entries(buckets)) {
+        let card = document.querySelector(`.stat-card.bucket[data-bucket="${CSS.escape(name)}"]`);
+        if (!card) {
+            card = document.createElement('div');
+            card.className = 'stat-card bucket';
+            card.dataset.bucket = name;
+            card.innerHTML = `
+                <div class="stat-icon">◆</div>
+                <div class="stat-content">
+                    <div class="stat-label">${escapeHtml(name)}</div>
+                    <div class="stat-value">0</div>
+                </div>`;
+            totalCard.before(card);
+        }
+        card.querySelector('.stat-value').textContent = count;
+    }
 }
 
 // Update rate limit info
@@ -78,13 +234,21 @@ function updateRateLimit(rateLimit) {
     if (!rateLimit) {
         return;
     }
+    // GitHub Enterprise Server with rate limiting off
+    if (rateLimit.unlimited) {
+        document.getElementById('rateLimitValue').textContent = 'Unlimited';
+        document.getElementById('rateLimitValue').classList.remove('warning', 'critical');
+        document.getElementById('rateLimitReset').textContent = '';
+        return;
+    }
     
     const remaining = rateLimit.remaining || 0;
     const limit = rateLimit.limit || 5000;
     const resetAt = rateLimit.reset_at;
     
-    // Update rate limit value
+    // Update rate limit value, the sum of all tokens when rotating between several
     document.getElementById('rateLimitValue').textContent = `${remaining}/${limit}`;
+    document.getElementById('rateLimitValue').title = rateLimit.tokens ? `${rateLimit.tokens} tokens` : '';
     
     // Calculate percentage
     const percentage = (remaining / limit) * 100;
@@ -115,6 +279,11 @@ function updateRateLimit(rateLimit) {
             const remainingMins = diffMins % 60;
             resetText = `Resets in ${diffHours}h ${remainingMins}m`;
         }
+        // GitHub asked to back off, e.g. after a secondary rate limit
+        if (rateLimit.throttled_until && new Date(rateLimit.throttled_until) > now) {
+            resetText = `Throttled until ${new Date(rateLimit.throttled_until).toLocaleTimeString()}`;
+            rateLimitValue.classList.add('critical');
+        }
         
         document.getElementById('rateLimitReset').textContent = resetText;
     } else {
@@ -145,8 +314,13 @@ function applyFilters() {
         return dateB - dateA; // Newest first
     });
     
-    // Update stats based on filtered jobs
-    updateFilteredStats(filteredJobs);
+    // Update stats based on filtered jobs. Without filters use the server
+    // stats, which also count runs beyond the truncated job list.
+    if (orgFilter === 'all' && statusFilter === 'all' && searchQuery === '' && serverStats) {
+        updateStats(serverStats);
+    } else {
+        updateFilteredStats(filteredJobs);
+    }
     
     currentPage = 1;
     renderTable();
@@ -160,6 +334,7 @@ function updateFilteredStats(jobs) {
         failed: 0,
         running: 0,
         pending: 0,
+        maintenance: 0,
         total: jobs.length
     };
     
@@ -169,7 +344,12 @@ function updateFilteredStats(jobs) {
                 stats.success++;
                 break;
             case 'failed':
-                stats.failed++;
+                // Failures during a maintenance window are not counted as failed
+                if ((job.tags || []).includes('maintenance')) {
+                    stats.maintenance++;
+                } else {
+                    stats.failed++;
+                }
                 break;
             case 'running':
                 stats.running++;
@@ -198,10 +378,10 @@ function renderTable() {
     tbody.innerHTML = jobsToShow.map(job => `
         <tr>
             <td>${job.id}</td>
-            <td>${escapeHtml(job.name)}</td>
-            <td><span class="status-badge ${job.status}">${job.status}</span></td>
+            <td>${renderJobName(job)}${renderMatrixLegs(job)}</td>
+            <td><span class="status-badge ${job.status}">${job.status}</span>${renderTags(job.tags)}${renderConcurrency(job)}${renderCancelReason(job)}${renderArgoCD(job)}${renderProgress(job)}</td>
             <td>${escapeHtml(job.pipeline)}</td>
-            <td>${escapeHtml(job.branch)}</td>
+            <td>${escapeHtml(job.branch)}${job.branch_state ? ` <span class="tag-badge branch-${job.branch_state}" title="Branch ${job.branch_state} since this run">${job.branch_state}</span>` : ''}</td>
             <td>${job.duration}</td>
             <td>${job.started}</td>
             <td>${escapeHtml(job.organization || 'N/A')}</td>
@@ -213,11 +393,107 @@ function renderTable() {
                         <line x1="10" y1="14" x2="21" y2="3"></line>
                     </svg>
                 </a>
+                <button class="btn-link" title="View logs"
+                        onclick="viewJob('${escapeHtml(job.provider || '')}', '${escapeHtml(job.organization)}', '${escapeHtml(job.pipeline)}', ${job.run_id})">
+                    <svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+                        <path d="M14 2H6a2 2 0 0 0-2 2v16a2 2 0 0 0 2 2h12a2 2 0 0 0 2-2V8z"></path>
+                        <polyline points="14 2 14 8 20 8"></polyline>
+                        <line x1="8" y1="13" x2="16" y2="13"></line>
+                        <line x1="8" y1="17" x2="16" y2="17"></line>
+                    </svg>
+                </button>
             </td>
         </tr>
     `).join('');
 }
 
+// Render job tags (e.g. maintenance)
+function renderTags(tags) {
+    if (!tags || tags.length === 0) {
+        return '';
+    }
+    return tags.map(tag => ` <span class="tag-badge">${escapeHtml(tag)}</span>`).join('');
+}
+
+// Render matrix legs (e.g. per OS) with their own status, so it's visible
+// which leg made a run fail
+function renderMatrixLegs(job) {
+    if (!job.matrix_legs || job.matrix_legs.length === 0) {
+        return '';
+    }
+    const legs = job.matrix_legs.map(leg => `
+        <a class="matrix-leg ${leg.status}" href="${leg.html_url || job.html_url || '#'}" target="_blank"
+           title="${escapeHtml(leg.job)} (${escapeHtml(leg.matrix)}): ${leg.status}, ${leg.duration}">${escapeHtml(leg.matrix)}</a>
+    `).join('');
+    return `<div class="matrix-legs">${legs}</div>`;
+}
+
+// Mark pending jobs that wait on their concurrency group, so they can be
+// told apart from jobs queued for a runner
+function renderConcurrency(job) {
+    if (!job.waiting_on_concurrency) {
+        return '';
+    }
+    let title = job.concurrency_group ? `Concurrency group: ${job.concurrency_group}` : 'Waiting on concurrency group';
+    if (job.waiting_on_run_id) {
+        title += ` (blocked by run ${job.waiting_on_run_id})`;
+    }
+    return ` <span class="tag-badge concurrency" title="${escapeHtml(title)}">concurrency</span>`;
+}
+
+// Tell why a cancelled run was cancelled; superseded ones are routine
+function renderCancelReason(job) {
+    if (!job.cancel_reason) {
+        return '';
+    }
+    const titles = {
+        superseded: 'Cancelled by a newer run of the same workflow and branch',
+        timeout: 'A job ran into its timeout-minutes',
+        user: 'Cancelled by a user or the API',
+        unknown: 'Reason could not be checked',
+    };
+    return ` <span class="tag-badge cancel-${job.cancel_reason}" title="${escapeHtml(titles[job.cancel_reason] || '')}">${escapeHtml(job.cancel_reason)}</span>`;
+}
+
+// Show whether ArgoCD has synced what a successful run built
+function renderArgoCD(job) {
+    if (!job.argocd || job.argocd.length === 0) {
+        return '';
+    }
+    return job.argocd.map(app => {
+        const title = `${app.app}: ${app.sync || 'Unknown'}, ${app.health || 'Unknown'}`;
+        const label = app.deployed ? `deployed: ${app.app}` : `not synced: ${app.app}`;
+        return ` <span class="tag-badge argocd ${app.deployed ? 'deployed' : 'pending'}" title="${escapeHtml(title)}">${escapeHtml(label)}</span>`;
+    }).join('');
+}
+
+// Render a progress bar and ETA for running jobs
+function renderProgress(job) {
+    if (job.status !== 'running' || !job.steps_total) {
+        return '';
+    }
+    const percent = Math.min(100, Math.round(job.steps_completed / job.steps_total * 100));
+    let eta = '';
+    if (job.median_duration_seconds && job.elapsed_seconds !== undefined) {
+        const remaining = job.median_duration_seconds - job.elapsed_seconds;
+        eta = remaining > 0 ? ` · ETA ${formatSeconds(remaining)}` : ' · overdue';
+    }
+    return `
+        <div class="run-progress" title="${job.steps_completed}/${job.steps_total} steps">
+            <div class="run-progress-bar" style="width: ${percent}%"></div>
+        </div>
+        <div class="run-progress-label">${job.steps_completed}/${job.steps_total} steps${eta}</div>
+    `;
+}
+
+function formatSeconds(seconds) {
+    const minutes = Math.floor(seconds / 60);
+    if (minutes > 0) {
+        return `${minutes}m ${seconds % 60}s`;
+    }
+    return `${seconds}s`;
+}
+
 // Render pagination
 function renderPagination() {
     const totalPages = Math.ceil(filteredJobs.length / itemsPerPage);
@@ -259,11 +535,20 @@ function changePage(page) {
     }
 }
 
-// View job details (placeholder - can be extended)
-function viewJob(runId, jobId, organization) {
-    alert(`Viewing job: ${jobId}\nRun ID: ${runId}\nOrganization: ${organization}\n\nThis can be extended to show detailed job information or link to GitHub Actions.`);
-    // You can extend this to open a modal or navigate to GitHub Actions page
-    // window.open(`https://github.com/${organization}/actions/runs/${runId}`, '_blank');
+// View the logs of a run in a new tab
+// GitHub Actions runs link to the drill-down page; other providers have no
+// run detail endpoint yet
+function renderJobName(job) {
+    if ((job.provider || 'github') !== 'github' || !job.run_id) {
+        return escapeHtml(job.name);
+    }
+    const params = new URLSearchParams({ owner: job.organization, repo: job.pipeline, run_id: job.run_id });
+    return `<a href="run.html?${params}" class="job-link">${escapeHtml(job.name)}</a>`;
+}
+
+function viewJob(provider, organization, pipeline, runId) {
+    const params = new URLSearchParams({ provider: provider || 'github', org: organization, pipeline: pipeline, run_id: runId });
+    window.open(`/api/logs?${params}`, '_blank');
 }
 
 // Toggle auto refresh
@@ -283,23 +568,164 @@ function toggleAutoRefresh() {
     }
 }
 
+// Quick-jump search over the cached runs of every period
+let quickSearchTimer = null;
+
+function quickSearch() {
+    clearTimeout(quickSearchTimer);
+    const query = document.getElementById('quickSearch').value.trim();
+    const results = document.getElementById('quickSearchResults');
+    if (query.length < 2) {
+        results.innerHTML = '';
+        results.style.display = 'none';
+        return;
+    }
+    quickSearchTimer = setTimeout(async () => {
+        try {
+            const response = await fetch(`/api/search?q=${encodeURIComponent(query)}&limit=10`);
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            renderQuickSearch(await response.json());
+        } catch (error) {
+            console.error('Error searching runs:', error);
+        }
+    }, 250);
+}
+
+function renderQuickSearch(data) {
+    const results = document.getElementById('quickSearchResults');
+    if (data.results.length === 0) {
+        results.innerHTML = '<div class="quick-search-empty">No matching runs</div>';
+    } else {
+        results.innerHTML = data.results.map(job => {
+            const href = (job.provider || 'github') === 'github'
+                ? `run.html?${new URLSearchParams({ owner: job.organization, repo: job.pipeline, run_id: job.run_id })}`
+                : job.html_url || '#';
+            return `
+                <a class="quick-search-result" href="${href}">
+                    <span class="status-badge ${job.status}">${job.status}</span>
+                    <strong>${escapeHtml(job.organization)}/${escapeHtml(job.pipeline)}</strong> · ${escapeHtml(job.name)}
+                    <div class="stat-detail">${escapeHtml(job.branch)}${job.actor ? ' · ' + escapeHtml(job.actor) : ''} · ${job.started}${job.commit_message ? ' · ' + escapeHtml(job.commit_message) : ''}</div>
+                </a>
+            `;
+        }).join('');
+    }
+    results.style.display = 'block';
+}
+
+// Warn when the data is stale: old, or the latest refresh failed
+function renderFreshness(data) {
+    const container = document.getElementById('staleWarning');
+    if (!data.stale) {
+        container.style.display = 'none';
+        return;
+    }
+    const reason = data.refresh_error ? ` Refresh failing: ${escapeHtml(data.refresh_error)}` : '';
+    container.innerHTML = `<strong>Stale data:</strong> last refreshed ${formatSeconds(data.data_age_seconds || 0)} ago.${reason}`;
+    container.style.display = 'block';
+}
+
 // Escape HTML to prevent XSS
+// Show which organizations/repositories are missing from the data
+function renderFetchErrors(errors) {
+    const container = document.getElementById('fetchErrors');
+    if (errors.length === 0) {
+        container.style.display = 'none';
+        return;
+    }
+    const items = errors.slice(0, 10).map(e => {
+        const target = e.repository ? `${e.organization}/${e.repository}` : e.organization;
+        const skipped = e.skipped ? ` (${e.skipped} repositories skipped)` : '';
+        return `<li><strong>${escapeHtml(target)}</strong>: ${escapeHtml(e.reason)}${skipped}</li>`;
+    }).join('');
+    const more = errors.length > 10 ? `<li>... and ${errors.length - 10} more</li>` : '';
+    container.innerHTML = `Incomplete data: ${errors.length} fetch error(s)<ul>${items}${more}</ul>`;
+    container.style.display = 'block';
+}
+
 function escapeHtml(text) {
     const div = document.createElement('div');
     div.textContent = text;
     return div.innerHTML;
 }
 
+// Show who is signed in when GitHub login is enabled
+async function loadViewer() {
+    try {
+        const response = await fetch('/auth/me');
+        if (!response.ok) return;
+        const viewer = await response.json();
+        const link = document.getElementById('logoutLink');
+        link.textContent = `Logout ${viewer.login}`;
+        link.title = viewer.full_access ? 'You see all repositories' : `You see the ${viewer.repos} repositories you can access`;
+        link.style.display = '';
+        setupPush();
+    } catch (error) {
+        // Login not enabled
+    }
+}
+
+// Offer Web Push for watched runs when the server has VAPID keys and the
+// browser supports it. Watches with channel=webpush notify every browser
+// registered here.
+async function setupPush() {
+    if (!('serviceWorker' in navigator) || !('PushManager' in window)) return;
+    const response = await fetch('/api/push/key');
+    if (!response.ok) return;
+    const { public_key: publicKey } = await response.json();
+
+    const button = document.getElementById('pushBtn');
+    const registration = await navigator.serviceWorker.register('/sw.js');
+    if (await registration.pushManager.getSubscription()) {
+        button.textContent = 'Notifications: ON';
+    }
+    button.style.display = '';
+    button.addEventListener('click', async () => {
+        try {
+            if (await Notification.requestPermission() !== 'granted') {
+                button.textContent = 'Notifications blocked';
+                return;
+            }
+            const subscription = await registration.pushManager.subscribe({
+                userVisibleOnly: true,
+                applicationServerKey: base64UrlToBytes(publicKey)
+            });
+            const saved = await fetch('/api/push/subscriptions', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(subscription)
+            });
+            if (!saved.ok) throw new Error(await saved.text());
+            button.textContent = 'Notifications: ON';
+        } catch (error) {
+            console.error('Error enabling notifications:', error);
+            button.textContent = 'Enable Notifications';
+        }
+    });
+}
+
+function base64UrlToBytes(value) {
+    const base64 = (value + '='.repeat((4 - value.length % 4) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0));
+}
+
 // Event listeners
 document.addEventListener('DOMContentLoaded', () => {
     fetchDashboardData();
+    loadViewer();
     
-    document.getElementById('refreshBtn').addEventListener('click', fetchDashboardData);
+    document.getElementById('refreshBtn').addEventListener('click', forceRefresh);
     document.getElementById('autoRefreshBtn').addEventListener('click', toggleAutoRefresh);
     document.getElementById('periodFilter').addEventListener('change', fetchDashboardData);
     document.getElementById('orgFilter').addEventListener('change', applyFilters);
     document.getElementById('statusFilter').addEventListener('change', applyFilters);
     document.getElementById('searchInput').addEventListener('input', applyFilters);
+    document.getElementById('quickSearch').addEventListener('input', quickSearch);
+    document.getElementById('quickSearch').addEventListener('blur', () => {
+        // Let a click on a result land before hiding them
+        setTimeout(() => { document.getElementById('quickSearchResults').style.display = 'none'; }, 200);
+    });
     document.getElementById('itemsPerPage').addEventListener('change', (e) => {
         itemsPerPage = parseInt(e.target.value);
         currentPage = 1;
@@ -0,0 +1,15 @@
+// Service worker for Web Push: shows the notifications of watched runs,
+// also when no dashboard tab is open.
+self.addEventListener('push', event => {
+    const data = event.data ? event.data.json() : {};
+    event.waitUntil(self.registration.showNotification(data.title || 'CI/CD Dashboard', {
+        body: data.body || '',
+        data: { url: data.url || '/' }
+    }));
+});
+
+// Open the run when the notification is clicked
+self.addEventListener('notificationclick', event => {
+    event.notification.close();
+    event.waitUntil(clients.openWindow(event.notification.data.url));
+});
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FetchProgress describes a running or finished fetch for one period.
+type FetchProgress struct {
+	Running      bool      `json:"running"`
+	OrgsTotal    int       `json:"orgs_total"`
+	OrgsDone     int       `json:"orgs_done"`
+	ReposTotal   int       `json:"repos_total"`
+	ReposDone    int       `json:"repos_done"`
+	ReposSkipped int       `json:"repos_skipped"` // not fetched because the rate limit budget ran out
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type SnapshotStatus struct {
+	FetchedAt  time.Time `json:"fetched_at"`
+	AgeSeconds int       `json:"age_seconds"`
+	Jobs       int       `json:"jobs"`
+}
+
+type StatusResponse struct {
+	Ready     bool                      `json:"ready"` // every prewarmed period has data
+	Warmup    []string                  `json:"warmup_periods"`
+	Fetches   map[string]FetchProgress  `json:"fetches"`
+	Snapshots map[string]SnapshotStatus `json:"snapshots"`
+
+	TokenCheck  *TokenCheck  `json:"token_check,omitempty"` // what GITHUB_TOKEN can read, see tokencheck.go
+	RetryQueue  []RetryEntry `json:"retry_queue"`           // repositories that failed to fetch, retried with backoff; only the caller's
+	RetryQueued int          `json:"retry_queued"`          // entries in the retry queue, including those left out
+}
+
+var (
+	progressMu sync.Mutex
+	progress   = make(map[string]*FetchProgress)
+
+	// prewarmPeriods are fetched in the background on startup so the first
+	// dashboard request doesn't have to wait for a full crawl.
+	prewarmPeriods = []string{"week"}
+
+	// snapshotFile optionally persists snapshots to disk so a restarted
+	// instance can serve the last known data immediately.
+	snapshotFile string
+	snapshotMu   sync.Mutex
+)
+
+// updateProgress applies fn to the progress entry of the period.
+func updateProgress(period string, fn func(p *FetchProgress)) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+
+	p, ok := progress[period]
+	if !ok {
+		p = &FetchProgress{}
+		progress[period] = p
+	}
+	fn(p)
+}
+
+func startProgress(period string) {
+	updateProgress(period, func(p *FetchProgress) {
+		*p = FetchProgress{Running: true, StartedAt: time.Now()}
+	})
+}
+
+func finishProgress(period string, err error) {
+	noteRefresh(period, err)
+	updateProgress(period, func(p *FetchProgress) {
+		p.Running = false
+		p.FinishedAt = time.Now()
+		p.Error = ""
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+}
+
+// prewarm fetches the configured periods in the background, first seeding the
+// store from the snapshot file when one is configured.
+func prewarm() {
+	if currentCacheTTL() <= 0 {
+		return
+	}
+
+	ctx := withRefreshTrigger(context.Background(), "prewarm")
+	loadSnapshotFile(ctx)
+
+	for _, period := range prewarmPeriods {
+		log.Printf("🔥 Prewarming dashboard cache for period: %s", period)
+		if _, err := getDashboard(ctx, period); err != nil {
+			log.Printf("❌ Prewarming period %s failed: %v", period, err)
+		}
+	}
+}
+
+func loadSnapshotFile(ctx context.Context) {
+	if snapshotFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(snapshotFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  Error reading snapshot file %s: %v", snapshotFile, err)
+		}
+		return
+	}
+
+	var snapshots map[string]*Snapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		log.Printf("⚠️  Error parsing snapshot file %s: %v", snapshotFile, err)
+		return
+	}
+
+	for period, snap := range snapshots {
+		// Don't overwrite newer data another replica already stored
+		if existing, err := loadSnapshot(ctx, period); err == nil && existing != nil && !existing.FetchedAt.Before(snap.FetchedAt) {
+			continue
+		}
+		if err := saveSnapshot(ctx, period, snap); err != nil {
+			log.Printf("⚠️  Error restoring snapshot for %s: %v", period, err)
+			continue
+		}
+		log.Printf("💾 Restored %s snapshot from %s (fetched %v)", period, snapshotFile, snap.FetchedAt)
+	}
+}
+
+// persistSnapshot writes the period's snapshot into the snapshot file.
+func persistSnapshot(period string, snap *Snapshot) {
+	if snapshotFile == "" {
+		return
+	}
+
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	snapshots := make(map[string]*Snapshot)
+	if data, err := os.ReadFile(snapshotFile); err == nil {
+		_ = json.Unmarshal(data, &snapshots)
+	}
+	snapshots[period] = snap
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		log.Printf("⚠️  Error encoding snapshot file: %v", err)
+		return
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := snapshotFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.Printf("⚠️  Error writing snapshot file %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, snapshotFile); err != nil {
+		log.Printf("⚠️  Error replacing snapshot file %s: %v", snapshotFile, err)
+	}
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	status := StatusResponse{
+		Ready:     true,
+		Warmup:    prewarmPeriods,
+		Fetches:   make(map[string]FetchProgress),
+		Snapshots: make(map[string]SnapshotStatus),
+	}
+
+	progressMu.Lock()
+	for period, p := range progress {
+		status.Fetches[period] = *p
+	}
+	progressMu.Unlock()
+
+	for _, period := range []string{"today", "week", "month"} {
+		snap, err := loadSnapshot(ctx, period)
+		if err != nil || snap == nil {
+			continue
+		}
+		status.Snapshots[period] = SnapshotStatus{
+			FetchedAt:  snap.FetchedAt,
+			AgeSeconds: int(time.Since(snap.FetchedAt).Seconds()),
+			Jobs:       len(snap.Response.Jobs),
+		}
+	}
+	for _, period := range prewarmPeriods {
+		if _, ok := status.Snapshots[period]; !ok {
+			status.Ready = false
+		}
+	}
+
+	// /api/status is open to probes: the repositories in the retry queue
+	// are only listed to who may see them
+	viewer := statusViewer(r)
+	retries := pendingRetries()
+	status.RetryQueued = len(retries)
+	status.RetryQueue = []RetryEntry{}
+	for _, entry := range retries {
+		if viewer.canSee(Job{Provider: entry.Provider, Organization: entry.Organization, Pipeline: entry.Repository}) {
+			status.RetryQueue = append(status.RetryQueue, entry)
+		}
+	}
+	status.TokenCheck = latestTokenCheck()
+	_, admin := adminFrom(r)
+	if r.URL.Query().Get("check") == "true" {
+		// Checking spends API calls, so it takes an admin or a login
+		if !admin && (viewer == nil || viewer.Login == "") {
+			http.Error(w, "Checking the token needs ADMIN_TOKEN as bearer token or a login", http.StatusUnauthorized)
+			return
+		}
+		if check := recheckToken(ctx); check != nil {
+			status.TokenCheck = check
+		}
+	}
+	if !admin && (viewer == nil || viewer.Login == "" || viewer.restricted()) {
+		status.TokenCheck = status.TokenCheck.redacted()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(status)
+}
+
+// statusViewer returns what the caller of /api/status may see, which
+// isn't behind the login: everything for admins and without OAuth, the
+// repositories of a signed-in user, or none.
+func statusViewer(r *http.Request) *viewerAccess {
+	if _, ok := adminFrom(r); ok || oauthConfig == nil {
+		return nil
+	}
+	sess := loadSession(r)
+	if sess == nil {
+		return &viewerAccess{}
+	}
+	access, err := viewerAccessFor(r.Context(), sess)
+	if err != nil {
+		log.Printf("⚠️  Error checking repository access of %s: %v", sess.Login, err)
+		return &viewerAccess{}
+	}
+	return access
+}
+
+func loadPrewarmConfig() {
+	snapshotFile = strings.TrimSpace(os.Getenv("SNAPSHOT_FILE"))
+
+	if env, ok := os.LookupEnv("PREWARM_PERIODS"); ok {
+		prewarmPeriods = nil
+		for _, period := range splitList(env) {
+			if !validPeriod(period) {
+				log.Fatalf("Invalid period %q in PREWARM_PERIODS (use today, week or month)", period)
+			}
+			prewarmPeriods = append(prewarmPeriods, period)
+		}
+	}
+}
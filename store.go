@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store holds state that has to be shared between dashboard replicas
+// (cached dashboard snapshots, fetch locks). The in-memory store is used for
+// single-instance deployments; Redis lets several replicas run behind a load
+// balancer and reuse each other's fetches.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Lock tries to acquire a lock that expires after ttl. It returns
+	// ok=false without error when another holder already owns the lock.
+	Lock(ctx context.Context, key string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// storeScanner is implemented by stores whose content outlives the process
+// and can be listed, for `snapshot export`. ttl is zero for keys that don't
+// expire.
+type storeScanner interface {
+	Scan(ctx context.Context, fn func(key string, value []byte, ttl time.Duration) error) error
+}
+
+// newStore creates the store configured by STORE_URL. An empty URL or
+// "memory://" gives an in-process store, "redis://..." a shared Redis store.
+func newStore(storeURL string) (Store, error) {
+	switch {
+	case storeURL == "" || storeURL == "memory://":
+		return newMemoryStore(), nil
+	case strings.HasPrefix(storeURL, "redis://"), strings.HasPrefix(storeURL, "rediss://"):
+		opts, err := redis.ParseURL(storeURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis URL: %v", err)
+		}
+		client := redis.NewClient(opts)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("cannot connect to redis: %v", err)
+		}
+		return &redisStore{client: client}, nil
+	default:
+		return nil, fmt.Errorf("unsupported STORE_URL %q (use memory:// or redis://)", storeURL)
+	}
+}
+
+func newLockToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *memoryStore) get(key string) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *memoryStore) Lock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, held := s.get(key); held {
+		return nil, false, nil
+	}
+	token := newLockToken()
+	s.entries[key] = memoryEntry{value: []byte(token), expiresAt: time.Now().Add(ttl)}
+
+	release := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if entry, ok := s.get(key); ok && string(entry.value) == token {
+			delete(s.entries, key)
+		}
+	}
+	return release, true, nil
+}
+
+type redisStore struct {
+	client *redis.Client
+}
+
+// releaseScript deletes a lock only if it is still held by the caller, so a
+// replica whose lock expired cannot release a lock taken over by another.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *redisStore) Lock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := newLockToken()
+	ok, err := s.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	release := func() {
+		// Use a fresh context: the request context may already be cancelled
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = releaseScript.Run(releaseCtx, s.client, []string{key}, token).Err()
+	}
+	return release, true, nil
+}
+
+func (s *redisStore) Scan(ctx context.Context, fn func(key string, value []byte, ttl time.Duration) error) error {
+	iter := s.client.Scan(ctx, 0, "*", 500).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		value, err := s.client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue // expired since the scan saw it
+		}
+		// Lists, hashes etc. belong to someone sharing the Redis database
+		if err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			kind, _ := s.client.Type(ctx, key).Result()
+			log.Printf("⚠️  Skipping key %q: a Redis %s, not written by the dashboard", key, kind)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ttl, err := s.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if ttl == -2 {
+			continue
+		}
+		if err := fn(key, value, max(ttl, 0)); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
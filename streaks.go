@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Failure streaks: how many times in a row a workflow has failed on a
+// branch, and what the latest failure looked like, for the integrations
+// that file issues about broken workflows (see jira.go and
+// nightlyissues.go).
+
+// maxExcerptLines caps the lines of a failure excerpt.
+const maxExcerptLines = 15
+
+// workflowRuns returns the finished runs of job's workflow on its branch,
+// newest first: the recorded history, plus the runs of the snapshot that
+// may not be recorded yet.
+func workflowRuns(ctx context.Context, job Job, snap *Snapshot) ([]HistoryRun, error) {
+	history, err := loadHistory(ctx, job.Organization, job.Pipeline, job.Branch)
+	if err != nil {
+		return nil, err
+	}
+	workflow := workflowName(job.Name)
+	byID := make(map[string]HistoryRun)
+	for _, run := range history {
+		if run.Provider == job.Provider && strings.EqualFold(run.Workflow, workflow) {
+			byID[run.ID] = run
+		}
+	}
+	for _, other := range snap.Response.Jobs {
+		if other.Provider == job.Provider && other.Organization == job.Organization && other.Pipeline == job.Pipeline &&
+			other.Branch == job.Branch && finished(other) && strings.EqualFold(workflowName(other.Name), workflow) {
+			byID[other.ID] = HistoryRun{Provider: other.Provider, ID: other.ID, RunID: other.RunID, Name: other.Name, Workflow: workflow,
+				Status: other.Status, HeadSHA: other.HeadSHA, CommitMessage: other.CommitMessage, Actor: other.Actor,
+				CreatedAt: other.CreatedAt, DurationSeconds: other.DurationSeconds, HTMLURL: other.HTMLURL, Tags: other.Tags}
+		}
+	}
+
+	runs := make([]HistoryRun, 0, len(byID))
+	for _, run := range byID {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedAt.After(runs[j].CreatedAt) })
+	return runs, nil
+}
+
+// failureStreak returns the failed runs in a row at the head of runs
+// (newest first). Failures during maintenance windows are left out and
+// don't break the streak either.
+func failureStreak(runs []HistoryRun) []HistoryRun {
+	var streak []HistoryRun
+	for _, run := range runs {
+		if slices.Contains(run.Tags, "maintenance") {
+			continue
+		}
+		if run.Status != "failed" {
+			break
+		}
+		streak = append(streak, run)
+	}
+	return streak
+}
+
+// repoDefaultBranch looks up the default branch of a GitHub repository in
+// the (cached) repository list of its organization.
+func repoDefaultBranch(ctx context.Context, org, repo string) (string, error) {
+	repos, err := listOrgRepos(ctx, org)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range repos {
+		if strings.EqualFold(r.Name, repo) {
+			return r.DefaultBranch, nil
+		}
+	}
+	return "", fmt.Errorf("repository %s/%s not found", org, repo)
+}
+
+// failureExcerpt describes why a GitHub Actions run failed: its failed
+// jobs and steps, and the error annotations they left (test failures,
+// compiler errors, "Process completed with exit code 1", ...).
+func failureExcerpt(ctx context.Context, org, repo string, runID int64) (string, error) {
+	jobs, err := fetchRunJobs(ctx, org, repo, runID)
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	for _, j := range jobs {
+		if j.GetConclusion() != "failure" && j.GetConclusion() != "timed_out" {
+			continue
+		}
+		step := ""
+		for _, s := range j.Steps {
+			if s.GetConclusion() == "failure" || s.GetConclusion() == "timed_out" {
+				step = s.GetName()
+				break
+			}
+		}
+		if step != "" {
+			lines = append(lines, fmt.Sprintf("Job %q failed at step %q", j.GetName(), step))
+		} else {
+			lines = append(lines, fmt.Sprintf("Job %q: %s", j.GetName(), j.GetConclusion()))
+		}
+
+		// The job is its own check run
+		if err := budget.acquire(ctx); err != nil {
+			break
+		}
+		annotations, resp, err := githubClient.Checks.ListCheckRunAnnotations(ctx, org, repo, j.GetID(), &github.ListOptions{PerPage: 10})
+		budget.update(resp)
+		if err != nil {
+			continue
+		}
+		for _, annotation := range annotations {
+			if annotation.GetAnnotationLevel() != "failure" {
+				continue
+			}
+			message := strings.TrimSpace(annotation.GetMessage())
+			if len(message) > 300 {
+				message = strings.ToValidUTF8(message[:300], "") + "..."
+			}
+			if path := annotation.GetPath(); path != "" && path != ".github" {
+				message = fmt.Sprintf("%s:%d: %s", path, annotation.GetStartLine(), message)
+			}
+			lines = append(lines, "  "+strings.ReplaceAll(message, "\n", "\n  "))
+		}
+		if len(lines) >= maxExcerptLines {
+			break
+		}
+	}
+	if len(lines) > maxExcerptLines {
+		lines = append(lines[:maxExcerptLines], "...")
+	}
+	return strings.Join(lines, "\n"), nil
+}
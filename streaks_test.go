@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFailureStreak(t *testing.T) {
+	run := func(id, status string, tags ...string) HistoryRun {
+		return HistoryRun{ID: id, Status: status, Tags: tags}
+	}
+	tests := []struct {
+		name    string
+		runs    []HistoryRun
+		wantIDs []string
+	}{
+		{"no runs", nil, nil},
+		{"latest passed", []HistoryRun{run("3", "success"), run("2", "failed")}, nil},
+		{"failed twice", []HistoryRun{run("3", "failed"), run("2", "failed"), run("1", "success")}, []string{"3", "2"}},
+		{"never passed", []HistoryRun{run("2", "failed"), run("1", "failed")}, []string{"2", "1"}},
+		{
+			"maintenance failures left out",
+			[]HistoryRun{run("4", "failed", "maintenance"), run("3", "failed"), run("2", "failed", "maintenance"), run("1", "success")},
+			[]string{"3"},
+		},
+		{"only maintenance failures", []HistoryRun{run("2", "failed", "maintenance"), run("1", "success")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, run := range failureStreak(tt.runs) {
+				ids = append(ids, run.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("failureStreak() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
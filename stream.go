@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// StreamChunk is one line of a streamed (newline-delimited JSON) dashboard
+// response. Every organization gets its own chunk as soon as it is fetched;
+// the last chunk has Done set and carries the totals.
+type StreamChunk struct {
+	Organization string         `json:"organization,omitempty"`
+	Stats        DashboardStats `json:"stats"`
+	Jobs         []Job          `json:"jobs,omitempty"`
+	RateLimit    *RateLimitInfo `json:"rate_limit,omitempty"`
+	Truncated    bool           `json:"truncated,omitempty"`
+	Partial      bool           `json:"partial,omitempty"` // on the last chunk, see DashboardResponse.Partial
+	Error        string         `json:"error,omitempty"`
+	Errors       []FetchError   `json:"errors,omitempty"` // on the last chunk, see DashboardResponse.Errors
+	Done         bool           `json:"done,omitempty"`
+
+	*DataFreshness // on the last chunk
+}
+
+// streamDashboard writes the dashboard org by org. Cached snapshots are
+// replayed per organization; otherwise organizations are fetched live and
+// each one is flushed to the client as soon as it finishes, in completion
+// order. A restricted viewer only gets their repositories' runs, with the
+// stats of those.
+func streamDashboard(w http.ResponseWriter, period, locale string, viewer *viewerAccess) {
+	ctx := context.Background()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	var visible DashboardStats
+	emit := func(chunk StreamChunk) {
+		if viewer.restricted() {
+			if chunk.Done {
+				chunk.Stats, chunk.Errors = visible, viewer.errors(chunk.Errors)
+			} else {
+				chunk.Jobs = viewer.jobs(chunk.Jobs)
+				chunk.Stats = calculateStats(chunk.Jobs)
+				addStats(&visible, chunk.Stats)
+			}
+		}
+		localizeJobs(chunk.Jobs, locale)
+		updateElapsed(chunk.Jobs)
+		if err := enc.Encode(chunk); err != nil {
+			log.Printf("❌ Error writing stream chunk: %v", err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	snap, err := loadSnapshot(ctx, period)
+	if err != nil {
+		log.Printf("⚠️  Error reading snapshot for %s from store: %v", period, err)
+	}
+	if currentCacheTTL() > 0 && isFresh(snap) {
+		emitSnapshot(period, snap, emit)
+		return
+	}
+
+	release, ok, err := store.Lock(ctx, "lock:"+snapshotKey(period), fetchLockTTL)
+	if err != nil || !ok {
+		// Another fetch is in progress: fall back to the regular path, which
+		// serves the previous snapshot or waits for the running fetch
+		snap, err := getDashboard(ctx, period)
+		if err != nil {
+			emit(StreamChunk{Error: err.Error(), Done: true})
+			return
+		}
+		emitSnapshot(period, snap, emit)
+		return
+	}
+	defer release()
+
+	startTime := time.Now()
+	calls := newCallCounter()
+	ctx = withCallCounter(ctx, calls)
+	window := newFetchWindow(period)
+	all := newJobCollector(maxJobs)
+	all.prepared = true
+	var rateLimit *RateLimitInfo
+	var orgs []OrgSummary
+
+	startProgress(period)
+	for result := range fetchAllOrgs(ctx, window) {
+		rateLimit = lowerRateLimit(rateLimit, result.RateLimit)
+
+		chunk := StreamChunk{Organization: result.Org, Stats: result.Collector.stats, Truncated: result.Collector.truncated}
+		if result.Err != nil {
+			log.Printf("❌ Error listing repositories for organization %s: %v", result.Org, result.Err)
+			chunk.Error = result.Err.Error()
+		}
+		// The organization's jobs are prepared once, for the chunk, and
+		// added to the snapshot as they are
+		chunk.Jobs = result.Collector.result()
+		prepareJobs(chunk.Jobs)
+		all.merge(result.Collector)
+		for _, job := range chunk.Jobs {
+			all.keep(job)
+		}
+		orgs = append(orgs, result.summary())
+		emit(chunk)
+	}
+	finishProgress(period, nil)
+
+	snap = buildSnapshot(all, rateLimit)
+	snap.Debug = debugInfo(calls)
+	snap.Orgs = orgs
+	previous := trackChanges(ctx, period, snap)
+	notifyFinishedRuns(previous, snap)
+	recordHistory(snap)
+	recordWeeklySummary(snap, all.dropped)
+	publishHealth(period, snap)
+	log.Printf("📈 Streamed dashboard for %s: Total=%d (took %v)", period, snap.Response.Stats.Total, time.Since(startTime))
+	announceSnapshot(period, snap)
+	if currentCacheTTL() > 0 {
+		if err := saveSnapshot(ctx, period, snap); err != nil {
+			log.Printf("⚠️  Error saving snapshot for %s to store: %v", period, err)
+		}
+		persistSnapshot(period, snap)
+	}
+
+	f := freshness(period, snap.FetchedAt)
+	emit(StreamChunk{
+		Stats:         snap.Response.Stats,
+		RateLimit:     &snap.Response.RateLimit,
+		Truncated:     snap.Response.Truncated,
+		Partial:       snap.Response.Partial,
+		Errors:        snap.Response.Errors,
+		Done:          true,
+		DataFreshness: &f,
+	})
+}
+
+// emitSnapshot replays a snapshot as one chunk per organization.
+func emitSnapshot(period string, snap *Snapshot, emit func(StreamChunk)) {
+	byOrg := make(map[string][]Job)
+	var order []string
+	for _, job := range snap.Response.Jobs {
+		if _, ok := byOrg[job.Organization]; !ok {
+			order = append(order, job.Organization)
+		}
+		byOrg[job.Organization] = append(byOrg[job.Organization], job)
+	}
+
+	for _, org := range order {
+		emit(StreamChunk{
+			Organization: org,
+			Stats:        calculateStats(byOrg[org]),
+			Jobs:         byOrg[org],
+		})
+	}
+
+	rateLimit := snap.Response.RateLimit
+	f := freshness(period, snap.FetchedAt)
+	emit(StreamChunk{
+		Stats:         snap.Response.Stats,
+		RateLimit:     &rateLimit,
+		Truncated:     snap.Response.Truncated,
+		Partial:       snap.Response.Partial,
+		Errors:        snap.Response.Errors,
+		Done:          true,
+		DataFreshness: &f,
+	})
+}
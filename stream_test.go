@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProvider serves fixed runs, one pipeline per organization.
+type fakeProvider struct {
+	runs map[string][]Job // by organization
+}
+
+func (p fakeProvider) Name() string { return "github" }
+
+func (p fakeProvider) ListPipelines(ctx context.Context, window fetchWindow, org string) ([]Pipeline, error) {
+	return []Pipeline{{Org: org, Name: "api"}}, nil
+}
+
+func (p fakeProvider) ListRuns(ctx context.Context, window fetchWindow, pipeline Pipeline) ([]Job, error) {
+	return p.runs[pipeline.Org], nil
+}
+
+func (p fakeProvider) GetLogs(ctx context.Context, pipeline Pipeline, runID int64) (string, error) {
+	return "", nil
+}
+
+// useFakeSources fetches from a fakeProvider with two organizations,
+// restored after the test.
+func useFakeSources(t *testing.T) {
+	t.Helper()
+	previous := sources
+	t.Cleanup(func() { sources = previous })
+	now := time.Now()
+	run := func(org, id string, minutes int) Job {
+		started := now.Add(-time.Duration(minutes) * time.Minute)
+		return Job{
+			ID: id, Provider: "github", Organization: org, Pipeline: "api", Name: "CI #" + id, Status: "success",
+			HeadSHA: "a" + id + "b2c3d4e5f", StartedAt: started, CreatedAt: started, DurationSeconds: 60,
+		}
+	}
+	provider := fakeProvider{runs: map[string][]Job{
+		"acme":   {run("acme", "1", 10), run("acme", "2", 20)},
+		"globex": {run("globex", "3", 30)},
+	}}
+	sources = []source{{Provider: provider, Org: "acme"}, {Provider: provider, Org: "globex"}}
+}
+
+// streamChunks streams the week's dashboard.
+func streamChunks(t *testing.T) []StreamChunk {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	streamDashboard(rec, "week", "en", nil)
+	var chunks []StreamChunk
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var chunk StreamChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// Each organization's runs are enriched once, for their chunk, and cached
+// as they were streamed.
+func TestStreamEnrichesOnce(t *testing.T) {
+	useTestStore(t)
+	useFakeSources(t)
+
+	var mu sync.Mutex
+	sent := make(map[string]int)
+	plugin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request enrichRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		var response enrichResponse
+		mu.Lock()
+		for _, job := range request.Jobs {
+			sent[job.ID]++
+			response.Jobs = append(response.Jobs, JobEnrichment{ID: job.ID, Annotations: map[string]string{"team": job.Organization}, Tags: []string{"payments"}})
+		}
+		mu.Unlock()
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer plugin.Close()
+	defer func(url string, client *http.Client, timeout time.Duration, cache map[string]JobEnrichment) {
+		enrichment.url, enrichment.client, enrichment.timeout, enrichment.cache = url, client, timeout, cache
+	}(enrichment.url, enrichment.client, enrichment.timeout, enrichment.cache)
+	enrichment.url, enrichment.client, enrichment.timeout, enrichment.cache = plugin.URL, plugin.Client(), time.Second, make(map[string]JobEnrichment)
+
+	chunks := streamChunks(t)
+	var streamed int
+	for _, chunk := range chunks {
+		for _, job := range chunk.Jobs {
+			streamed++
+			if job.Annotations["team"] != job.Organization || len(job.Tags) != 1 {
+				t.Errorf("streamed job %s: annotations %v, tags %v", job.ID, job.Annotations, job.Tags)
+			}
+		}
+	}
+	if streamed != 3 || !chunks[len(chunks)-1].Done {
+		t.Fatalf("streamed %d jobs in %d chunks, want 3 and a last one", streamed, len(chunks))
+	}
+	for id, n := range sent {
+		if n != 1 {
+			t.Errorf("job %s sent to the plugin %d times, want once", id, n)
+		}
+	}
+
+	snap, err := loadSnapshot(context.Background(), "week")
+	if err != nil || snap == nil {
+		t.Fatalf("snapshot = %v, %v", snap, err)
+	}
+	for _, job := range snap.Response.Jobs {
+		if job.Annotations["team"] != job.Organization || len(job.Tags) != 1 {
+			t.Errorf("cached job %s: annotations %v, tags %v", job.ID, job.Annotations, job.Tags)
+		}
+	}
+}
+
+// Each organization gets its chunk, the last one the totals, and the jobs
+// are cached as they were streamed, so a replay streams them again.
+func TestStreamDashboard(t *testing.T) {
+	useTestStore(t)
+	useFakeSources(t)
+
+	ids := func(chunks []StreamChunk) map[string][]string {
+		byOrg := make(map[string][]string)
+		for _, chunk := range chunks {
+			for _, job := range chunk.Jobs {
+				byOrg[chunk.Organization] = append(byOrg[chunk.Organization], job.ID)
+			}
+		}
+		return byOrg
+	}
+	want := map[string][]string{"acme": {"1", "2"}, "globex": {"3"}}
+
+	for _, replay := range []bool{false, true} {
+		chunks := streamChunks(t)
+		if len(chunks) != 3 {
+			t.Fatalf("replay %v: %d chunks, want one per organization and a last one", replay, len(chunks))
+		}
+		for _, chunk := range chunks[:2] {
+			if chunk.Done || chunk.Stats.Total != len(want[chunk.Organization]) {
+				t.Errorf("replay %v: chunk of %s: done %v, total %d", replay, chunk.Organization, chunk.Done, chunk.Stats.Total)
+			}
+		}
+		if last := chunks[2]; !last.Done || last.Stats.Total != 3 || last.Stats.Success != 3 || len(last.Jobs) != 0 {
+			t.Errorf("replay %v: last chunk = %+v, want the totals", replay, last)
+		}
+		if got := ids(chunks); !reflect.DeepEqual(got, want) {
+			t.Errorf("replay %v: jobs = %v, want %v", replay, got, want)
+		}
+	}
+}
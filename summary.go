@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weekly summaries: finished runs are rolled up per ISO week and kept in
+// the Store per organization, repository and workflow, so trends over many
+// months don't need the raw run history. While a week is open its runs are
+// kept too (a rerun replaces the earlier result); once it's over they're
+// dropped and only the totals stay.
+
+var (
+	// weeklySummaryRetention is how long a week's summary is kept.
+	weeklySummaryRetention = 2 * 365 * 24 * time.Hour
+
+	// weekGracePeriod is how long after its end a week still takes reruns
+	// before it's closed.
+	weekGracePeriod = 2 * 24 * time.Hour
+)
+
+const maxSummaryWeeks = 104
+
+// weeklyRun is a finished run as kept while its week is open.
+type weeklyRun struct {
+	Provider        string `json:"provider"`
+	Organization    string `json:"organization"`
+	Pipeline        string `json:"pipeline"`
+	Workflow        string `json:"workflow"`
+	Status          string `json:"status"`
+	Maintenance     bool   `json:"maintenance,omitempty"`
+	DurationSeconds int64  `json:"duration_seconds"`
+
+	CreatedAt time.Time `json:"created_at"` // orders the sparkline
+
+	PassedOnRerun        bool  `json:"passed_on_rerun,omitempty"`
+	FailedAttemptSeconds int64 `json:"failed_attempt_seconds,omitempty"`
+}
+
+// weekRecord is what the Store holds per week.
+type weekRecord struct {
+	Runs    map[string]weeklyRun `json:"runs,omitempty"` // by provider|id, until the week is closed
+	Summary *WeeklySummary       `json:"summary,omitempty"`
+}
+
+type WeeklySummary struct {
+	Week   string         `json:"week"` // ISO week, e.g. "2025-W45"
+	Start  time.Time      `json:"start"`
+	End    time.Time      `json:"end"`
+	Closed bool           `json:"closed"` // totals are final
+	Stats  DashboardStats `json:"stats"`
+	Orgs   []WeeklyOrg    `json:"orgs"`
+}
+
+type WeeklyOrg struct {
+	Organization string         `json:"organization"`
+	Provider     string         `json:"provider"`
+	Stats        DashboardStats `json:"stats"`
+	SuccessRate  *float64       `json:"success_rate,omitempty"`
+	Repos        []WeeklyRepo   `json:"repos"`
+}
+
+type WeeklyRepo struct {
+	Repository  string           `json:"repository"` // org/repo
+	Stats       DashboardStats   `json:"stats"`
+	SuccessRate *float64         `json:"success_rate,omitempty"`
+	Workflows   []WeeklyWorkflow `json:"workflows"`
+}
+
+type WeeklyWorkflow struct {
+	Workflow           string         `json:"workflow"`
+	Stats              DashboardStats `json:"stats"`
+	SuccessRate        *float64       `json:"success_rate,omitempty"`
+	AvgDurationSeconds int64          `json:"avg_duration_seconds"`
+	// The durations of the week's latest runs for a sparkline and their
+	// trend, like in /api/stats/workflows
+	Durations    []int64  `json:"durations,omitempty"`
+	TrendPercent *float64 `json:"trend_percent,omitempty"`
+}
+
+// successRate is the percentage of finished runs that succeeded, nil
+// without finished runs.
+func successRate(stats DashboardStats) *float64 {
+	finished := stats.Success + stats.Failed
+	if finished == 0 {
+		return nil
+	}
+	rate := math.Round(float64(stats.Success)/float64(finished)*1000) / 10
+	return &rate
+}
+
+// weekOf returns the ISO week t falls in and when that week starts.
+func weekOf(t time.Time) (string, time.Time) {
+	t = t.In(clock().Location())
+	year, week := t.ISOWeek()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	return fmt.Sprintf("%d-W%02d", year, week), start
+}
+
+func weeklySummaryKey(week string) string {
+	return "summary:weekly:" + week
+}
+
+func weeklyRunOf(job Job) weeklyRun {
+	return weeklyRun{
+		Provider:        job.Provider,
+		Organization:    job.Organization,
+		Pipeline:        job.Pipeline,
+		Workflow:        workflowName(job.Name),
+		Status:          job.Status,
+		Maintenance:     hasTag(job, "maintenance"),
+		DurationSeconds: job.DurationSeconds,
+		CreatedAt:       job.CreatedAt,
+
+		PassedOnRerun:        passedOnRerun(job),
+		FailedAttemptSeconds: job.FailedAttemptSeconds,
+	}
+}
+
+// recordWeeklySummary adds the runs of a fresh snapshot that finished or
+// changed since the previous fetch to their week, like recordHistory, and
+// the finished runs MAX_JOBS left out of its job list (dropped, see
+// jobCollector), which can't be compared and are added every time.
+func recordWeeklySummary(snap *Snapshot, dropped map[string]weeklyRun) {
+	updates := make(map[string]map[string]weeklyRun)
+	add := func(id string, run weeklyRun) {
+		week, _ := weekOf(run.CreatedAt)
+		if updates[week] == nil {
+			updates[week] = make(map[string]weeklyRun)
+		}
+		updates[week][id] = run
+	}
+	for _, job := range snap.Response.Jobs {
+		if finished(job) && job.ChangedAt.Equal(snap.FetchedAt) {
+			add(job.Provider+"|"+job.ID, weeklyRunOf(job))
+		}
+	}
+	for id, run := range dropped {
+		add(id, run)
+	}
+
+	go func() {
+		ctx := context.Background()
+		for week, runs := range updates {
+			if err := updateWeek(ctx, week, func(record *weekRecord) {
+				if record.Runs == nil {
+					record.Runs = make(map[string]weeklyRun)
+				}
+				for id, run := range runs {
+					record.Runs[id] = run
+				}
+			}); err != nil {
+				log.Printf("⚠️  Error recording weekly summary for %s: %v", week, err)
+			}
+		}
+
+		// Close the weeks whose grace period is over
+		for i := 1; i <= 2; i++ {
+			week, start := weekOf(clock().AddDate(0, 0, -7*i))
+			if clock().Before(start.AddDate(0, 0, 7).Add(weekGracePeriod)) {
+				continue
+			}
+			if err := updateWeek(ctx, week, func(record *weekRecord) {
+				if record.Summary == nil && record.Runs != nil {
+					summary := summarizeWeek(week, start, record.Runs)
+					summary.Closed = true
+					record.Summary, record.Runs = &summary, nil
+					log.Printf("📅 Closed weekly summary for %s: %d runs", week, summary.Stats.Total)
+				}
+			}); err != nil {
+				log.Printf("⚠️  Error closing weekly summary for %s: %v", week, err)
+			}
+		}
+	}()
+}
+
+// updateWeek changes a week's record under a lock, replicas and periods
+// record the same runs. Closed weeks aren't changed anymore.
+func updateWeek(ctx context.Context, week string, update func(*weekRecord)) error {
+	key := weeklySummaryKey(week)
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+key, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			time.Sleep(lockPollInterval)
+			continue
+		}
+		defer release()
+
+		record, err := loadWeek(ctx, week)
+		if err != nil {
+			return err
+		}
+		if record.Summary != nil {
+			return nil
+		}
+		update(&record)
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, key, data, weeklySummaryRetention)
+	}
+	return fmt.Errorf("timed out waiting for the weekly summary lock")
+}
+
+func loadWeek(ctx context.Context, week string) (weekRecord, error) {
+	var record weekRecord
+	data, ok, err := store.Get(ctx, weeklySummaryKey(week))
+	if err != nil || !ok {
+		return record, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// summarizeWeek totals a week's runs per organization, repository and
+// workflow.
+func summarizeWeek(week string, start time.Time, runs map[string]weeklyRun) WeeklySummary {
+	summary := WeeklySummary{Week: week, Start: start, End: start.AddDate(0, 0, 7), Orgs: []WeeklyOrg{}}
+	orgs := make(map[string]*WeeklyOrg)
+	repos := make(map[string]*WeeklyRepo)
+	workflows := make(map[string]*WeeklyWorkflow)
+	durations := make(map[string]int64)
+	timed := make(map[string][]weeklyRun) // runs with a duration, per workflow key
+	parent := make(map[string]string)     // workflow key to repo key, repo key to org key
+
+	for _, run := range runs {
+		job := Job{Status: run.Status}
+		if run.Maintenance {
+			job.Tags = []string{"maintenance"}
+		}
+		if run.PassedOnRerun {
+			job.SupersededAttempts, job.FailedAttemptSeconds = []string{"failed"}, run.FailedAttemptSeconds
+		}
+		orgKey := run.Provider + "|" + run.Organization
+		repoKey := orgKey + "/" + run.Pipeline
+		workflowKey := repoKey + "|" + run.Workflow
+		if orgs[orgKey] == nil {
+			orgs[orgKey] = &WeeklyOrg{Organization: run.Organization, Provider: run.Provider}
+		}
+		if repos[repoKey] == nil {
+			repos[repoKey] = &WeeklyRepo{Repository: run.Organization + "/" + run.Pipeline}
+		}
+		if workflows[workflowKey] == nil {
+			workflows[workflowKey] = &WeeklyWorkflow{Workflow: run.Workflow}
+		}
+		addToStats(&summary.Stats, job)
+		addToStats(&orgs[orgKey].Stats, job)
+		addToStats(&repos[repoKey].Stats, job)
+		addToStats(&workflows[workflowKey].Stats, job)
+		durations[workflowKey] += run.DurationSeconds
+		if run.DurationSeconds > 0 {
+			timed[workflowKey] = append(timed[workflowKey], run)
+		}
+		parent[workflowKey], parent[repoKey] = repoKey, orgKey
+	}
+
+	for workflowKey, workflow := range workflows {
+		workflow.SuccessRate = successRate(workflow.Stats)
+		workflow.AvgDurationSeconds = durations[workflowKey] / int64(workflow.Stats.Total)
+		runs := timed[workflowKey]
+		sort.Slice(runs, func(i, j int) bool { return runs[i].CreatedAt.Before(runs[j].CreatedAt) })
+		for _, run := range runs[max(len(runs)-defaultSparklineRuns, 0):] {
+			workflow.Durations = append(workflow.Durations, run.DurationSeconds)
+		}
+		workflow.TrendPercent = durationTrend(workflow.Durations)
+		repo := repos[parent[workflowKey]]
+		repo.Workflows = append(repo.Workflows, *workflow)
+	}
+	for repoKey, repo := range repos {
+		repo.SuccessRate = successRate(repo.Stats)
+		sort.Slice(repo.Workflows, func(i, j int) bool { return repo.Workflows[i].Workflow < repo.Workflows[j].Workflow })
+		org := orgs[parent[repoKey]]
+		org.Repos = append(org.Repos, *repo)
+	}
+	for _, org := range orgs {
+		org.SuccessRate = successRate(org.Stats)
+		sort.Slice(org.Repos, func(i, j int) bool { return org.Repos[i].Repository < org.Repos[j].Repository })
+		summary.Orgs = append(summary.Orgs, *org)
+	}
+	sort.Slice(summary.Orgs, func(i, j int) bool {
+		if summary.Orgs[i].Organization != summary.Orgs[j].Organization {
+			return summary.Orgs[i].Organization < summary.Orgs[j].Organization
+		}
+		return summary.Orgs[i].Provider < summary.Orgs[j].Provider
+	})
+	return summary
+}
+
+// filter narrows a summary to one organization, repository or workflow,
+// with the totals of what's left.
+func (s WeeklySummary) filter(org, repo, workflow string) WeeklySummary {
+	if org == "" && repo == "" && workflow == "" {
+		return s
+	}
+	filtered := s
+	filtered.Stats = DashboardStats{}
+	filtered.Orgs = []WeeklyOrg{}
+	for _, o := range s.Orgs {
+		if org != "" && o.Organization != org {
+			continue
+		}
+		keptOrg := o
+		keptOrg.Stats, keptOrg.Repos = DashboardStats{}, []WeeklyRepo{}
+		for _, r := range o.Repos {
+			if repo != "" && !strings.EqualFold(r.Repository, repo) {
+				continue
+			}
+			keptRepo := r
+			keptRepo.Stats, keptRepo.Workflows = DashboardStats{}, []WeeklyWorkflow{}
+			for _, w := range r.Workflows {
+				if workflow != "" && !strings.EqualFold(w.Workflow, workflow) {
+					continue
+				}
+				keptRepo.Workflows = append(keptRepo.Workflows, w)
+				addStats(&keptRepo.Stats, w.Stats)
+			}
+			if len(keptRepo.Workflows) == 0 {
+				continue
+			}
+			keptRepo.SuccessRate = successRate(keptRepo.Stats)
+			keptOrg.Repos = append(keptOrg.Repos, keptRepo)
+			addStats(&keptOrg.Stats, keptRepo.Stats)
+		}
+		if len(keptOrg.Repos) == 0 {
+			continue
+		}
+		keptOrg.SuccessRate = successRate(keptOrg.Stats)
+		filtered.Orgs = append(filtered.Orgs, keptOrg)
+		addStats(&filtered.Stats, keptOrg.Stats)
+	}
+	return filtered
+}
+
+type WeeklySummaryResponse struct {
+	Weeks []WeeklySummary `json:"weeks"` // newest first
+}
+
+// weeklySummaryHandler serves /api/summary/weekly?weeks=12, the weekly
+// totals per organization, repository and workflow. ?org=, ?repo=org/repo
+// and ?workflow= narrow them down.
+func weeklySummaryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	weeks := 12
+	if value := query.Get("weeks"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("Invalid weeks %q", value), http.StatusBadRequest)
+			return
+		}
+		weeks = min(n, maxSummaryWeeks)
+	}
+
+	response := WeeklySummaryResponse{Weeks: []WeeklySummary{}}
+	for i := 0; i < weeks; i++ {
+		week, start := weekOf(clock().AddDate(0, 0, -7*i))
+		record, err := loadWeek(r.Context(), week)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading weekly summary for %s: %v", week, err), http.StatusInternalServerError)
+			return
+		}
+		summary := record.Summary
+		if summary == nil {
+			if record.Runs == nil {
+				continue // nothing recorded
+			}
+			open := summarizeWeek(week, start, record.Runs)
+			summary = &open
+		}
+		response.Weeks = append(response.Weeks, summary.filter(query.Get("org"), query.Get("repo"), query.Get("workflow")))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}
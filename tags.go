@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Custom tags: labels like "critical" or "flaky-known" that teams attach
+// to a single run or to every run of a workflow through /api/tags. They're
+// kept in the Store and added to jobs when responses are served, so they
+// also apply to runs fetched before they were set.
+
+const customTagsKey = "tags"
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+// CustomTag attaches a tag to a run (RunID set) or to every run of a
+// workflow.
+type CustomTag struct {
+	Tag        string    `json:"tag"`
+	Provider   string    `json:"provider,omitempty"` // empty matches every provider
+	Repository string    `json:"repository"`         // org/repo
+	Workflow   string    `json:"workflow,omitempty"`
+	RunID      int64     `json:"run_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (t CustomTag) matches(job Job) bool {
+	if (t.Provider != "" && t.Provider != job.Provider) || !strings.EqualFold(t.Repository, job.Organization+"/"+job.Pipeline) {
+		return false
+	}
+	if t.RunID != 0 {
+		return t.RunID == job.RunID
+	}
+	return strings.EqualFold(t.Workflow, workflowName(job.Name))
+}
+
+func (t CustomTag) same(other CustomTag) bool {
+	return t.Tag == other.Tag && t.Provider == other.Provider && strings.EqualFold(t.Repository, other.Repository) &&
+		strings.EqualFold(t.Workflow, other.Workflow) && t.RunID == other.RunID
+}
+
+func loadCustomTags(ctx context.Context) ([]CustomTag, error) {
+	data, ok, err := store.Get(ctx, customTagsKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var tags []CustomTag
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// updateCustomTags changes the stored tags under a lock, replicas may edit
+// them at the same time.
+func updateCustomTags(ctx context.Context, update func([]CustomTag) []CustomTag) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+customTagsKey, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			time.Sleep(lockPollInterval)
+			continue
+		}
+		defer release()
+
+		tags, err := loadCustomTags(ctx)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(update(tags))
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, customTagsKey, data, 0)
+	}
+	return fmt.Errorf("timed out waiting for the tags lock")
+}
+
+// applyCustomTags adds the stored custom tags to the jobs they match.
+func applyCustomTags(ctx context.Context, jobs []Job) {
+	tags, err := loadCustomTags(ctx)
+	if err != nil {
+		log.Printf("⚠️  Error reading custom tags: %v", err)
+		return
+	}
+	if len(tags) == 0 {
+		return
+	}
+	for i := range jobs {
+		for _, tag := range tags {
+			if tag.matches(jobs[i]) && !hasTag(jobs[i], tag.Tag) {
+				jobs[i].Tags = append(jobs[i].Tags, tag.Tag)
+			}
+		}
+	}
+}
+
+// filterByTag keeps the jobs carrying tag.
+func filterByTag(jobs []Job, tag string) []Job {
+	filtered := []Job{}
+	for _, job := range jobs {
+		if hasTag(job, tag) {
+			filtered = append(filtered, job)
+		}
+	}
+	return filtered
+}
+
+// tagsHandler serves /api/tags:
+//
+//	GET                                                   list the custom tags (?tag= filters)
+//	POST   ?tag=critical&repo=org/repo&workflow=CI        tag every run of a workflow
+//	POST   ?tag=flaky-known&repo=org/repo&run_id=123      tag one run
+//	DELETE with the same parameters                       remove the tag
+//
+// provider= limits a tag to one CI provider. Without a login (OAuth off),
+// only the admin token may change tags.
+func tagsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := loadCustomTags(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading tags: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result := []CustomTag{}
+		for _, tag := range tags {
+			if query.Get("tag") == "" || tag.Tag == query.Get("tag") {
+				result = append(result, tag)
+			}
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(result)
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, admin := adminFrom(r); oauthConfig == nil && !admin {
+		http.Error(w, "Changing tags needs ADMIN_TOKEN as bearer token, or a login (set OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET)", http.StatusUnauthorized)
+		return
+	}
+
+	tag := CustomTag{
+		Tag:        strings.ToLower(query.Get("tag")),
+		Provider:   query.Get("provider"),
+		Repository: strings.Trim(query.Get("repo"), "/"),
+		Workflow:   query.Get("workflow"),
+		CreatedAt:  clock(),
+	}
+	if !tagPattern.MatchString(tag.Tag) {
+		http.Error(w, fmt.Sprintf("Invalid tag %q: lowercase letters, digits, '.', '_' and '-', up to 50 characters", tag.Tag), http.StatusBadRequest)
+		return
+	}
+	if tag.Tag == "maintenance" {
+		http.Error(w, "The maintenance tag is set by MAINTENANCE_WINDOWS", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("run_id"); value != "" {
+		runID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid run_id %q", value), http.StatusBadRequest)
+			return
+		}
+		tag.RunID = runID
+	}
+	if !strings.Contains(tag.Repository, "/") || (tag.RunID == 0) == (tag.Workflow == "") {
+		http.Error(w, "Expected ?tag=name&repo=org/repo and either workflow=name or run_id=id", http.StatusBadRequest)
+		return
+	}
+
+	changed := false
+	err := updateCustomTags(r.Context(), func(tags []CustomTag) []CustomTag {
+		kept := []CustomTag{}
+		for _, existing := range tags {
+			if existing.same(tag) {
+				changed = r.Method == http.MethodDelete
+				if changed {
+					continue
+				}
+			}
+			kept = append(kept, existing)
+		}
+		if r.Method == http.MethodPost && !slices.ContainsFunc(tags, tag.same) {
+			kept = append(kept, tag)
+			changed = true
+		}
+		return kept
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error saving tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodDelete && !changed {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if changed {
+		log.Printf("🏷️  %s tag %q on %s %s", map[string]string{http.MethodPost: "Added", http.MethodDelete: "Removed"}[r.Method], tag.Tag, tag.Repository, tagTarget(tag))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func tagTarget(tag CustomTag) string {
+	if tag.RunID != 0 {
+		return fmt.Sprintf("run %d", tag.RunID)
+	}
+	return "workflow " + tag.Workflow
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/sync/singleflight"
+)
+
+// Time to green: how long after a pull request is merged into the default
+// branch the first successful run on that branch finishes, which is about
+// how long a hotfix takes to be deployable. A red run after the merge
+// makes it longer until a fix goes green. ?workflow= counts only the
+// workflow that gates deploys, e.g. CI, instead of any successful run.
+
+// mergedPullsTTL is how long the merged pull requests of a repository are
+// reused.
+const mergedPullsTTL = 15 * time.Minute
+
+// timeToGreenGroup shares a computation between requests for the same
+// period, filters and viewer.
+var timeToGreenGroup singleflight.Group
+
+// mergedPull is a pull request merged into the default branch.
+type mergedPull struct {
+	Number         int       `json:"number"`
+	Title          string    `json:"title"`
+	MergedAt       time.Time `json:"merged_at"`
+	MergeCommitSHA string    `json:"merge_commit_sha,omitempty"`
+	HTMLURL        string    `json:"html_url,omitempty"`
+}
+
+var mergedPulls = struct {
+	sync.Mutex
+	repos map[string]cachedMergedPulls
+}{repos: make(map[string]cachedMergedPulls)}
+
+type cachedMergedPulls struct {
+	pulls     []mergedPull
+	since     time.Time // pull requests updated before it weren't listed
+	fetchedAt time.Time
+}
+
+// timeToGreenBuckets are the upper bounds of the distribution, in seconds;
+// the last bucket is open.
+var timeToGreenBuckets = []struct {
+	label string
+	upTo  int64
+}{
+	{"<10m", 600},
+	{"10-30m", 1800},
+	{"30m-1h", 3600},
+	{"1-4h", 4 * 3600},
+	{"4-24h", 24 * 3600},
+	{">24h", 0},
+}
+
+// TimeToGreen is the distribution of the times to green of some merges.
+type TimeToGreen struct {
+	Merges       int            `json:"merges"`
+	Green        int            `json:"green"`     // merges followed by a successful run
+	Pending      int            `json:"pending"`   // merges without a successful run since
+	RedFirst     int            `json:"red_first"` // merges whose first run failed
+	P50Seconds   *int64         `json:"p50_seconds,omitempty"`
+	P75Seconds   *int64         `json:"p75_seconds,omitempty"`
+	P90Seconds   *int64         `json:"p90_seconds,omitempty"`
+	P95Seconds   *int64         `json:"p95_seconds,omitempty"`
+	MaxSeconds   *int64         `json:"max_seconds,omitempty"`
+	Distribution map[string]int `json:"distribution"` // merges per bucket of time to green
+}
+
+// MergeToGreen is one merge and the run that made the branch green.
+type MergeToGreen struct {
+	Pull         mergedPull `json:"pull"`
+	GreenRunID   int64      `json:"green_run_id,omitempty"`
+	GreenAt      *time.Time `json:"green_at,omitempty"`
+	Seconds      *int64     `json:"seconds,omitempty"`
+	FirstRunFail bool       `json:"first_run_failed,omitempty"`
+}
+
+type RepoTimeToGreen struct {
+	Repository    string `json:"repository"`
+	DefaultBranch string `json:"default_branch"`
+	TimeToGreen
+	Slowest []MergeToGreen `json:"slowest"` // pending first, then the longest, at most 5
+}
+
+type TimeToGreenResponse struct {
+	Period       string            `json:"period"`
+	FetchedAt    time.Time         `json:"fetched_at"`
+	Workflow     string            `json:"workflow,omitempty"`
+	ReposSkipped int               `json:"repos_skipped,omitempty"` // merged pull requests not read, e.g. on a low budget
+	Overall      TimeToGreen       `json:"overall"`
+	Repositories []RepoTimeToGreen `json:"repositories"` // slowest p90 first
+}
+
+// fetchMergedPulls returns the pull requests merged into a branch of a
+// repository that were updated since a time, cached for mergedPullsTTL.
+func fetchMergedPulls(ctx context.Context, org, repo, branch string, since time.Time) ([]mergedPull, error) {
+	key := org + "/" + repo + "|" + branch
+	mergedPulls.Lock()
+	cached, ok := mergedPulls.repos[key]
+	mergedPulls.Unlock()
+	if ok && clock().Sub(cached.fetchedAt) < mergedPullsTTL && !cached.since.After(since) {
+		return cached.pulls, nil
+	}
+
+	// The most recently updated pull requests first, up to the first one
+	// last updated before since
+	var merged []mergedPull
+	opts := &github.PullRequestListOptions{
+		State:       "closed",
+		Base:        branch,
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+listing:
+	for {
+		if err := budget.acquire(ctx); err != nil {
+			return nil, err
+		}
+		listCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+		pulls, resp, err := githubClient.PullRequests.List(listCtx, org, repo, opts)
+		cancel()
+		budget.update(resp)
+		if err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls {
+			if pull.GetUpdatedAt().Before(since) {
+				break listing
+			}
+			if pull.MergedAt != nil {
+				merged = append(merged, mergedPull{Number: pull.GetNumber(), Title: pull.GetTitle(), MergedAt: pull.MergedAt.Time, MergeCommitSHA: pull.GetMergeCommitSHA(), HTMLURL: pull.GetHTMLURL()})
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	mergedPulls.Lock()
+	// Repositories not asked about within the TTL are dropped
+	now := clock()
+	for k, entry := range mergedPulls.repos {
+		if now.Sub(entry.fetchedAt) >= mergedPullsTTL {
+			delete(mergedPulls.repos, k)
+		}
+	}
+	mergedPulls.repos[key] = cachedMergedPulls{pulls: merged, since: since, fetchedAt: now}
+	mergedPulls.Unlock()
+	return merged, nil
+}
+
+// demoMergedPulls makes every commit pushed to main of a demo repository a
+// merge just before its first run.
+func demoMergedPulls(runs []Job) []mergedPull {
+	var pulls []mergedPull
+	seen := make(map[string]bool)
+	for i := len(runs) - 1; i >= 0; i-- {
+		job := runs[i]
+		if job.Event == "push" && !seen[job.HeadSHA] {
+			seen[job.HeadSHA] = job.HeadSHA != ""
+			pulls = append(pulls, mergedPull{Number: int(job.RunID % 1000), Title: "Demo change", MergedAt: job.CreatedAt.Add(-10 * time.Second), MergeCommitSHA: job.HeadSHA})
+		}
+	}
+	return pulls
+}
+
+// finishedAt is when a finished run finished.
+func finishedAt(job Job) time.Time {
+	start := job.StartedAt
+	if start.IsZero() {
+		start = job.CreatedAt
+	}
+	return start.Add(time.Duration(job.DurationSeconds) * time.Second)
+}
+
+// firstRuns returns when each commit of a branch was first run on, which
+// is about when it reached the branch. runs are newest first.
+func firstRuns(runs []Job) map[string]time.Time {
+	first := make(map[string]time.Time)
+	for _, run := range runs {
+		if run.HeadSHA != "" {
+			first[run.HeadSHA] = run.CreatedAt
+		}
+	}
+	return first
+}
+
+// mergeToGreen finds the first successful run of the default branch that
+// finished after the merge, of the merge commit or a commit that reached
+// the branch after it: a run of an older commit, e.g. one re-run after the
+// merge, doesn't test the merge. runs are the branch's runs, newest first,
+// and first their firstRuns.
+func mergeToGreen(pull mergedPull, runs []Job, first map[string]time.Time) MergeToGreen {
+	result := MergeToGreen{Pull: pull}
+	// Without a run of the merge commit, e.g. one skipped with [skip ci],
+	// commits first run on after the merge are later ones
+	since := pull.MergedAt
+	if at, ok := first[pull.MergeCommitSHA]; ok {
+		since = at
+	}
+	var firstRun *Job
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if run.CreatedAt.Before(pull.MergedAt) {
+			continue
+		}
+		if run.HeadSHA != pull.MergeCommitSHA && (run.HeadSHA == "" || first[run.HeadSHA].Before(since)) {
+			continue
+		}
+		if firstRun == nil && finished(run) {
+			firstRun = &runs[i]
+		}
+		if run.Status != "success" {
+			continue
+		}
+		if at := finishedAt(run); result.GreenAt == nil || at.Before(*result.GreenAt) {
+			seconds := int64(at.Sub(pull.MergedAt).Seconds())
+			result.GreenRunID, result.GreenAt, result.Seconds = run.RunID, &at, &seconds
+		}
+	}
+	result.FirstRunFail = firstRun != nil && firstRun.Status == "failed"
+	return result
+}
+
+// summarizeTimeToGreen computes the distribution of merges.
+func summarizeTimeToGreen(merges []MergeToGreen) TimeToGreen {
+	summary := TimeToGreen{Merges: len(merges), Distribution: make(map[string]int)}
+	for _, bucket := range timeToGreenBuckets {
+		summary.Distribution[bucket.label] = 0
+	}
+	var seconds []int64
+	for _, merge := range merges {
+		if merge.FirstRunFail {
+			summary.RedFirst++
+		}
+		if merge.Seconds == nil {
+			summary.Pending++
+			continue
+		}
+		summary.Green++
+		seconds = append(seconds, *merge.Seconds)
+		for _, bucket := range timeToGreenBuckets {
+			if bucket.upTo == 0 || *merge.Seconds < bucket.upTo {
+				summary.Distribution[bucket.label]++
+				break
+			}
+		}
+	}
+	if len(seconds) == 0 {
+		return summary
+	}
+	sort.Slice(seconds, func(i, j int) bool { return seconds[i] < seconds[j] })
+	percentile := func(p int) *int64 {
+		// Nearest rank
+		value := seconds[(len(seconds)*p+99)/100-1]
+		return &value
+	}
+	summary.P50Seconds, summary.P75Seconds, summary.P90Seconds, summary.P95Seconds = percentile(50), percentile(75), percentile(90), percentile(95)
+	summary.MaxSeconds = &seconds[len(seconds)-1]
+	return summary
+}
+
+// timeToGreenHandler serves /api/stats/time-to-green?period=week, the time
+// from merging into the default branch to its first successful run after,
+// per GitHub repository. ?repo=org/repo narrows it down, ?workflow= only
+// counts runs of that workflow as green.
+func timeToGreenHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	repo, workflow := query.Get("repo"), query.Get("workflow")
+
+	viewer := viewerFrom(r)
+	key := strings.Join([]string{period, strings.ToLower(repo), strings.ToLower(workflow)}, "|")
+	if viewer.restricted() {
+		key += "|" + viewer.Login
+	}
+	// The request that started it may go away before the others
+	ctx := context.WithoutCancel(r.Context())
+	v, err, _ := timeToGreenGroup.Do(key, func() (interface{}, error) {
+		return computeTimeToGreen(ctx, viewer, period, repo, workflow)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(v.(*TimeToGreenResponse))
+}
+
+// computeTimeToGreen computes the time to green of the repositories the
+// viewer sees. The merged pull requests of the repositories are listed at
+// the same time, in the fetch slots (FETCH_CONCURRENCY) of the dashboard.
+func computeTimeToGreen(ctx context.Context, viewer *viewerAccess, period, repo, workflow string) (*TimeToGreenResponse, error) {
+	snap, err := getDashboard(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+	snap = viewer.snapshot(snap)
+
+	// Runs per repository, newest first like the jobs
+	byRepo := make(map[string][]Job)
+	var order []string
+	for _, job := range snap.Response.Jobs {
+		if job.Provider != "github" && job.Provider != "demo" {
+			continue
+		}
+		name := job.Organization + "/" + job.Pipeline
+		if repo != "" && !strings.EqualFold(repo, name) {
+			continue
+		}
+		if workflow != "" && !strings.EqualFold(workflowName(job.Name), workflow) {
+			continue
+		}
+		if _, ok := byRepo[name]; !ok {
+			order = append(order, name)
+		}
+		byRepo[name] = append(byRepo[name], job)
+	}
+
+	window := newFetchWindow(period)
+	response := &TimeToGreenResponse{Period: period, FetchedAt: snap.FetchedAt, Workflow: workflow, Repositories: []RepoTimeToGreen{}}
+	results := make([]*RepoTimeToGreen, len(order))
+	merges := make([][]MergeToGreen, len(order))
+	skipped := make([]bool, len(order))
+	var wg sync.WaitGroup
+	for i, name := range order {
+		listed := byRepo[name][0].Provider == "github"
+		if listed && !acquireFetchSlot(ctx) {
+			skipped[i] = true
+			continue
+		}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			if listed {
+				defer releaseFetchSlot()
+			}
+			results[i], merges[i], skipped[i] = repoTimeToGreen(ctx, name, byRepo[name], window)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var all []MergeToGreen
+	for i := range order {
+		if skipped[i] {
+			response.ReposSkipped++
+		}
+		if results[i] != nil {
+			all = append(all, merges[i]...)
+			response.Repositories = append(response.Repositories, *results[i])
+		}
+	}
+	response.Overall = summarizeTimeToGreen(all)
+	sort.SliceStable(response.Repositories, func(i, j int) bool {
+		a, b := response.Repositories[i].P90Seconds, response.Repositories[j].P90Seconds
+		if (a == nil) != (b == nil) {
+			return b == nil
+		}
+		return a != nil && *a > *b
+	})
+	return response, nil
+}
+
+// repoTimeToGreen computes the time to green of the merges of one
+// repository within the window, nil without any, and whether its merged
+// pull requests couldn't be read. jobs are its runs, newest first.
+func repoTimeToGreen(ctx context.Context, name string, jobs []Job, window fetchWindow) (*RepoTimeToGreen, []MergeToGreen, bool) {
+	org, repoName := jobs[0].Organization, jobs[0].Pipeline
+	branch := "main"
+	if jobs[0].Provider == "github" {
+		var err error
+		if branch, err = repoDefaultBranch(ctx, org, repoName); err != nil {
+			return nil, nil, true
+		}
+	}
+	var runs []Job
+	for _, job := range jobs {
+		if job.Branch == branch {
+			runs = append(runs, job)
+		}
+	}
+	if len(runs) == 0 {
+		return nil, nil, false
+	}
+
+	var pulls []mergedPull
+	if jobs[0].Provider == "demo" {
+		pulls = demoMergedPulls(runs)
+	} else if budget.low() {
+		return nil, nil, true
+	} else {
+		var err error
+		if pulls, err = fetchMergedPulls(ctx, org, repoName, branch, window.Start); err != nil {
+			log.Printf("⚠️  Error listing merged pull requests of %s: %v", name, err)
+			return nil, nil, true
+		}
+	}
+
+	first := firstRuns(runs)
+	var merges []MergeToGreen
+	for _, pull := range pulls {
+		// Runs before the period aren't there to turn it green
+		if pull.MergedAt.Before(window.Start) || pull.MergedAt.After(window.Now) {
+			continue
+		}
+		merges = append(merges, mergeToGreen(pull, runs, first))
+	}
+	if len(merges) == 0 {
+		return nil, nil, false
+	}
+
+	slowest := append([]MergeToGreen(nil), merges...)
+	sort.Slice(slowest, func(i, j int) bool {
+		a, b := slowest[i], slowest[j]
+		if (a.Seconds == nil) != (b.Seconds == nil) {
+			return a.Seconds == nil
+		}
+		if a.Seconds == nil {
+			return a.Pull.MergedAt.Before(b.Pull.MergedAt)
+		}
+		return *a.Seconds > *b.Seconds
+	})
+	result := &RepoTimeToGreen{Repository: name, DefaultBranch: branch, TimeToGreen: summarizeTimeToGreen(merges)}
+	result.Slowest = slowest[:min(len(slowest), 5)]
+	return result, merges, false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeTimeToGreen(t *testing.T) {
+	merge := func(seconds int64, firstRunFailed bool) MergeToGreen {
+		return MergeToGreen{Seconds: &seconds, FirstRunFail: firstRunFailed}
+	}
+	pending := MergeToGreen{FirstRunFail: true}
+	seconds := func(s int64) *int64 { return &s }
+	distribution := func(counts ...int) map[string]int {
+		result := make(map[string]int)
+		for i, bucket := range timeToGreenBuckets {
+			result[bucket.label] = counts[i]
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		merges []MergeToGreen
+		want   TimeToGreen
+	}{
+		{
+			name: "no merges",
+			want: TimeToGreen{Distribution: distribution(0, 0, 0, 0, 0, 0)},
+		},
+		{
+			name:   "only pending",
+			merges: []MergeToGreen{pending, {}},
+			want:   TimeToGreen{Merges: 2, Pending: 2, RedFirst: 1, Distribution: distribution(0, 0, 0, 0, 0, 0)},
+		},
+		{
+			name:   "one merge",
+			merges: []MergeToGreen{merge(300, false)},
+			want: TimeToGreen{
+				Merges: 1, Green: 1,
+				P50Seconds: seconds(300), P75Seconds: seconds(300), P90Seconds: seconds(300), P95Seconds: seconds(300), MaxSeconds: seconds(300),
+				Distribution: distribution(1, 0, 0, 0, 0, 0),
+			},
+		},
+		{
+			name: "bucket edges and nearest rank",
+			merges: []MergeToGreen{
+				merge(600, false), merge(599, false), merge(3600, true), merge(1800, false),
+				merge(90000, true), merge(20000, false), pending,
+			},
+			want: TimeToGreen{
+				Merges: 7, Green: 6, Pending: 1, RedFirst: 3,
+				P50Seconds: seconds(1800), P75Seconds: seconds(20000), P90Seconds: seconds(90000), P95Seconds: seconds(90000), MaxSeconds: seconds(90000),
+				Distribution: distribution(1, 1, 1, 1, 1, 1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeTimeToGreen(tt.merges); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("summarizeTimeToGreen() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
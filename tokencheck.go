@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Token self-check: on startup, and on /api/status?check=true at most once
+// a minute, the token is checked against every configured GitHub
+// organization the way a new organization is (see onboarding.go), so a
+// missing scope or SAML SSO authorization shows up as such rather than as
+// errors deep inside a fetch.
+
+// TokenCheck is the outcome of the latest self-check.
+type TokenCheck struct {
+	OK        bool        `json:"ok"` // every organization passed
+	CheckedAt time.Time   `json:"checked_at"`
+	Orgs      []*OrgCheck `json:"orgs"`
+}
+
+var tokenCheck struct {
+	sync.Mutex
+	latest *TokenCheck
+}
+
+// tokenCheckGroup coalesces concurrent rechecks into one.
+var tokenCheckGroup singleflight.Group
+
+// tokenRecheckInterval keeps /api/status?check=true from spending the
+// rate limit on every request.
+const tokenRecheckInterval = time.Minute
+
+// latestTokenCheck returns the latest self-check, nil before the first.
+func latestTokenCheck() *TokenCheck {
+	tokenCheck.Lock()
+	defer tokenCheck.Unlock()
+	return tokenCheck.latest
+}
+
+// recheckToken checks the token again, shared by concurrent callers, unless
+// the latest check is younger than tokenRecheckInterval.
+func recheckToken(ctx context.Context) *TokenCheck {
+	v, _, _ := tokenCheckGroup.Do("check", func() (interface{}, error) {
+		if latest := latestTokenCheck(); latest != nil && clock().Sub(latest.CheckedAt) < tokenRecheckInterval {
+			return latest, nil
+		}
+		// Shared, so not cancelled with the first caller's request
+		return checkToken(context.WithoutCancel(ctx)), nil
+	})
+	return v.(*TokenCheck)
+}
+
+// redacted leaves out the organizations, whose repositories and scopes are
+// only shown to admins and users who see everything.
+func (c *TokenCheck) redacted() *TokenCheck {
+	if c == nil {
+		return nil
+	}
+	return &TokenCheck{OK: c.OK, CheckedAt: c.CheckedAt}
+}
+
+// checkToken checks the token against the configured GitHub organizations
+// and logs what's missing. Demo mode and replayed fixtures have nothing to
+// check.
+func checkToken(ctx context.Context) *TokenCheck {
+	if demoMode || replayDir != "" {
+		return nil
+	}
+	result := &TokenCheck{OK: true, Orgs: []*OrgCheck{}}
+	for _, src := range currentSources() {
+		if src.Provider.Name() != "github" {
+			continue
+		}
+		check := &OrgCheck{Organization: accountEntry(src.Org)}
+		checkOrgAccess(ctx, check)
+		check.OK = len(check.Errors) == 0
+		result.OK = result.OK && check.OK
+		result.Orgs = append(result.Orgs, check)
+
+		for _, problem := range check.Errors {
+			log.Printf("❌ Token check %s: %s", src.Org, problem)
+		}
+		for _, warning := range check.Warnings {
+			log.Printf("⚠️  Token check %s: %s", src.Org, warning)
+		}
+		if check.OK && check.TokenScopes != nil {
+			log.Printf("🔑 Token check %s: %d repositories, %d active, scopes %s", src.Org, check.Repos, check.ActiveRepos, strings.Join(check.TokenScopes, ", "))
+		} else if check.OK {
+			log.Printf("🔑 Token check %s: %d repositories, %d active", src.Org, check.Repos, check.ActiveRepos)
+		}
+	}
+	if len(result.Orgs) == 0 {
+		return nil
+	}
+	result.CheckedAt = clock()
+
+	tokenCheck.Lock()
+	tokenCheck.latest = result
+	tokenCheck.Unlock()
+	return result
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Token rotation: GITHUB_TOKEN may hold several comma-separated tokens,
+// e.g. personal access tokens of different users, so a large organization
+// is crawled with the rate limit of all of them. Every request goes out
+// with the token that has the most calls left; a token that runs out is
+// left alone until its reset while the others carry on. The rate limit
+// budget (budget.go) works with the sum of the tokens, and keeps
+// RATE_LIMIT_RESERVE per token. All tokens should see the same
+// repositories, as any of them may fetch any repository.
+
+// githubTokens is set with more than one GITHUB_TOKEN.
+var githubTokens *tokenPool
+
+// tokenPool authenticates each request with the token that has the most
+// of its rate limit left.
+type tokenPool struct {
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	tokens []*pooledToken
+}
+
+// pooledToken is one token and its last known core rate limit.
+type pooledToken struct {
+	value     string
+	known     bool
+	remaining int
+	limit     int
+	resetAt   time.Time
+}
+
+// newTokenPool returns the pool of several tokens, or nil for a single
+// one.
+func newTokenPool(values []string) *tokenPool {
+	if len(values) < 2 {
+		return nil
+	}
+	pool := &tokenPool{}
+	for _, value := range values {
+		pool.tokens = append(pool.tokens, &pooledToken{value: value})
+	}
+	log.Printf("🔑 Rotating between %d GitHub tokens", len(values))
+	return pool
+}
+
+// size returns the number of tokens; 1 without a pool.
+func (p *tokenPool) size() int {
+	if p == nil {
+		return 1
+	}
+	return len(p.tokens)
+}
+
+// left returns the calls a token has left, assuming a full limit once it
+// was reset. Tokens not used yet come first.
+func (t *pooledToken) left(now time.Time) int {
+	switch {
+	case !t.known:
+		return int(^uint(0) >> 1)
+	case now.After(t.resetAt):
+		return t.limit
+	}
+	return t.remaining
+}
+
+// pick returns the token to send the next request with and counts the
+// call, so concurrent requests spread over the tokens.
+func (p *tokenPool) pick() *pooledToken {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	best := p.tokens[0]
+	for _, t := range p.tokens[1:] {
+		left, bestLeft := t.left(now), best.left(now)
+		// All used up: the one that resets first
+		if left > bestLeft || (left == 0 && bestLeft == 0 && t.resetAt.Before(best.resetAt)) {
+			best = t
+		}
+	}
+	if best.known && !now.After(best.resetAt) && best.remaining > 0 {
+		best.remaining--
+	}
+	return best
+}
+
+// record notes the core rate limit a response reported for a token.
+// GraphQL and search have limits of their own and are left out.
+func (p *tokenPool) record(t *pooledToken, resp *http.Response) {
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return
+	}
+	limit, err1 := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	remaining, err2 := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, err3 := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || limit == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	resetAt := time.Unix(reset, 0)
+	// Like rateBudget.update: out of order responses within the same reset
+	// window report more than is left
+	if t.known && resetAt.Equal(t.resetAt) && remaining > t.remaining {
+		return
+	}
+	t.known, t.remaining, t.limit, t.resetAt = true, remaining, limit, resetAt
+}
+
+func (p *tokenPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := p.pick()
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.value)
+	resp, err := p.base.RoundTrip(req)
+	if err == nil {
+		p.record(t, resp)
+	}
+	return resp, err
+}
+
+// available reports whether a token still has calls left before its
+// reset, so a rate limited request can be sent again with it.
+func (p *tokenPool) available() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, t := range p.tokens {
+		if t.left(now) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nextReset returns when the first used up token resets.
+func (p *tokenPool) nextReset() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var next time.Time
+	for _, t := range p.tokens {
+		if t.known && (next.IsZero() || t.resetAt.Before(next)) {
+			next = t.resetAt
+		}
+	}
+	return next
+}
+
+// rateLimit returns the sum of the tokens' rate limits, reset at the first
+// reset to come, or false before any token reported its rate limit. A
+// token past its reset counts with its full limit.
+func (p *tokenPool) rateLimit() (remaining, limit int, resetAt time.Time, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var lastReset time.Time
+	for _, t := range p.tokens {
+		if !t.known {
+			continue
+		}
+		ok = true
+		remaining += t.left(now)
+		limit += t.limit
+		if t.resetAt.After(now) && (resetAt.IsZero() || t.resetAt.Before(resetAt)) {
+			resetAt = t.resetAt
+		}
+		if t.resetAt.After(lastReset) {
+			lastReset = t.resetAt
+		}
+	}
+	if resetAt.IsZero() {
+		// Every token was reset since
+		resetAt = lastReset
+	}
+	return remaining, limit, resetAt, ok
+}
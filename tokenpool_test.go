@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenPoolPick(t *testing.T) {
+	now := time.Now()
+	soon, later := now.Add(10*time.Minute), now.Add(40*time.Minute)
+	tests := []struct {
+		name          string
+		tokens        []*pooledToken
+		want          string
+		wantRemaining int // of the picked token afterwards
+	}{
+		{
+			name: "unused token first",
+			tokens: []*pooledToken{
+				{value: "a", known: true, remaining: 4000, limit: 5000, resetAt: later},
+				{value: "b"},
+			},
+			want: "b",
+		},
+		{
+			name: "most calls left",
+			tokens: []*pooledToken{
+				{value: "a", known: true, remaining: 100, limit: 5000, resetAt: later},
+				{value: "b", known: true, remaining: 2500, limit: 5000, resetAt: later},
+				{value: "c", known: true, remaining: 900, limit: 5000, resetAt: soon},
+			},
+			want:          "b",
+			wantRemaining: 2499,
+		},
+		{
+			name: "reset counts with its full limit",
+			tokens: []*pooledToken{
+				{value: "a", known: true, remaining: 3000, limit: 5000, resetAt: later},
+				{value: "b", known: true, remaining: 0, limit: 5000, resetAt: now.Add(-time.Minute)},
+			},
+			want: "b",
+		},
+		{
+			name: "all used up: first to reset",
+			tokens: []*pooledToken{
+				{value: "a", known: true, remaining: 0, limit: 5000, resetAt: later},
+				{value: "b", known: true, remaining: 0, limit: 5000, resetAt: soon},
+			},
+			want: "b",
+		},
+		{
+			name: "tie keeps the first",
+			tokens: []*pooledToken{
+				{value: "a", known: true, remaining: 500, limit: 5000, resetAt: later},
+				{value: "b", known: true, remaining: 500, limit: 5000, resetAt: soon},
+			},
+			want:          "a",
+			wantRemaining: 499,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &tokenPool{tokens: tt.tokens}
+			got := pool.pick()
+			if got.value != tt.want {
+				t.Fatalf("pick() = %s, want %s", got.value, tt.want)
+			}
+			if got.known && now.Before(got.resetAt) && got.remaining != tt.wantRemaining {
+				t.Errorf("remaining = %d, want %d", got.remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestTokenPoolPickSpreads(t *testing.T) {
+	resetAt := time.Now().Add(time.Hour)
+	pool := &tokenPool{tokens: []*pooledToken{
+		{value: "a", known: true, remaining: 3, limit: 5000, resetAt: resetAt},
+		{value: "b", known: true, remaining: 2, limit: 5000, resetAt: resetAt},
+	}}
+	var picked string
+	for i := 0; i < 5; i++ {
+		picked += pool.pick().value
+	}
+	// Counting each call moves the next one to the other token
+	if picked != "aabab" {
+		t.Errorf("picked %s, want aabab", picked)
+	}
+}
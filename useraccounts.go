@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Personal accounts: GITHUB_ORG only lists the repositories of
+// organizations. Personal accounts are added with GITHUB_USERS, or as
+// user:<login> in GITHUB_ORG and github_orgs, and otherwise work like an
+// organization. The token owner's own account includes its private
+// repositories; other users only show their public ones. Organization-wide
+// features (runner alerts and tokens, rulesets, org Actions permissions)
+// leave them out.
+
+const userAccountPrefix = "user:"
+
+// githubUsers are the lowercased logins of the configured personal
+// accounts, guarded by runtimeMu.
+var githubUsers = map[string]bool{}
+
+// tokenLogin caches the login of the token's owner.
+var tokenLogin struct {
+	sync.Mutex
+	login string
+}
+
+// userAccounts turns GITHUB_USERS into user:<login> entries.
+func userAccounts(usersEnv string) []string {
+	var accounts []string
+	for _, login := range splitList(usersEnv) {
+		accounts = append(accounts, userAccountPrefix+strings.TrimPrefix(login, userAccountPrefix))
+	}
+	return accounts
+}
+
+// parseAccount returns the login of a GITHUB_ORG entry, and whether it's a
+// personal account.
+func parseAccount(entry string) (login string, user bool) {
+	if strings.HasPrefix(strings.ToLower(entry), userAccountPrefix) {
+		return strings.TrimSpace(entry[len(userAccountPrefix):]), true
+	}
+	return entry, false
+}
+
+// splitAccounts returns the logins of GITHUB_ORG entries in order, and
+// which of them are personal accounts.
+func splitAccounts(entries []string) (logins []string, users map[string]bool) {
+	users = make(map[string]bool)
+	for _, entry := range entries {
+		login, user := parseAccount(entry)
+		logins = append(logins, login)
+		if user {
+			users[strings.ToLower(login)] = true
+		}
+	}
+	return logins, users
+}
+
+// isGitHubUser reports whether a configured GitHub account is a personal
+// account rather than an organization.
+func isGitHubUser(login string) bool {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+	return githubUsers[strings.ToLower(login)]
+}
+
+// accountEntry is how a GitHub account is written in github_orgs.
+func accountEntry(login string) string {
+	if isGitHubUser(login) {
+		return userAccountPrefix + login
+	}
+	return login
+}
+
+// authenticatedLogin returns the login of the token's owner, asked once.
+func authenticatedLogin(ctx context.Context) (string, error) {
+	if githubApp {
+		return "", fmt.Errorf("GitHub App installation tokens belong to no user")
+	}
+	if githubTokens != nil {
+		return "", fmt.Errorf("the rotated GitHub tokens may belong to different users")
+	}
+	tokenLogin.Lock()
+	defer tokenLogin.Unlock()
+	if tokenLogin.login != "" {
+		return tokenLogin.login, nil
+	}
+	if err := budget.acquire(ctx); err != nil {
+		return "", err
+	}
+	user, resp, err := githubClient.Users.Get(ctx, "")
+	budget.update(resp)
+	if err != nil {
+		return "", err
+	}
+	tokenLogin.login = user.GetLogin()
+	return tokenLogin.login, nil
+}
+
+// listAccountRepos lists a page of an organization's or a user's
+// repositories, sorted by sort ("" for GitHub's default) newest first. For
+// the token owner's own account that includes its private repositories.
+func listAccountRepos(ctx context.Context, account string, user bool, sort string, page int) ([]*github.Repository, *github.Response, error) {
+	direction := ""
+	if sort != "" {
+		direction = "desc"
+	}
+	listOpts := github.ListOptions{PerPage: 100, Page: page}
+	if !user {
+		return githubClient.Repositories.ListByOrg(ctx, account, &github.RepositoryListByOrgOptions{
+			Type: "all", Sort: sort, Direction: direction, ListOptions: listOpts,
+		})
+	}
+	if own, err := authenticatedLogin(ctx); err == nil && strings.EqualFold(own, account) {
+		return githubClient.Repositories.ListByAuthenticatedUser(ctx, &github.RepositoryListByAuthenticatedUserOptions{
+			Affiliation: "owner", Sort: sort, Direction: direction, ListOptions: listOpts,
+		})
+	}
+	return githubClient.Repositories.ListByUser(ctx, account, &github.RepositoryListByUserOptions{
+		Type: "owner", Sort: sort, Direction: direction, ListOptions: listOpts,
+	})
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// View tokens: signed-in users create API tokens bound to a slice of the
+// dashboard (organizations, repositories, branches) through
+// /api/view-tokens, for screens that can't sign in, like a team's TV. A
+// token only reads: it sees the runs of its slice on the endpoints that are
+// narrowed down per repository, and nothing else. Only the token's hash is
+// kept in the Store, next to the watches. Tokens expire (VIEW_TOKEN_TTL,
+// at most VIEW_TOKEN_MAX_TTL) and only see what their creator still sees,
+// checked with the creator's token like their watches.
+
+const viewTokensKey = "view-tokens"
+
+// viewTokenCookie keeps a token given as ?token= on a page, so the page's
+// own API calls carry it.
+const viewTokenCookie = "cicd_view_token"
+
+// maxViewTokensPerUser keeps one user from filling the store.
+const maxViewTokensPerUser = 20
+
+// ViewToken is a token's slice of the data. A run is in it when its
+// organization is in Orgs or its repository in Repos, and, with Branches,
+// it ran on one of them.
+type ViewToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Login      string    `json:"login"` // who created it
+	Orgs       []string  `json:"orgs,omitempty"`
+	Repos      []string  `json:"repos,omitempty"` // org/repo
+	Branches   []string  `json:"branches,omitempty"`
+	GitHubOnly bool      `json:"github_only,omitempty"` // created by a user who only sees some GitHub repositories
+	Hash       string    `json:"hash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	creator *viewerAccess // what the creator sees now
+}
+
+// expired reports whether a token is past its expiry; tokens from before
+// expiries last VIEW_TOKEN_MAX_TTL.
+func (t *ViewToken) expired() bool {
+	expiresAt := t.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = t.CreatedAt.Add(viewTokenMaxTTL)
+	}
+	return !clock().Before(expiresAt)
+}
+
+// covers reports whether a run is in the token's slice. Run details and
+// logs are checked without a branch, per repository.
+func (t *ViewToken) covers(job Job) bool {
+	if t.GitHubOnly && job.Provider != "github" {
+		return false
+	}
+	if t.creator.restricted() && !t.creator.canSee(job) {
+		return false
+	}
+	in := false
+	for _, org := range t.Orgs {
+		in = in || strings.EqualFold(org, job.Organization)
+	}
+	for _, repo := range t.Repos {
+		in = in || strings.EqualFold(repo, job.Organization+"/"+job.Pipeline)
+	}
+	if !in || len(t.Branches) == 0 || job.Branch == "" {
+		return in
+	}
+	for _, branch := range t.Branches {
+		if branch == job.Branch {
+			return true
+		}
+	}
+	return false
+}
+
+func hashViewToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadViewTokens(ctx context.Context) ([]ViewToken, error) {
+	data, ok, err := store.Get(ctx, viewTokensKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var tokens []ViewToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// updateViewTokens changes the stored tokens under a lock, like
+// updateWatches.
+func updateViewTokens(ctx context.Context, update func([]ViewToken) ([]ViewToken, error)) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+viewTokensKey, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			time.Sleep(lockPollInterval)
+			continue
+		}
+		defer release()
+
+		tokens, err := loadViewTokens(ctx)
+		if err != nil {
+			return err
+		}
+		if tokens, err = update(tokens); err != nil {
+			return err
+		}
+		data, err := json.Marshal(tokens)
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, viewTokensKey, data, 0)
+	}
+	return fmt.Errorf("timed out waiting for the view tokens lock")
+}
+
+// requestViewToken returns the view token a request carries and where
+// from: "header" (a bearer token), "query" (?token=), or "cookie", set by
+// an earlier ?token=.
+func requestViewToken(r *http.Request) (token, from string) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), "header"
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, "query"
+	}
+	if cookie, err := r.Cookie(viewTokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, "cookie"
+	}
+	return "", ""
+}
+
+// viewTokenAccess returns what a view token may see, nil for an unknown,
+// revoked or expired token, or one whose creator's access can't be checked
+// anymore.
+func viewTokenAccess(ctx context.Context, token string) (*viewerAccess, error) {
+	tokens, err := loadViewTokens(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := hashViewToken(token)
+	for i := range tokens {
+		if tokens[i].Hash != hash {
+			continue
+		}
+		if tokens[i].expired() {
+			return nil, nil
+		}
+		creator, err := storedUserAccess(ctx, tokens[i].Login)
+		if err != nil || creator == nil {
+			return nil, err
+		}
+		tokens[i].creator = creator
+		return &viewerAccess{View: &tokens[i], CheckedAt: clock()}, nil
+	}
+	return nil, nil
+}
+
+// viewTokenAllowed reports whether a view token may make a request: reads
+// of the narrowed-down endpoints, but not those of a signed-in user.
+func viewTokenAllowed(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	switch {
+	case r.URL.Path == "/api/watches", r.URL.Path == "/api/view-tokens", strings.HasPrefix(r.URL.Path, "/api/push/"):
+		return false
+	}
+	return scopedPath(r.URL.Path)
+}
+
+// viewTokensHandler serves /api/view-tokens, the signed-in user's view
+// tokens:
+//
+//	GET                                                              list them
+//	POST   ?name=TV lantai 3&orgs=acme&repos=acme-labs/api&branches=main  create one
+//	DELETE ?id=<id>                                                  revoke it
+//
+// The token itself is only in the response to POST. ?expires_in=720h
+// shortens or extends VIEW_TOKEN_TTL, up to VIEW_TOKEN_MAX_TTL.
+func viewTokensHandler(w http.ResponseWriter, r *http.Request) {
+	viewer := viewerFrom(r)
+	if viewer == nil {
+		http.Error(w, "View tokens need login (set OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET)", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := loadViewTokens(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading view tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result := []ViewToken{}
+		for _, token := range tokens {
+			if strings.EqualFold(token.Login, viewer.Login) {
+				token.Hash = ""
+				result = append(result, token)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
+	case http.MethodPost:
+		sess := loadSession(r)
+		if sess == nil {
+			http.Error(w, "View tokens need login", http.StatusUnauthorized)
+			return
+		}
+		ttl := viewTokenTTL
+		if expiresIn := query.Get("expires_in"); expiresIn != "" {
+			d, err := time.ParseDuration(expiresIn)
+			if err != nil || d <= 0 || d > viewTokenMaxTTL {
+				http.Error(w, fmt.Sprintf("Invalid expires_in %q: expected a duration up to %s", expiresIn, viewTokenMaxTTL), http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		secret := "cvt_" + randomToken()
+		token := ViewToken{
+			ID:         randomToken()[:16],
+			Name:       strings.TrimSpace(query.Get("name")),
+			Login:      viewer.Login,
+			Orgs:       splitList(query.Get("orgs")),
+			Repos:      splitList(query.Get("repos")),
+			Branches:   splitList(query.Get("branches")),
+			GitHubOnly: viewer.restricted(),
+			Hash:       hashViewToken(secret),
+			CreatedAt:  clock(),
+			ExpiresAt:  clock().Add(ttl),
+		}
+		if token.Name == "" {
+			http.Error(w, "Expected ?name=", http.StatusBadRequest)
+			return
+		}
+		if err := validateViewToken(viewer, &token); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := updateViewTokens(r.Context(), func(tokens []ViewToken) ([]ViewToken, error) {
+			count := 0
+			for _, existing := range tokens {
+				if strings.EqualFold(existing.Login, token.Login) {
+					count++
+				}
+			}
+			if count >= maxViewTokensPerUser {
+				return nil, fmt.Errorf("limit of %d view tokens reached", maxViewTokensPerUser)
+			}
+			return append(tokens, token), nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving view token: %v", err), http.StatusBadRequest)
+			return
+		}
+		saveUserToken(r.Context(), sess)
+		log.Printf("🔑 %s created view token %q, expiring %s", token.Login, token.Name, token.ExpiresAt.Format(time.RFC3339))
+		token.Hash = ""
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			ViewToken
+			Token string `json:"token"`
+		}{token, secret})
+
+	case http.MethodDelete:
+		id := query.Get("id")
+		found := false
+		err := updateViewTokens(r.Context(), func(tokens []ViewToken) ([]ViewToken, error) {
+			kept := []ViewToken{}
+			for _, existing := range tokens {
+				if existing.ID == id && strings.EqualFold(existing.Login, viewer.Login) {
+					found = true
+					continue
+				}
+				kept = append(kept, existing)
+			}
+			return kept, nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving view tokens: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "View token not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validateViewToken checks that a token's slice names configured
+// organizations and that its creator sees all of it: whole organizations
+// need access to everything, repositories access to each of them.
+func validateViewToken(viewer *viewerAccess, token *ViewToken) error {
+	if len(token.Orgs) == 0 && len(token.Repos) == 0 {
+		return fmt.Errorf("expected ?orgs= or ?repos=")
+	}
+	for _, org := range token.Orgs {
+		if !configuredOrg(org) {
+			return fmt.Errorf("unknown organization %q", org)
+		}
+		if viewer.restricted() {
+			return fmt.Errorf("you can't access every repository of %s: list the repositories with ?repos=", org)
+		}
+	}
+	for i, repo := range token.Repos {
+		org, name, ok := strings.Cut(strings.Trim(repo, "/"), "/")
+		if !ok || org == "" || name == "" {
+			return fmt.Errorf("invalid repository %q: expected org/repo", repo)
+		}
+		if !configuredOrg(org) {
+			return fmt.Errorf("unknown organization %q", org)
+		}
+		if !viewer.canSee(Job{Provider: "github", Organization: org, Pipeline: name}) {
+			return fmt.Errorf("you can't access %s/%s", org, name)
+		}
+		token.Repos[i] = org + "/" + name
+	}
+	return nil
+}
+
+func configuredOrg(org string) bool {
+	for _, src := range currentSources() {
+		if strings.EqualFold(src.Org, org) {
+			return true
+		}
+	}
+	return false
+}
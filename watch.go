@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Run watching: signed-in users subscribe to the runs of a repository,
+// optionally narrowed down to a workflow and branch, through /api/watches
+// and get their own notification, by email or Web Push, when one of those
+// runs finishes. Watches are kept in the Store next to the custom tags.
+// Email watches only notify once the address confirmed them through a
+// link mailed to it, and runs are only sent to users who can still see
+// their repository.
+
+const watchesKey = "watches"
+
+// watchConfirmTTL is how long the confirmation link of an email watch
+// works.
+const watchConfirmTTL = 24 * time.Hour
+
+// maxWatchesPerUser keeps one user from filling the store.
+const maxWatchesPerUser = 50
+
+// Watch is a user's subscription to runs.
+type Watch struct {
+	ID           string    `json:"id"`
+	Login        string    `json:"login"`
+	Repository   string    `json:"repository"`         // org/repo
+	Workflow     string    `json:"workflow,omitempty"` // empty watches every workflow
+	Branch       string    `json:"branch,omitempty"`   // empty watches every branch
+	FailuresOnly bool      `json:"failures_only,omitempty"`
+	Channel      string    `json:"channel"` // "email" or "webpush" (every browser the user registered)
+	Email        string    `json:"email,omitempty"`
+	Confirmed    bool      `json:"confirmed"` // email watches, by the link mailed to the address
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (w Watch) matches(job Job) bool {
+	if job.Provider != "github" || !strings.EqualFold(w.Repository, job.Organization+"/"+job.Pipeline) {
+		return false
+	}
+	if w.Workflow != "" && !strings.EqualFold(w.Workflow, workflowName(job.Name)) {
+		return false
+	}
+	if w.Branch != "" && w.Branch != job.Branch {
+		return false
+	}
+	return !w.FailuresOnly || job.Status == "failed"
+}
+
+func loadWatches(ctx context.Context) ([]Watch, error) {
+	data, ok, err := store.Get(ctx, watchesKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var watches []Watch
+	if err := json.Unmarshal(data, &watches); err != nil {
+		return nil, err
+	}
+	return watches, nil
+}
+
+// updateWatches changes the stored watches under a lock, like
+// updateCustomTags.
+func updateWatches(ctx context.Context, update func([]Watch) ([]Watch, error)) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+watchesKey, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			time.Sleep(lockPollInterval)
+			continue
+		}
+		defer release()
+
+		watches, err := loadWatches(ctx)
+		if err != nil {
+			return err
+		}
+		if watches, err = update(watches); err != nil {
+			return err
+		}
+		data, err := json.Marshal(watches)
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, watchesKey, data, 0)
+	}
+	return fmt.Errorf("timed out waiting for the watches lock")
+}
+
+// notifyWatchers notifies the users watching the runs that finished, if
+// they can still see the run's repository.
+func notifyWatchers(ctx context.Context, finished []Job) {
+	watches, err := loadWatches(ctx)
+	if err != nil {
+		log.Printf("⚠️  Error reading watches: %v", err)
+		return
+	}
+	access := make(map[string]*viewerAccess)
+	for _, job := range finished {
+		for _, watch := range watches {
+			if !watch.Confirmed || !watch.matches(job) {
+				continue
+			}
+			login := strings.ToLower(watch.Login)
+			viewer, ok := access[login]
+			if !ok {
+				if viewer, err = storedUserAccess(ctx, watch.Login); err != nil {
+					log.Printf("⚠️  Error checking the access of %s, not notifying them: %v", watch.Login, err)
+				}
+				access[login] = viewer
+			}
+			if viewer == nil || !viewer.canSee(job) || !claimNotification(ctx, "watch-sent:"+watch.ID, job) {
+				continue
+			}
+			if err := deliverWatch(ctx, watch, runNotification(job)); err != nil {
+				log.Printf("⚠️  Error notifying %s about %s/%s %s: %v", watch.Login, job.Organization, job.Pipeline, job.Name, err)
+				continue
+			}
+			log.Printf("🔔 Notified %s: %s/%s %s %s", watch.Login, job.Organization, job.Pipeline, job.Name, job.Status)
+		}
+	}
+}
+
+func deliverWatch(ctx context.Context, watch Watch, n notification) error {
+	switch watch.Channel {
+	case "email":
+		if !emailEnabled() {
+			return fmt.Errorf("email notifications are not configured")
+		}
+		return sendEmail(watch.Email, n)
+	case "webpush":
+		return sendWebPush(ctx, watch.Login, n)
+	default:
+		return fmt.Errorf("unknown channel %q", watch.Channel)
+	}
+}
+
+// watchesHandler serves /api/watches, the signed-in user's watches:
+//
+//	GET                                                              list them
+//	POST   ?repo=org/repo&workflow=CI&branch=main&email=me@example.com  watch runs
+//	POST   ?repo=org/repo&workflow=CI&channel=webpush                   in the browser
+//	DELETE ?id=<id>                                                  stop watching
+//
+// failures_only=true only notifies about failed runs.
+func watchesHandler(w http.ResponseWriter, r *http.Request) {
+	viewer := viewerFrom(r)
+	if viewer == nil {
+		http.Error(w, "Watching runs needs login (set OAUTH_CLIENT_ID and OAUTH_CLIENT_SECRET)", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		watches, err := loadWatches(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading watches: %v", err), http.StatusInternalServerError)
+			return
+		}
+		result := []Watch{}
+		for _, watch := range watches {
+			if strings.EqualFold(watch.Login, viewer.Login) {
+				result = append(result, watch)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
+	case http.MethodPost:
+		// The watcher's access is checked again with their token when runs
+		// are delivered
+		sess := loadSession(r)
+		if sess == nil {
+			http.Error(w, "Watching runs needs login", http.StatusUnauthorized)
+			return
+		}
+		watch := Watch{
+			ID:           randomToken()[:16],
+			Login:        viewer.Login,
+			Repository:   strings.Trim(query.Get("repo"), "/"),
+			Workflow:     query.Get("workflow"),
+			Branch:       query.Get("branch"),
+			FailuresOnly: query.Get("failures_only") == "true",
+			Channel:      query.Get("channel"),
+			Email:        query.Get("email"),
+			CreatedAt:    clock(),
+		}
+		org, repo, ok := strings.Cut(watch.Repository, "/")
+		if !ok || org == "" || repo == "" {
+			http.Error(w, "Expected ?repo=org/repo", http.StatusBadRequest)
+			return
+		}
+		if !viewer.canSee(Job{Provider: "github", Organization: org, Pipeline: repo}) {
+			http.Error(w, fmt.Sprintf("You can't access %s", watch.Repository), http.StatusForbidden)
+			return
+		}
+		switch watch.Channel {
+		case "", "email":
+			watch.Channel = "email"
+			if !emailEnabled() {
+				http.Error(w, "Email notifications are not configured (set SMTP_HOST)", http.StatusBadRequest)
+				return
+			}
+			if _, err := mail.ParseAddress(watch.Email); err != nil || strings.ContainsAny(watch.Email, "\r\n") {
+				http.Error(w, fmt.Sprintf("Invalid email %q", watch.Email), http.StatusBadRequest)
+				return
+			}
+		case "webpush":
+			watch.Email, watch.Confirmed = "", true
+			if !webPushEnabled() {
+				http.Error(w, "Web Push notifications are not configured (set VAPID_PUBLIC_KEY and VAPID_PRIVATE_KEY)", http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, fmt.Sprintf("Invalid channel %q: expected email or webpush", watch.Channel), http.StatusBadRequest)
+			return
+		}
+
+		err := updateWatches(r.Context(), func(watches []Watch) ([]Watch, error) {
+			count := 0
+			for _, existing := range watches {
+				if strings.EqualFold(existing.Login, watch.Login) {
+					count++
+				}
+			}
+			if count >= maxWatchesPerUser {
+				return nil, fmt.Errorf("limit of %d watches reached", maxWatchesPerUser)
+			}
+			return append(watches, watch), nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving watch: %v", err), http.StatusBadRequest)
+			return
+		}
+		saveUserToken(r.Context(), sess)
+		if !watch.Confirmed {
+			if err := sendWatchConfirmation(r, watch); err != nil {
+				log.Printf("⚠️  Error mailing the confirmation of watch %s to %s: %v", watch.ID, watch.Email, err)
+				http.Error(w, fmt.Sprintf("Watch saved, but its confirmation couldn't be mailed: %v", err), http.StatusBadGateway)
+				return
+			}
+		}
+		log.Printf("🔔 %s watches %s %s", watch.Login, watch.Repository, watchTarget(watch))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(watch)
+
+	case http.MethodDelete:
+		id := query.Get("id")
+		found := false
+		err := updateWatches(r.Context(), func(watches []Watch) ([]Watch, error) {
+			kept := []Watch{}
+			for _, existing := range watches {
+				if existing.ID == id && strings.EqualFold(existing.Login, viewer.Login) {
+					found = true
+					continue
+				}
+				kept = append(kept, existing)
+			}
+			return kept, nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving watches: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Watch not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// sendWatchConfirmation mails the link that confirms an email watch, so
+// nobody gets mail they didn't ask for.
+func sendWatchConfirmation(r *http.Request, watch Watch) error {
+	token := randomToken()
+	if err := store.Set(r.Context(), "watch-confirm:"+token, []byte(watch.ID), watchConfirmTTL); err != nil {
+		return err
+	}
+	scheme := "http"
+	if secureRequest(r) {
+		scheme = "https"
+	}
+	link := fmt.Sprintf("%s://%s/api/watches/confirm?token=%s", scheme, r.Host, token)
+	return sendEmail(watch.Email, notification{
+		Title: fmt.Sprintf("Confirm watching %s", watch.Repository),
+		Body: fmt.Sprintf("%s wants to notify %s about the runs of %s (%s).\n\nConfirm within %s:\n\n%s\n\nIgnore this email to not get them.",
+			watch.Login, watch.Email, watch.Repository, watchTarget(watch), watchConfirmTTL, link),
+		URL: link,
+	})
+}
+
+// watchConfirmHandler serves /api/watches/confirm?token=, the link mailed
+// to the address of an email watch. It's open, the token is the proof.
+func watchConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	key := "watch-confirm:" + token
+	id, ok, err := store.Get(r.Context(), key)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading confirmation: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if token == "" || !ok || len(id) == 0 {
+		http.Error(w, "Invalid or expired confirmation link", http.StatusNotFound)
+		return
+	}
+	var confirmed *Watch
+	err = updateWatches(r.Context(), func(watches []Watch) ([]Watch, error) {
+		for i := range watches {
+			if watches[i].ID == string(id) {
+				watches[i].Confirmed = true
+				confirmed = &watches[i]
+			}
+		}
+		return watches, nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error saving watches: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if confirmed == nil {
+		http.Error(w, "Watch not found", http.StatusNotFound)
+		return
+	}
+	// Like a logout, the link is used up
+	if err := store.Set(r.Context(), key, []byte{}, time.Second); err != nil {
+		log.Printf("⚠️  Error expiring the confirmation of watch %s: %v", confirmed.ID, err)
+	}
+	log.Printf("🔔 %s confirmed watching %s %s", confirmed.Email, confirmed.Repository, watchTarget(*confirmed))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s will be notified about the runs of %s (%s).\n", confirmed.Email, confirmed.Repository, watchTarget(*confirmed))
+}
+
+func watchTarget(watch Watch) string {
+	target := "workflow " + watch.Workflow
+	if watch.Workflow == "" {
+		target = "every workflow"
+	}
+	if watch.Branch != "" {
+		target += " on " + watch.Branch
+	}
+	return target
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWatchMatches(t *testing.T) {
+	job := func(provider, repo, name, branch, status string) Job {
+		org, pipeline, _ := strings.Cut(repo, "/")
+		return Job{Provider: provider, Organization: org, Pipeline: pipeline, Name: name, Branch: branch, Status: status}
+	}
+	tests := []struct {
+		name  string
+		watch Watch
+		job   Job
+		want  bool
+	}{
+		{"every run of the repository", Watch{Repository: "acme/api"}, job("github", "acme/api", "CI #12", "feature", "success"), true},
+		{"repository ignoring case", Watch{Repository: "ACME/Api"}, job("github", "acme/api", "CI #12", "main", "success"), true},
+		{"other repository", Watch{Repository: "acme/api"}, job("github", "acme/web", "CI #12", "main", "success"), false},
+		{"other provider", Watch{Repository: "acme/api"}, job("gitlab", "acme/api", "CI #12", "main", "success"), false},
+		{"workflow", Watch{Repository: "acme/api", Workflow: "ci"}, job("github", "acme/api", "CI #12", "main", "success"), true},
+		{"other workflow", Watch{Repository: "acme/api", Workflow: "Deploy"}, job("github", "acme/api", "CI #12", "main", "success"), false},
+		{"branch", Watch{Repository: "acme/api", Branch: "main"}, job("github", "acme/api", "CI #12", "main", "success"), true},
+		{"other branch", Watch{Repository: "acme/api", Branch: "main"}, job("github", "acme/api", "CI #12", "feature", "success"), false},
+		{"failure", Watch{Repository: "acme/api", FailuresOnly: true}, job("github", "acme/api", "CI #12", "main", "failed"), true},
+		{"success with failures only", Watch{Repository: "acme/api", FailuresOnly: true}, job("github", "acme/api", "CI #12", "main", "success"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.watch.matches(tt.job); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchTarget(t *testing.T) {
+	tests := []struct {
+		watch Watch
+		want  string
+	}{
+		{Watch{}, "every workflow"},
+		{Watch{Workflow: "CI"}, "workflow CI"},
+		{Watch{Branch: "main"}, "every workflow on main"},
+		{Watch{Workflow: "CI", Branch: "main"}, "workflow CI on main"},
+	}
+	for _, tt := range tests {
+		if got := watchTarget(tt.watch); got != tt.want {
+			t.Errorf("watchTarget(%+v) = %q, want %q", tt.watch, got, tt.want)
+		}
+	}
+}
+
+// The link mailed to an email watch confirms it once.
+func TestWatchConfirmHandler(t *testing.T) {
+	defer func(s Store) { store = s }(store)
+	store = newMemoryStore()
+	ctx := context.Background()
+	watches, _ := json.Marshal([]Watch{
+		{ID: "w1", Login: "octocat", Repository: "acme/api", Channel: "email", Email: "octocat@example.com"},
+		{ID: "w2", Login: "hubot", Repository: "acme/api", Channel: "email", Email: "hubot@example.com"},
+	})
+	if err := store.Set(ctx, watchesKey, watches, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(ctx, "watch-confirm:token1", []byte("w1"), watchConfirmTTL); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{"no token", "", http.StatusNotFound},
+		{"unknown token", "guess", http.StatusNotFound},
+		{"valid token", "token1", http.StatusOK},
+		{"used token", "token1", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		watchConfirmHandler(rec, httptest.NewRequest(http.MethodGet, "/api/watches/confirm?token="+tt.token, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.wantStatus, rec.Body)
+		}
+	}
+
+	stored, err := loadWatches(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, watch := range stored {
+		if want := watch.ID == "w1"; watch.Confirmed != want {
+			t.Errorf("watch %s confirmed = %v, want %v", watch.ID, watch.Confirmed, want)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Web Push: browsers subscribe through the dashboard's service worker
+// (static/sw.js) and get native notifications for the runs their user
+// watches (channel webpush in /api/watches), even with the dashboard
+// closed. Messages are encrypted for the browser (RFC 8291) and signed with
+// the dashboard's VAPID key (RFC 8292); `main vapid-keys` generates one.
+// Endpoints come from browsers, so only those of the known push services,
+// plus PUSH_SERVICE_HOSTS, are accepted and posted to.
+
+const pushSubscriptionsKey = "push-subscriptions"
+
+// maxPushSubscriptionsPerUser is how many browsers one user can register.
+const maxPushSubscriptionsPerUser = 10
+
+// maxPushPayload keeps messages under the 4096 bytes push services accept,
+// with room for the encryption overhead.
+const maxPushPayload = 3000
+
+// pushServiceHosts are the hosts of the browsers' push services, with
+// their subdomains: Chrome and Edge's FCM, Firefox's autopush, Safari's and
+// the Windows push service.
+var pushServiceHosts = []string{"fcm.googleapis.com", "push.services.mozilla.com", "push.apple.com", "notify.windows.com"}
+
+var webPush struct {
+	publicKey string // base64url, handed to browsers as applicationServerKey
+	key       *ecdsa.PrivateKey
+	subject   string // mailto: or https: contact for push services
+	client    *http.Client
+}
+
+// PushSubscription is a browser's PushSubscription.toJSON(), registered
+// by a user.
+type PushSubscription struct {
+	Login    string `json:"login"`
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// loadWebPushConfig reads the key pair from VAPID_PUBLIC_KEY and
+// VAPID_PRIVATE_KEY and the contact from VAPID_SUBJECT.
+func loadWebPushConfig() {
+	public, private := strings.TrimSpace(os.Getenv("VAPID_PUBLIC_KEY")), strings.TrimSpace(os.Getenv("VAPID_PRIVATE_KEY"))
+	if public == "" && private == "" {
+		return
+	}
+	key, err := parseVAPIDKey(private)
+	if err != nil {
+		log.Fatalf("Invalid VAPID_PRIVATE_KEY: %v", err)
+	}
+	if encodeVAPIDPublicKey(key) != public {
+		log.Fatal("VAPID_PUBLIC_KEY doesn't belong to VAPID_PRIVATE_KEY (generate a pair with `main vapid-keys`)")
+	}
+	webPush.subject = strings.TrimSpace(os.Getenv("VAPID_SUBJECT"))
+	if !strings.HasPrefix(webPush.subject, "mailto:") && !strings.HasPrefix(webPush.subject, "https://") {
+		log.Fatalf("Invalid VAPID_SUBJECT %q: expected mailto:<address> or https://<url>", webPush.subject)
+	}
+	webPush.publicKey, webPush.key = public, key
+	pushServiceHosts = append(pushServiceHosts, splitList(strings.ToLower(os.Getenv("PUSH_SERVICE_HOSTS")))...)
+	webPush.client = newHTTPClient()
+	// A push service has no reason to send us elsewhere
+	webPush.client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	log.Printf("🔔 Web Push notifications enabled")
+}
+
+func webPushEnabled() bool {
+	return webPush.key != nil
+}
+
+// validPushEndpoint reports whether an endpoint is an https URL of one of
+// the pushServiceHosts.
+func validPushEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || (u.Port() != "" && u.Port() != "443") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, service := range pushServiceHosts {
+		if host == service || strings.HasSuffix(host, "."+service) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVAPIDKey reads a P-256 private key: its 32-byte scalar, base64url.
+func parseVAPIDKey(encoded string) (*ecdsa.PrivateKey, error) {
+	d, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, err
+	}
+	point := key.PublicKey().Bytes() // 0x04 || X || Y
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(point[1:33]), Y: new(big.Int).SetBytes(point[33:])},
+		D:         new(big.Int).SetBytes(d),
+	}, nil
+}
+
+func encodeVAPIDPublicKey(key *ecdsa.PrivateKey) string {
+	point := make([]byte, 65)
+	point[0] = 4
+	key.X.FillBytes(point[1:33])
+	key.Y.FillBytes(point[33:])
+	return base64.RawURLEncoding.EncodeToString(point)
+}
+
+// runVAPIDKeysCommand prints a new key pair for the environment.
+func runVAPIDKeysCommand() error {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("VAPID_PUBLIC_KEY=%s\n", base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()))
+	fmt.Printf("VAPID_PRIVATE_KEY=%s\n", base64.RawURLEncoding.EncodeToString(key.Bytes()))
+	return nil
+}
+
+func loadPushSubscriptions(ctx context.Context) ([]PushSubscription, error) {
+	data, ok, err := store.Get(ctx, pushSubscriptionsKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var subs []PushSubscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// updatePushSubscriptions changes the stored subscriptions under a lock,
+// like updateCustomTags.
+func updatePushSubscriptions(ctx context.Context, update func([]PushSubscription) ([]PushSubscription, error)) error {
+	for attempt := 0; attempt < 10; attempt++ {
+		release, ok, err := store.Lock(ctx, "lock:"+pushSubscriptionsKey, 10*time.Second)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			time.Sleep(lockPollInterval)
+			continue
+		}
+		defer release()
+
+		subs, err := loadPushSubscriptions(ctx)
+		if err != nil {
+			return err
+		}
+		if subs, err = update(subs); err != nil {
+			return err
+		}
+		data, err := json.Marshal(subs)
+		if err != nil {
+			return err
+		}
+		return store.Set(ctx, pushSubscriptionsKey, data, 0)
+	}
+	return fmt.Errorf("timed out waiting for the push subscriptions lock")
+}
+
+// removePushSubscription forgets a browser, optionally only one of login.
+func removePushSubscription(ctx context.Context, login, endpoint string) (found bool, err error) {
+	err = updatePushSubscriptions(ctx, func(subs []PushSubscription) ([]PushSubscription, error) {
+		kept := []PushSubscription{}
+		for _, sub := range subs {
+			if sub.Endpoint == endpoint && (login == "" || strings.EqualFold(sub.Login, login)) {
+				found = true
+				continue
+			}
+			kept = append(kept, sub)
+		}
+		return kept, nil
+	})
+	return found, err
+}
+
+// sendWebPush notifies every browser the user registered. Browsers whose
+// subscription is gone (unsubscribed, uninstalled) are forgotten.
+func sendWebPush(ctx context.Context, login string, n notification) error {
+	if !webPushEnabled() {
+		return fmt.Errorf("web push notifications are not configured")
+	}
+	subs, err := loadPushSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	body := n.Body
+	if len(body) > maxPushPayload/2 {
+		body = strings.ToValidUTF8(body[:maxPushPayload/2], "")
+	}
+	payload, _ := json.Marshal(map[string]string{"title": n.Title, "body": body, "url": n.URL})
+
+	sent := 0
+	var lastErr error
+	for _, sub := range subs {
+		if !strings.EqualFold(sub.Login, login) {
+			continue
+		}
+		gone, err := pushMessage(ctx, sub, payload)
+		if gone {
+			log.Printf("🔔 Push subscription of %s expired, removing it", login)
+			if _, err := removePushSubscription(ctx, "", sub.Endpoint); err != nil {
+				log.Printf("⚠️  Error removing push subscription: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 && lastErr == nil {
+		return fmt.Errorf("no browser registered for push notifications")
+	}
+	return lastErr
+}
+
+// pushMessage delivers one encrypted message to a browser's push service.
+// gone reports a subscription that no longer exists.
+func pushMessage(ctx context.Context, sub PushSubscription, payload []byte) (gone bool, err error) {
+	// Subscriptions stored before PUSH_SERVICE_HOSTS changed
+	if !validPushEndpoint(sub.Endpoint) {
+		return true, nil
+	}
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		return false, err
+	}
+	auth, err := vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", auth)
+	resp, err := webPush.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return true, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return false, fmt.Errorf("POST %s: %s", pushServiceOrigin(sub.Endpoint), resp.Status)
+	}
+	return false, nil
+}
+
+func pushServiceOrigin(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// vapidAuthorization signs a JWT for the push service of the endpoint
+// (RFC 8292).
+func vapidAuthorization(endpoint string) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": pushServiceOrigin(endpoint),
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": webPush.subject,
+	})
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, webPush.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	jwt := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", jwt, webPush.publicKey), nil
+}
+
+// encryptPushPayload encrypts a message for a browser with the aes128gcm
+// content encoding of RFC 8291, as a single record.
+func encryptPushPayload(sub PushSubscription, payload []byte) ([]byte, error) {
+	uaPublic, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %v", err)
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// HKDF with SHA-256, one block each
+	hkdf := func(salt, ikm, info []byte, length int) []byte {
+		extract := hmac.New(sha256.New, salt)
+		extract.Write(ikm)
+		expand := hmac.New(sha256.New, extract.Sum(nil))
+		expand.Write(info)
+		expand.Write([]byte{1})
+		return expand.Sum(nil)[:length]
+	}
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := hkdf(authSecret, sharedSecret, keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	record := append(append([]byte{}, payload...), 2) // delimiter of the last record
+
+	// Header: salt, record size, key ID (our public key)
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, 4096)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// pushKeyHandler serves /api/push/key, the applicationServerKey browsers
+// subscribe with.
+func pushKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !webPushEnabled() {
+		http.Error(w, "Web Push is not enabled (set VAPID_PUBLIC_KEY and VAPID_PRIVATE_KEY)", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"public_key": webPush.publicKey})
+}
+
+// pushSubscriptionsHandler serves /api/push/subscriptions, the signed-in
+// user's browsers:
+//
+//	POST   <PushSubscription JSON>   register this browser
+//	DELETE ?endpoint=<endpoint>      unregister it
+func pushSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	viewer := viewerFrom(r)
+	if viewer == nil || !webPushEnabled() {
+		http.Error(w, "Web Push needs login and VAPID keys", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var sub PushSubscription
+		if err := json.NewDecoder(io.LimitReader(r.Body, 8192)).Decode(&sub); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid subscription: %v", err), http.StatusBadRequest)
+			return
+		}
+		if !validPushEndpoint(sub.Endpoint) {
+			http.Error(w, "Invalid subscription: expected an https endpoint of a known push service (see PUSH_SERVICE_HOSTS)", http.StatusBadRequest)
+			return
+		}
+		sub.Login, sub.CreatedAt = viewer.Login, clock()
+		if _, err := encryptPushPayload(sub, nil); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid subscription: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		err := updatePushSubscriptions(r.Context(), func(subs []PushSubscription) ([]PushSubscription, error) {
+			kept, count := []PushSubscription{}, 0
+			for _, existing := range subs {
+				if existing.Endpoint == sub.Endpoint {
+					continue // re-registered, possibly by another user of the browser
+				}
+				if strings.EqualFold(existing.Login, sub.Login) {
+					count++
+				}
+				kept = append(kept, existing)
+			}
+			if count >= maxPushSubscriptionsPerUser {
+				return nil, fmt.Errorf("limit of %d browsers reached", maxPushSubscriptionsPerUser)
+			}
+			return append(kept, sub), nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving subscription: %v", err), http.StatusBadRequest)
+			return
+		}
+		log.Printf("🔔 %s registered a browser for push notifications (%s)", sub.Login, pushServiceOrigin(sub.Endpoint))
+		w.WriteHeader(http.StatusCreated)
+
+	case http.MethodDelete:
+		found, err := removePushSubscription(r.Context(), viewer.Login, r.URL.Query().Get("endpoint"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving subscriptions: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Subscription not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// WorkflowChange flags a failure that followed an edit of the workflow file
+// itself. Broken YAML edits are a frequent root cause, and the file is easy
+// to overlook among the commits since the last success.
+type WorkflowChange struct {
+	Path    string          `json:"path"`
+	Since   string          `json:"since"`   // head SHA of the last successful run
+	Commits []CommitSummary `json:"commits"` // that changed the file, newest first
+	Message string          `json:"message"` // e.g. "workflow recently modified (by @alice)"
+}
+
+// workflowChange returns how the workflow file at path changed between the
+// last success (base) and a failure (head), given the comparison of the
+// two, or nil if it didn't.
+func workflowChange(ctx context.Context, owner, repo, path, base, head string, comparison *CommitComparison) (*WorkflowChange, error) {
+	// The compare API lists at most 300 files; with that many the file may
+	// have changed without being listed
+	if path == "" || (!slices.Contains(comparison.files, path) && len(comparison.files) < 300) {
+		return nil, nil
+	}
+
+	inRange := make(map[string]bool)
+	for _, commit := range comparison.Commits {
+		inRange[commit.SHA] = true
+	}
+	commits, resp, err := githubClient.Repositories.ListCommits(ctx, owner, repo, &github.CommitsListOptions{SHA: head, Path: path, ListOptions: github.ListOptions{PerPage: 20}})
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &WorkflowChange{Path: path, Since: base, Commits: []CommitSummary{}}
+	var authors []string
+	for _, commit := range commits {
+		if !inRange[commit.GetSHA()] {
+			continue
+		}
+		summary := CommitSummary{
+			SHA:     commit.GetSHA(),
+			Message: commitSubject(commit.GetCommit().GetMessage()),
+			Author:  commit.GetCommit().GetAuthor().GetName(),
+			Login:   commit.GetAuthor().GetLogin(),
+		}
+		change.Commits = append(change.Commits, summary)
+		author := summary.Author
+		if summary.Login != "" {
+			author = "@" + summary.Login
+		}
+		if author != "" && !slices.Contains(authors, author) {
+			authors = append(authors, author)
+		}
+	}
+	if len(change.Commits) == 0 {
+		return nil, nil
+	}
+	change.Message = "workflow recently modified"
+	if len(authors) > 0 {
+		change.Message += " (by " + strings.Join(authors, ", ") + ")"
+	}
+	return change, nil
+}
+
+// runWorkflowChange checks a failed run against the last successful run of
+// its workflow on the same branch.
+func runWorkflowChange(ctx context.Context, owner, repo string, run *github.WorkflowRun) (*WorkflowChange, error) {
+	runs, resp, err := githubClient.Actions.ListWorkflowRunsByID(ctx, owner, repo, run.GetWorkflowID(), &github.ListWorkflowRunsOptions{
+		Branch:      run.GetHeadBranch(),
+		Status:      "success",
+		ListOptions: github.ListOptions{PerPage: 20},
+	})
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+	base := ""
+	for _, previous := range runs.WorkflowRuns {
+		if previous.GetCreatedAt().Before(run.GetCreatedAt().Time) {
+			base = previous.GetHeadSHA()
+			break
+		}
+	}
+	// No success to compare with, or a failure of the same commit
+	if base == "" || base == run.GetHeadSHA() {
+		return nil, nil
+	}
+
+	comparison, err := compareCommits(ctx, owner, repo, base, run.GetHeadSHA())
+	if err != nil {
+		return nil, err
+	}
+	path, err := fetchWorkflowPath(ctx, owner, repo, run.GetWorkflowID())
+	if err != nil {
+		return nil, err
+	}
+	return workflowChange(ctx, owner, repo, path, base, run.GetHeadSHA(), comparison)
+}
+
+// runPath returns the workflow file a run ran, e.g. ".github/workflows/ci.yml".
+func runPath(ctx context.Context, owner, repo string, runID int64) (string, error) {
+	run, resp, err := githubClient.Actions.GetWorkflowRunByID(ctx, owner, repo, runID)
+	budget.update(resp)
+	if err != nil {
+		return "", err
+	}
+	return fetchWorkflowPath(ctx, owner, repo, run.GetWorkflowID())
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v57/github"
+	"gopkg.in/yaml.v3"
+)
+
+// workflowFile is the part of a workflow definition the dashboard uses.
+type workflowFile struct {
+	Name        string                 `yaml:"name"`
+	Concurrency concurrency            `yaml:"concurrency"`
+	Jobs        map[string]workflowJob `yaml:"jobs"`
+}
+
+type workflowJob struct {
+	Name           string `yaml:"name"`
+	TimeoutMinutes string `yaml:"timeout-minutes"` // may be an expression
+}
+
+// concurrency accepts both forms GitHub allows: a plain group string or a
+// mapping with group and cancel-in-progress.
+type concurrency struct {
+	Group            string `yaml:"group"`
+	CancelInProgress bool   `yaml:"cancel-in-progress"`
+}
+
+func (c *concurrency) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Group = node.Value
+		return nil
+	}
+	type plain concurrency
+	return node.Decode((*plain)(c))
+}
+
+// workflowFiles caches parsed workflow files by repository, path and commit.
+// Files at a commit never change, so entries don't expire.
+var workflowFiles = struct {
+	sync.Mutex
+	files map[string]*workflowFile
+}{files: make(map[string]*workflowFile)}
+
+const maxCachedWorkflowFiles = 1000
+
+// fetchWorkflowFile returns the workflow definition at path as of ref.
+func fetchWorkflowFile(ctx context.Context, owner, repo, path, ref string) (*workflowFile, error) {
+	key := owner + "/" + repo + "/" + path + "@" + ref
+	workflowFiles.Lock()
+	file, ok := workflowFiles.files[key]
+	workflowFiles.Unlock()
+	if ok {
+		return file, nil
+	}
+
+	if err := budget.acquire(ctx); err != nil {
+		return nil, err
+	}
+	getCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	content, _, resp, err := githubClient.Repositories.GetContents(getCtx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	cancel()
+	budget.update(resp)
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		return nil, fmt.Errorf("%s is not a file", path)
+	}
+	text, err := content.GetContent()
+	if err != nil {
+		return nil, err
+	}
+
+	file = &workflowFile{}
+	if err := yaml.Unmarshal([]byte(text), file); err != nil {
+		return nil, fmt.Errorf("invalid workflow file %s: %v", path, err)
+	}
+
+	workflowFiles.Lock()
+	if len(workflowFiles.files) >= maxCachedWorkflowFiles {
+		workflowFiles.files = make(map[string]*workflowFile)
+	}
+	workflowFiles.files[key] = file
+	workflowFiles.Unlock()
+	return file, nil
+}
+
+// workflowPaths caches the file path of workflows by ID.
+var workflowPaths sync.Map
+
+// fetchWorkflowPath returns the path of a workflow's file, e.g.
+// ".github/workflows/ci.yml".
+func fetchWorkflowPath(ctx context.Context, owner, repo string, workflowID int64) (string, error) {
+	if path, ok := workflowPaths.Load(workflowID); ok {
+		return path.(string), nil
+	}
+
+	if err := budget.acquire(ctx); err != nil {
+		return "", err
+	}
+	getCtx, cancel := withPhaseTimeout(ctx, runListTimeout)
+	workflow, resp, err := githubClient.Actions.GetWorkflowByID(getCtx, owner, repo, workflowID)
+	cancel()
+	budget.update(resp)
+	if err != nil {
+		return "", err
+	}
+	workflowPaths.Store(workflowID, workflow.GetPath())
+	return workflow.GetPath(), nil
+}
+
+var workflowExpression = regexp.MustCompile(`\$\{\{\s*(.*?)\s*\}\}`)
+
+// evalConcurrencyGroup resolves the expressions commonly used in
+// concurrency groups, such as ${{ github.workflow }}-${{ github.ref }}.
+// Expressions it doesn't understand are kept as written.
+func evalConcurrencyGroup(group, orgName, repoName string, run *github.WorkflowRun) string {
+	values := map[string]string{
+		"github.workflow":   run.GetName(),
+		"github.ref":        "refs/heads/" + run.GetHeadBranch(),
+		"github.ref_name":   run.GetHeadBranch(),
+		"github.head_ref":   "",
+		"github.event_name": run.GetEvent(),
+		"github.repository": orgName + "/" + repoName,
+		"github.sha":        run.GetHeadSHA(),
+		"github.run_id":     fmt.Sprint(run.GetID()),
+	}
+	if run.GetEvent() == "pull_request" || run.GetEvent() == "pull_request_target" {
+		values["github.head_ref"] = run.GetHeadBranch()
+	}
+
+	return workflowExpression.ReplaceAllStringFunc(group, func(expr string) string {
+		inner := workflowExpression.FindStringSubmatch(expr)[1]
+		// a || b evaluates to the first non-empty operand
+		for _, operand := range strings.Split(inner, "||") {
+			operand = strings.TrimSpace(operand)
+			value, ok := values[operand]
+			if !ok {
+				return expr
+			}
+			if value != "" {
+				return value
+			}
+		}
+		return ""
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Per-workflow duration sparklines: the durations of a workflow's latest
+// finished runs and their trend, here for the runs of a period, and in the
+// weekly summaries (summary.go) for each week. This endpoint stays next to
+// the weekly summaries for the rolling periods of the dashboard, with
+// filters by branch, and runs that aren't recorded weekly yet.
+
+// defaultSparklineRuns is how many durations a workflow's sparkline has,
+// unless ?runs= says otherwise.
+const defaultSparklineRuns = 20
+
+// WorkflowStats is how the runs of one workflow went, with the durations
+// of its latest finished runs for a sparkline.
+type WorkflowStats struct {
+	Provider           string         `json:"provider"`
+	Repository         string         `json:"repository"` // org/repo
+	Workflow           string         `json:"workflow"`
+	Stats              DashboardStats `json:"stats"`
+	SuccessRate        *float64       `json:"success_rate,omitempty"`
+	AvgDurationSeconds int64          `json:"avg_duration_seconds"`
+	Durations          []int64        `json:"durations"` // seconds, oldest first
+	// Change of the median duration of the newer half of Durations against
+	// the older half, in percent; positive means slower. Needs 4 runs.
+	TrendPercent *float64 `json:"trend_percent,omitempty"`
+}
+
+type WorkflowStatsResponse struct {
+	Period    string          `json:"period"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Truncated bool            `json:"truncated,omitempty"` // job list capped at MAX_JOBS, older runs aren't counted
+	Workflows []WorkflowStats `json:"workflows"`           // most runs first
+}
+
+// durationTrend compares the median of the newer half of durations with
+// that of the older half.
+func durationTrend(durations []int64) *float64 {
+	if len(durations) < 4 {
+		return nil
+	}
+	half := len(durations) / 2
+	older, newer := medianInt64(durations[:half]), medianInt64(durations[len(durations)-half:])
+	if older == 0 {
+		return nil
+	}
+	trend := math.Round(float64(newer-older)/float64(older)*1000) / 10
+	return &trend
+}
+
+// workflowStatsHandler serves /api/stats/workflows?period=week, the runs
+// and duration trend per workflow. ?runs= sets the sparkline length
+// (default 20, at most 100), ?repo=org/repo and ?branch= narrow it down.
+func workflowStatsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = "week"
+	}
+	if !validPeriod(period) {
+		http.Error(w, fmt.Sprintf("Invalid period %q", period), http.StatusBadRequest)
+		return
+	}
+	runs := defaultSparklineRuns
+	if value := query.Get("runs"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "Invalid runs, expected 1 to 100", http.StatusBadRequest)
+			return
+		}
+		runs = n
+	}
+	repo, branch := query.Get("repo"), query.Get("branch")
+
+	snap, err := getDashboard(context.Background(), period)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching workflow runs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	snap = viewerFrom(r).snapshot(snap)
+
+	type workflowRuns struct {
+		stats    *WorkflowStats
+		finished []Job
+	}
+	byWorkflow := make(map[string]*workflowRuns)
+	var order []string
+	for _, job := range snap.Response.Jobs {
+		if repo != "" && !strings.EqualFold(repo, job.Organization+"/"+job.Pipeline) {
+			continue
+		}
+		if branch != "" && job.Branch != branch {
+			continue
+		}
+		key := job.Provider + "|" + strings.ToLower(job.Organization+"/"+job.Pipeline) + "|" + workflowName(job.Name)
+		workflow, ok := byWorkflow[key]
+		if !ok {
+			workflow = &workflowRuns{stats: &WorkflowStats{Provider: job.Provider, Repository: job.Organization + "/" + job.Pipeline, Workflow: workflowName(job.Name)}}
+			byWorkflow[key] = workflow
+			order = append(order, key)
+		}
+		addToStats(&workflow.stats.Stats, job)
+		if finished(job) && job.DurationSeconds > 0 {
+			workflow.finished = append(workflow.finished, job)
+		}
+	}
+
+	response := WorkflowStatsResponse{Period: period, FetchedAt: snap.FetchedAt, Truncated: snap.Response.Truncated, Workflows: []WorkflowStats{}}
+	for _, key := range order {
+		workflow := byWorkflow[key]
+		stats := workflow.stats
+		stats.SuccessRate = successRate(stats.Stats)
+
+		// Jobs come newest first
+		finished := workflow.finished
+		var total int64
+		for _, job := range finished {
+			total += job.DurationSeconds
+		}
+		if len(finished) > 0 {
+			stats.AvgDurationSeconds = total / int64(len(finished))
+		}
+		if len(finished) > runs {
+			finished = finished[:runs]
+		}
+		stats.Durations = make([]int64, len(finished))
+		for i, job := range finished {
+			stats.Durations[len(finished)-1-i] = job.DurationSeconds
+		}
+		stats.TrendPercent = durationTrend(stats.Durations)
+		response.Workflows = append(response.Workflows, *stats)
+	}
+	sort.SliceStable(response.Workflows, func(i, j int) bool {
+		return response.Workflows[i].Stats.Total > response.Workflows[j].Stats.Total
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(response)
+}